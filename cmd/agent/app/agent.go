@@ -1,10 +1,13 @@
 package app
 
 import (
+	"context"
 	"log"
 	"net"
+	"net/http"
 	"os"
 
+	"code.cloudfoundry.org/loggregator-agent/pkg/health"
 	"code.cloudfoundry.org/loggregator-agent/pkg/metrics"
 	"code.cloudfoundry.org/loggregator-agent/pkg/plumbing"
 )
@@ -12,6 +15,9 @@ import (
 type Agent struct {
 	config *Config
 	lookup func(string) ([]net.IP, error)
+
+	appV1 *AppV1
+	appV2 *AppV2
 }
 
 // AgentOption configures agent options.
@@ -76,9 +82,20 @@ func (a *Agent) Start() {
 		metrics.WithDefaultTags(map[string]string{"origin": "loggregator.metron"}),
 	)
 
-	appV1 := NewV1App(a.config, clientCreds, metricClient)
-	go appV1.Start()
+	a.appV1 = NewV1App(a.config, clientCreds, metricClient)
+	go a.appV1.Start()
+
+	a.appV2 = NewV2App(a.config, clientCreds, serverCreds, metricClient, WithV2DebugMux(http.DefaultServeMux))
+	go a.appV2.Start()
+
+	h := health.NewHandler()
+	h.Add("doppler", a.appV2.dopplerReady)
+	h.Register(http.DefaultServeMux)
+}
 
-	appV2 := NewV2App(a.config, clientCreds, serverCreds, metricClient)
-	go appV2.Start()
+// Stop stops the ingress of both APIs and flushes the v2 buffers until the
+// context is done. It must be called after Start has returned.
+func (a *Agent) Stop(ctx context.Context) {
+	a.appV1.Stop()
+	a.appV2.Stop(ctx)
 }
@@ -6,6 +6,7 @@ import (
 	"log"
 	"math/rand"
 	"net"
+	"sync"
 	"time"
 
 	"code.cloudfoundry.org/loggregator-agent/pkg/clientpool"
@@ -23,6 +24,9 @@ type AppV1 struct {
 	creds        credentials.TransportCredentials
 	metricClient MetricClient
 	lookup       func(string) ([]net.IP, error)
+
+	mu            sync.Mutex
+	networkReader *ingress.NetworkReader
 }
 
 // AppV1Option configures AppV1 options.
@@ -86,11 +90,26 @@ func (a *AppV1) Start() {
 		log.Panic(fmt.Errorf("Failed to listen on %s: %s", agentAddress, err))
 	}
 
+	a.mu.Lock()
+	a.networkReader = networkReader
+	a.mu.Unlock()
+
 	log.Printf("agent v1 API started on addr %s", agentAddress)
 	go networkReader.StartReading()
 	networkReader.StartWriting()
 }
 
+// Stop stops reading from the UDP port. Envelopes that are still buffered
+// are not flushed because the v1 API is deprecated.
+func (a *AppV1) Stop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.networkReader != nil {
+		a.networkReader.Stop()
+	}
+}
+
 func (a *AppV1) initializeV1DopplerPool() *egress.EventMarshaller {
 	pool := a.setupGRPC()
 
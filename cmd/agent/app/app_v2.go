@@ -2,10 +2,16 @@ package app
 
 import (
 	"code.cloudfoundry.org/loggregator-agent/pkg/metrics"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
 	"net"
+	"net/http"
+	"os"
+	"sync"
 	"time"
 
 	gendiodes "code.cloudfoundry.org/go-diodes"
@@ -13,6 +19,12 @@ import (
 	clientpoolv2 "code.cloudfoundry.org/loggregator-agent/pkg/clientpool/v2"
 	"code.cloudfoundry.org/loggregator-agent/pkg/diodes"
 	egress "code.cloudfoundry.org/loggregator-agent/pkg/egress/v2"
+	"code.cloudfoundry.org/loggregator-agent/pkg/ingress/fluent"
+	"code.cloudfoundry.org/loggregator-agent/pkg/ingress/otlp"
+	"code.cloudfoundry.org/loggregator-agent/pkg/ingress/ratelimit"
+	"code.cloudfoundry.org/loggregator-agent/pkg/ingress/remotewrite"
+	"code.cloudfoundry.org/loggregator-agent/pkg/ingress/statsd"
+	"code.cloudfoundry.org/loggregator-agent/pkg/ingress/syslog"
 	ingress "code.cloudfoundry.org/loggregator-agent/pkg/ingress/v2"
 	"code.cloudfoundry.org/loggregator-agent/pkg/plumbing"
 	"google.golang.org/grpc"
@@ -24,6 +36,7 @@ import (
 type MetricClient interface {
 	NewCounter(name string, opts ...metrics.MetricOption) metrics.Counter
 	NewGauge(name string, opts ...metrics.MetricOption) metrics.Gauge
+	RemoveGauge(metrics.Gauge)
 }
 
 // AppV2Option configures AppV2 options.
@@ -36,12 +49,40 @@ func WithV2Lookup(l func(string) ([]net.IP, error)) func(*AppV2) {
 	}
 }
 
+// WithV2DebugMux registers the report of the source IDs that send the most
+// envelopes on the given mux.
+func WithV2DebugMux(m *http.ServeMux) func(*AppV2) {
+	return func(a *AppV2) {
+		a.debugMux = m
+	}
+}
+
 type AppV2 struct {
 	config                   *Config
 	clientCreds              credentials.TransportCredentials
 	serverCreds              credentials.TransportCredentials
 	metricClient             MetricClient
 	lookup                   func(string) ([]net.IP, error)
+	debugMux                 *http.ServeMux
+
+	stopOnce  sync.Once
+	mu        sync.Mutex
+	stopped   bool
+	ingresses []stopper
+	tx        *egress.Transponder
+	occupancy *diodes.Occupancy
+	lost      metrics.Counter
+	stops     []stopper
+
+	// pool is written while holding both mu and poolMu. Readiness checks
+	// only take poolMu so that they do not wait for Stop to flush.
+	poolMu sync.Mutex
+	pool   *clientpoolv2.ClientPool
+}
+
+// stopper is an ingress or a background task that can be stopped.
+type stopper interface {
+	Stop()
 }
 
 func NewV2App(
@@ -71,14 +112,36 @@ func (a *AppV2) Start() {
 		log.Panic("Failed to load TLS server config")
 	}
 
-	droppedMetric := a.metricClient.NewCounter("dropped", metrics.WithMetricTags(map[string]string{"direction": "ingress", "metric_version": "2.0"}))
-	envelopeBuffer := diodes.NewManyToOneEnvelopeV2(10000, gendiodes.AlertFunc(func(missed int) {
-		// metric-documentation-v2: (loggregator.metron.dropped) Number of v2 envelopes
-		// dropped from the agent ingress diode
-		droppedMetric.Add(float64(missed))
+	ingressTags := metrics.WithMetricTags(map[string]string{"direction": "ingress", "metric_version": "2.0"})
+	occupancy := diodes.NewOccupancy()
+	reporter := diodes.NewOccupancyReporter(15 * time.Second)
+	reporter.Add(
+		occupancy,
+		a.metricClient.NewGauge("queue_depth", ingressTags),
+		a.metricClient.NewGauge("queue_high_water", ingressTags),
+	)
+	go reporter.Start()
+	a.addStop(reporter)
+
+	droppedMetric := a.metricClient.NewCounter("dropped", ingressTags)
+	var envelopeBuffer diodes.EnvelopeV2Diode
+	if a.config.PriorityBuffer {
+		envelopeBuffer = a.newPriorityBuffer(droppedMetric, occupancy)
+	} else {
+		envelopeBuffer = diodes.NewManyToOneEnvelopeV2(10000, occupancy.Alerter(gendiodes.AlertFunc(func(missed int) {
+			// metric-documentation-v2: (loggregator.metron.dropped) Number of v2 envelopes
+			// dropped from the agent ingress diode
+			droppedMetric.Add(float64(missed))
 
-		log.Printf("Dropped %d v2 envelopes", missed)
-	}))
+			log.Printf("Dropped %d v2 envelopes", missed)
+		})))
+	}
+	envelopeBuffer = diodes.NewTrackedEnvelopeV2(envelopeBuffer, occupancy)
+	var lossless *diodes.LosslessEnvelopeV2
+	if a.config.Backpressure.Mode != "" {
+		lossless = diodes.NewLosslessEnvelopeV2(a.config.Backpressure.Threshold, envelopeBuffer, occupancy)
+		envelopeBuffer = lossless
+	}
 
 	pool := a.initializePool()
 	batchWriter := egress.NewBatchEnvelopeWriter(
@@ -98,23 +161,205 @@ func (a *AppV2) Start() {
 	)
 	go tx.Start()
 
+	a.mu.Lock()
+	a.tx = tx
+	a.poolMu.Lock()
+	a.pool = pool
+	a.poolMu.Unlock()
+	a.occupancy = occupancy
+	// metric-documentation-v2: (loggregator.metron.shutdown_lost) Number of
+	// v2 envelopes left in the ingress buffer at shutdown
+	a.lost = a.metricClient.NewCounter("shutdown_lost", metrics.WithMetricTags(map[string]string{"metric_version": "2.0"}))
+	a.mu.Unlock()
+
 	agentAddress := fmt.Sprintf("127.0.0.1:%d", a.config.GRPC.Port)
 	log.Printf("agent v2 API started on addr %s", agentAddress)
 
-	rx := ingress.NewReceiver(envelopeBuffer, ingressMetric, originMappings)
+	limiter := ratelimit.NewLimiter(
+		envelopeBuffer,
+		a.metricClient,
+		ratelimit.WithRate(float64(a.config.RateLimit.Rate), a.config.RateLimit.Burst),
+		ratelimit.WithReport(a.config.RateLimit.ReportSize, a.config.RateLimit.ReportInterval),
+	)
+	go limiter.Start()
+	a.addStop(limiter)
+	if a.debugMux != nil {
+		a.debugMux.Handle("/ingress/sources", limiter)
+	}
+
+	a.startOTLPIngress(limiter)
+	a.startStatsDIngress(limiter)
+	a.startSyslogIngress(limiter)
+	a.startRemoteWriteIngress(limiter)
+	a.startFluentIngress(limiter)
+
+	var rxOpts []ingress.ReceiverOption
+	if a.config.GRPC.UnixSocketPath != "" {
+		rxOpts = append(rxOpts, ingress.WithAuthorizer(
+			ingress.NewPeerCredAuthorizer(a.config.GRPC.UnixSocketSourceIDs.Rules),
+			a.metricClient.NewCounter("unauthorized_envelopes", metrics.WithMetricTags(map[string]string{"policy": "peer_cred", "metric_version": "2.0"})),
+		))
+	}
+	if len(a.config.GRPC.CertSourceIDs.Rules) > 0 {
+		rxOpts = append(rxOpts, ingress.WithAuthorizer(
+			ingress.NewCertAuthorizer(
+				a.config.GRPC.CertSourceIDs.Rules,
+				a.config.GRPC.CertPolicyMode,
+				a.metricClient.NewCounter("rewritten_source_ids", metrics.WithMetricTags(map[string]string{"metric_version": "2.0"})),
+			),
+			a.metricClient.NewCounter("unauthorized_envelopes", metrics.WithMetricTags(map[string]string{"policy": "cert", "metric_version": "2.0"})),
+		))
+	}
+
+	rxOpts = append(rxOpts, ingress.WithSanitizer(ingress.NewSanitizer(
+		a.metricClient,
+		ingress.WithMaxPayloadBytes(a.config.Sanitizer.MaxPayloadBytes, a.config.Sanitizer.SplitPayloads),
+		ingress.WithMaxTags(a.config.Sanitizer.MaxTags, a.config.Sanitizer.MaxTagLength),
+		ingress.WithMaxTimestampSkew(a.config.Sanitizer.MaxTimestampSkew),
+	)))
+
+	rx := ingress.NewReceiver(limiter, ingressMetric, originMappings, rxOpts...)
+	losslessRx := rx
+	if a.config.Backpressure.Mode != "" {
+		bp := ingress.NewBackpressure(
+			lossless,
+			a.config.Backpressure.Mode,
+			a.metricClient,
+			ingress.WithMaxWait(a.config.Backpressure.MaxWait),
+			ingress.WithLosslessSources(a.config.Backpressure.SourceIDs...),
+		)
+		losslessRx = ingress.NewReceiver(limiter, ingressMetric, originMappings, append(rxOpts, ingress.WithBackpressure(bp))...)
+	}
+	receiver := func(listener string) *ingress.Receiver {
+		if a.config.Backpressure.lossless(listener) {
+			return losslessRx
+		}
+		return rx
+	}
+
 	kp := keepalive.EnforcementPolicy{
 		MinTime:             10 * time.Second,
 		PermitWithoutStream: true,
 	}
 	ingressServer := ingress.NewServer(
 		agentAddress,
-		rx,
+		receiver(ListenerGRPC),
 		grpc.Creds(a.serverCreds),
 		grpc.KeepaliveEnforcementPolicy(kp),
 	)
+
+	if a.config.HTTPIngressPort != 0 {
+		httpServer := ingress.NewHTTPServer(
+			fmt.Sprintf("127.0.0.1:%d", a.config.HTTPIngressPort),
+			receiver(ListenerHTTP),
+			a.serverTLSConfig(),
+		)
+		go httpServer.Start()
+		a.addIngress(httpServer)
+	}
+
+	if a.config.GRPC.UnixSocketPath != "" {
+		unixServer := ingress.NewUnixServer(
+			a.config.GRPC.UnixSocketPath,
+			os.FileMode(a.config.GRPC.UnixSocketMode),
+			receiver(ListenerUnix),
+			grpc.KeepaliveEnforcementPolicy(kp),
+		)
+		go unixServer.Start()
+		a.addIngress(unixServer)
+	}
+
+	a.addIngress(ingressServer)
 	ingressServer.Start()
 }
 
+// Stop stops accepting envelopes and writes the envelopes that are
+// buffered until the context is done. The envelopes that could not be
+// written are reported as lost. Only the first call has an effect.
+func (a *AppV2) Stop(ctx context.Context) {
+	a.stopOnce.Do(func() {
+		a.shutdown(ctx)
+	})
+}
+
+func (a *AppV2) shutdown(ctx context.Context) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.stopped = true
+	for _, i := range a.ingresses {
+		i.Stop()
+	}
+
+	if a.tx != nil {
+		a.tx.Stop(ctx)
+		a.pool.Close()
+
+		lost := a.occupancy.Fill()
+		a.lost.Add(float64(lost))
+		log.Printf("Lost %d v2 envelopes at shutdown", lost)
+	}
+
+	for _, s := range a.stops {
+		s.Stop()
+	}
+}
+
+// dopplerReady returns an error unless there is at least one live
+// connection to doppler.
+func (a *AppV2) dopplerReady() error {
+	a.poolMu.Lock()
+	defer a.poolMu.Unlock()
+
+	if a.pool == nil {
+		return errors.New("not started")
+	}
+
+	if a.pool.Connected() == 0 {
+		return errors.New("no live doppler connections")
+	}
+
+	return nil
+}
+
+// addIngress registers an ingress to be stopped before the buffers are
+// flushed. An ingress added after Stop is stopped right away.
+func (a *AppV2) addIngress(i stopper) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.stopped {
+		i.Stop()
+		return
+	}
+	a.ingresses = append(a.ingresses, i)
+}
+
+// addStop registers a background task to be stopped after the buffers are
+// flushed.
+func (a *AppV2) addStop(s stopper) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.stops = append(a.stops, s)
+}
+
+// newPriorityBuffer returns an ingress buffer that drops metrics before
+// logs. Dropped envelopes are counted in total and per class.
+func (a *AppV2) newPriorityBuffer(dropped metrics.Counter, o *diodes.Occupancy) *diodes.PriorityEnvelopeV2 {
+	classDropped := make(map[string]metrics.Counter)
+	for _, c := range diodes.Classes {
+		classDropped[c] = a.metricClient.NewCounter("dropped_by_class", metrics.WithMetricTags(map[string]string{"direction": "ingress", "class": c, "metric_version": "2.0"}))
+	}
+
+	return diodes.NewPriorityEnvelopeV2(10000, o.ClassAlerter(diodes.ClassAlertFunc(func(class string, missed int) {
+		dropped.Add(float64(missed))
+		classDropped[class].Add(float64(missed))
+
+		log.Printf("Dropped %d v2 %s envelopes", missed, class)
+	})))
+}
+
 func (a *AppV2) initializePool() *clientpoolv2.ClientPool {
 	if a.clientCreds == nil {
 		log.Panic("Failed to load TLS client config")
@@ -163,3 +408,204 @@ func (a *AppV2) initializePool() *clientpoolv2.ClientPool {
 
 	return clientpoolv2.New(connManagers...)
 }
+
+// startOTLPIngress starts the OTLP gRPC and HTTP servers that are enabled.
+func (a *AppV2) startOTLPIngress(setter otlp.DataSetter) {
+	rx := otlp.NewReceiver(setter, a.metricClient)
+
+	if a.config.OTLP.GRPCPort != 0 {
+		srv := otlp.NewServer(
+			fmt.Sprintf("127.0.0.1:%d", a.config.OTLP.GRPCPort),
+			rx,
+			grpc.Creds(a.serverCreds),
+		)
+		go srv.Start()
+		a.addIngress(srv)
+	}
+
+	if a.config.OTLP.HTTPPort != 0 {
+		srv := otlp.NewHTTPServer(
+			fmt.Sprintf("127.0.0.1:%d", a.config.OTLP.HTTPPort),
+			rx,
+			a.serverTLSConfig(),
+		)
+		go srv.Start()
+		a.addIngress(srv)
+	}
+}
+
+// startStatsDIngress starts the StatsD listener if it is enabled.
+func (a *AppV2) startStatsDIngress(setter statsd.DataSetter) {
+	if a.config.StatsD.Port == 0 {
+		return
+	}
+
+	l, err := statsd.NewListener(
+		fmt.Sprintf("127.0.0.1:%d", a.config.StatsD.Port),
+		setter,
+		a.metricClient,
+		statsd.WithFlushInterval(a.config.StatsD.FlushInterval),
+		statsd.WithSourceID(a.config.StatsD.SourceID),
+	)
+	if err != nil {
+		log.Fatalf("Failed to start StatsD listener: %s", err)
+	}
+	go l.Start()
+	a.addIngress(l)
+}
+
+// startSyslogIngress starts the syslog listeners that are enabled.
+func (a *AppV2) startSyslogIngress(setter syslog.DataSetter) {
+	cfg := a.config.Syslog
+	opts := []syslog.ListenerOption{
+		syslog.WithSourceIDFields(cfg.SourceIDFields...),
+		syslog.WithDefaultSourceID(cfg.DefaultSourceID),
+	}
+
+	if cfg.UDPPort != 0 {
+		l, err := syslog.NewUDPListener(
+			fmt.Sprintf("127.0.0.1:%d", cfg.UDPPort),
+			setter,
+			a.metricClient,
+			opts...,
+		)
+		if err != nil {
+			log.Fatalf("Failed to start syslog UDP listener: %s", err)
+		}
+		go l.Start()
+		a.addIngress(l)
+	}
+
+	if cfg.TCPPort != 0 {
+		l, err := syslog.NewTCPListener(
+			fmt.Sprintf("127.0.0.1:%d", cfg.TCPPort),
+			nil,
+			setter,
+			a.metricClient,
+			opts...,
+		)
+		if err != nil {
+			log.Fatalf("Failed to start syslog TCP listener: %s", err)
+		}
+		go l.Start()
+		a.addIngress(l)
+	}
+
+	if cfg.TLSPort != 0 {
+		certFile, keyFile := cfg.CertFile, cfg.KeyFile
+		if certFile == "" {
+			certFile, keyFile = a.config.GRPC.CertFile, a.config.GRPC.KeyFile
+		}
+
+		tlsConfig, err := plumbing.NewServerTLSConfig(certFile, keyFile)
+		if err != nil {
+			log.Fatalf("Could not use TLS config for syslog listener: %s", err)
+		}
+
+		l, err := syslog.NewTCPListener(
+			fmt.Sprintf("127.0.0.1:%d", cfg.TLSPort),
+			tlsConfig,
+			setter,
+			a.metricClient,
+			opts...,
+		)
+		if err != nil {
+			log.Fatalf("Failed to start syslog TLS listener: %s", err)
+		}
+		go l.Start()
+		a.addIngress(l)
+	}
+}
+
+// startRemoteWriteIngress starts the Prometheus remote write endpoint if it
+// is enabled.
+func (a *AppV2) startRemoteWriteIngress(setter remotewrite.DataSetter) {
+	if a.config.RemoteWrite.Port == 0 {
+		return
+	}
+
+	h := remotewrite.NewHandler(
+		setter,
+		a.metricClient,
+		remotewrite.WithDefaultSourceID(a.config.RemoteWrite.DefaultSourceID),
+	)
+	srv := remotewrite.NewServer(
+		fmt.Sprintf("127.0.0.1:%d", a.config.RemoteWrite.Port),
+		h,
+		a.serverTLSConfig(),
+	)
+	go srv.Start()
+	a.addIngress(srv)
+}
+
+// startFluentIngress starts the Fluent Forward listeners that are enabled.
+func (a *AppV2) startFluentIngress(setter fluent.DataSetter) {
+	cfg := a.config.Fluent
+	opt := fluent.WithRecordMapping(fluent.RecordMapping{
+		MessageKey:    cfg.MessageKey,
+		SourceIDKey:   cfg.SourceIDKey,
+		InstanceIDKey: cfg.InstanceIDKey,
+		TagKeys:       cfg.TagKeys,
+	})
+
+	if cfg.Port != 0 {
+		l, err := fluent.NewListener(
+			fmt.Sprintf("127.0.0.1:%d", cfg.Port),
+			nil,
+			setter,
+			a.metricClient,
+			opt,
+		)
+		if err != nil {
+			log.Fatalf("Failed to start fluent forward listener: %s", err)
+		}
+		go l.Start()
+		a.addIngress(l)
+	}
+
+	if cfg.TLSPort != 0 {
+		certFile, keyFile := cfg.CertFile, cfg.KeyFile
+		if certFile == "" {
+			certFile, keyFile = a.config.GRPC.CertFile, a.config.GRPC.KeyFile
+		}
+
+		tlsConfig, err := plumbing.NewServerTLSConfig(certFile, keyFile)
+		if err != nil {
+			log.Fatalf("Could not use TLS config for fluent forward listener: %s", err)
+		}
+
+		l, err := fluent.NewListener(
+			fmt.Sprintf("127.0.0.1:%d", cfg.TLSPort),
+			tlsConfig,
+			setter,
+			a.metricClient,
+			opt,
+		)
+		if err != nil {
+			log.Fatalf("Failed to start fluent forward TLS listener: %s", err)
+		}
+		go l.Start()
+		a.addIngress(l)
+	}
+}
+
+// serverTLSConfig returns the mutual TLS configuration of the HTTP servers.
+// It uses the same certificates as the gRPC server.
+func (a *AppV2) serverTLSConfig() *tls.Config {
+	var opts []plumbing.ConfigOption
+	if len(a.config.GRPC.CipherSuites) > 0 {
+		opts = append(opts, plumbing.WithCipherSuites(a.config.GRPC.CipherSuites))
+	}
+
+	tlsConfig, err := plumbing.NewServerMutualTLSConfig(
+		a.config.GRPC.CertFile,
+		a.config.GRPC.KeyFile,
+		a.config.GRPC.CAFile,
+		opts...,
+	)
+	if err != nil {
+		log.Fatalf("Could not use TLS config for HTTP server: %s", err)
+	}
+
+	return tlsConfig
+}
@@ -1,7 +1,9 @@
 package app_test
 
 import (
+	"context"
 	"net"
+	"time"
 
 	"code.cloudfoundry.org/loggregator-agent/cmd/agent/app"
 	"code.cloudfoundry.org/loggregator-agent/internal/testhelper"
@@ -87,4 +89,42 @@ var _ = Describe("v2 App", func() {
 		Eventually(hasMetric(mc, "origin_mappings", map[string]string{"unit": "bytes/minute", "metric_version": "2.0"})).Should(BeTrue())
 		Eventually(hasMetric(mc, "average_envelopes", map[string]string{"unit": "bytes/minute", "metric_version": "2.0", "loggregator": "v2"})).Should(BeTrue())
 	})
+
+	It("can be stopped more than once", func() {
+		spyLookup := newSpyLookup()
+
+		clientCreds, err := plumbing.NewClientCredentials(
+			testhelper.Cert("metron.crt"),
+			testhelper.Cert("metron.key"),
+			testhelper.Cert("loggregator-ca.crt"),
+			"doppler",
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		serverCreds, err := plumbing.NewServerCredentials(
+			testhelper.Cert("router.crt"),
+			testhelper.Cert("router.key"),
+			testhelper.Cert("loggregator-ca.crt"),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		config := buildAgentConfig("127.0.0.1", 1234)
+		mc := testhelper.NewMetricClient()
+
+		app := app.NewV2App(
+			&config,
+			clientCreds,
+			serverCreds,
+			mc,
+			app.WithV2Lookup(spyLookup.lookup),
+		)
+		go app.Start()
+		Eventually(hasMetric(mc, "shutdown_lost", map[string]string{"metric_version": "2.0"})).Should(BeTrue())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		app.Stop(ctx)
+
+		Expect(func() { app.Stop(ctx) }).ToNot(Panic())
+	})
 })
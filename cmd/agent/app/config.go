@@ -3,8 +3,12 @@ package app
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	envstruct "code.cloudfoundry.org/go-envstruct"
+	"code.cloudfoundry.org/loggregator-agent/pkg/ingress/fluent"
+	"code.cloudfoundry.org/loggregator-agent/pkg/ingress/syslog"
+	v2 "code.cloudfoundry.org/loggregator-agent/pkg/ingress/v2"
 	"golang.org/x/net/idna"
 )
 
@@ -16,6 +20,128 @@ type GRPC struct {
 	CertFile     string   `env:"AGENT_CERT_FILE"`
 	KeyFile      string   `env:"AGENT_KEY_FILE"`
 	CipherSuites []string `env:"AGENT_CIPHER_SUITES"`
+
+	// UnixSocketPath enables the ingress on a Unix socket in addition to
+	// the port when set. UnixSocketSourceIDs restricts the source IDs
+	// each user ID may send over it.
+	UnixSocketPath      string           `env:"AGENT_UNIX_SOCKET_PATH"`
+	UnixSocketMode      v2.SocketMode    `env:"AGENT_UNIX_SOCKET_MODE"`
+	UnixSocketSourceIDs v2.PeerSourceIDs `env:"AGENT_UNIX_SOCKET_SOURCE_IDS"`
+
+	// CertSourceIDs restricts the source IDs each client certificate may
+	// send when set. CertPolicyMode decides if other source IDs are
+	// rejected or rewritten.
+	CertSourceIDs  v2.CertSourceIDs  `env:"AGENT_CERT_SOURCE_IDS"`
+	CertPolicyMode v2.CertPolicyMode `env:"AGENT_CERT_POLICY_MODE"`
+}
+
+// Sanitizer stores the limits of envelopes received by the v2 ingress. A
+// limit is disabled when it is zero. Invalid UTF-8 is always replaced.
+type Sanitizer struct {
+	MaxPayloadBytes  int           `env:"AGENT_MAX_PAYLOAD_BYTES"`
+	SplitPayloads    bool          `env:"AGENT_SPLIT_PAYLOADS"`
+	MaxTags          int           `env:"AGENT_MAX_TAGS"`
+	MaxTagLength     int           `env:"AGENT_MAX_TAG_LENGTH"`
+	MaxTimestampSkew time.Duration `env:"AGENT_MAX_TIMESTAMP_SKEW"`
+}
+
+// RateLimit stores the per source ID rate limit of the v2 ingress and the
+// report of the source IDs that send the most envelopes. There is no limit
+// when the rate is zero but the report is always created.
+type RateLimit struct {
+	Rate           int           `env:"AGENT_SOURCE_RATE_LIMIT"`
+	Burst          int           `env:"AGENT_SOURCE_RATE_BURST"`
+	ReportSize     int           `env:"AGENT_SOURCE_REPORT_SIZE"`
+	ReportInterval time.Duration `env:"AGENT_SOURCE_REPORT_INTERVAL"`
+}
+
+// Backpressure stores the configuration of the lossless v2 ingress. It is
+// disabled unless the mode is set. Envelopes of the source IDs matching
+// SourceIDs bypass the rate limiter and are buffered separately from other
+// envelopes. They are pushed back once that buffer holds Threshold
+// envelopes. All source IDs and listeners are lossless when not set.
+type Backpressure struct {
+	Mode      v2.BackpressureMode `env:"AGENT_BACKPRESSURE_MODE"`
+	SourceIDs []string            `env:"AGENT_BACKPRESSURE_SOURCE_IDS"`
+	Listeners []string            `env:"AGENT_BACKPRESSURE_LISTENERS"`
+	Threshold int                 `env:"AGENT_BACKPRESSURE_THRESHOLD"`
+	MaxWait   time.Duration       `env:"AGENT_BACKPRESSURE_MAX_WAIT"`
+}
+
+// Listeners of the v2 ingress that can be selected for backpressure.
+const (
+	ListenerGRPC = "grpc"
+	ListenerHTTP = "http"
+	ListenerUnix = "unix"
+)
+
+// lossless returns true if envelopes received by the listener may be
+// pushed back.
+func (b Backpressure) lossless(listener string) bool {
+	if b.Mode == "" {
+		return false
+	}
+	if len(b.Listeners) == 0 {
+		return true
+	}
+
+	for _, l := range b.Listeners {
+		if l == listener {
+			return true
+		}
+	}
+
+	return false
+}
+
+// OTLP stores the ports of the OTLP ingress servers. A server is only
+// started when its port is set. Both use the GRPC TLS configuration.
+type OTLP struct {
+	GRPCPort uint16 `env:"AGENT_OTLP_GRPC_PORT"`
+	HTTPPort uint16 `env:"AGENT_OTLP_HTTP_PORT"`
+}
+
+// StatsD stores the configuration of the StatsD listener. The listener is
+// only started when its port is set.
+type StatsD struct {
+	Port          uint16        `env:"AGENT_STATSD_PORT"`
+	FlushInterval time.Duration `env:"AGENT_STATSD_FLUSH_INTERVAL"`
+	SourceID      string        `env:"AGENT_STATSD_SOURCE_ID"`
+}
+
+// Syslog stores the configuration of the syslog listeners. A listener is
+// only started when its port is set. The TLS listener uses the GRPC
+// certificate unless a certificate is configured.
+type Syslog struct {
+	UDPPort         uint16   `env:"AGENT_SYSLOG_UDP_PORT"`
+	TCPPort         uint16   `env:"AGENT_SYSLOG_TCP_PORT"`
+	TLSPort         uint16   `env:"AGENT_SYSLOG_TLS_PORT"`
+	CertFile        string   `env:"AGENT_SYSLOG_CERT_FILE"`
+	KeyFile         string   `env:"AGENT_SYSLOG_KEY_FILE"`
+	SourceIDFields  []string `env:"AGENT_SYSLOG_SOURCE_ID_FIELDS"`
+	DefaultSourceID string   `env:"AGENT_SYSLOG_DEFAULT_SOURCE_ID"`
+}
+
+// RemoteWrite stores the configuration of the Prometheus remote write
+// endpoint. It is only started when its port is set and uses the GRPC TLS
+// configuration.
+type RemoteWrite struct {
+	Port            uint16 `env:"AGENT_REMOTE_WRITE_PORT"`
+	DefaultSourceID string `env:"AGENT_REMOTE_WRITE_SOURCE_ID"`
+}
+
+// Fluent stores the configuration of the Fluent Forward listeners. A
+// listener is only started when its port is set. The TLS listener uses the
+// GRPC certificate unless a certificate is configured.
+type Fluent struct {
+	Port          uint16   `env:"AGENT_FLUENT_PORT"`
+	TLSPort       uint16   `env:"AGENT_FLUENT_TLS_PORT"`
+	CertFile      string   `env:"AGENT_FLUENT_CERT_FILE"`
+	KeyFile       string   `env:"AGENT_FLUENT_KEY_FILE"`
+	MessageKey    string   `env:"AGENT_FLUENT_MESSAGE_KEY"`
+	SourceIDKey   string   `env:"AGENT_FLUENT_SOURCE_ID_KEY"`
+	InstanceIDKey string   `env:"AGENT_FLUENT_INSTANCE_ID_KEY"`
+	TagKeys       []string `env:"AGENT_FLUENT_TAG_KEYS"`
 }
 
 // Config stores all configurations options for the Agent.
@@ -33,7 +159,18 @@ type Config struct {
 	DebugPort                       uint32            `env:"AGENT_DEBUG_PORT"`
 	RouterAddr                      string            `env:"ROUTER_ADDR"`
 	RouterAddrWithAZ                string            `env:"ROUTER_ADDR_WITH_AZ"`
+	HTTPIngressPort                 uint16            `env:"AGENT_HTTP_INGRESS_PORT"`
+	PriorityBuffer                  bool              `env:"AGENT_PRIORITY_BUFFER"`
+	ShutdownTimeout                 time.Duration     `env:"AGENT_SHUTDOWN_TIMEOUT"`
 	GRPC                            GRPC
+	Sanitizer                       Sanitizer
+	RateLimit                       RateLimit
+	Backpressure                    Backpressure
+	OTLP                            OTLP
+	StatsD                          StatsD
+	Syslog                          Syslog
+	RemoteWrite                     RemoteWrite
+	Fluent                          Fluent
 }
 
 // LoadConfig reads from the environment to create a Config.
@@ -43,8 +180,35 @@ func LoadConfig() (*Config, error) {
 		MetricSourceID:                  "metron",
 		IncomingUDPPort:                 3457,
 		DebugPort:                       14824,
+		ShutdownTimeout:                 10 * time.Second,
 		GRPC: GRPC{
-			Port: 3458,
+			Port:           3458,
+			UnixSocketMode: 0660,
+			CertPolicyMode: v2.CertPolicyReject,
+		},
+		RateLimit: RateLimit{
+			ReportSize:     10,
+			ReportInterval: time.Minute,
+		},
+		Backpressure: Backpressure{
+			Threshold: 8000,
+			MaxWait:   5 * time.Second,
+		},
+		StatsD: StatsD{
+			FlushInterval: 10 * time.Second,
+			SourceID:      "statsd",
+		},
+		Syslog: Syslog{
+			SourceIDFields:  syslog.DefaultSourceIDFields,
+			DefaultSourceID: "syslog",
+		},
+		RemoteWrite: RemoteWrite{
+			DefaultSourceID: "remote_write",
+		},
+		Fluent: Fluent{
+			MessageKey:    fluent.DefaultRecordMapping.MessageKey,
+			SourceIDKey:   fluent.DefaultRecordMapping.SourceIDKey,
+			InstanceIDKey: fluent.DefaultRecordMapping.InstanceIDKey,
 		},
 	}
 	err := envstruct.Load(&config)
@@ -56,6 +220,18 @@ func LoadConfig() (*Config, error) {
 		return nil, fmt.Errorf("RouterAddr is required")
 	}
 
+	if err := syslog.ValidateSourceIDFields(config.Syslog.SourceIDFields); err != nil {
+		return nil, err
+	}
+
+	for _, l := range config.Backpressure.Listeners {
+		switch l {
+		case ListenerGRPC, ListenerHTTP, ListenerUnix:
+		default:
+			return nil, fmt.Errorf("unknown backpressure listener: %s", l)
+		}
+	}
+
 	config.RouterAddrWithAZ, err = idna.ToASCII(config.RouterAddrWithAZ)
 	if err != nil {
 		return nil, err
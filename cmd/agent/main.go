@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -9,6 +10,8 @@ import (
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"code.cloudfoundry.org/loggregator-agent/cmd/agent/app"
@@ -27,9 +30,17 @@ func main() {
 	}
 
 	a := app.NewAgent(config)
-	go a.Start()
+	a.Start()
 
-	runPProf(config.DebugPort)
+	go runPProf(config.DebugPort)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	<-signals
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+	a.Stop(ctx)
 }
 
 func runPProf(port uint32) {
@@ -2,8 +2,10 @@ package app
 
 import (
 	"fmt"
+	"time"
 
 	"code.cloudfoundry.org/go-envstruct"
+	"code.cloudfoundry.org/loggregator-agent/pkg/ingress/v2"
 )
 
 // GRPC stores the configuration for the router as a server using a PORT
@@ -14,17 +16,68 @@ type GRPC struct {
 	CertFile     string   `env:"AGENT_CERT_FILE_PATH, required, report"`
 	KeyFile      string   `env:"AGENT_KEY_FILE_PATH, required, report"`
 	CipherSuites []string `env:"AGENT_CIPHER_SUITES, report"`
+
+	// UnixSocketPath serves the ingress on a Unix socket next to the port
+	// when set. Peers are limited to the source IDs of their user ID in
+	// UnixSocketSourceIDs.
+	UnixSocketPath      string           `env:"AGENT_UNIX_SOCKET_PATH, report"`
+	UnixSocketMode      v2.SocketMode    `env:"AGENT_UNIX_SOCKET_MODE, report"`
+	UnixSocketSourceIDs v2.PeerSourceIDs `env:"AGENT_UNIX_SOCKET_SOURCE_IDS, report"`
+
+	// CertSourceIDs limits clients to the source IDs of their certificate
+	// identities when set. Envelopes with other source IDs are rejected or
+	// rewritten depending on CertPolicyMode.
+	CertSourceIDs  v2.CertSourceIDs  `env:"AGENT_CERT_SOURCE_IDS, report"`
+	CertPolicyMode v2.CertPolicyMode `env:"AGENT_CERT_POLICY_MODE, report"`
+}
+
+// Sanitizer stores the limits of envelopes received by the v2 ingress. A
+// limit is disabled when it is zero.
+type Sanitizer struct {
+	MaxPayloadBytes  int           `env:"MAX_PAYLOAD_BYTES, report"`
+	SplitPayloads    bool          `env:"SPLIT_PAYLOADS, report"`
+	MaxTags          int           `env:"MAX_TAGS, report"`
+	MaxTagLength     int           `env:"MAX_TAG_LENGTH, report"`
+	MaxTimestampSkew time.Duration `env:"MAX_TIMESTAMP_SKEW, report"`
 }
 
 // Config holds the configuration for the forwarder agent
 type Config struct {
-	// DownstreamIngressPortCfg will define consumers on localhost that will
-	// receive each envelope. It is assumed to adhere to the Loggregator Ingress
-	// Service and use the provided TLS configuration.
+	// DownstreamIngressPortCfg will define consumers that will receive each
+	// envelope. It is assumed to adhere to the Loggregator Ingress Service.
+	// Consumers are on localhost and use the provided TLS configuration
+	// unless their port file sets a host or TLS credentials.
 	DownstreamIngressPortCfg string `env:"DOWNSTREAM_INGRESS_PORT_GLOB, report"`
 	DebugPort                uint16 `env:"DEBUG_PORT, report"`
 	GRPC                     GRPC
+	Sanitizer                Sanitizer
 	Tags                     map[string]string `env:"AGENT_TAGS"`
+
+	// OTLPGRPCPort and OTLPHTTPPort enable OTLP ingress over gRPC and HTTP
+	// on localhost when set. Both use the provided TLS configuration.
+	OTLPGRPCPort uint16 `env:"OTLP_GRPC_PORT, report"`
+	OTLPHTTPPort uint16 `env:"OTLP_HTTP_PORT, report"`
+
+	// HTTPIngressPort enables JSON and NDJSON envelope ingress over HTTP on
+	// localhost when set. It uses the provided TLS configuration.
+	HTTPIngressPort uint16 `env:"HTTP_INGRESS_PORT, report"`
+
+	// PriorityBuffer buffers envelopes per type so that metrics are
+	// dropped before logs when the consumers can not keep up.
+	PriorityBuffer bool `env:"PRIORITY_BUFFER, report"`
+
+	// DownstreamIngressPortPollInterval is how often the files matching
+	// DownstreamIngressPortCfg are checked for added, changed and removed
+	// consumers.
+	DownstreamIngressPortPollInterval time.Duration `env:"DOWNSTREAM_INGRESS_PORT_POLL_INTERVAL, report"`
+
+	// DownstreamFailureThreshold is how long writes to a consumer must fail
+	// before the consumer is reported on the debug port's health endpoint.
+	DownstreamFailureThreshold time.Duration `env:"DOWNSTREAM_FAILURE_THRESHOLD, report"`
+
+	// ShutdownTimeout is how long buffered envelopes are written to the
+	// consumers after a SIGTERM before they are dropped.
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT, report"`
 }
 
 // LoadConfig will load the configuration for the forwarder agent from the
@@ -33,8 +86,13 @@ type Config struct {
 func LoadConfig() Config {
 	cfg := Config{
 		GRPC: GRPC{
-			Port: 3458,
+			Port:           3458,
+			UnixSocketMode: 0660,
+			CertPolicyMode: v2.CertPolicyReject,
 		},
+		DownstreamIngressPortPollInterval: 5 * time.Second,
+		DownstreamFailureThreshold:        time.Minute,
+		ShutdownTimeout:                   10 * time.Second,
 	}
 	if err := envstruct.Load(&cfg); err != nil {
 		panic(fmt.Sprintf("Failed to load config from environment: %s", err))
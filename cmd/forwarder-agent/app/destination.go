@@ -0,0 +1,259 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	gendiodes "code.cloudfoundry.org/go-diodes"
+	"code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/pkg/diodes"
+	"code.cloudfoundry.org/loggregator-agent/pkg/downstream"
+	"code.cloudfoundry.org/loggregator-agent/pkg/egress"
+	egress_v2 "code.cloudfoundry.org/loggregator-agent/pkg/egress/v2"
+	"code.cloudfoundry.org/loggregator-agent/pkg/metrics"
+	"code.cloudfoundry.org/loggregator-agent/pkg/timeoutwaitgroup"
+	"google.golang.org/grpc"
+)
+
+// destination writes envelopes to a downstream consumer through its own
+// diode so that a slow consumer does not block the others.
+type destination struct {
+	egress_v2.EnvelopeWriter
+
+	cancel    context.CancelFunc
+	wg        *timeoutwaitgroup.TimeoutWaitGroup
+	health    *downstream.Health
+	state     *downstream.ConnectionState
+	reporter  *diodes.OccupancyReporter
+	occupancy *diodes.Occupancy
+	metrics   Metrics
+	dm        *destinationMetrics
+}
+
+// Close stops the destination once its buffered envelopes are written. Its
+// metrics are removed.
+func (d destination) Close() error {
+	d.cancel()
+	d.wg.Wait()
+	d.health.Remove(d.state)
+	d.reporter.Remove(d.occupancy)
+	d.dm.remove(d.metrics)
+
+	return nil
+}
+
+func destinationFactory(
+	grpcCfg GRPC,
+	tags map[string]string,
+	m Metrics,
+	h *downstream.Health,
+	r *diodes.OccupancyReporter,
+	total *diodes.Occupancy,
+) downstream.DestinationFactory {
+	return func(cfg downstream.Config) (downstream.Destination, error) {
+		addr := cfg.Addr()
+		clientCreds, err := clientTLSConfig(cfg.TLS, grpcCfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure client TLS: %s", err)
+		}
+
+		dm := newDestinationMetrics(addr, m)
+		occupancy := diodes.NewOccupancy()
+		state := h.NewConnectionState(addr)
+
+		il := log.New(os.Stderr, fmt.Sprintf("[INGRESS CLIENT] -> %s: ", addr), log.LstdFlags)
+
+		var wc egress.WriteCloser
+		switch cfg.Type {
+		case downstream.TypeOTLP:
+			wc, err = newOTLPWriter(addr, clientCreds, dm, state, il)
+		default:
+			wc, err = newClientWriter(addr, clientCreds, dm, state, il)
+		}
+		if err != nil {
+			h.Remove(state)
+			dm.remove(m)
+			return nil, err
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		wg := timeoutwaitgroup.New(time.Minute)
+		wg.Add(1)
+		wc = closeWaiter{WriteCloser: wc, wg: wg}
+		dw := egress.NewDiodeWriter(ctx, wc, gendiodes.AlertFunc(func(missed int) {
+			dm.drops.Add(float64(missed))
+			il.Printf("Dropped %d logs for url %s", missed, addr)
+		}), wg, egress.WithOccupancy(occupancy, total))
+		r.Add(occupancy, dm.queueDepth, dm.queueHighWater)
+
+		ew := egress_v2.NewEnvelopeWriter(
+			dw,
+			egress_v2.NewCounterAggregator(),
+			egress_v2.NewTagger(tags),
+		)
+
+		return destination{
+			EnvelopeWriter: ew,
+			cancel:         cancel,
+			wg:             wg,
+			health:         h,
+			state:          state,
+			reporter:       r,
+			occupancy:      occupancy,
+			metrics:        m,
+			dm:             dm,
+		}, nil
+	}
+}
+
+// closeWaiter marks the wait group done once the writer is closed. The
+// DiodeWriter marks its wait group done before closing its writer, so
+// without it Close would not wait for the writer to flush.
+type closeWaiter struct {
+	egress.WriteCloser
+	wg egress.WaitGroup
+}
+
+func (c closeWaiter) Close() error {
+	defer c.wg.Done()
+	return c.WriteCloser.Close()
+}
+
+// clientTLSConfig returns the TLS config for a destination. Credentials that
+// are not set for the destination default to the agent's own.
+func clientTLSConfig(t downstream.TLS, grpcCfg GRPC) (*tls.Config, error) {
+	caFile := grpcCfg.CAFile
+	if t.CAFile != "" {
+		caFile = t.CAFile
+	}
+
+	certFile, keyFile := grpcCfg.CertFile, grpcCfg.KeyFile
+	if t.CertFile != "" {
+		certFile, keyFile = t.CertFile, t.KeyFile
+	}
+
+	tlsConfig, err := loggregator.NewIngressTLSConfig(caFile, certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.ServerName != "" {
+		tlsConfig.ServerName = t.ServerName
+	}
+
+	return tlsConfig, nil
+}
+
+// destinationMetrics are the metrics of a single destination. The queue
+// depth and its high water mark are set by the occupancy reporter.
+type destinationMetrics struct {
+	egress         metrics.Counter
+	drops          metrics.Counter
+	queueDepth     metrics.Gauge
+	queueHighWater metrics.Gauge
+}
+
+func newDestinationMetrics(addr string, m Metrics) *destinationMetrics {
+	tags := metrics.WithMetricTags(map[string]string{"destination": addr})
+
+	return &destinationMetrics{
+		egress:         m.NewCounter("downstream_egress", tags),
+		drops:          m.NewCounter("downstream_dropped", tags),
+		queueDepth:     m.NewGauge("downstream_queue_depth", tags),
+		queueHighWater: m.NewGauge("downstream_queue_high_water", tags),
+	}
+}
+
+func (dm *destinationMetrics) remove(m Metrics) {
+	m.RemoveCounter(dm.egress)
+	m.RemoveCounter(dm.drops)
+	m.RemoveGauge(dm.queueDepth)
+	m.RemoveGauge(dm.queueHighWater)
+}
+
+func newClientWriter(
+	addr string,
+	clientCreds *tls.Config,
+	dm *destinationMetrics,
+	state *downstream.ConnectionState,
+	il *log.Logger,
+) (clientWriter, error) {
+	ingressClient, err := loggregator.NewIngressClient(
+		clientCreds,
+		loggregator.WithLogger(il),
+		loggregator.WithAddr(addr),
+		loggregator.WithDialOptions(
+			grpc.WithStreamInterceptor(streamInterceptor(state, dm.egress)),
+		),
+	)
+	if err != nil {
+		return clientWriter{}, fmt.Errorf("failed to create ingress client for %s: %s", addr, err)
+	}
+
+	return clientWriter{c: ingressClient}, nil
+}
+
+type clientWriter struct {
+	c *loggregator.IngressClient
+}
+
+func (c clientWriter) Write(e *loggregator_v2.Envelope) error {
+	c.c.Emit(e)
+	return nil
+}
+
+func (c clientWriter) Close() error {
+	return c.c.CloseSend()
+}
+
+// streamInterceptor records the outcome of every batch the ingress client
+// sends. The ingress client only logs errors, so this is the only place
+// failures can be observed.
+func streamInterceptor(
+	state *downstream.ConnectionState,
+	egress metrics.Counter,
+) grpc.StreamClientInterceptor {
+	return func(
+		ctx context.Context,
+		desc *grpc.StreamDesc,
+		cc *grpc.ClientConn,
+		method string,
+		streamer grpc.Streamer,
+		opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			state.Failed(err)
+			return nil, err
+		}
+
+		return observedStream{ClientStream: cs, state: state, egress: egress}, nil
+	}
+}
+
+type observedStream struct {
+	grpc.ClientStream
+
+	state  *downstream.ConnectionState
+	egress metrics.Counter
+}
+
+func (s observedStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err != nil {
+		s.state.Failed(err)
+		return err
+	}
+
+	s.state.Succeeded()
+	if b, ok := m.(*loggregator_v2.EnvelopeBatch); ok {
+		s.egress.Add(float64(len(b.GetBatch())))
+	}
+
+	return nil
+}
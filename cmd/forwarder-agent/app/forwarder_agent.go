@@ -3,11 +3,11 @@ package app
 import (
 	"code.cloudfoundry.org/loggregator-agent/pkg/metrics"
 	"context"
+	"crypto/tls"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
-	"path/filepath"
+	"sync"
 	"time"
 
 	"net/http"
@@ -15,32 +15,58 @@ import (
 	_ "net/http/pprof"
 
 	gendiodes "code.cloudfoundry.org/go-diodes"
-	"code.cloudfoundry.org/go-loggregator"
 	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
 	"code.cloudfoundry.org/loggregator-agent/pkg/diodes"
-	"code.cloudfoundry.org/loggregator-agent/pkg/egress"
+	"code.cloudfoundry.org/loggregator-agent/pkg/downstream"
 	"code.cloudfoundry.org/loggregator-agent/pkg/egress/syslog"
-	egress_v2 "code.cloudfoundry.org/loggregator-agent/pkg/egress/v2"
+	"code.cloudfoundry.org/loggregator-agent/pkg/health"
+	"code.cloudfoundry.org/loggregator-agent/pkg/ingress/otlp"
 	"code.cloudfoundry.org/loggregator-agent/pkg/ingress/v2"
 	"code.cloudfoundry.org/loggregator-agent/pkg/plumbing"
-	"code.cloudfoundry.org/loggregator-agent/pkg/timeoutwaitgroup"
 	"google.golang.org/grpc"
-	"gopkg.in/yaml.v2"
+	"google.golang.org/grpc/credentials"
 )
 
 // ForwarderAgent manages starting the forwarder agent service.
 type ForwarderAgent struct {
-	pprofPort          uint16
-	m                  Metrics
-	grpc               GRPC
-	downstreamPortsCfg string
-	log                *log.Logger
-	tags               map[string]string
+	pprofPort              uint16
+	m                      Metrics
+	grpc                   GRPC
+	sanitizer              Sanitizer
+	downstreamPortsCfg     string
+	downstreamPollInterval time.Duration
+	downstreamHealth       *downstream.Health
+	otlpGRPCPort           uint16
+	otlpHTTPPort           uint16
+	httpIngressPort        uint16
+	priorityBuffer         bool
+	log                    *log.Logger
+	tags                   map[string]string
+
+	mu               sync.Mutex
+	stopped          bool
+	debugServer      *http.Server
+	ingresses        []stopper
+	dests            *downstream.Destinations
+	reporter         *diodes.OccupancyReporter
+	ingressOccupancy *diodes.Occupancy
+	egressOccupancy  *diodes.Occupancy
+	lost             metrics.Counter
+	stop             chan struct{}
+	stopOnce         sync.Once
+	writerDone       chan struct{}
+}
+
+// stopper is an ingress server that can be stopped.
+type stopper interface {
+	Stop()
 }
 
 type Metrics interface {
 	NewGauge(name string, opts ...metrics.MetricOption) metrics.Gauge
 	NewCounter(name string, opts ...metrics.MetricOption) metrics.Counter
+	RemoveGauge(metrics.Gauge)
+	RemoveCounter(metrics.Counter)
 }
 
 type BindingFetcher interface {
@@ -58,33 +84,86 @@ func NewForwarderAgent(
 	log *log.Logger,
 ) *ForwarderAgent {
 	return &ForwarderAgent{
-		pprofPort:          cfg.DebugPort,
-		grpc:               cfg.GRPC,
-		m:                  m,
-		downstreamPortsCfg: cfg.DownstreamIngressPortCfg,
-		log:                log,
-		tags:               cfg.Tags,
+		pprofPort:              cfg.DebugPort,
+		grpc:                   cfg.GRPC,
+		sanitizer:              cfg.Sanitizer,
+		m:                      m,
+		downstreamPortsCfg:     cfg.DownstreamIngressPortCfg,
+		downstreamPollInterval: cfg.DownstreamIngressPortPollInterval,
+		downstreamHealth:       downstream.NewHealth(cfg.DownstreamFailureThreshold, m),
+		otlpGRPCPort:           cfg.OTLPGRPCPort,
+		otlpHTTPPort:           cfg.OTLPHTTPPort,
+		httpIngressPort:        cfg.HTTPIngressPort,
+		priorityBuffer:         cfg.PriorityBuffer,
+		log:                    log,
+		tags:                   cfg.Tags,
+		stop:                   make(chan struct{}),
+		writerDone:             make(chan struct{}),
 	}
 }
 
-func (s ForwarderAgent) Run() {
-	go http.ListenAndServe(fmt.Sprintf("127.0.0.1:%d", s.pprofPort), nil)
-
-	ingressDropped := s.m.NewCounter("dropped", metrics.WithMetricTags(map[string]string{"direction": "ingress"}))
-	diode := diodes.NewManyToOneEnvelopeV2(10000, gendiodes.AlertFunc(func(missed int) {
-		ingressDropped.Add(float64(missed))
-	}))
-
-	downstreamAddrs := getDownstreamAddresses(s.downstreamPortsCfg, s.log)
-	clients := ingressClients(downstreamAddrs, s.grpc, s.log, s.tags)
-	go func() {
-		for {
-			e := diode.Next()
-			for _, c := range clients {
-				c.Write(e)
-			}
+func (s *ForwarderAgent) Run() {
+	mux := http.NewServeMux()
+	// pprof and /metrics are registered with the default mux
+	mux.Handle("/", http.DefaultServeMux)
+	mux.Handle("/downstream/health", s.downstreamHealth)
+	h := health.NewHandler()
+	h.Add("downstream", s.downstreamHealth.Check)
+	h.Register(mux)
+	s.startDebugServer(mux)
+
+	reporter := diodes.NewOccupancyReporter(15 * time.Second)
+	go reporter.Start()
+
+	ingressTags := metrics.WithMetricTags(map[string]string{"direction": "ingress"})
+	ingressOccupancy := diodes.NewOccupancy()
+	reporter.Add(
+		ingressOccupancy,
+		s.m.NewGauge("queue_depth", ingressTags),
+		s.m.NewGauge("queue_high_water", ingressTags),
+	)
+
+	ingressDropped := s.m.NewCounter("dropped", ingressTags)
+	var diode diodes.EnvelopeV2Diode
+	if s.priorityBuffer {
+		classDropped := make(map[string]metrics.Counter)
+		for _, c := range diodes.Classes {
+			classDropped[c] = s.m.NewCounter("dropped_by_class", metrics.WithMetricTags(map[string]string{"direction": "ingress", "class": c}))
 		}
-	}()
+
+		diode = diodes.NewPriorityEnvelopeV2(10000, ingressOccupancy.ClassAlerter(diodes.ClassAlertFunc(func(class string, missed int) {
+			ingressDropped.Add(float64(missed))
+			classDropped[class].Add(float64(missed))
+		})))
+	} else {
+		diode = diodes.NewManyToOneEnvelopeV2(10000, ingressOccupancy.Alerter(gendiodes.AlertFunc(func(missed int) {
+			ingressDropped.Add(float64(missed))
+		})))
+	}
+	waitable := diodes.NewWaitableEnvelopeV2(diodes.NewTrackedEnvelopeV2(diode, ingressOccupancy))
+	diode = waitable
+
+	egressOccupancy := diodes.NewOccupancy()
+	dests := downstream.NewDestinations(
+		s.downstreamPortsCfg,
+		destinationFactory(s.grpc, s.tags, s.m, s.downstreamHealth, reporter, egressOccupancy),
+		s.m,
+		s.log,
+	)
+	dests.Reload()
+	if s.downstreamPollInterval > 0 {
+		go dests.Watch(s.downstreamPollInterval)
+	}
+
+	s.mu.Lock()
+	s.dests = dests
+	s.reporter = reporter
+	s.ingressOccupancy = ingressOccupancy
+	s.egressOccupancy = egressOccupancy
+	s.lost = s.m.NewCounter("shutdown_lost")
+	s.mu.Unlock()
+
+	go s.writeDownstream(waitable, dests)
 
 	var opts []plumbing.ConfigOption
 	if len(s.grpc.CipherSuites) > 0 {
@@ -101,99 +180,196 @@ func (s ForwarderAgent) Run() {
 		s.log.Fatalf("failed to configure server TLS: %s", err)
 	}
 
+	s.startOTLPIngress(diode, serverCreds, opts)
+
 	im := s.m.NewCounter("ingress")
 	omm := s.m.NewCounter("origin_mappings")
-	rx := v2.NewReceiver(diode, im, omm)
+	var rxOpts []v2.ReceiverOption
+	if s.grpc.UnixSocketPath != "" {
+		rxOpts = append(rxOpts, v2.WithAuthorizer(
+			v2.NewPeerCredAuthorizer(s.grpc.UnixSocketSourceIDs.Rules),
+			s.m.NewCounter("unauthorized_envelopes", metrics.WithMetricTags(map[string]string{"policy": "peer_cred"})),
+		))
+	}
+	if len(s.grpc.CertSourceIDs.Rules) > 0 {
+		rxOpts = append(rxOpts, v2.WithAuthorizer(
+			v2.NewCertAuthorizer(
+				s.grpc.CertSourceIDs.Rules,
+				s.grpc.CertPolicyMode,
+				s.m.NewCounter("rewritten_source_ids"),
+			),
+			s.m.NewCounter("unauthorized_envelopes", metrics.WithMetricTags(map[string]string{"policy": "cert"})),
+		))
+	}
+	rxOpts = append(rxOpts, v2.WithSanitizer(v2.NewSanitizer(
+		s.m,
+		v2.WithMaxPayloadBytes(s.sanitizer.MaxPayloadBytes, s.sanitizer.SplitPayloads),
+		v2.WithMaxTags(s.sanitizer.MaxTags, s.sanitizer.MaxTagLength),
+		v2.WithMaxTimestampSkew(s.sanitizer.MaxTimestampSkew),
+	)))
+	rx := v2.NewReceiver(diode, im, omm, rxOpts...)
+
+	if s.httpIngressPort != 0 {
+		httpSrv := v2.NewHTTPServer(
+			fmt.Sprintf("127.0.0.1:%d", s.httpIngressPort),
+			rx,
+			s.serverTLSConfig(opts),
+		)
+		go httpSrv.Start()
+		s.addIngress(httpSrv)
+	}
+
+	if s.grpc.UnixSocketPath != "" {
+		unixSrv := v2.NewUnixServer(
+			s.grpc.UnixSocketPath,
+			os.FileMode(s.grpc.UnixSocketMode),
+			rx,
+		)
+		go unixSrv.Start()
+		s.addIngress(unixSrv)
+	}
 
 	srv := v2.NewServer(
 		fmt.Sprintf("127.0.0.1:%d", s.grpc.Port),
 		rx,
 		grpc.Creds(serverCreds),
 	)
+	s.addIngress(srv)
 	srv.Start()
 }
 
-type clientWriter struct {
-	c *loggregator.IngressClient
+// Stop stops accepting envelopes and writes the buffered envelopes to the
+// destinations until the context is done. The envelopes that could not be
+// written are reported as lost. Only the first call has an effect.
+func (s *ForwarderAgent) Stop(ctx context.Context) {
+	s.stopOnce.Do(func() {
+		s.shutdown(ctx)
+	})
 }
 
-func (c clientWriter) Write(e *loggregator_v2.Envelope) error {
-	c.c.Emit(e)
-	return nil
-}
+func (s *ForwarderAgent) shutdown(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-func (c clientWriter) Close() error {
-	return c.c.CloseSend()
-}
+	s.stopped = true
+	if s.debugServer != nil {
+		// Metrics and health checks are served until the buffers are flushed.
+		defer func() {
+			if err := s.debugServer.Shutdown(ctx); err != nil {
+				s.log.Printf("failed to stop debug server: %s", err)
+			}
+		}()
+	}
 
-type portConfig struct {
-	Ingress string `yaml:"ingress"`
-}
+	for _, i := range s.ingresses {
+		i.Stop()
+	}
 
-func getDownstreamAddresses(glob string, l *log.Logger) []string {
-	files, err := filepath.Glob(glob)
-	if err != nil {
-		l.Fatal("Unable to read downstream port location")
+	if s.dests == nil {
+		return
 	}
 
-	var addrs []string
-	for _, f := range files {
-		yamlFile, err := ioutil.ReadFile(f)
-		if err != nil {
-			l.Fatalf("cannot read file: %s", err)
-		}
+	close(s.stop)
+	select {
+	case <-s.writerDone:
+	case <-ctx.Done():
+	}
+
+	if err := s.dests.Close(ctx); err != nil {
+		s.log.Printf("failed to flush downstream destinations: %s", err)
+	}
+
+	lost := s.ingressOccupancy.Fill() + s.egressOccupancy.Fill()
+	s.lost.Add(float64(lost))
+	s.log.Printf("Lost %d envelopes at shutdown", lost)
+
+	s.reporter.Stop()
+}
+
+// writeDownstream writes envelopes from the ingress buffer to the
+// destinations. Once Stop is called it returns as soon as the buffer is
+// empty.
+func (s *ForwarderAgent) writeDownstream(diode *diodes.WaitableEnvelopeV2, dests *downstream.Destinations) {
+	defer close(s.writerDone)
 
-		var c portConfig
-		err = yaml.Unmarshal(yamlFile, &c)
-		if err != nil {
-			l.Fatalf("Unmarshal: %v", err)
+	for {
+		e, ok := diode.NextOrDone(s.stop)
+		if !ok {
+			return
 		}
 
-		addrs = append(addrs, fmt.Sprintf("127.0.0.1:%s", c.Ingress))
+		dests.Write(e)
 	}
+}
+
+// startDebugServer serves pprof, metrics and health checks on the debug
+// port until Stop is called.
+func (s *ForwarderAgent) startDebugServer(h http.Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	return addrs
+	if s.stopped {
+		return
+	}
+	s.debugServer = &http.Server{
+		Addr:    fmt.Sprintf("127.0.0.1:%d", s.pprofPort),
+		Handler: h,
+	}
+	go s.debugServer.ListenAndServe()
 }
 
-func ingressClients(downstreamAddrs []string,
-	grpc GRPC,
-	l *log.Logger,
-	tags map[string]string) []Writer {
-
-	var ingressClients []Writer
-	for _, addr := range downstreamAddrs {
-		clientCreds, err := loggregator.NewIngressTLSConfig(
-			grpc.CAFile,
-			grpc.CertFile,
-			grpc.KeyFile,
-		)
-		if err != nil {
-			l.Fatalf("failed to configure client TLS: %s", err)
-		}
+func (s *ForwarderAgent) addIngress(i stopper) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-		il := log.New(os.Stderr, fmt.Sprintf("[INGRESS CLIENT] -> %s: ", addr), log.LstdFlags)
-		ingressClient, err := loggregator.NewIngressClient(
-			clientCreds,
-			loggregator.WithLogger(il),
-			loggregator.WithAddr(addr),
-		)
-		if err != nil {
-			l.Fatalf("failed to create ingress client for %s: %s", addr, err)
-		}
+	if s.stopped {
+		i.Stop()
+		return
+	}
+	s.ingresses = append(s.ingresses, i)
+}
 
-		ctx := context.Background()
-		wc := clientWriter{ingressClient}
-		dw := egress.NewDiodeWriter(ctx, wc, gendiodes.AlertFunc(func(missed int) {
-			il.Printf("Dropped %d logs for url %s", missed, addr)
-		}), timeoutwaitgroup.New(time.Minute))
+// startOTLPIngress starts the OTLP gRPC and HTTP servers that are enabled.
+func (s *ForwarderAgent) startOTLPIngress(
+	diode otlp.DataSetter,
+	serverCreds credentials.TransportCredentials,
+	opts []plumbing.ConfigOption,
+) {
+	rx := otlp.NewReceiver(diode, s.m)
 
-		ew := egress_v2.NewEnvelopeWriter(
-			dw,
-			egress_v2.NewCounterAggregator(),
-			egress_v2.NewTagger(tags),
+	if s.otlpGRPCPort != 0 {
+		srv := otlp.NewServer(
+			fmt.Sprintf("127.0.0.1:%d", s.otlpGRPCPort),
+			rx,
+			grpc.Creds(serverCreds),
 		)
+		go srv.Start()
+		s.addIngress(srv)
+	}
 
-		ingressClients = append(ingressClients, ew)
+	if s.otlpHTTPPort != 0 {
+		srv := otlp.NewHTTPServer(
+			fmt.Sprintf("127.0.0.1:%d", s.otlpHTTPPort),
+			rx,
+			s.serverTLSConfig(opts),
+		)
+		go srv.Start()
+		s.addIngress(srv)
 	}
-	return ingressClients
+}
+
+// serverTLSConfig returns the mutual TLS configuration of the HTTP ingress
+// servers.
+func (s *ForwarderAgent) serverTLSConfig(opts []plumbing.ConfigOption) *tls.Config {
+	tlsConfig, err := plumbing.NewServerMutualTLSConfig(
+		s.grpc.CertFile,
+		s.grpc.KeyFile,
+		s.grpc.CAFile,
+		opts...,
+	)
+	if err != nil {
+		s.log.Fatalf("failed to configure HTTP server TLS: %s", err)
+	}
+
+	return tlsConfig
 }
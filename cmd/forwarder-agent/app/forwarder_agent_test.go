@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
@@ -16,10 +17,13 @@ import (
 	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
 	"code.cloudfoundry.org/loggregator-agent/cmd/forwarder-agent/app"
 	"code.cloudfoundry.org/loggregator-agent/internal/testhelper"
+	"code.cloudfoundry.org/loggregator-agent/pkg/metrics"
 	"code.cloudfoundry.org/loggregator-agent/pkg/plumbing"
 	"github.com/gogo/protobuf/proto"
 	"github.com/onsi/gomega/gexec"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -29,6 +33,22 @@ const forwardConfigTemplate = `---
 ingress: %s
 `
 
+const otlpForwardConfigTemplate = `---
+type: otlp
+port: %s
+tls:
+  server_name: example.com
+  ca_file: %s
+`
+
+const remoteForwardConfigTemplate = `---
+host: 127.0.0.1
+port: %s
+tls:
+  server_name: example.com
+  ca_file: %s
+`
+
 var (
 	fConfigDir string
 )
@@ -87,8 +107,9 @@ var _ = Describe("Main", func() {
 				CertFile: testhelper.Cert("metron.crt"),
 				KeyFile:  testhelper.Cert("metron.key"),
 			},
-			DownstreamIngressPortCfg: fmt.Sprintf("%s/*/ingress_port.yml", fConfigDir),
-			DebugPort:                7392,
+			DownstreamIngressPortCfg:          fmt.Sprintf("%s/*/ingress_port.yml", fConfigDir),
+			DownstreamIngressPortPollInterval: 10 * time.Millisecond,
+			DebugPort:                         7392,
 			Tags: map[string]string{
 				"some-tag": "some-value",
 			},
@@ -121,6 +142,115 @@ var _ = Describe("Main", func() {
 		Expect(m.Opts.ConstLabels).To(HaveKeyWithValue("direction", "ingress"))
 	})
 
+	It("flushes buffered envelopes downstream on stop", func() {
+		downstream1 := startSpyLoggregatorV2Ingress()
+		cfg.DebugPort = 7397
+
+		forwarderAgent = app.NewForwarderAgent(cfg, mc, testLogger)
+		go forwarderAgent.Run()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var wg sync.WaitGroup
+		wg.Add(1)
+		emitEnvelopes(ctx, 10*time.Millisecond, &wg)
+		Eventually(downstream1.envelopes, 5).Should(Receive())
+		cancel()
+		wg.Wait()
+
+		debugAddr := fmt.Sprintf("127.0.0.1:%d", cfg.DebugPort)
+		Eventually(func() error {
+			conn, err := net.Dial("tcp", debugAddr)
+			if err == nil {
+				conn.Close()
+			}
+			return err
+		}).Should(Succeed())
+
+		stopCtx, stopCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer stopCancel()
+		forwarderAgent.Stop(stopCtx)
+
+		_, err := net.Dial("tcp", debugAddr)
+		Expect(err).To(HaveOccurred())
+		Expect(mc.GetMetric("shutdown_lost", nil).Value()).To(BeZero())
+		Expect(func() { forwarderAgent.Stop(stopCtx) }).ToNot(Panic())
+	})
+
+	It("has metrics for each destination", func() {
+		downstream1 := startSpyLoggregatorV2Ingress()
+
+		forwarderAgent = app.NewForwarderAgent(cfg, mc, testLogger)
+		go forwarderAgent.Run()
+
+		_, port, err := net.SplitHostPort(downstream1.addr)
+		Expect(err).ToNot(HaveOccurred())
+
+		tags := map[string]string{"destination": "127.0.0.1:" + port}
+		Eventually(func() bool {
+			return mc.HasMetric("downstream_egress", tags) &&
+				mc.HasMetric("downstream_dropped", tags) &&
+				mc.HasMetric("downstream_queue_depth", tags) &&
+				mc.HasMetric("downstream_connected", tags)
+		}).Should(BeTrue())
+	})
+
+	It("reports failing destinations on the debug port", func() {
+		createForwarderPortConfigFile("1")
+		cfg.DownstreamFailureThreshold = 0
+		cfg.DebugPort = 7393
+
+		forwarderAgent = app.NewForwarderAgent(cfg, mc, testLogger)
+		go forwarderAgent.Run()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var wg sync.WaitGroup
+		defer wg.Wait()
+		defer cancel()
+
+		wg.Add(1)
+		emitEnvelopes(ctx, 10*time.Millisecond, &wg)
+
+		Eventually(func() (string, error) {
+			resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/downstream/health", cfg.DebugPort))
+			if err != nil {
+				return "", err
+			}
+			defer resp.Body.Close()
+
+			body, err := ioutil.ReadAll(resp.Body)
+			return string(body), err
+		}, 5).Should(ContainSubstring(`"destination":"127.0.0.1:1"`))
+
+		resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/ready", cfg.DebugPort))
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+
+		body, err := ioutil.ReadAll(resp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(body)).To(ContainSubstring(`"downstream":{"ready":false,"error":"failing destinations: 127.0.0.1:1"}`))
+	})
+
+	It("serves prometheus metrics on the debug port", func() {
+		http.DefaultServeMux = new(http.ServeMux)
+		m := metrics.NewPromRegistry("forwarder_agent", testLogger)
+		cfg.DebugPort = 7395
+
+		forwarderAgent = app.NewForwarderAgent(cfg, m, testLogger)
+		go forwarderAgent.Run()
+
+		Eventually(func() (string, error) {
+			resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/metrics", cfg.DebugPort))
+			if err != nil {
+				return "", err
+			}
+			defer resp.Body.Close()
+
+			body, err := ioutil.ReadAll(resp.Body)
+			return string(body), err
+		}).Should(ContainSubstring("queue_depth"))
+	})
+
 	It("forwards all envelopes downstream", func() {
 		downstream1 := startSpyLoggregatorV2Ingress()
 		downstream2 := startSpyLoggregatorV2Ingress()
@@ -144,6 +274,65 @@ var _ = Describe("Main", func() {
 		Expect(proto.Equal(e2, sampleEnvelope)).To(BeTrue())
 	})
 
+	It("forwards envelopes to consumers added after start", func() {
+		forwarderAgent = app.NewForwarderAgent(cfg, mc, testLogger)
+		go forwarderAgent.Run()
+
+		downstream1 := startSpyLoggregatorV2Ingress()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var wg sync.WaitGroup
+		defer wg.Wait()
+		defer cancel()
+
+		wg.Add(1)
+		emitEnvelopes(ctx, 10*time.Millisecond, &wg)
+
+		var e *loggregator_v2.Envelope
+		Eventually(downstream1.envelopes, 5).Should(Receive(&e))
+		Expect(proto.Equal(e, sampleEnvelope)).To(BeTrue())
+	})
+
+	It("forwards envelopes to remote consumers with their own credentials", func() {
+		downstream1 := startRemoteSpyLoggregatorV2Ingress()
+
+		forwarderAgent = app.NewForwarderAgent(cfg, mc, testLogger)
+		go forwarderAgent.Run()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var wg sync.WaitGroup
+		defer wg.Wait()
+		defer cancel()
+
+		wg.Add(1)
+		emitEnvelopes(ctx, 10*time.Millisecond, &wg)
+
+		var e *loggregator_v2.Envelope
+		Eventually(downstream1.envelopes, 5).Should(Receive(&e))
+		Expect(proto.Equal(e, sampleEnvelope)).To(BeTrue())
+	})
+
+	It("exports envelopes to OTLP consumers", func() {
+		receiver := startSpyOTLPReceiver()
+
+		forwarderAgent = app.NewForwarderAgent(cfg, mc, testLogger)
+		go forwarderAgent.Run()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var wg sync.WaitGroup
+		defer wg.Wait()
+		defer cancel()
+
+		wg.Add(1)
+		emitEnvelopes(ctx, 10*time.Millisecond, &wg)
+
+		var req *collogspb.ExportLogsServiceRequest
+		Eventually(receiver.requests, 5).Should(Receive(&req))
+
+		record := req.ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+		Expect(record.Body.GetStringValue()).To(Equal("hello"))
+	})
+
 	It("aggregates counter events before forwarding downstream", func() {
 		downstream1 := startSpyLoggregatorV2Ingress()
 
@@ -253,15 +442,40 @@ func newIngressClient(port int) *loggregator.IngressClient {
 }
 
 func startSpyLoggregatorV2Ingress() *spyLoggregatorV2Ingress {
-	s := &spyLoggregatorV2Ingress{
-		envelopes: make(chan *loggregator_v2.Envelope, 10000),
-	}
-
 	serverCreds, err := plumbing.NewServerCredentials(
 		testhelper.Cert("metron.crt"),
 		testhelper.Cert("metron.key"),
 		testhelper.Cert("loggregator-ca.crt"),
 	)
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+
+	return startSpyLoggregatorV2IngressWithCreds(serverCreds, func(port string) {
+		createForwarderPortConfigFile(port)
+	})
+}
+
+// startRemoteSpyLoggregatorV2Ingress starts a spy with its own certificate.
+// Its port file sets the host and the TLS config needed to reach it.
+func startRemoteSpyLoggregatorV2Ingress() *spyLoggregatorV2Ingress {
+	certFile := testhelper.Cert("localhost.crt")
+	serverCreds, err := credentials.NewServerTLSFromFile(
+		certFile,
+		testhelper.Cert("localhost.key"),
+	)
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+
+	return startSpyLoggregatorV2IngressWithCreds(serverCreds, func(port string) {
+		createForwarderConfigFile(fmt.Sprintf(remoteForwardConfigTemplate, port, certFile))
+	})
+}
+
+func startSpyLoggregatorV2IngressWithCreds(
+	serverCreds credentials.TransportCredentials,
+	writePortFile func(port string),
+) *spyLoggregatorV2Ingress {
+	s := &spyLoggregatorV2Ingress{
+		envelopes: make(chan *loggregator_v2.Envelope, 10000),
+	}
 
 	lis, err := net.Listen("tcp", ":0")
 	ExpectWithOffset(1, err).ToNot(HaveOccurred())
@@ -275,12 +489,48 @@ func startSpyLoggregatorV2Ingress() *spyLoggregatorV2Ingress {
 	s.addr = lis.Addr().String()
 	port := strings.Split(s.addr, ":")
 
-	createForwarderPortConfigFile(port[len(port)-1])
+	writePortFile(port[len(port)-1])
 	go grpcServer.Serve(lis)
 
 	return s
 }
 
+type spyOTLPReceiver struct {
+	collogspb.UnimplementedLogsServiceServer
+
+	requests chan *collogspb.ExportLogsServiceRequest
+}
+
+func startSpyOTLPReceiver() *spyOTLPReceiver {
+	certFile := testhelper.Cert("localhost.crt")
+	serverCreds, err := credentials.NewServerTLSFromFile(
+		certFile,
+		testhelper.Cert("localhost.key"),
+	)
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+
+	s := &spyOTLPReceiver{
+		requests: make(chan *collogspb.ExportLogsServiceRequest, 100),
+	}
+	grpcServer := grpc.NewServer(grpc.Creds(serverCreds))
+	collogspb.RegisterLogsServiceServer(grpcServer, s)
+
+	_, port, err := net.SplitHostPort(lis.Addr().String())
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	createForwarderConfigFile(fmt.Sprintf(otlpForwardConfigTemplate, port, certFile))
+	go grpcServer.Serve(lis)
+
+	return s
+}
+
+func (s *spyOTLPReceiver) Export(_ context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	s.requests <- req
+	return &collogspb.ExportLogsServiceResponse{}, nil
+}
+
 type spyLoggregatorV2Ingress struct {
 	addr      string
 	close     func()
@@ -370,6 +620,10 @@ func forwarderPortConfigDir() string {
 }
 
 func createForwarderPortConfigFile(port string) {
+	createForwarderConfigFile(fmt.Sprintf(forwardConfigTemplate, port))
+}
+
+func createForwarderConfigFile(contents string) {
 	fDir, err := ioutil.TempDir(fConfigDir, "")
 	if err != nil {
 		log.Fatal(err)
@@ -379,7 +633,6 @@ func createForwarderPortConfigFile(port string) {
 	tmpfn, err = filepath.Abs(tmpfn)
 	Expect(err).ToNot(HaveOccurred())
 
-	contents := fmt.Sprintf(forwardConfigTemplate, port)
 	if err := ioutil.WriteFile(tmpfn, []byte(contents), 0666); err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1,127 @@
+package app
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/pkg/downstream"
+	"code.cloudfoundry.org/loggregator-agent/pkg/egress/otlp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+const (
+	otlpBatchSize     = 100
+	otlpFlushInterval = time.Second
+)
+
+// otlpWriter batches envelopes and exports them to an OTLP receiver. A
+// batch is exported when it is full or when the flush interval lapses.
+type otlpWriter struct {
+	conn     *grpc.ClientConn
+	exporter *otlp.Exporter
+	m        *destinationMetrics
+	state    *downstream.ConnectionState
+	log      *log.Logger
+
+	mu    sync.Mutex
+	batch []*loggregator_v2.Envelope
+	done  chan struct{}
+}
+
+func newOTLPWriter(
+	addr string,
+	clientCreds *tls.Config,
+	dm *destinationMetrics,
+	state *downstream.ConnectionState,
+	l *log.Logger,
+) (*otlpWriter, error) {
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(credentials.NewTLS(clientCreds)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP client for %s: %s", addr, err)
+	}
+
+	w := &otlpWriter{
+		conn:     conn,
+		exporter: otlp.NewExporter(conn),
+		m:        dm,
+		state:    state,
+		log:      l,
+		done:     make(chan struct{}),
+	}
+	go w.flushLoop()
+
+	return w, nil
+}
+
+func (w *otlpWriter) Write(e *loggregator_v2.Envelope) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.batch = append(w.batch, e)
+	if len(w.batch) < otlpBatchSize {
+		return nil
+	}
+
+	return w.flush()
+}
+
+// Close exports the remaining envelopes and closes the connection.
+func (w *otlpWriter) Close() error {
+	close(w.done)
+
+	w.mu.Lock()
+	w.flush()
+	w.mu.Unlock()
+
+	return w.conn.Close()
+}
+
+func (w *otlpWriter) flushLoop() {
+	t := time.NewTicker(otlpFlushInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-t.C:
+			w.mu.Lock()
+			w.flush()
+			w.mu.Unlock()
+		}
+	}
+}
+
+// flush exports the batch. It must be called with the lock held.
+func (w *otlpWriter) flush() error {
+	if len(w.batch) == 0 {
+		return nil
+	}
+
+	batch := w.batch
+	w.batch = nil
+
+	err := w.exporter.Write(batch)
+	if err != nil {
+		failed := len(batch)
+		if exportErr, ok := err.(*otlp.ExportError); ok {
+			failed = exportErr.Failed
+		}
+
+		w.state.Failed(err)
+		w.m.drops.Add(float64(failed))
+		w.m.egress.Add(float64(len(batch) - failed))
+		w.log.Printf("Error while exporting: %s", err)
+		return err
+	}
+
+	w.state.Succeeded()
+	w.m.egress.Add(float64(len(batch)))
+
+	return nil
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"code.cloudfoundry.org/loggregator-agent/cmd/forwarder-agent/app"
 	"code.cloudfoundry.org/loggregator-agent/pkg/metrics"
@@ -25,9 +28,18 @@ func main() {
 		metrics.WithDefaultTags(dt),
 	)
 
-	app.NewForwarderAgent(
+	a := app.NewForwarderAgent(
 		cfg,
 		metrics,
 		logger,
-	).Run()
+	)
+	go a.Run()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	<-signals
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	a.Stop(ctx)
 }
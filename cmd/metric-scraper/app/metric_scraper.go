@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/loggregator-agent/pkg/health"
 	"code.cloudfoundry.org/loggregator-agent/pkg/plumbing"
 	"code.cloudfoundry.org/loggregator-agent/pkg/scraper"
 )
@@ -19,6 +20,7 @@ type MetricScraper struct {
 	doneChan    chan struct{}
 	stoppedChan chan struct{}
 	metrics     metricsClient
+	scrapes     *health.Freshness
 }
 
 type metricsClient interface {
@@ -34,6 +36,7 @@ func NewMetricScraper(cfg Config, l *log.Logger, m metricsClient) *MetricScraper
 		doneChan:    make(chan struct{}),
 		metrics:     m,
 		stoppedChan: make(chan struct{}),
+		scrapes:     health.NewFreshness(3 * cfg.ScrapeInterval),
 	}
 }
 
@@ -79,12 +82,17 @@ func (m *MetricScraper) scrape() {
 		case <-t.C:
 			resp, err := leadershipClient.Get(m.cfg.LeadershipServerAddr)
 			if err == nil && resp.StatusCode == http.StatusLocked {
+				// Another instance is scraping, so there is nothing to
+				// fail.
+				m.scrapes.Record(nil)
 				continue
 			}
 
-			if err := s.Scrape(); err != nil {
+			err = s.Scrape()
+			if err != nil {
 				m.log.Printf("failed to scrape: %s", err)
 			}
+			m.scrapes.Record(err)
 
 			numScrapes.Add(1.0)
 		case <-m.doneChan:
@@ -94,6 +102,11 @@ func (m *MetricScraper) scrape() {
 	}
 }
 
+// Ready returns an error unless the last scrape succeeded recently.
+func (m *MetricScraper) Ready() error {
+	return m.scrapes.Check()
+}
+
 func (m *MetricScraper) Stop() {
 	close(m.doneChan)
 	<-m.stoppedChan
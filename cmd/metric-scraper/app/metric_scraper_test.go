@@ -90,6 +90,25 @@ var _ = Describe("App", func() {
 			))
 		})
 
+		It("is ready once a scrape succeeds", func() {
+			scraper = app.NewMetricScraper(cfg, testLogger, spyMetricsClient)
+			Expect(scraper.Ready()).To(HaveOccurred())
+
+			go scraper.Run()
+
+			Eventually(scraper.Ready).Should(Succeed())
+		})
+
+		It("is not ready when scrapes fail", func() {
+			promServer.stop()
+			cfg.ScrapeTimeout = 50 * time.Millisecond
+
+			scraper = app.NewMetricScraper(cfg, testLogger, spyMetricsClient)
+			go scraper.Run()
+
+			Consistently(scraper.Ready, 500*time.Millisecond).Should(HaveOccurred())
+		})
+
 		It("does not scrape when leadership server returns 423", func() {
 			leadership.setReturnCode(http.StatusLocked)
 
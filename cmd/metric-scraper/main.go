@@ -3,9 +3,11 @@ package main
 import (
 	"code.cloudfoundry.org/loggregator-agent/pkg/metrics"
 	"log"
+	"net/http"
 	"os"
 
 	"code.cloudfoundry.org/loggregator-agent/cmd/metric-scraper/app"
+	"code.cloudfoundry.org/loggregator-agent/pkg/health"
 )
 
 func main() {
@@ -25,5 +27,12 @@ func main() {
 		metrics.WithServer(cfg.DebugPort),
 	)
 
-	app.NewMetricScraper(cfg, log, metricClient).Run()
+	s := app.NewMetricScraper(cfg, log, metricClient)
+
+	// The metrics server serves the default mux.
+	h := health.NewHandler()
+	h.Add("scrape", s.Ready)
+	h.Register(http.DefaultServeMux)
+
+	s.Run()
 }
@@ -17,6 +17,10 @@ type Config struct {
 	DefaultSourceID        string        `env:"DEFAULT_SOURCE_ID, report, required"`
 	MetricPortCfg          string        `env:"METRIC_PORT_GLOB, report"`
 	ScrapeInterval         time.Duration `env:"SCRAPE_INTERVAL, report"`
+
+	// DebugPort serves the health and readiness endpoints on localhost
+	// when set.
+	DebugPort uint16 `env:"DEBUG_PORT, report"`
 }
 
 func LoadConfig(log *log.Logger) Config {
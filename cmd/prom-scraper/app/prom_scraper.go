@@ -9,23 +9,30 @@ import (
 	"time"
 
 	"code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/loggregator-agent/pkg/health"
 	"code.cloudfoundry.org/loggregator-agent/pkg/scraper"
 	"gopkg.in/yaml.v2"
 )
 
 type PromScraper struct {
-	cfg Config
-	log *log.Logger
+	cfg     Config
+	log     *log.Logger
+	scrapes *health.Freshness
 }
 
 func NewPromScraper(cfg Config, log *log.Logger) *PromScraper {
 	return &PromScraper{
-		cfg: cfg,
-		log: log,
+		cfg:     cfg,
+		log:     log,
+		scrapes: health.NewFreshness(3 * cfg.ScrapeInterval),
 	}
 }
 
 func (p *PromScraper) Run() {
+	if p.cfg.DebugPort != 0 {
+		go p.startDebugServer()
+	}
+
 	creds, err := loggregator.NewIngressTLSConfig(
 		p.cfg.CACertPath,
 		p.cfg.ClientCertPath,
@@ -56,12 +63,29 @@ func (p *PromScraper) Run() {
 	)
 
 	for range time.Tick(p.cfg.ScrapeInterval) {
-		if err := s.Scrape(); err != nil {
+		err := s.Scrape()
+		if err != nil {
 			p.log.Printf("failed to scrape: %s", err)
 		}
+		p.scrapes.Record(err)
 	}
 }
 
+// Ready returns an error unless the last scrape succeeded recently.
+func (p *PromScraper) Ready() error {
+	return p.scrapes.Check()
+}
+
+func (p *PromScraper) startDebugServer() {
+	mux := http.NewServeMux()
+	h := health.NewHandler()
+	h.Add("scrape", p.Ready)
+	h.Register(mux)
+
+	addr := fmt.Sprintf("127.0.0.1:%d", p.cfg.DebugPort)
+	p.log.Printf("debug server closing: %s", http.ListenAndServe(addr, mux))
+}
+
 type portConfig struct {
 	Metric string `yaml:"port"`
 }
@@ -67,6 +67,48 @@ var _ = Describe("PromScraper", func() {
 		})
 	})
 
+	Describe("when there is a debug port", func() {
+		var metricConfigDir = metricPortConfigDir()
+
+		BeforeEach(func() {
+			spyAgent = newSpyAgent()
+			startPromServer(metricConfigDir, promOutput)
+
+			cfg = app.Config{
+				ClientKeyPath:          testhelper.Cert("metron.key"),
+				ClientCertPath:         testhelper.Cert("metron.crt"),
+				CACertPath:             testhelper.Cert("loggregator-ca.crt"),
+				LoggregatorIngressAddr: spyAgent.addr,
+				DefaultSourceID:        "some-id",
+				MetricPortCfg:          fmt.Sprintf("%s/*/metric_port.yml", metricConfigDir),
+				ScrapeInterval:         100 * time.Millisecond,
+				DebugPort:              7395,
+			}
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(metricConfigDir)
+			gexec.CleanupBuildArtifacts()
+		})
+
+		It("is ready once a scrape succeeds", func() {
+			ps := app.NewPromScraper(cfg, testLogger)
+			Expect(ps.Ready()).To(HaveOccurred())
+
+			go ps.Run()
+
+			Eventually(func() (int, error) {
+				resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/ready", cfg.DebugPort))
+				if err != nil {
+					return 0, err
+				}
+				defer resp.Body.Close()
+
+				return resp.StatusCode, nil
+			}).Should(Equal(http.StatusOK))
+		})
+	})
+
 	Describe("when there are multiple metric_port config files", func() {
 		var metricConfigDir = metricPortConfigDir()
 
@@ -1,11 +1,13 @@
 package app
 
 import (
-	"code.cloudfoundry.org/loggregator-agent/pkg/ingress/cups"
 	"fmt"
 	"time"
 
 	"code.cloudfoundry.org/go-envstruct"
+	"code.cloudfoundry.org/loggregator-agent/pkg/binding"
+	"code.cloudfoundry.org/loggregator-agent/pkg/ingress/cups"
+	"code.cloudfoundry.org/loggregator-agent/pkg/ingress/v2"
 )
 
 // GRPC stores the configuration for the router as a server using a PORT
@@ -16,6 +18,18 @@ type GRPC struct {
 	CertFile     string   `env:"AGENT_CERT_FILE_PATH, required, report"`
 	KeyFile      string   `env:"AGENT_KEY_FILE_PATH, required, report"`
 	CipherSuites []string `env:"AGENT_CIPHER_SUITES, report"`
+
+	// UnixSocketPath additionally serves the ingress on a Unix socket when
+	// set. Its access is controlled by UnixSocketMode and the source IDs
+	// of each peer user ID by UnixSocketSourceIDs.
+	UnixSocketPath      string           `env:"AGENT_UNIX_SOCKET_PATH, report"`
+	UnixSocketMode      v2.SocketMode    `env:"AGENT_UNIX_SOCKET_MODE, report"`
+	UnixSocketSourceIDs v2.PeerSourceIDs `env:"AGENT_UNIX_SOCKET_SOURCE_IDS, report"`
+
+	// CertSourceIDs maps client certificate identities to the source IDs
+	// they may send. It is not enforced when empty.
+	CertSourceIDs  v2.CertSourceIDs  `env:"AGENT_CERT_SOURCE_IDS, report"`
+	CertPolicyMode v2.CertPolicyMode `env:"AGENT_CERT_POLICY_MODE, report"`
 }
 
 type Cache struct {
@@ -34,7 +48,44 @@ type Config struct {
 	DrainSkipCertVerify bool          `env:"DRAIN_SKIP_CERT_VERIFY,   report"`
 	IdleDrainTimeout    time.Duration `env:"IDLE_DRAIN_TIMEOUT, report"`
 
-	DebugPort   uint16 `env:"DEBUG_PORT, report"`
+	// BindingsPerAppLimitOverrides overrides BindingsPerAppLimit for
+	// individual apps.
+	BindingsPerAppLimitOverrides cups.AppLimits `env:"BINDING_PER_APP_LIMIT_OVERRIDES, report"`
+
+	// DrainLimit is the maximum number of drains across all apps. There is
+	// no limit when it is zero.
+	DrainLimit int `env:"DRAIN_LIMIT, report"`
+
+	// EagerDrainConnect connects drains as soon as bindings arrive instead
+	// of on the first envelope for an app.
+	EagerDrainConnect bool `env:"EAGER_DRAIN_CONNECT, report"`
+
+	// DrainHealthProbeInterval is the interval at which connected drains are
+	// probed. Probing is disabled when it is zero.
+	DrainHealthProbeInterval time.Duration `env:"DRAIN_HEALTH_PROBE_INTERVAL, report"`
+
+	// LoggregatorIngressAddr is the address of the Loggregator Agent. When
+	// set, drain errors and health are reported to the app's log stream.
+	LoggregatorIngressAddr string `env:"LOGGREGATOR_AGENT_ADDR, report"`
+	InstanceIndex          string `env:"INSTANCE_INDEX, report"`
+
+	// AggregateDrains are drains that receive envelopes from every source
+	// ID, not only from the apps bound to them.
+	AggregateDrains binding.AggregateDrains `env:"AGGREGATE_DRAIN_URLS"`
+
+	DebugPort uint16 `env:"DEBUG_PORT, report"`
+
+	// PriorityBuffer drops metrics before logs when drains can not keep
+	// up with ingress.
+	PriorityBuffer bool `env:"PRIORITY_BUFFER, report"`
+
+	// AdminToken enables the drain admin API on the debug port. Requests
+	// must carry it as a bearer token.
+	AdminToken string `env:"ADMIN_TOKEN"`
+
+	// ShutdownTimeout is how long buffered envelopes are written to drains
+	// after a SIGTERM before they are dropped.
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT, report"`
 
 	GRPC  GRPC
 	Cache Cache
@@ -47,12 +98,15 @@ func LoadConfig() Config {
 	cfg := Config{
 		BindingsPerAppLimit: 5,
 		IdleDrainTimeout:    10 * time.Minute,
+		ShutdownTimeout:     10 * time.Second,
 
 		Cache: Cache{
 			PollingInterval: 1 * time.Minute,
 		},
 		GRPC: GRPC{
-			Port: 3458,
+			Port:           3458,
+			UnixSocketMode: 0660,
+			CertPolicyMode: v2.CertPolicyReject,
 		},
 	}
 	if err := envstruct.Load(&cfg); err != nil {
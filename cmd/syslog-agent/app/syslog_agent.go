@@ -2,19 +2,24 @@ package app
 
 import (
 	"code.cloudfoundry.org/loggregator-agent/pkg/metrics"
+	"context"
 	"fmt"
 	"log"
+	"os"
+	"sync"
 	"time"
 
 	"net/http"
 	_ "net/http/pprof"
 
 	gendiodes "code.cloudfoundry.org/go-diodes"
+	"code.cloudfoundry.org/go-loggregator"
 	"code.cloudfoundry.org/loggregator-agent/pkg/binding"
 	"code.cloudfoundry.org/loggregator-agent/pkg/cache"
 	"code.cloudfoundry.org/loggregator-agent/pkg/diodes"
 	"code.cloudfoundry.org/loggregator-agent/pkg/egress"
 	"code.cloudfoundry.org/loggregator-agent/pkg/egress/syslog"
+	"code.cloudfoundry.org/loggregator-agent/pkg/health"
 	"code.cloudfoundry.org/loggregator-agent/pkg/ingress/cups"
 	"code.cloudfoundry.org/loggregator-agent/pkg/ingress/v2"
 	"code.cloudfoundry.org/loggregator-agent/pkg/plumbing"
@@ -27,21 +32,44 @@ type SyslogAgent struct {
 	pprofPort           uint16
 	metrics             Metrics
 	bindingManager      BindingManager
+	adminHandler        http.Handler
 	grpc                GRPC
 	log                 *log.Logger
 	cache               Cache
 	bindingsPerAppLimit int
 	drainSkipCertVerify bool
+	priorityBuffer      bool
+	drainOccupancy      *diodes.Occupancy
+	drainWG             *timeoutwaitgroup.TimeoutWaitGroup
+	bindingFreshness    *health.Freshness
+
+	mu               sync.Mutex
+	stopped          bool
+	debugServer      *http.Server
+	ingresses        []stopper
+	reporter         *diodes.OccupancyReporter
+	ingressOccupancy *diodes.Occupancy
+	lost             metrics.Counter
+	stop             chan struct{}
+	stopOnce         sync.Once
+	writerDone       chan struct{}
+}
+
+// stopper is an ingress server that can be stopped.
+type stopper interface {
+	Stop()
 }
 
 type Metrics interface {
 	NewGauge(name string, options ...metrics.MetricOption) metrics.Gauge
 	NewCounter(name string, options ...metrics.MetricOption) metrics.Counter
+	RemoveGauge(metrics.Gauge)
 }
 
 type BindingManager interface {
 	Run()
 	GetDrains(string) []egress.Writer
+	Close()
 }
 
 // NewSyslogAgent intializes and returns a new syslog agent.
@@ -50,6 +78,23 @@ func NewSyslogAgent(
 	m Metrics,
 	l *log.Logger,
 ) *SyslogAgent {
+	drainOccupancy := diodes.NewOccupancy()
+	drainWG := timeoutwaitgroup.New(time.Minute)
+	var (
+		connectorOpts = []syslog.ConnectorOption{
+			syslog.WithOccupancy(drainOccupancy),
+		}
+		fetcherOpts = []cups.BindingFetcherOption{
+			cups.WithAppLimits(cfg.BindingsPerAppLimitOverrides.Limits),
+			cups.WithMaxDrains(cfg.DrainLimit),
+		}
+	)
+	if cfg.LoggregatorIngressAddr != "" {
+		lc := logClient(cfg, l)
+		connectorOpts = append(connectorOpts, syslog.WithLogClient(lc, cfg.InstanceIndex))
+		fetcherOpts = append(fetcherOpts, cups.WithLogClient(lc, cfg.InstanceIndex))
+	}
+
 	connector := syslog.NewSyslogConnector(
 		syslog.NetworkTimeoutConfig{
 			Keepalive:    10 * time.Second,
@@ -57,9 +102,10 @@ func NewSyslogAgent(
 			WriteTimeout: 10 * time.Second,
 		},
 		cfg.DrainSkipCertVerify,
-		timeoutwaitgroup.New(time.Minute),
+		drainWG,
 		syslog.NewWriterFactory(m),
 		m,
+		connectorOpts...,
 	)
 
 	tlsClient := plumbing.NewTLSHTTPClient(
@@ -71,54 +117,152 @@ func NewSyslogAgent(
 	cacheClient := cache.NewClient(cfg.Cache.URL, tlsClient)
 	fetcher := cups.NewFilteredBindingFetcher(
 		&cfg.Cache.Blacklist,
-		cups.NewBindingFetcher(cfg.BindingsPerAppLimit, cacheClient, m),
+		cups.NewBindingFetcher(cfg.BindingsPerAppLimit, cacheClient, m, fetcherOpts...),
 		m,
 		l,
 	)
+	managerOpts := []binding.ManagerOption{
+		binding.WithAggregateDrains(cfg.AggregateDrains.Drains),
+	}
+	if cfg.EagerDrainConnect {
+		managerOpts = append(managerOpts, binding.WithEagerConnect())
+	}
+	if cfg.DrainHealthProbeInterval > 0 {
+		managerOpts = append(managerOpts, binding.WithHealthProbes(connector, cfg.DrainHealthProbeInterval))
+	}
+
+	// Bindings are fetched once per polling interval plus a random offset
+	// of up to one interval.
+	bindingFreshness := health.NewFreshness(3 * cfg.Cache.PollingInterval)
 	bindingManager := binding.NewManager(
-		fetcher,
+		freshnessFetcher{Fetcher: fetcher, freshness: bindingFreshness},
 		connector,
 		m,
 		cfg.Cache.PollingInterval,
 		cfg.IdleDrainTimeout,
 		l,
+		managerOpts...,
 	)
 
+	var adminHandler http.Handler
+	if cfg.AdminToken != "" {
+		adminHandler = binding.NewAdminHandler(bindingManager, cfg.AdminToken)
+	}
+
 	return &SyslogAgent{
+		adminHandler:        adminHandler,
 		pprofPort:           cfg.DebugPort,
 		grpc:                cfg.GRPC,
 		metrics:             m,
 		log:                 l,
 		bindingsPerAppLimit: cfg.BindingsPerAppLimit,
 		drainSkipCertVerify: cfg.DrainSkipCertVerify,
+		priorityBuffer:      cfg.PriorityBuffer,
+		drainOccupancy:      drainOccupancy,
+		drainWG:             drainWG,
+		bindingFreshness:    bindingFreshness,
 		bindingManager:      bindingManager,
+		stop:                make(chan struct{}),
+		writerDone:          make(chan struct{}),
 	}
 }
 
-func (s *SyslogAgent) Run() {
-	go http.ListenAndServe(fmt.Sprintf("127.0.0.1:%d", s.pprofPort), nil)
+// freshnessFetcher records the outcome of every fetch so that readiness
+// reflects whether the binding cache is reachable and bindings are recent.
+type freshnessFetcher struct {
+	binding.Fetcher
+	freshness *health.Freshness
+}
 
-	ingressDropped := s.metrics.NewCounter("dropped", metrics.WithMetricTags(map[string]string{"direction": "ingress"}))
-	diode := diodes.NewManyToOneEnvelopeV2(10000, gendiodes.AlertFunc(func(missed int) {
-		ingressDropped.Add(float64(missed))
-	}))
+func (f freshnessFetcher) FetchBindings() ([]syslog.Binding, error) {
+	bindings, err := f.Fetcher.FetchBindings()
+	f.freshness.Record(err)
 
-	drainIngress := s.metrics.NewCounter("ingress", metrics.WithMetricTags(map[string]string{"scope": "all_drains"}))
-	go s.bindingManager.Run()
-	go func() {
-		for {
-			e := diode.Next()
+	return bindings, err
+}
 
-			drainWriters := s.bindingManager.GetDrains(e.SourceId)
-			for _, w := range drainWriters {
-				drainIngress.Add(1)
+func logClient(cfg Config, l *log.Logger) *loggregator.IngressClient {
+	creds, err := loggregator.NewIngressTLSConfig(
+		cfg.GRPC.CAFile,
+		cfg.GRPC.CertFile,
+		cfg.GRPC.KeyFile,
+	)
+	if err != nil {
+		l.Fatalf("failed to configure log client TLS: %s", err)
+	}
 
-				// Ignore this because we typically wrap everything in a diode
-				// writer which doesn't return an error
-				_ = w.Write(e)
-			}
+	client, err := loggregator.NewIngressClient(
+		creds,
+		loggregator.WithAddr(cfg.LoggregatorIngressAddr),
+		loggregator.WithLogger(l),
+	)
+	if err != nil {
+		l.Fatalf("failed to create log client: %s", err)
+	}
+
+	return client
+}
+
+func (s *SyslogAgent) Run() {
+	// pprof and /metrics are registered with the default mux.
+	mux := http.NewServeMux()
+	mux.Handle("/", http.DefaultServeMux)
+	if s.adminHandler != nil {
+		mux.Handle("/admin/", s.adminHandler)
+	}
+	h := health.NewHandler()
+	h.Add("binding_cache", s.bindingFreshness.LastError)
+	h.Add("bindings", s.bindingFreshness.Stale)
+	h.Register(mux)
+	s.startDebugServer(mux)
+
+	// The egress fill level is the total of the diodes of all drains.
+	reporter := diodes.NewOccupancyReporter(15 * time.Second)
+	go reporter.Start()
+
+	ingressTags := metrics.WithMetricTags(map[string]string{"direction": "ingress"})
+	egressTags := metrics.WithMetricTags(map[string]string{"direction": "egress"})
+	ingressOccupancy := diodes.NewOccupancy()
+	reporter.Add(
+		ingressOccupancy,
+		s.metrics.NewGauge("queue_depth", ingressTags),
+		s.metrics.NewGauge("queue_high_water", ingressTags),
+	)
+	reporter.Add(
+		s.drainOccupancy,
+		s.metrics.NewGauge("queue_depth", egressTags),
+		s.metrics.NewGauge("queue_high_water", egressTags),
+	)
+
+	ingressDropped := s.metrics.NewCounter("dropped", ingressTags)
+	var diode diodes.EnvelopeV2Diode
+	if s.priorityBuffer {
+		classDropped := make(map[string]metrics.Counter)
+		for _, c := range diodes.Classes {
+			classDropped[c] = s.metrics.NewCounter("dropped_by_class", metrics.WithMetricTags(map[string]string{"direction": "ingress", "class": c}))
 		}
-	}()
+
+		diode = diodes.NewPriorityEnvelopeV2(10000, ingressOccupancy.ClassAlerter(diodes.ClassAlertFunc(func(class string, missed int) {
+			ingressDropped.Add(float64(missed))
+			classDropped[class].Add(float64(missed))
+		})))
+	} else {
+		diode = diodes.NewManyToOneEnvelopeV2(10000, ingressOccupancy.Alerter(gendiodes.AlertFunc(func(missed int) {
+			ingressDropped.Add(float64(missed))
+		})))
+	}
+	waitable := diodes.NewWaitableEnvelopeV2(diodes.NewTrackedEnvelopeV2(diode, ingressOccupancy))
+	diode = waitable
+
+	s.mu.Lock()
+	s.reporter = reporter
+	s.ingressOccupancy = ingressOccupancy
+	s.lost = s.metrics.NewCounter("shutdown_lost")
+	s.mu.Unlock()
+
+	drainIngress := s.metrics.NewCounter("ingress", metrics.WithMetricTags(map[string]string{"scope": "all_drains"}))
+	go s.bindingManager.Run()
+	go s.writeDrains(waitable, drainIngress)
 
 	var opts []plumbing.ConfigOption
 	if len(s.grpc.CipherSuites) > 0 {
@@ -137,12 +281,147 @@ func (s *SyslogAgent) Run() {
 
 	im := s.metrics.NewCounter("ingress", metrics.WithMetricTags(map[string]string{"scope": "agent"}))
 	omm := s.metrics.NewCounter("origin_mappings")
-	rx := v2.NewReceiver(diode, im, omm)
+	var rxOpts []v2.ReceiverOption
+	if s.grpc.UnixSocketPath != "" {
+		rxOpts = append(rxOpts, v2.WithAuthorizer(
+			v2.NewPeerCredAuthorizer(s.grpc.UnixSocketSourceIDs.Rules),
+			s.metrics.NewCounter("unauthorized_envelopes", metrics.WithMetricTags(map[string]string{"scope": "agent", "policy": "peer_cred"})),
+		))
+	}
+	if len(s.grpc.CertSourceIDs.Rules) > 0 {
+		rxOpts = append(rxOpts, v2.WithAuthorizer(
+			v2.NewCertAuthorizer(
+				s.grpc.CertSourceIDs.Rules,
+				s.grpc.CertPolicyMode,
+				s.metrics.NewCounter("rewritten_source_ids", metrics.WithMetricTags(map[string]string{"scope": "agent"})),
+			),
+			s.metrics.NewCounter("unauthorized_envelopes", metrics.WithMetricTags(map[string]string{"scope": "agent", "policy": "cert"})),
+		))
+	}
+	rx := v2.NewReceiver(diode, im, omm, rxOpts...)
+
+	if s.grpc.UnixSocketPath != "" {
+		unixSrv := v2.NewUnixServer(
+			s.grpc.UnixSocketPath,
+			os.FileMode(s.grpc.UnixSocketMode),
+			rx,
+		)
+		go unixSrv.Start()
+		s.addIngress(unixSrv)
+	}
 
 	srv := v2.NewServer(
 		fmt.Sprintf("127.0.0.1:%d", s.grpc.Port),
 		rx,
 		grpc.Creds(serverCreds),
 	)
+	s.addIngress(srv)
 	srv.Start()
 }
+
+// Stop stops accepting envelopes and writes the buffered envelopes to the
+// drains until the context is done. The envelopes that could not be
+// written are reported as lost. Only the first call has an effect.
+func (s *SyslogAgent) Stop(ctx context.Context) {
+	s.stopOnce.Do(func() {
+		s.shutdown(ctx)
+	})
+}
+
+func (s *SyslogAgent) shutdown(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stopped = true
+	if s.debugServer != nil {
+		// Metrics and health checks are served until the buffers are flushed.
+		defer func() {
+			if err := s.debugServer.Shutdown(ctx); err != nil {
+				s.log.Printf("failed to stop debug server: %s", err)
+			}
+		}()
+	}
+
+	for _, i := range s.ingresses {
+		i.Stop()
+	}
+
+	if s.reporter == nil {
+		return
+	}
+
+	close(s.stop)
+	select {
+	case <-s.writerDone:
+	case <-ctx.Done():
+	}
+
+	s.bindingManager.Close()
+
+	done := make(chan struct{})
+	go func() {
+		s.drainWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		s.log.Printf("failed to flush drains: %s", ctx.Err())
+	}
+
+	lost := s.ingressOccupancy.Fill() + s.drainOccupancy.Fill()
+	s.lost.Add(float64(lost))
+	s.log.Printf("Lost %d envelopes at shutdown", lost)
+
+	s.reporter.Stop()
+}
+
+// writeDrains writes envelopes from the ingress buffer to the drains of
+// their source IDs. Once Stop is called it returns as soon as the buffer is
+// empty.
+func (s *SyslogAgent) writeDrains(diode *diodes.WaitableEnvelopeV2, drainIngress metrics.Counter) {
+	defer close(s.writerDone)
+
+	for {
+		e, ok := diode.NextOrDone(s.stop)
+		if !ok {
+			return
+		}
+
+		drainWriters := s.bindingManager.GetDrains(e.SourceId)
+		for _, w := range drainWriters {
+			drainIngress.Add(1)
+
+			// Ignore this because we typically wrap everything in a diode
+			// writer which doesn't return an error
+			_ = w.Write(e)
+		}
+	}
+}
+
+// startDebugServer serves pprof, metrics and health checks on the debug
+// port until Stop is called.
+func (s *SyslogAgent) startDebugServer(h http.Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return
+	}
+	s.debugServer = &http.Server{
+		Addr:    fmt.Sprintf("127.0.0.1:%d", s.pprofPort),
+		Handler: h,
+	}
+	go s.debugServer.ListenAndServe()
+}
+
+func (s *SyslogAgent) addIngress(i stopper) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		i.Stop()
+		return
+	}
+	s.ingresses = append(s.ingresses, i)
+}
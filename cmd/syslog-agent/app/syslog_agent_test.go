@@ -24,6 +24,7 @@ import (
 	"code.cloudfoundry.org/loggregator-agent/cmd/syslog-agent/app"
 	"code.cloudfoundry.org/loggregator-agent/internal/testhelper"
 	"code.cloudfoundry.org/loggregator-agent/pkg/binding"
+	"code.cloudfoundry.org/loggregator-agent/pkg/metrics"
 	"code.cloudfoundry.org/loggregator-agent/pkg/plumbing"
 	"code.cloudfoundry.org/rfc5424"
 )
@@ -110,6 +111,132 @@ var _ = Describe("SyslogAgent", func() {
 		Eventually(hasMetric(mc, "egress", nil)).Should(BeTrue())
 	})
 
+	It("is ready once bindings are fetched", func() {
+		mc := testhelper.NewMetricClient()
+		cfg := app.Config{
+			BindingsPerAppLimit: 5,
+			DebugPort:           7394,
+			IdleDrainTimeout:    10 * time.Minute,
+			Cache: app.Cache{
+				URL:             cupsProvider.URL,
+				CAFile:          testhelper.Cert("binding-cache-ca.crt"),
+				CertFile:        testhelper.Cert("binding-cache-ca.crt"),
+				KeyFile:         testhelper.Cert("binding-cache-ca.key"),
+				CommonName:      "bindingCacheCA",
+				PollingInterval: 10 * time.Millisecond,
+			},
+			GRPC: app.GRPC{
+				Port:     grpcPort,
+				CAFile:   testhelper.Cert("loggregator-ca.crt"),
+				CertFile: testhelper.Cert("metron.crt"),
+				KeyFile:  testhelper.Cert("metron.key"),
+			},
+		}
+		go app.NewSyslogAgent(cfg, mc, testLogger).Run()
+
+		var body string
+		Eventually(func() (int, error) {
+			resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/ready", cfg.DebugPort))
+			if err != nil {
+				return 0, err
+			}
+			defer resp.Body.Close()
+
+			b, err := ioutil.ReadAll(resp.Body)
+			body = string(b)
+			return resp.StatusCode, err
+		}).Should(Equal(http.StatusOK))
+
+		Expect(body).To(ContainSubstring(`"binding_cache":{"ready":true}`))
+		Expect(body).To(ContainSubstring(`"bindings":{"ready":true}`))
+	})
+
+	It("serves prometheus metrics on the debug port", func() {
+		http.DefaultServeMux = new(http.ServeMux)
+		m := metrics.NewPromRegistry("syslog_agent", testLogger)
+		cfg := app.Config{
+			BindingsPerAppLimit: 5,
+			DebugPort:           7396,
+			IdleDrainTimeout:    10 * time.Minute,
+			Cache: app.Cache{
+				URL:             cupsProvider.URL,
+				CAFile:          testhelper.Cert("binding-cache-ca.crt"),
+				CertFile:        testhelper.Cert("binding-cache-ca.crt"),
+				KeyFile:         testhelper.Cert("binding-cache-ca.key"),
+				CommonName:      "bindingCacheCA",
+				PollingInterval: 10 * time.Millisecond,
+			},
+			GRPC: app.GRPC{
+				Port:     grpcPort,
+				CAFile:   testhelper.Cert("loggregator-ca.crt"),
+				CertFile: testhelper.Cert("metron.crt"),
+				KeyFile:  testhelper.Cert("metron.key"),
+			},
+		}
+		agent := app.NewSyslogAgent(cfg, m, testLogger)
+		go agent.Run()
+		defer agent.Stop(context.Background())
+
+		Eventually(func() (string, error) {
+			resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/metrics", cfg.DebugPort))
+			if err != nil {
+				return "", err
+			}
+			defer resp.Body.Close()
+
+			b, err := ioutil.ReadAll(resp.Body)
+			return string(b), err
+		}).Should(ContainSubstring("queue_depth"))
+	})
+
+	It("stops accepting envelopes and flushes drains on stop", func() {
+		mc := testhelper.NewMetricClient()
+		cfg := app.Config{
+			BindingsPerAppLimit: 5,
+			DebugPort:           7397,
+			IdleDrainTimeout:    10 * time.Minute,
+			Cache: app.Cache{
+				URL:             cupsProvider.URL,
+				CAFile:          testhelper.Cert("binding-cache-ca.crt"),
+				CertFile:        testhelper.Cert("binding-cache-ca.crt"),
+				KeyFile:         testhelper.Cert("binding-cache-ca.key"),
+				CommonName:      "bindingCacheCA",
+				PollingInterval: 10 * time.Millisecond,
+			},
+			GRPC: app.GRPC{
+				Port:     grpcPort,
+				CAFile:   testhelper.Cert("loggregator-ca.crt"),
+				CertFile: testhelper.Cert("metron.crt"),
+				KeyFile:  testhelper.Cert("metron.key"),
+			},
+		}
+		agent := app.NewSyslogAgent(cfg, mc, testLogger)
+		go agent.Run()
+
+		Eventually(hasMetric(mc, "shutdown_lost", nil)).Should(BeTrue())
+		for _, port := range []int{int(grpcPort), int(cfg.DebugPort)} {
+			addr := fmt.Sprintf("127.0.0.1:%d", port)
+			Eventually(func() error {
+				conn, err := net.Dial("tcp", addr)
+				if err == nil {
+					conn.Close()
+				}
+				return err
+			}).Should(Succeed())
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		agent.Stop(ctx)
+
+		_, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", grpcPort))
+		Expect(err).To(HaveOccurred())
+		_, err = net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", cfg.DebugPort))
+		Expect(err).To(HaveOccurred())
+		Expect(mc.GetMetric("shutdown_lost", nil).Value()).To(BeZero())
+		Expect(func() { agent.Stop(ctx) }).ToNot(Panic())
+	})
+
 	It("should not send logs to blacklisted IPs", func() {
 		mc := testhelper.NewMetricClient()
 		cfg := app.Config{
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"code.cloudfoundry.org/loggregator-agent/cmd/syslog-agent/app"
 	"code.cloudfoundry.org/loggregator-agent/pkg/metrics"
@@ -23,5 +26,14 @@ func main() {
 		}),
 	)
 
-	app.NewSyslogAgent(cfg, m, log).Run()
+	a := app.NewSyslogAgent(cfg, m, log)
+	go a.Run()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	<-signals
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	a.Stop(ctx)
 }
@@ -8,6 +8,7 @@ import (
 
 	"code.cloudfoundry.org/loggregator-agent/pkg/binding"
 	"code.cloudfoundry.org/loggregator-agent/pkg/cache"
+	"code.cloudfoundry.org/loggregator-agent/pkg/health"
 	"code.cloudfoundry.org/loggregator-agent/pkg/ingress/api"
 	"code.cloudfoundry.org/loggregator-agent/pkg/plumbing"
 	"github.com/gorilla/mux"
@@ -16,12 +17,14 @@ import (
 type SyslogBindingCache struct {
 	config Config
 	log    *log.Logger
+	capi   *health.Freshness
 }
 
 func NewSyslogBindingCache(config Config, log *log.Logger) *SyslogBindingCache {
 	return &SyslogBindingCache{
 		config: config,
 		log:    log,
+		capi:   health.NewFreshness(3 * config.APIPollingInterval),
 	}
 }
 
@@ -32,8 +35,17 @@ func (sbc *SyslogBindingCache) Run() {
 		sbc.log.Panicf("error creating listener: %s", err)
 	}
 
+	if sbc.config.DebugPort != 0 {
+		go sbc.startDebugServer()
+	}
+
 	store := binding.NewStore()
-	poller := binding.NewPoller(sbc.apiClient(), sbc.config.APIPollingInterval, store)
+	poller := binding.NewPoller(
+		sbc.apiClient(),
+		sbc.config.APIPollingInterval,
+		store,
+		binding.WithFreshness(sbc.capi),
+	)
 
 	go poller.Poll()
 
@@ -63,6 +75,18 @@ func (sbc *SyslogBindingCache) Run() {
 	server.ServeTLS(lis, "", "")
 }
 
+// startDebugServer serves the health and readiness endpoints. The cache is
+// ready while polling CAPI succeeds.
+func (sbc *SyslogBindingCache) startDebugServer() {
+	mux := http.NewServeMux()
+	h := health.NewHandler()
+	h.Add("capi", sbc.capi.Check)
+	h.Register(mux)
+
+	addr := fmt.Sprintf("127.0.0.1:%d", sbc.config.DebugPort)
+	sbc.log.Printf("debug server closing: %s", http.ListenAndServe(addr, mux))
+}
+
 func (sbc *SyslogBindingCache) apiClient() api.Client {
 	httpClient := plumbing.NewTLSHTTPClient(
 		sbc.config.APICertFile,
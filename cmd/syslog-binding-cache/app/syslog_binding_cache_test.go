@@ -27,6 +27,7 @@ var _ = Describe("SyslogBindingCache", func() {
 		sbc  *app.SyslogBindingCache
 
 		cachePort = 40000
+		debugPort = 41000
 	)
 
 	BeforeEach(func() {
@@ -59,6 +60,7 @@ var _ = Describe("SyslogBindingCache", func() {
 			CacheKeyFile:       testhelper.Cert("binding-cache-ca.key"),
 			CacheCommonName:    "bindingCacheCA",
 			CachePort:          cachePort,
+			DebugPort:          debugPort,
 		}
 		sbc = app.NewSyslogBindingCache(config, logger)
 		go sbc.Run()
@@ -69,12 +71,25 @@ var _ = Describe("SyslogBindingCache", func() {
 		capi.Close()
 
 		cachePort++
+		debugPort++
 	})
 
 	It("polls CAPI on an interval for results", func() {
 		Eventually(capi.numRequests).Should(BeNumerically(">=", 2))
 	})
 
+	It("is ready once CAPI has been polled", func() {
+		Eventually(func() (int, error) {
+			resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/ready", debugPort))
+			if err != nil {
+				return 0, err
+			}
+			defer resp.Body.Close()
+
+			return resp.StatusCode, nil
+		}).Should(Equal(http.StatusOK))
+	})
+
 	It("has an HTTP endpoint that returns bindings", func() {
 		client := plumbing.NewTLSHTTPClient(
 			testhelper.Cert("binding-cache-ca.crt"),
@@ -3,8 +3,10 @@ package app
 import (
 	"code.cloudfoundry.org/loggregator-agent/pkg/collector"
 	"code.cloudfoundry.org/loggregator-agent/pkg/egress/stats"
+	"code.cloudfoundry.org/loggregator-agent/pkg/health"
 	"code.cloudfoundry.org/loggregator-agent/pkg/plumbing"
 	"context"
+	"errors"
 	"fmt"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -26,13 +28,15 @@ type SystemMetricsAgent struct {
 	metricsServer http.Server
 	mu            sync.Mutex
 	inputFunc     collector.InputFunc
+	collections   *health.Freshness
 }
 
 func NewSystemMetricsAgent(i collector.InputFunc, cfg Config, log *log.Logger) *SystemMetricsAgent {
 	return &SystemMetricsAgent{
-		cfg:       cfg,
-		log:       log,
-		inputFunc: i,
+		cfg:         cfg,
+		log:         log,
+		inputFunc:   i,
+		collections: health.NewFreshness(3 * cfg.SampleInterval),
 	}
 }
 
@@ -86,7 +90,31 @@ func (a *SystemMetricsAgent) startDebugServer() {
 		a.log.Panicf("failed to start debug listener: %s", err)
 	}
 
-	go http.Serve(a.debugLis, nil)
+	h := health.NewHandler()
+	h.Add("collector", a.collections.Check)
+	h.Add("metrics_server", a.metricsServerReady)
+
+	mux := http.NewServeMux()
+	mux.Handle("/", http.DefaultServeMux)
+	h.Register(mux)
+
+	go http.Serve(a.debugLis, mux)
+}
+
+func (a *SystemMetricsAgent) metricsServerReady() error {
+	if a.MetricsAddr() == "" {
+		return errors.New("not listening")
+	}
+
+	return nil
+}
+
+// collect reads the system stats and records whether it succeeded.
+func (a *SystemMetricsAgent) collect() (collector.SystemStat, error) {
+	stat, err := a.inputFunc()
+	a.collections.Record(err)
+
+	return stat, err
 }
 
 func (a *SystemMetricsAgent) startMetricsServer(addr string) {
@@ -108,7 +136,7 @@ func (a *SystemMetricsAgent) startMetricsServer(addr string) {
 	a.setup(addr, router)
 
 	go collector.NewProcessor(
-		a.inputFunc,
+		a.collect,
 		[]collector.StatsSender{promSender},
 		a.cfg.SampleInterval,
 		a.log,
@@ -58,6 +58,27 @@ var _ = Describe("SystemMetricsAgent", func() {
 		Expect(resp.StatusCode).To(Equal(http.StatusOK))
 	})
 
+	It("is ready once stats are collected", func() {
+		go agent.Run()
+		defer agent.Shutdown(context.Background())
+
+		var addr string
+		Eventually(func() int {
+			addr = agent.DebugAddr()
+			return len(addr)
+		}).ShouldNot(Equal(0))
+
+		Eventually(func() (int, error) {
+			resp, err := http.Get("http://" + addr + "/ready")
+			if err != nil {
+				return 0, err
+			}
+			defer resp.Body.Close()
+
+			return resp.StatusCode, nil
+		}).Should(Equal(http.StatusOK))
+	})
+
 	It("has a prom exposition endpoint", func() {
 		go agent.Run()
 		defer agent.Shutdown(context.Background())
@@ -2,6 +2,7 @@ package app
 
 import (
 	"code.cloudfoundry.org/loggregator-agent/pkg/egress/v1"
+	"code.cloudfoundry.org/loggregator-agent/pkg/health"
 	"code.cloudfoundry.org/loggregator-agent/pkg/metrics"
 	"fmt"
 	"log"
@@ -81,8 +82,14 @@ func (u *UDPForwarder) Run() {
 		u.log.Fatalf("Failed to listen on 127.0.0.1:%d: %s", u.udpPort, err)
 	}
 
+	// The forwarder has no state to check. It is ready once it listens on
+	// the UDP port.
+	mux := http.NewServeMux()
+	mux.Handle("/", http.DefaultServeMux)
+	health.NewHandler().Register(mux)
+
 	go func() {
-		http.ListenAndServe(fmt.Sprintf("127.0.0.1:%d", u.debugPort), nil)
+		http.ListenAndServe(fmt.Sprintf("127.0.0.1:%d", u.debugPort), mux)
 	}()
 
 	go networkReader.StartReading()
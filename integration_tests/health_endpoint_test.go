@@ -32,4 +32,32 @@ var _ = Describe("Agent Health Endpoint", func() {
 		Expect(body).To(ContainSubstring("doppler_v2_streams"))
 		Expect(body).To(ContainSubstring("doppler_connections"))
 	})
+
+	It("is ready once it is connected to doppler", func() {
+		consumerServer, err := NewServer()
+		Expect(err).ToNot(HaveOccurred())
+		defer consumerServer.Stop()
+		agentCleanup, agentPorts := testservers.StartAgent(
+			testservers.BuildAgentConfig("127.0.0.1", consumerServer.Port()),
+		)
+		defer agentCleanup()
+
+		Eventually(func() (int, error) {
+			resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/ready", agentPorts.PProf))
+			if err != nil {
+				return 0, err
+			}
+			defer resp.Body.Close()
+
+			return resp.StatusCode, nil
+		}, 5).Should(Equal(http.StatusOK))
+
+		resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/health", agentPorts.PProf))
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(body).To(ContainSubstring(`"doppler":{"ready":true}`))
+	})
 })
@@ -39,6 +39,25 @@ func (s *SpyMetricClient) NewGauge(name string, opts ...metrics.MetricOption) me
 	return m
 }
 
+func (s *SpyMetricClient) RemoveGauge(g metrics.Gauge) {
+	s.remove(g)
+}
+
+func (s *SpyMetricClient) RemoveCounter(c metrics.Counter) {
+	s.remove(c)
+}
+
+func (s *SpyMetricClient) remove(metric interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for n, m := range s.Metrics {
+		if m == metric {
+			delete(s.Metrics, n)
+		}
+	}
+}
+
 func (s *SpyMetricClient) addMetric(sm *SpyMetric) {
 	n := getMetricName(sm.name, sm.Opts.ConstLabels)
 
@@ -0,0 +1,204 @@
+package binding
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"sort"
+
+	"code.cloudfoundry.org/loggregator-agent/pkg/egress"
+	"code.cloudfoundry.org/loggregator-agent/pkg/egress/syslog"
+)
+
+// ErrDrainNotFound is returned when an admin action refers to a drain the
+// Manager does not hold.
+var ErrDrainNotFound = errors.New("drain not found")
+
+const redacted = "REDACTED"
+
+// Query parameters that never hold secrets and are shown as is.
+var safeQueryParams = map[string]bool{
+	"drain-type":    true,
+	"source-id":     true,
+	"envelope-type": true,
+}
+
+// DrainInfo describes a drain held by the Manager. Credentials in the drain
+// URL are redacted.
+type DrainInfo struct {
+	ID       string            `json:"id"`
+	AppID    string            `json:"app_id,omitempty"`
+	Hostname string            `json:"hostname,omitempty"`
+	Drain    string            `json:"drain"`
+	Active   bool              `json:"active"`
+	State    syslog.DrainState `json:"state"`
+}
+
+// DrainReport lists the drains held by the Manager.
+type DrainReport struct {
+	Apps      map[string][]DrainInfo `json:"apps"`
+	Aggregate []DrainInfo            `json:"aggregate"`
+}
+
+type stater interface {
+	State() syslog.DrainState
+}
+
+// Drains returns the bindings per app and the aggregate drains along with
+// the state of their writers.
+func (m *Manager) Drains() DrainReport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	report := DrainReport{
+		Apps:      make(map[string][]DrainInfo),
+		Aggregate: make([]DrainInfo, 0, len(m.aggregateDrains)),
+	}
+
+	for appID, drains := range m.sourceDrainMap {
+		for b, dh := range drains {
+			report.Apps[appID] = append(report.Apps[appID], drainInfo(b, dh.drainWriter))
+		}
+
+		sort.Slice(report.Apps[appID], func(i, j int) bool {
+			return report.Apps[appID][i].Drain < report.Apps[appID][j].Drain
+		})
+	}
+
+	for _, ah := range m.aggregateDrains {
+		b := syslog.Binding{Drain: ah.drain.URL}
+		report.Aggregate = append(report.Aggregate, drainInfo(b, ah.drainWriter))
+	}
+
+	return report
+}
+
+// Reconnect closes the writer of the drain with the given ID and connects a
+// new one.
+func (m *Manager) Reconnect(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, ah := range m.aggregateDrains {
+		if drainID(syslog.Binding{Drain: ah.drain.URL}) != id {
+			continue
+		}
+
+		ah.cancel()
+		m.aggregateDrains[i] = aggregateDrainHolder{
+			drain:       ah.drain,
+			drainHolder: newDrainHolder(),
+		}
+		m.connectAggregateDrain(i)
+
+		return nil
+	}
+
+	b, dh, ok := m.findDrain(id)
+	if !ok {
+		return ErrDrainNotFound
+	}
+
+	dh.cancel()
+	if dh.drainWriter != nil {
+		m.activeDrainCount--
+	}
+
+	dh = newDrainHolder()
+	m.sourceDrainMap[b.AppId][b] = dh
+	m.connectDrain(b, dh)
+	m.activeDrainCountMetric.Set(float64(m.activeDrainCount))
+
+	return nil
+}
+
+// Evict closes and removes the drain with the given ID. The drain is added
+// again on the next binding update if it is still bound. Aggregate drains
+// can not be evicted.
+func (m *Manager) Evict(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, _, ok := m.findDrain(id)
+	if !ok {
+		return ErrDrainNotFound
+	}
+
+	m.removeDrain(m.sourceDrainMap[b.AppId], b)
+
+	return nil
+}
+
+func (m *Manager) findDrain(id string) (syslog.Binding, drainHolder, bool) {
+	for _, drains := range m.sourceDrainMap {
+		for b, dh := range drains {
+			if drainID(b) == id {
+				return b, dh, true
+			}
+		}
+	}
+
+	return syslog.Binding{}, drainHolder{}, false
+}
+
+func drainInfo(b syslog.Binding, w egress.Writer) DrainInfo {
+	info := DrainInfo{
+		ID:       drainID(b),
+		AppID:    b.AppId,
+		Hostname: b.Hostname,
+		Drain:    redactDrainURL(b.Drain),
+		Active:   w != nil,
+		State: syslog.DrainState{
+			Connection: syslog.StatePending,
+		},
+	}
+
+	if s, ok := w.(stater); ok {
+		info.State = s.State()
+	}
+
+	return info
+}
+
+// drainID identifies a binding without exposing its drain URL.
+func drainID(b syslog.Binding) string {
+	sum := sha256.Sum256([]byte(b.AppId + "\x00" + b.Drain))
+	return hex.EncodeToString(sum[:8])
+}
+
+// redactDrainURL removes credentials from the drain URL. The user info, the
+// path, the fragment and the values of query parameters may hold secrets.
+func redactDrainURL(drain string) string {
+	u, err := url.Parse(drain)
+	if err != nil {
+		return redacted
+	}
+
+	if u.User != nil {
+		u.User = url.User(redacted)
+	}
+
+	if u.Path != "" && u.Path != "/" {
+		u.Path = "/" + redacted
+		u.RawPath = ""
+	}
+
+	if u.Fragment != "" {
+		u.Fragment = redacted
+	}
+
+	query := u.Query()
+	for k, v := range query {
+		if safeQueryParams[k] {
+			continue
+		}
+
+		for i := range v {
+			v[i] = redacted
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
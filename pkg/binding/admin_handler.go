@@ -0,0 +1,79 @@
+package binding
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// DrainAdmin inspects and manages the drains held by a Manager.
+type DrainAdmin interface {
+	Drains() DrainReport
+	Reconnect(id string) error
+	Evict(id string) error
+}
+
+// NewAdminHandler returns a handler for the drain admin API. Every request
+// must carry the given token as a bearer token.
+//
+//	GET    /admin/drains                 lists drains per app
+//	POST   /admin/drains/{id}/reconnect  reconnects a drain
+//	DELETE /admin/drains/{id}            evicts a drain
+func NewAdminHandler(a DrainAdmin, token string) http.Handler {
+	router := mux.NewRouter()
+	router.HandleFunc("/admin/drains", drainsHandler(a)).Methods(http.MethodGet)
+	router.HandleFunc("/admin/drains/{id}/reconnect", drainActionHandler(a.Reconnect)).Methods(http.MethodPost)
+	router.HandleFunc("/admin/drains/{id}", drainActionHandler(a.Evict)).Methods(http.MethodDelete)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r, token) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		router.ServeHTTP(w, r)
+	})
+}
+
+func drainsHandler(a DrainAdmin) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		err := json.NewEncoder(w).Encode(a.Drains())
+		if err != nil {
+			log.Printf("failed to encode response body: %s", err)
+			return
+		}
+	}
+}
+
+func drainActionHandler(action func(id string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := action(mux.Vars(r)["id"])
+		switch err {
+		case nil:
+			w.WriteHeader(http.StatusNoContent)
+		case ErrDrainNotFound:
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
+
+func authorized(r *http.Request, token string) bool {
+	if token == "" {
+		return false
+	}
+
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) == 1
+}
@@ -0,0 +1,130 @@
+package binding_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/loggregator-agent/pkg/binding"
+	"code.cloudfoundry.org/loggregator-agent/pkg/egress/syslog"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AdminHandler", func() {
+	var (
+		admin   *spyDrainAdmin
+		handler http.Handler
+	)
+
+	BeforeEach(func() {
+		admin = &spyDrainAdmin{
+			report: binding.DrainReport{
+				Apps: map[string][]binding.DrainInfo{
+					"app-1": {
+						{
+							ID:    "some-id",
+							AppID: "app-1",
+							Drain: "syslog://drain.url.com",
+							State: syslog.DrainState{
+								Connection: syslog.StateFailing,
+								LastError:  "connection refused",
+								QueueDepth: 5,
+							},
+						},
+					},
+				},
+			},
+		}
+		handler = binding.NewAdminHandler(admin, "some-token")
+	})
+
+	It("lists the drains", func() {
+		rw := serve(handler, http.MethodGet, "/admin/drains", "some-token")
+
+		Expect(rw.Code).To(Equal(http.StatusOK))
+
+		j, err := json.Marshal(&admin.report)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rw.Body.String()).To(MatchJSON(j))
+	})
+
+	It("reconnects a drain", func() {
+		rw := serve(handler, http.MethodPost, "/admin/drains/some-id/reconnect", "some-token")
+
+		Expect(rw.Code).To(Equal(http.StatusNoContent))
+		Expect(admin.reconnected).To(ConsistOf("some-id"))
+	})
+
+	It("evicts a drain", func() {
+		rw := serve(handler, http.MethodDelete, "/admin/drains/some-id", "some-token")
+
+		Expect(rw.Code).To(Equal(http.StatusNoContent))
+		Expect(admin.evicted).To(ConsistOf("some-id"))
+	})
+
+	It("returns not found for unknown drains", func() {
+		admin.err = binding.ErrDrainNotFound
+
+		rw := serve(handler, http.MethodDelete, "/admin/drains/unknown", "some-token")
+		Expect(rw.Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("returns an internal server error when the action fails", func() {
+		admin.err = errors.New("some-error")
+
+		rw := serve(handler, http.MethodPost, "/admin/drains/some-id/reconnect", "some-token")
+		Expect(rw.Code).To(Equal(http.StatusInternalServerError))
+	})
+
+	It("rejects requests with an invalid token", func() {
+		rw := serve(handler, http.MethodGet, "/admin/drains", "invalid-token")
+		Expect(rw.Code).To(Equal(http.StatusUnauthorized))
+
+		rw = serve(handler, http.MethodGet, "/admin/drains", "")
+		Expect(rw.Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("rejects every request without a configured token", func() {
+		handler = binding.NewAdminHandler(admin, "")
+
+		rw := serve(handler, http.MethodGet, "/admin/drains", "")
+		Expect(rw.Code).To(Equal(http.StatusUnauthorized))
+	})
+})
+
+func serve(h http.Handler, method, path, token string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, path, nil)
+	Expect(err).ToNot(HaveOccurred())
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, req)
+
+	return rw
+}
+
+type spyDrainAdmin struct {
+	report      binding.DrainReport
+	reconnected []string
+	evicted     []string
+	err         error
+}
+
+func (s *spyDrainAdmin) Drains() binding.DrainReport {
+	return s.report
+}
+
+func (s *spyDrainAdmin) Reconnect(id string) error {
+	s.reconnected = append(s.reconnected, id)
+	return s.err
+}
+
+func (s *spyDrainAdmin) Evict(id string) error {
+	s.evicted = append(s.evicted, id)
+	return s.err
+}
@@ -0,0 +1,143 @@
+package binding
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/pkg/egress"
+)
+
+// AggregateDrain is an operator configured drain that receives envelopes for
+// every source ID rather than for a single app. The envelopes it receives can
+// be narrowed down by source ID glob patterns and envelope types.
+type AggregateDrain struct {
+	URL           string
+	SourceIDs     []string
+	EnvelopeTypes []string
+}
+
+// NewAggregateDrain parses the given drain URL. Filters are read from the
+// repeatable source-id and envelope-type query parameters, e.g.
+// syslog-tls://siem.example.com:6514?source-id=app-*&envelope-type=log
+// Unlike app drains, aggregate drains default to drain-type=all so that the
+// envelope-type parameter alone selects the envelopes. A drain-type that
+// excludes any of the envelope types is an error.
+func NewAggregateDrain(drainURL string) (AggregateDrain, error) {
+	u, err := url.Parse(drainURL)
+	if err != nil {
+		return AggregateDrain{}, fmt.Errorf("invalid aggregate drain URL: %s", err)
+	}
+
+	if u.Scheme == "" || u.Host == "" {
+		return AggregateDrain{}, errors.New("invalid aggregate drain URL: missing scheme or host")
+	}
+
+	query := u.Query()
+	for _, p := range query["source-id"] {
+		if _, err := path.Match(p, ""); err != nil {
+			return AggregateDrain{}, fmt.Errorf("invalid source-id pattern: %s", p)
+		}
+	}
+
+	drainType := query.Get("drain-type")
+	for _, t := range query["envelope-type"] {
+		if !egress.ValidEnvelopeType(t) {
+			return AggregateDrain{}, fmt.Errorf("invalid envelope-type: %s", t)
+		}
+
+		if drainType != "" && !drainTypeIncludes(drainType, t) {
+			return AggregateDrain{}, fmt.Errorf("envelope-type %s is excluded by drain-type %s", t, drainType)
+		}
+	}
+
+	if drainType == "" {
+		query.Set("drain-type", "all")
+		u.RawQuery = query.Encode()
+		drainURL = u.String()
+	}
+
+	return AggregateDrain{
+		URL:           drainURL,
+		SourceIDs:     query["source-id"],
+		EnvelopeTypes: query["envelope-type"],
+	}, nil
+}
+
+// MatchesSourceID reports whether envelopes from the given source ID should
+// be written to the drain. A drain without source ID patterns matches every
+// source ID.
+func (d AggregateDrain) MatchesSourceID(sourceID string) bool {
+	if len(d.SourceIDs) == 0 {
+		return true
+	}
+
+	for _, p := range d.SourceIDs {
+		if ok, _ := path.Match(p, sourceID); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MatchesEnvelope reports whether the type of the given envelope should be
+// written to the drain. A drain without envelope types matches every
+// envelope.
+func (d AggregateDrain) MatchesEnvelope(e *loggregator_v2.Envelope) bool {
+	if len(d.EnvelopeTypes) == 0 {
+		return true
+	}
+
+	t := egress.EnvelopeType(e)
+	for _, et := range d.EnvelopeTypes {
+		if et == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AggregateDrains is the list of aggregate drains configured for the syslog
+// agent.
+type AggregateDrains struct {
+	Drains []AggregateDrain
+}
+
+// UnmarshalEnv implements envstruct.Unmarshaller.
+// Example input:
+// syslog://siem.example.com:514,https://logs.example.com/drain?envelope-type=log
+func (a *AggregateDrains) UnmarshalEnv(v string) error {
+	if v == "" {
+		return nil
+	}
+
+	for _, u := range strings.Split(v, ",") {
+		d, err := NewAggregateDrain(strings.TrimSpace(u))
+		if err != nil {
+			return err
+		}
+
+		a.Drains = append(a.Drains, d)
+	}
+
+	return nil
+}
+
+// drainTypeIncludes reports whether a drain with the given drain-type
+// receives envelopes of the given type. Unknown drain types only receive
+// logs, like in the syslog connector.
+func drainTypeIncludes(drainType, envelopeType string) bool {
+	switch drainType {
+	case "all":
+		return true
+	case "metrics":
+		return envelopeType == "counter" || envelopeType == "gauge" || envelopeType == "timer"
+	default:
+		return envelopeType == "log"
+	}
+}
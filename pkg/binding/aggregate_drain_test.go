@@ -0,0 +1,154 @@
+package binding_test
+
+import (
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/pkg/binding"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AggregateDrain", func() {
+	It("parses the filters from the drain URL", func() {
+		d, err := binding.NewAggregateDrain(
+			"syslog://drain.url.com?source-id=app-*&source-id=doppler&envelope-type=log&envelope-type=event",
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(d.URL).To(Equal("syslog://drain.url.com?drain-type=all&envelope-type=log&envelope-type=event&source-id=app-%2A&source-id=doppler"))
+		Expect(d.SourceIDs).To(ConsistOf("app-*", "doppler"))
+		Expect(d.EnvelopeTypes).To(ConsistOf("log", "event"))
+	})
+
+	It("defaults to every drain type", func() {
+		d, err := binding.NewAggregateDrain("syslog://drain.url.com")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(d.URL).To(Equal("syslog://drain.url.com?drain-type=all"))
+
+		d, err = binding.NewAggregateDrain("syslog://drain.url.com?envelope-type=counter")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(d.URL).To(Equal("syslog://drain.url.com?drain-type=all&envelope-type=counter"))
+
+		d, err = binding.NewAggregateDrain("syslog://drain.url.com?")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(d.URL).To(Equal("syslog://drain.url.com?drain-type=all"))
+	})
+
+	It("adds the default drain type to the query of URLs with a fragment", func() {
+		d, err := binding.NewAggregateDrain("https://drain.url.com/path?envelope-type=log#fragment")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(d.URL).To(Equal("https://drain.url.com/path?drain-type=all&envelope-type=log#fragment"))
+	})
+
+	It("keeps an explicit drain type", func() {
+		d, err := binding.NewAggregateDrain("syslog://drain.url.com?drain-type=metrics&envelope-type=gauge")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(d.URL).To(Equal("syslog://drain.url.com?drain-type=metrics&envelope-type=gauge"))
+	})
+
+	It("returns an error if the drain type excludes an envelope type", func() {
+		_, err := binding.NewAggregateDrain("syslog://drain.url.com?drain-type=logs&envelope-type=counter")
+		Expect(err).To(MatchError("envelope-type counter is excluded by drain-type logs"))
+
+		_, err = binding.NewAggregateDrain("syslog://drain.url.com?drain-type=metrics&envelope-type=event")
+		Expect(err).To(MatchError("envelope-type event is excluded by drain-type metrics"))
+	})
+
+	It("returns an error for an invalid URL", func() {
+		_, err := binding.NewAggregateDrain("drain.url.com")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("returns an error for an invalid source ID pattern", func() {
+		_, err := binding.NewAggregateDrain("syslog://drain.url.com?source-id=[")
+		Expect(err).To(MatchError("invalid source-id pattern: ["))
+	})
+
+	It("returns an error for an unknown envelope type", func() {
+		_, err := binding.NewAggregateDrain("syslog://drain.url.com?envelope-type=metric")
+		Expect(err).To(MatchError("invalid envelope-type: metric"))
+	})
+
+	Describe("MatchesSourceID()", func() {
+		It("matches every source ID without patterns", func() {
+			d, err := binding.NewAggregateDrain("syslog://drain.url.com")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(d.MatchesSourceID("app-1")).To(BeTrue())
+			Expect(d.MatchesSourceID("")).To(BeTrue())
+		})
+
+		It("matches source IDs against the patterns", func() {
+			d, err := binding.NewAggregateDrain("syslog://drain.url.com?source-id=app-*&source-id=doppler")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(d.MatchesSourceID("app-1")).To(BeTrue())
+			Expect(d.MatchesSourceID("doppler")).To(BeTrue())
+			Expect(d.MatchesSourceID("router")).To(BeFalse())
+		})
+	})
+
+	Describe("MatchesEnvelope()", func() {
+		It("matches every envelope without types", func() {
+			d, err := binding.NewAggregateDrain("syslog://drain.url.com")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(d.MatchesEnvelope(logEnvelope("app-1"))).To(BeTrue())
+			Expect(d.MatchesEnvelope(counterEnvelope("app-1"))).To(BeTrue())
+		})
+
+		It("matches envelopes against the types", func() {
+			d, err := binding.NewAggregateDrain("syslog://drain.url.com?envelope-type=counter")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(d.MatchesEnvelope(logEnvelope("app-1"))).To(BeFalse())
+			Expect(d.MatchesEnvelope(counterEnvelope("app-1"))).To(BeTrue())
+		})
+	})
+
+	Describe("AggregateDrains", func() {
+		It("parses a comma separated list of drain URLs", func() {
+			var drains binding.AggregateDrains
+			Expect(drains.UnmarshalEnv("syslog://drain-1.url.com, https://drain-2.url.com?envelope-type=log")).To(Succeed())
+
+			Expect(drains.Drains).To(HaveLen(2))
+			Expect(drains.Drains[0].URL).To(Equal("syslog://drain-1.url.com?drain-type=all"))
+			Expect(drains.Drains[1].URL).To(Equal("https://drain-2.url.com?drain-type=all&envelope-type=log"))
+			Expect(drains.Drains[1].EnvelopeTypes).To(ConsistOf("log"))
+		})
+
+		It("does not return an error for an empty list", func() {
+			var drains binding.AggregateDrains
+			Expect(drains.UnmarshalEnv("")).To(Succeed())
+			Expect(drains.Drains).To(BeEmpty())
+		})
+
+		It("returns an error if any drain is invalid", func() {
+			var drains binding.AggregateDrains
+			Expect(drains.UnmarshalEnv("syslog://drain-1.url.com,invalid")).ToNot(Succeed())
+		})
+	})
+})
+
+func logEnvelope(sourceID string) *loggregator_v2.Envelope {
+	return &loggregator_v2.Envelope{
+		SourceId: sourceID,
+		Message: &loggregator_v2.Envelope_Log{
+			Log: &loggregator_v2.Log{
+				Payload: []byte("hello"),
+			},
+		},
+	}
+}
+
+func counterEnvelope(sourceID string) *loggregator_v2.Envelope {
+	return &loggregator_v2.Envelope{
+		SourceId: sourceID,
+		Message: &loggregator_v2.Envelope_Counter{
+			Counter: &loggregator_v2.Counter{
+				Name:  "some-counter",
+				Delta: 1,
+			},
+		},
+	}
+}
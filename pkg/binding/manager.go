@@ -8,6 +8,7 @@ import (
 	"sync"
 	"time"
 
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
 	"code.cloudfoundry.org/loggregator-agent/pkg/egress"
 	"code.cloudfoundry.org/loggregator-agent/pkg/egress/syslog"
 )
@@ -20,17 +21,28 @@ type Fetcher interface {
 type Metrics interface {
 	NewGauge(name string, o ...metrics.MetricOption) metrics.Gauge
 	NewCounter(name string, o ...metrics.MetricOption) metrics.Counter
+	RemoveGauge(metrics.Gauge)
 }
 
 type Connector interface {
 	Connect(context.Context, syslog.Binding) (egress.Writer, error)
 }
 
+// Prober checks the health of a drain.
+type Prober interface {
+	Probe(context.Context, syslog.Binding) error
+}
+
+type dialer interface {
+	Dial() error
+}
+
 type Manager struct {
 	mu        sync.Mutex
 	bf        Fetcher
 	bfLimit   int
 	connector Connector
+	metrics   Metrics
 	log       *log.Logger
 
 	pollingInterval time.Duration
@@ -42,6 +54,49 @@ type Manager struct {
 
 	sourceDrainMap    map[string]map[syslog.Binding]drainHolder
 	sourceAccessTimes map[string]time.Time
+
+	aggregateDrains        []aggregateDrainHolder
+	aggregateIngressMetric metrics.Counter
+
+	eagerConnect  bool
+	prober        Prober
+	probeInterval time.Duration
+	healthMetrics map[syslog.Binding]metrics.Gauge
+
+	closed bool
+}
+
+// ManagerOption configures a Manager.
+type ManagerOption func(*Manager)
+
+// WithAggregateDrains configures drains that receive envelopes from every
+// source ID in addition to the drains bound to individual apps.
+func WithAggregateDrains(drains []AggregateDrain) ManagerOption {
+	return func(m *Manager) {
+		for _, d := range drains {
+			m.aggregateDrains = append(m.aggregateDrains, aggregateDrainHolder{
+				drain:       d,
+				drainHolder: newDrainHolder(),
+			})
+		}
+	}
+}
+
+// WithEagerConnect connects drains as soon as their bindings arrive instead
+// of on the first envelope. Connected drains are not closed when idle.
+func WithEagerConnect() ManagerOption {
+	return func(m *Manager) {
+		m.eagerConnect = true
+	}
+}
+
+// WithHealthProbes probes every connected drain on the given interval and
+// reports its health.
+func WithHealthProbes(p Prober, interval time.Duration) ManagerOption {
+	return func(m *Manager) {
+		m.prober = p
+		m.probeInterval = interval
+	}
 }
 
 func NewManager(
@@ -51,6 +106,7 @@ func NewManager(
 	pollingInterval time.Duration,
 	idleTimeout time.Duration,
 	log *log.Logger,
+	opts ...ManagerOption,
 ) *Manager {
 	tagOpt := metrics.WithMetricTags(map[string]string{"unit": "count"})
 	drainCount := m.NewGauge("drains", tagOpt)
@@ -62,14 +118,33 @@ func NewManager(
 		pollingInterval:        pollingInterval,
 		idleTimeout:            idleTimeout,
 		connector:              c,
+		metrics:                m,
 		drainCountMetric:       drainCount,
 		activeDrainCountMetric: activeDrains,
 		sourceDrainMap:         make(map[string]map[syslog.Binding]drainHolder),
 		sourceAccessTimes:      make(map[string]time.Time),
+		healthMetrics:          make(map[syslog.Binding]metrics.Gauge),
 		log:                    log,
 	}
 
-	go manager.idleCleanupLoop()
+	for _, o := range opts {
+		o(manager)
+	}
+
+	aggregateDrains := m.NewGauge("aggregate_drains", tagOpt)
+	aggregateDrains.Set(float64(len(manager.aggregateDrains)))
+	manager.aggregateIngressMetric = m.NewCounter(
+		"ingress",
+		metrics.WithMetricTags(map[string]string{"scope": "aggregate_drains"}),
+	)
+
+	if !manager.eagerConnect {
+		go manager.idleCleanupLoop()
+	}
+
+	if manager.prober != nil {
+		go manager.probeLoop()
+	}
 
 	return manager
 }
@@ -97,34 +172,94 @@ func (m *Manager) GetDrains(sourceID string) []egress.Writer {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	if m.closed {
+		return nil
+	}
+
 	m.sourceAccessTimes[sourceID] = time.Now()
-	drains := make([]egress.Writer, 0, m.bfLimit)
+	drains := make([]egress.Writer, 0, m.bfLimit+len(m.aggregateDrains))
 	for binding, dh := range m.sourceDrainMap[sourceID] {
 		// Create drain writer if one does not already exist
 		if dh.drainWriter == nil {
-			writer, err := m.connector.Connect(dh.ctx, binding)
-			if err != nil {
-				m.log.Printf("failed to create binding: %s", err)
+			var ok bool
+			dh, ok = m.connectDrain(binding, dh)
+			if !ok {
 				continue
 			}
+		}
+
+		drains = append(drains, dh.drainWriter)
+	}
+
+	return append(drains, m.getAggregateDrains(sourceID)...)
+}
+
+// connectDrain creates the drain writer for the given binding. The caller
+// must hold the lock.
+func (m *Manager) connectDrain(b syslog.Binding, dh drainHolder) (drainHolder, bool) {
+	writer, err := m.connector.Connect(dh.ctx, b)
+	if err != nil {
+		m.log.Printf("failed to create binding: %s", err)
+		return dh, false
+	}
+
+	dh.drainWriter = writer
+	m.sourceDrainMap[b.AppId][b] = dh
+	m.dial(writer)
+
+	m.activeDrainCount++
+	m.activeDrainCountMetric.Set(float64(m.activeDrainCount))
 
-			dh.drainWriter = writer
-			m.sourceDrainMap[sourceID][binding] = dh
+	return dh, true
+}
 
-			m.activeDrainCount++
-			m.activeDrainCountMetric.Set(float64(m.activeDrainCount))
+func (m *Manager) getAggregateDrains(sourceID string) []egress.Writer {
+	var drains []egress.Writer
+	for i, ah := range m.aggregateDrains {
+		if !ah.drain.MatchesSourceID(sourceID) {
+			continue
 		}
 
-		drains = append(drains, dh.drainWriter)
+		if ah.drainWriter == nil && !m.connectAggregateDrain(i) {
+			continue
+		}
+
+		drains = append(drains, m.aggregateDrains[i].drainWriter)
 	}
 
 	return drains
 }
 
+// connectAggregateDrain creates the drain writer for the aggregate drain at
+// the given index. The caller must hold the lock.
+func (m *Manager) connectAggregateDrain(i int) bool {
+	ah := m.aggregateDrains[i]
+
+	writer, err := m.connector.Connect(ah.ctx, syslog.Binding{Drain: ah.drain.URL})
+	if err != nil {
+		m.log.Printf("failed to create aggregate drain: %s", err)
+		return false
+	}
+
+	ah.drainWriter = aggregateDrainWriter{
+		drain:   ah.drain,
+		writer:  writer,
+		ingress: m.aggregateIngressMetric,
+	}
+	m.aggregateDrains[i] = ah
+	m.dial(writer)
+
+	return true
+}
+
 func (m *Manager) updateDrains(bindings []syslog.Binding) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	if m.closed {
+		return
+	}
+
 	newBindings := make(map[syslog.Binding]bool)
 
 	for _, b := range bindings {
@@ -141,6 +276,17 @@ func (m *Manager) updateDrains(bindings []syslog.Binding) {
 		}
 
 		m.sourceDrainMap[b.AppId][b] = newDrainHolder()
+		if m.eagerConnect {
+			m.connectDrain(b, m.sourceDrainMap[b.AppId][b])
+		}
+	}
+
+	if m.eagerConnect {
+		for i, ah := range m.aggregateDrains {
+			if ah.drainWriter == nil {
+				m.connectAggregateDrain(i)
+			}
+		}
 	}
 
 	// Delete all bindings that are not in updated list of bindings.
@@ -156,6 +302,24 @@ func (m *Manager) updateDrains(bindings []syslog.Binding) {
 	}
 }
 
+// Close cancels the context of every drain. Drains write their buffered
+// envelopes before they close their connections. No drains are returned
+// once the manager is closed.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closed = true
+	for _, bindingWriterMap := range m.sourceDrainMap {
+		for _, dh := range bindingWriterMap {
+			dh.cancel()
+		}
+	}
+	for _, ah := range m.aggregateDrains {
+		ah.cancel()
+	}
+}
+
 func (m *Manager) removeDrain(
 	bindingWriterMap map[syslog.Binding]drainHolder,
 	b syslog.Binding,
@@ -176,6 +340,101 @@ func (m *Manager) removeDrain(
 		m.activeDrainCount--
 		m.activeDrainCountMetric.Set(float64(m.activeDrainCount))
 	}
+
+	m.removeHealth(b)
+}
+
+// removeHealth stops reporting the health of the drain.
+func (m *Manager) removeHealth(b syslog.Binding) {
+	if health, ok := m.healthMetrics[b]; ok {
+		m.metrics.RemoveGauge(health)
+		delete(m.healthMetrics, b)
+	}
+}
+
+// dial connects the writer in the background when drains are connected
+// eagerly. Errors are recorded in the state of the writer.
+func (m *Manager) dial(w egress.Writer) {
+	if !m.eagerConnect {
+		return
+	}
+
+	if d, ok := w.(dialer); ok {
+		go d.Dial()
+	}
+}
+
+func (m *Manager) probeLoop() {
+	t := time.NewTicker(m.probeInterval)
+	for range t.C {
+		m.probeDrains()
+	}
+}
+
+func (m *Manager) probeDrains() {
+	type target struct {
+		ctx     context.Context
+		binding syslog.Binding
+	}
+
+	var targets []target
+	m.mu.Lock()
+	for _, drains := range m.sourceDrainMap {
+		for b, dh := range drains {
+			if dh.drainWriter != nil {
+				targets = append(targets, target{ctx: dh.ctx, binding: b})
+			}
+		}
+	}
+	for _, ah := range m.aggregateDrains {
+		if ah.drainWriter != nil {
+			targets = append(targets, target{ctx: ah.ctx, binding: syslog.Binding{Drain: ah.drain.URL}})
+		}
+	}
+	m.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, t := range targets {
+		wg.Add(1)
+		go func(t target) {
+			defer wg.Done()
+			m.probe(t.ctx, t.binding)
+		}(t)
+	}
+	wg.Wait()
+}
+
+func (m *Manager) probe(ctx context.Context, b syslog.Binding) {
+	err := m.prober.Probe(ctx, b)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// The drain was removed or went idle while it was probed.
+	if ctx.Err() != nil {
+		return
+	}
+
+	id := drainID(b)
+	health, ok := m.healthMetrics[b]
+	if !ok {
+		health = m.metrics.NewGauge(
+			"drain_health",
+			metrics.WithMetricTags(map[string]string{
+				"app_id":   b.AppId,
+				"drain_id": id,
+			}),
+		)
+		m.healthMetrics[b] = health
+	}
+
+	if err != nil {
+		m.log.Printf("drain %s failed health check: %s", id, err)
+		health.Set(0)
+		return
+	}
+
+	health.Set(1)
 }
 
 func (m *Manager) idleCleanupLoop() {
@@ -194,6 +453,7 @@ func (m *Manager) idleCleanup() {
 		if ts.Before(currentTime.Add(-m.idleTimeout)) {
 			for b, dh := range m.sourceDrainMap[sID] {
 				dh.cancel()
+				m.removeHealth(b)
 
 				m.sourceDrainMap[sID][b] = newDrainHolder()
 
@@ -220,3 +480,34 @@ func newDrainHolder() drainHolder {
 		drainWriter: nil,
 	}
 }
+
+type aggregateDrainHolder struct {
+	drainHolder
+	drain AggregateDrain
+}
+
+// aggregateDrainWriter drops envelopes whose type was not requested by the
+// aggregate drain before they reach the drain's diode.
+type aggregateDrainWriter struct {
+	drain   AggregateDrain
+	writer  egress.Writer
+	ingress metrics.Counter
+}
+
+func (w aggregateDrainWriter) Write(e *loggregator_v2.Envelope) error {
+	if !w.drain.MatchesEnvelope(e) {
+		return nil
+	}
+
+	w.ingress.Add(1)
+	return w.writer.Write(e)
+}
+
+// State returns the state of the wrapped drain writer.
+func (w aggregateDrainWriter) State() syslog.DrainState {
+	if s, ok := w.writer.(stater); ok {
+		return s.State()
+	}
+
+	return syslog.DrainState{Connection: syslog.StatePending}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"log"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -212,12 +213,17 @@ var _ = Describe("Manager", func() {
 			100*time.Millisecond,
 			100*time.Millisecond,
 			log.New(GinkgoWriter, "", 0),
+			binding.WithHealthProbes(newSpyProber(), 10*time.Millisecond),
 		)
 		go m.Run()
 
 		Eventually(func() []egress.Writer {
 			return m.GetDrains("app-1")
 		}).Should(HaveLen(1))
+		healthTags := map[string]string{"app_id": "app-1", "drain_id": m.Drains().Apps["app-1"][0].ID}
+		Eventually(func() bool {
+			return sm.HasMetric("drain_health", healthTags)
+		}).Should(BeTrue())
 
 		go func() {
 			for {
@@ -240,6 +246,7 @@ var _ = Describe("Manager", func() {
 		Consistently(func() float64 {
 			return sm.GetMetric("active_drains", map[string]string{"unit": "count"}).Value()
 		}).Should(Equal(1.0))
+		Expect(sm.HasMetric("drain_health", healthTags)).To(BeFalse())
 
 		// It re-activates on another get drains.
 		Eventually(func() []egress.Writer {
@@ -291,6 +298,39 @@ var _ = Describe("Manager", func() {
 		Expect(env).To(Equal(e))
 	})
 
+	It("cancels every drain when closed", func() {
+		bf.bindings <- []syslog.Binding{
+			{"app-1", "host-1", "syslog://drain.url.com"},
+		}
+
+		m := binding.NewManager(
+			bf,
+			c,
+			sm,
+			10*time.Second,
+			10*time.Minute,
+			log.New(GinkgoWriter, "", 0),
+			binding.WithAggregateDrains([]binding.AggregateDrain{
+				{URL: "syslog://aggregate.url.com"},
+			}),
+		)
+		go m.Run()
+
+		Eventually(func() []egress.Writer {
+			return m.GetDrains("app-1")
+		}).Should(HaveLen(2))
+
+		m.Close()
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for _, ctx := range c.bindingContextMap {
+			Expect(ctx.Err()).To(MatchError(context.Canceled))
+		}
+		Expect(c.bindingContextMap).To(HaveLen(2))
+		Expect(m.GetDrains("app-1")).To(BeEmpty())
+	})
+
 	It("maintains current state on error", func() {
 		bf.bindings <- []syslog.Binding{
 			{"app-1", "host-1", "syslog://drain.url.com"},
@@ -317,6 +357,257 @@ var _ = Describe("Manager", func() {
 		}).Should(Equal(1))
 	})
 
+	Context("with aggregate drains", func() {
+		It("returns aggregate drains for every source ID", func() {
+			bf.bindings <- []syslog.Binding{
+				{"app-1", "host-1", "syslog://drain.url.com"},
+			}
+
+			m := binding.NewManager(
+				bf,
+				c,
+				sm,
+				10*time.Second,
+				10*time.Minute,
+				log.New(GinkgoWriter, "", 0),
+				binding.WithAggregateDrains([]binding.AggregateDrain{
+					{URL: "syslog://aggregate.url.com"},
+				}),
+			)
+			go m.Run()
+
+			Eventually(func() []egress.Writer {
+				return m.GetDrains("app-1")
+			}).Should(HaveLen(2))
+			Expect(m.GetDrains("app-2")).To(HaveLen(1))
+			Expect(m.GetDrains("doppler")).To(HaveLen(1))
+
+			Expect(c.ConnectionCount()).To(BeNumerically("==", 2))
+			Expect(sm.GetMetric("aggregate_drains", map[string]string{"unit": "count"}).Value()).To(Equal(1.0))
+		})
+
+		It("only returns aggregate drains matching the source ID", func() {
+			m := binding.NewManager(
+				bf,
+				c,
+				sm,
+				10*time.Second,
+				10*time.Minute,
+				log.New(GinkgoWriter, "", 0),
+				binding.WithAggregateDrains([]binding.AggregateDrain{
+					{URL: "syslog://aggregate.url.com", SourceIDs: []string{"app-*"}},
+				}),
+			)
+
+			Expect(m.GetDrains("app-1")).To(HaveLen(1))
+			Expect(m.GetDrains("doppler")).To(HaveLen(0))
+		})
+
+		It("only writes envelopes matching the envelope types", func() {
+			m := binding.NewManager(
+				bf,
+				c,
+				sm,
+				10*time.Second,
+				10*time.Minute,
+				log.New(GinkgoWriter, "", 0),
+				binding.WithAggregateDrains([]binding.AggregateDrain{
+					{URL: "syslog://aggregate.url.com", EnvelopeTypes: []string{"counter"}},
+				}),
+			)
+
+			drains := m.GetDrains("app-1")
+			Expect(drains).To(HaveLen(1))
+
+			Expect(drains[0].Write(logEnvelope("app-1"))).To(Succeed())
+			Expect(drains[0].Write(counterEnvelope("app-1"))).To(Succeed())
+
+			spy := c.drains[syslog.Binding{Drain: "syslog://aggregate.url.com"}]
+			var env *loggregator_v2.Envelope
+			Eventually(spy.envelopes).Should(Receive(&env))
+			Expect(env.GetCounter()).ToNot(BeNil())
+			Consistently(spy.envelopes).ShouldNot(Receive())
+
+			Expect(sm.GetMetric("ingress", map[string]string{"scope": "aggregate_drains"}).Value()).To(Equal(1.0))
+		})
+
+		It("does not remove aggregate drains when bindings are updated", func() {
+			bf.bindings <- []syslog.Binding{
+				{"app-1", "host-1", "syslog://drain.url.com"},
+			}
+
+			m := binding.NewManager(
+				bf,
+				c,
+				sm,
+				10*time.Millisecond,
+				10*time.Minute,
+				log.New(GinkgoWriter, "", 0),
+				binding.WithAggregateDrains([]binding.AggregateDrain{
+					{URL: "syslog://aggregate.url.com"},
+				}),
+			)
+			go m.Run()
+
+			Eventually(func() []egress.Writer {
+				return m.GetDrains("app-1")
+			}).Should(HaveLen(2))
+
+			bf.bindings <- []syslog.Binding{}
+
+			Eventually(func() []egress.Writer {
+				return m.GetDrains("app-1")
+			}).Should(HaveLen(1))
+			Consistently(func() []egress.Writer {
+				return m.GetDrains("app-1")
+			}).Should(HaveLen(1))
+		})
+	})
+
+	Context("with eager connections", func() {
+		It("connects drains when the bindings arrive", func() {
+			bf.bindings <- []syslog.Binding{
+				{"app-1", "host-1", "syslog://drain.url.com"},
+				{"app-2", "host-2", "syslog://drain.url.com"},
+			}
+
+			m := binding.NewManager(
+				bf,
+				c,
+				sm,
+				10*time.Second,
+				10*time.Minute,
+				log.New(GinkgoWriter, "", 0),
+				binding.WithEagerConnect(),
+				binding.WithAggregateDrains([]binding.AggregateDrain{
+					{URL: "syslog://aggregate.url.com"},
+				}),
+			)
+			go m.Run()
+
+			Eventually(c.ConnectionCount).Should(BeNumerically("==", 3))
+			Expect(sm.GetMetric("active_drains", map[string]string{"unit": "count"}).Value()).To(Equal(2.0))
+
+			Eventually(func() int64 {
+				c.mu.Lock()
+				defer c.mu.Unlock()
+
+				var dials int64
+				for _, d := range c.drains {
+					dials += d.Dials()
+				}
+				return dials
+			}).Should(BeNumerically("==", 3))
+
+			Expect(m.GetDrains("app-1")).To(HaveLen(2))
+			Expect(c.ConnectionCount()).To(BeNumerically("==", 3))
+		})
+
+		It("does not close idle drains", func() {
+			bf.bindings <- []syslog.Binding{
+				{"app-1", "host-1", "syslog://drain.url.com"},
+			}
+
+			m := binding.NewManager(
+				bf,
+				c,
+				sm,
+				10*time.Second,
+				10*time.Millisecond,
+				log.New(GinkgoWriter, "", 0),
+				binding.WithEagerConnect(),
+			)
+			go m.Run()
+
+			Eventually(c.ConnectionCount).Should(BeNumerically("==", 1))
+			Expect(m.GetDrains("app-1")).To(HaveLen(1))
+
+			Consistently(func() float64 {
+				return sm.GetMetric("active_drains", map[string]string{"unit": "count"}).Value()
+			}).Should(Equal(1.0))
+			Expect(c.ConnectionCount()).To(BeNumerically("==", 1))
+		})
+	})
+
+	Context("with health probes", func() {
+		It("reports the health of connected drains", func() {
+			bf.bindings <- []syslog.Binding{
+				{"app-1", "host-1", "syslog://drain.url.com"},
+				{"app-2", "host-2", "syslog://unhealthy.url.com"},
+				{"app-3", "host-3", "syslog://drain.url.com"},
+			}
+
+			p := newSpyProber()
+			m := binding.NewManager(
+				bf,
+				c,
+				sm,
+				10*time.Second,
+				10*time.Minute,
+				log.New(GinkgoWriter, "", 0),
+				binding.WithHealthProbes(p, 10*time.Millisecond),
+			)
+			go m.Run()
+
+			Eventually(func() []egress.Writer {
+				return m.GetDrains("app-1")
+			}).Should(HaveLen(1))
+			Expect(m.GetDrains("app-2")).To(HaveLen(1))
+
+			healthy := m.Drains().Apps["app-1"][0].ID
+			unhealthy := m.Drains().Apps["app-2"][0].ID
+
+			Eventually(func() bool {
+				return sm.HasMetric("drain_health", map[string]string{"app_id": "app-2", "drain_id": unhealthy})
+			}).Should(BeTrue())
+			Expect(sm.GetMetric("drain_health", map[string]string{"app_id": "app-2", "drain_id": unhealthy}).Value()).To(Equal(0.0))
+
+			Eventually(func() bool {
+				return sm.HasMetric("drain_health", map[string]string{"app_id": "app-1", "drain_id": healthy})
+			}).Should(BeTrue())
+			Eventually(func() float64 {
+				return sm.GetMetric("drain_health", map[string]string{"app_id": "app-1", "drain_id": healthy}).Value()
+			}).Should(Equal(1.0))
+
+			Consistently(p.ProbedApps).ShouldNot(ContainElement("app-3"))
+		})
+
+		It("removes the health of removed drains", func() {
+			bf.bindings <- []syslog.Binding{
+				{"app-1", "host-1", "syslog://drain.url.com"},
+			}
+
+			m := binding.NewManager(
+				bf,
+				c,
+				sm,
+				10*time.Millisecond,
+				10*time.Minute,
+				log.New(GinkgoWriter, "", 0),
+				binding.WithHealthProbes(newSpyProber(), 10*time.Millisecond),
+			)
+			go m.Run()
+
+			Eventually(func() []egress.Writer {
+				return m.GetDrains("app-1")
+			}).Should(HaveLen(1))
+			tags := map[string]string{"app_id": "app-1", "drain_id": m.Drains().Apps["app-1"][0].ID}
+
+			Eventually(func() bool {
+				return sm.HasMetric("drain_health", tags)
+			}).Should(BeTrue())
+
+			bf.bindings <- []syslog.Binding{}
+
+			Eventually(func() bool {
+				return sm.HasMetric("drain_health", tags)
+			}).Should(BeFalse())
+			Consistently(func() bool {
+				return sm.HasMetric("drain_health", tags)
+			}).Should(BeFalse())
+		})
+	})
+
 	It("should not return a drain for binding to an invalid address", func() {
 		bf.bindings <- []syslog.Binding{
 			{"app-1", "host-1", "syslog-v3-v3://drain.url.com"},
@@ -340,6 +631,7 @@ var _ = Describe("Manager", func() {
 
 type spyDrain struct {
 	envelopes chan *loggregator_v2.Envelope
+	dials     int64
 }
 
 func newSpyDrain() *spyDrain {
@@ -353,14 +645,54 @@ func (s *spyDrain) Write(e *loggregator_v2.Envelope) error {
 	return nil
 }
 
+func (s *spyDrain) Dial() error {
+	atomic.AddInt64(&s.dials, 1)
+	return nil
+}
+
+func (s *spyDrain) Dials() int64 {
+	return atomic.LoadInt64(&s.dials)
+}
+
+type spyProber struct {
+	mu         sync.Mutex
+	probedApps []string
+}
+
+func newSpyProber() *spyProber {
+	return &spyProber{}
+}
+
+func (p *spyProber) Probe(ctx context.Context, b syslog.Binding) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.probedApps = append(p.probedApps, b.AppId)
+	if strings.Contains(b.Drain, "unhealthy") {
+		return errors.New("connection refused")
+	}
+
+	return nil
+}
+
+func (p *spyProber) ProbedApps() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]string(nil), p.probedApps...)
+}
+
 type spyConnector struct {
+	mu                sync.Mutex
 	connectionCount   int64
 	bindingContextMap map[syslog.Binding]context.Context
+	drains            map[syslog.Binding]*spyDrain
 }
 
 func newSpyConnector() *spyConnector {
 	return &spyConnector{
 		bindingContextMap: make(map[syslog.Binding]context.Context),
+		drains:            make(map[syslog.Binding]*spyDrain),
 	}
 }
 
@@ -370,9 +702,14 @@ func (c *spyConnector) ConnectionCount() int64 {
 
 func (c *spyConnector) Connect(ctx context.Context, b syslog.Binding) (egress.Writer, error) {
 	if strings.HasPrefix(b.Drain, "syslog://") {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		d := newSpyDrain()
 		c.bindingContextMap[b] = ctx
+		c.drains[b] = d
 		atomic.AddInt64(&c.connectionCount, 1)
-		return newSpyDrain(), nil
+		return d, nil
 	}
 
 	return nil, errors.New("invalid hostname")
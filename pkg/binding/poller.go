@@ -5,12 +5,25 @@ import (
 	"log"
 	"net/http"
 	"time"
+
+	"code.cloudfoundry.org/loggregator-agent/pkg/health"
 )
 
 type Poller struct {
 	apiClient       client
 	pollingInterval time.Duration
 	store           Setter
+	freshness       *health.Freshness
+}
+
+// PollerOption configures a Poller.
+type PollerOption func(*Poller)
+
+// WithFreshness records the outcome of every poll.
+func WithFreshness(f *health.Freshness) PollerOption {
+	return func(p *Poller) {
+		p.freshness = f
+	}
 }
 
 type client interface {
@@ -27,12 +40,17 @@ type Setter interface {
 	Set([]Binding)
 }
 
-func NewPoller(ac client, pi time.Duration, s Setter) *Poller {
+func NewPoller(ac client, pi time.Duration, s Setter, opts ...PollerOption) *Poller {
 	p := &Poller{
 		apiClient:       ac,
 		pollingInterval: pi,
 		store:           s,
 	}
+
+	for _, o := range opts {
+		o(p)
+	}
+
 	p.poll()
 	return p
 }
@@ -47,9 +65,13 @@ func (p *Poller) Poll() {
 
 func (p *Poller) poll() {
 	nextID := 0
-	var bindings []Binding
+	var (
+		bindings []Binding
+		err      error
+	)
 	for {
-		resp, err := p.apiClient.Get(nextID)
+		var resp *http.Response
+		resp, err = p.apiClient.Get(nextID)
 		if err != nil {
 			log.Printf("failed to get id %d from CUPS Provider: %s", nextID, err)
 			break
@@ -69,6 +91,10 @@ func (p *Poller) poll() {
 		}
 	}
 	p.store.Set(bindings)
+
+	if p.freshness != nil {
+		p.freshness.Record(err)
+	}
 }
 
 func (p *Poller) toBindings(aResp apiResponse) []Binding {
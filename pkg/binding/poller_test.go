@@ -3,6 +3,7 @@ package binding_test
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"net/http"
 	"sync/atomic"
@@ -12,6 +13,7 @@ import (
 	. "github.com/onsi/gomega"
 
 	"code.cloudfoundry.org/loggregator-agent/pkg/binding"
+	"code.cloudfoundry.org/loggregator-agent/pkg/health"
 )
 
 var _ = Describe("Poller", func() {
@@ -103,12 +105,24 @@ var _ = Describe("Poller", func() {
 
 		Expect(apiClient.requestedIDs).To(ConsistOf(0, 2))
 	})
+
+	It("records the outcome of every poll", func() {
+		f := health.NewFreshness(time.Minute)
+		binding.NewPoller(apiClient, time.Minute, store, binding.WithFreshness(f))
+		Expect(f.Check()).To(Succeed())
+
+		apiClient.err = errors.New("some-error")
+		f = health.NewFreshness(time.Minute)
+		binding.NewPoller(apiClient, time.Minute, store, binding.WithFreshness(f))
+		Expect(f.LastError()).To(MatchError("last attempt failed: some-error"))
+	})
 })
 
 type fakeAPIClient struct {
 	numRequests  int64
 	bindings     chan response
 	requestedIDs []int
+	err          error
 }
 
 func newFakeAPIClient() *fakeAPIClient {
@@ -119,6 +133,9 @@ func newFakeAPIClient() *fakeAPIClient {
 
 func (c *fakeAPIClient) Get(nextID int) (*http.Response, error) {
 	atomic.AddInt64(&c.numRequests, 1)
+	if c.err != nil {
+		return nil, c.err
+	}
 
 	var binding response
 	select {
@@ -2,6 +2,7 @@ package v2
 
 import (
 	"errors"
+	"io"
 	"math/rand"
 	"sync/atomic"
 	"unsafe"
@@ -41,3 +42,34 @@ func (c *ClientPool) Write(msgs []*loggregator_v2.Envelope) error {
 
 	return errors.New("unable to write to any dopplers")
 }
+
+// Connected returns the number of connections that have a stream to
+// doppler. Connections that do not report their state are not counted.
+func (c *ClientPool) Connected() int {
+	var n int
+	for i := range c.conns {
+		conn := *(*Conn)(atomic.LoadPointer(&c.conns[i]))
+
+		if cc, ok := conn.(interface{ Connected() bool }); ok && cc.Connected() {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Close closes every connection that can be closed.
+func (c *ClientPool) Close() error {
+	var err error
+	for i := range c.conns {
+		conn := *(*Conn)(atomic.LoadPointer(&c.conns[i]))
+
+		if closer, ok := conn.(io.Closer); ok {
+			if cerr := closer.Close(); cerr != nil {
+				err = cerr
+			}
+		}
+	}
+
+	return err
+}
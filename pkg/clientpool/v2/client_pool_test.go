@@ -11,8 +11,9 @@ import (
 )
 
 type SpyConn struct {
-	err  error
-	data []*loggregator_v2.Envelope
+	err       error
+	data      []*loggregator_v2.Envelope
+	connected bool
 }
 
 func (s *SpyConn) Write(e []*loggregator_v2.Envelope) error {
@@ -20,6 +21,10 @@ func (s *SpyConn) Write(e []*loggregator_v2.Envelope) error {
 	return s.err
 }
 
+func (s *SpyConn) Connected() bool {
+	return s.connected
+}
+
 var _ = Describe("ClientPool", func() {
 	var (
 		pool  *clientpool.ClientPool
@@ -73,6 +78,17 @@ var _ = Describe("ClientPool", func() {
 			})
 		})
 	})
+
+	Describe("Connected()", func() {
+		It("counts the connections to doppler", func() {
+			Expect(pool.Connected()).To(Equal(0))
+
+			conns[1].connected = true
+			conns[3].connected = true
+
+			Expect(pool.Connected()).To(Equal(2))
+		})
+	})
 })
 
 func chooseData(conns []*SpyConn) (idx int, value *loggregator_v2.Envelope) {
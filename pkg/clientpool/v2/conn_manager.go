@@ -29,6 +29,7 @@ type ConnManager struct {
 
 	ticker *time.Ticker
 	reset  chan bool
+	done   chan struct{}
 }
 
 func NewConnManager(c Connector, maxWrites int64, pollDuration time.Duration) *ConnManager {
@@ -38,6 +39,7 @@ func NewConnManager(c Connector, maxWrites int64, pollDuration time.Duration) *C
 		connector:    c,
 		ticker:       time.NewTicker(pollDuration),
 		reset:        make(chan bool, 100),
+		done:         make(chan struct{}),
 	}
 	go m.maintainConn()
 	return m
@@ -70,13 +72,40 @@ func (m *ConnManager) Write(envelopes []*loggregator_v2.Envelope) error {
 	return nil
 }
 
+// Connected reports whether there is a stream to doppler.
+func (m *ConnManager) Connected() bool {
+	conn := atomic.LoadPointer(&m.conn)
+	return conn != nil && (*v2GRPCConn)(conn) != nil
+}
+
+// Close stops reconnecting and closes the current stream once doppler has
+// received everything that was written to it.
+func (m *ConnManager) Close() error {
+	close(m.done)
+	m.ticker.Stop()
+
+	conn := atomic.SwapPointer(&m.conn, nil)
+	if conn == nil || (*v2GRPCConn)(conn) == nil {
+		return nil
+	}
+
+	gRPCConn := (*v2GRPCConn)(conn)
+	if _, err := gRPCConn.client.CloseAndRecv(); err != nil && err != io.EOF {
+		log.Printf("error closing stream to doppler: %s", err)
+	}
+
+	return gRPCConn.closer.Close()
+}
+
 func (m *ConnManager) maintainConn() {
 
 	// Ensure initial connection does not wait on timer
 	m.reset <- true
 
 	for {
-		m.checkConnectionTimer()
+		if !m.checkConnectionTimer() {
+			return
+		}
 
 		conn := atomic.LoadPointer(&m.conn)
 		if conn != nil && (*v2GRPCConn)(conn) != nil {
@@ -96,9 +125,15 @@ func (m *ConnManager) maintainConn() {
 	}
 }
 
-func (m *ConnManager) checkConnectionTimer() {
+// checkConnectionTimer waits until the connection should be checked. It
+// returns false once the manager is closed.
+func (m *ConnManager) checkConnectionTimer() bool {
 	select {
 	case <-m.ticker.C:
 	case <-m.reset:
+	case <-m.done:
+		return false
 	}
+
+	return true
 }
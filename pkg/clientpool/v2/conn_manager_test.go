@@ -42,8 +42,9 @@ func (s *SpyConnector) called() int {
 type SpyClient struct {
 	loggregator_v2.Ingress_BatchSenderClient
 
-	batch *loggregator_v2.EnvelopeBatch
-	err   error
+	batch        *loggregator_v2.EnvelopeBatch
+	err          error
+	closedStream bool
 }
 
 func (s *SpyClient) Send(e *loggregator_v2.EnvelopeBatch) error {
@@ -51,6 +52,11 @@ func (s *SpyClient) Send(e *loggregator_v2.EnvelopeBatch) error {
 	return s.err
 }
 
+func (s *SpyClient) CloseAndRecv() (*loggregator_v2.BatchSenderResponse, error) {
+	s.closedStream = true
+	return &loggregator_v2.BatchSenderResponse{}, nil
+}
+
 type SpyCloser struct {
 	called int
 }
@@ -79,6 +85,10 @@ var _ = Describe("ConnManager", func() {
 			connManager = clientpool.NewConnManager(connector, 5, time.Minute)
 		})
 
+		It("is connected", func() {
+			Eventually(connManager.Connected).Should(BeTrue())
+		})
+
 		It("sends the message down the connection", func() {
 			e := &loggregator_v2.Envelope{SourceId: "some-uuid"}
 			f := func() error {
@@ -117,6 +127,21 @@ var _ = Describe("ConnManager", func() {
 				Expect(closer.called).To(Equal(1))
 			})
 		})
+
+		It("closes the stream and the connection", func() {
+			f := func() error {
+				return connManager.Write(nil)
+			}
+			Eventually(f).Should(Succeed())
+
+			Expect(connManager.Close()).To(Succeed())
+
+			Expect(senderClient.closedStream).To(BeTrue())
+			Expect(closer.called).To(Equal(1))
+			Expect(connManager.Connected()).To(BeFalse())
+			Expect(connManager.Write(nil)).To(HaveOccurred())
+			Consistently(connector.called, 100*time.Millisecond).Should(Equal(1))
+		})
 	})
 
 	Context("when a connection is not able to be established", func() {
@@ -133,5 +158,9 @@ var _ = Describe("ConnManager", func() {
 			}
 			Consistently(f).Should(HaveOccurred())
 		})
+
+		It("is not connected", func() {
+			Consistently(connManager.Connected).Should(BeFalse())
+		})
 	})
 })
@@ -0,0 +1,98 @@
+package diodes
+
+import (
+	"log"
+	"sync/atomic"
+
+	gendiodes "code.cloudfoundry.org/go-diodes"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+// LosslessEnvelopeV2 diode puts envelopes of lossless sources in a bounded
+// buffer in front of a diode for all other envelopes. Writers reserve room
+// in the bounded buffer before they set envelopes on it, so it never drops
+// envelopes. The reader reads the bounded buffer first.
+type LosslessEnvelopeV2 struct {
+	lossy    EnvelopeV2Diode
+	lossless *gendiodes.ManyToOne
+	o        *Occupancy
+	size     int64
+	reserved int64
+	notify   chan struct{}
+}
+
+// NewLosslessEnvelopeV2 returns a LosslessEnvelopeV2 diode with a bounded
+// buffer of the given size in front of the given diode. Envelopes in the
+// bounded buffer are counted by the occupancy.
+func NewLosslessEnvelopeV2(size int, lossy EnvelopeV2Diode, o *Occupancy) *LosslessEnvelopeV2 {
+	return &LosslessEnvelopeV2{
+		lossy: lossy,
+		lossless: gendiodes.NewManyToOne(size, gendiodes.AlertFunc(func(missed int) {
+			log.Printf("Dropped %d lossless v2 envelopes", missed)
+		})),
+		o:      o,
+		size:   int64(size),
+		notify: make(chan struct{}, 1),
+	}
+}
+
+// Set inserts the given V2 envelope into the diode of lossy envelopes.
+func (d *LosslessEnvelopeV2) Set(data *loggregator_v2.Envelope) {
+	d.lossy.Set(data)
+	d.signal()
+}
+
+// Reserve reserves room for n envelopes in the bounded buffer. It returns
+// false without reserving anything if there is not enough room.
+func (d *LosslessEnvelopeV2) Reserve(n int) bool {
+	for {
+		reserved := atomic.LoadInt64(&d.reserved)
+		if reserved+int64(n) > d.size {
+			return false
+		}
+
+		if atomic.CompareAndSwapInt64(&d.reserved, reserved, reserved+int64(n)) {
+			return true
+		}
+	}
+}
+
+// SetReserved inserts the given V2 envelope into the bounded buffer. Room
+// for it must have been reserved.
+func (d *LosslessEnvelopeV2) SetReserved(data *loggregator_v2.Envelope) {
+	d.o.Enqueue()
+	d.lossless.Set(gendiodes.GenericDataType(data))
+	d.signal()
+}
+
+// TryNext returns the next V2 envelope to be read from the diode. If the
+// diode is empty it will return a nil envelope and false for the bool.
+func (d *LosslessEnvelopeV2) TryNext() (*loggregator_v2.Envelope, bool) {
+	if data, ok := d.lossless.TryNext(); ok {
+		d.o.Dequeue()
+		atomic.AddInt64(&d.reserved, -1)
+		return (*loggregator_v2.Envelope)(data), true
+	}
+
+	return d.lossy.TryNext()
+}
+
+// Next will return the next V2 envelope to be read from the diode. If the
+// diode is empty this method will block until an envelope is available to
+// be read.
+func (d *LosslessEnvelopeV2) Next() *loggregator_v2.Envelope {
+	for {
+		if e, ok := d.TryNext(); ok {
+			return e
+		}
+
+		<-d.notify
+	}
+}
+
+func (d *LosslessEnvelopeV2) signal() {
+	select {
+	case d.notify <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,105 @@
+package diodes_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	gendiodes "code.cloudfoundry.org/go-diodes"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/pkg/diodes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LosslessEnvelopeV2", func() {
+	var (
+		occupancy *diodes.Occupancy
+		d         *diodes.LosslessEnvelopeV2
+	)
+
+	BeforeEach(func() {
+		occupancy = diodes.NewOccupancy()
+		lossy := diodes.NewTrackedEnvelopeV2(
+			diodes.NewManyToOneEnvelopeV2(5, occupancy.Alerter(gendiodes.AlertFunc(func(int) {}))),
+			occupancy,
+		)
+		d = diodes.NewLosslessEnvelopeV2(10, lossy, occupancy)
+	})
+
+	It("does not lose lossless envelopes while lossy envelopes flood the diode", func() {
+		Expect(d.Reserve(10)).To(BeTrue())
+		for i := 0; i < 10; i++ {
+			d.SetReserved(&loggregator_v2.Envelope{SourceId: fmt.Sprintf("lossless-%d", i)})
+		}
+		for i := 0; i < 100; i++ {
+			d.Set(&loggregator_v2.Envelope{SourceId: "lossy"})
+		}
+
+		var ids []string
+		for {
+			e, ok := d.TryNext()
+			if !ok {
+				break
+			}
+			if e.SourceId != "lossy" {
+				ids = append(ids, e.SourceId)
+			}
+		}
+
+		Expect(ids).To(HaveLen(10))
+		for i, id := range ids {
+			Expect(id).To(Equal(fmt.Sprintf("lossless-%d", i)))
+		}
+		Expect(occupancy.Fill()).To(BeZero())
+	})
+
+	It("does not reserve more room than it has", func() {
+		Expect(d.Reserve(8)).To(BeTrue())
+		Expect(d.Reserve(3)).To(BeFalse())
+		Expect(d.Reserve(2)).To(BeTrue())
+		Expect(d.Reserve(1)).To(BeFalse())
+	})
+
+	It("frees room when envelopes are read", func() {
+		Expect(d.Reserve(10)).To(BeTrue())
+		d.SetReserved(&loggregator_v2.Envelope{})
+
+		_, ok := d.TryNext()
+		Expect(ok).To(BeTrue())
+		Expect(d.Reserve(1)).To(BeTrue())
+		Expect(d.Reserve(1)).To(BeFalse())
+	})
+
+	It("never reserves more room than it has for concurrent writers", func() {
+		var (
+			wg       sync.WaitGroup
+			reserved int64
+		)
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if d.Reserve(3) {
+					atomic.AddInt64(&reserved, 3)
+				}
+			}()
+		}
+		wg.Wait()
+
+		Expect(atomic.LoadInt64(&reserved)).To(Equal(int64(9)))
+	})
+
+	It("wakes up a blocked reader", func() {
+		envs := make(chan *loggregator_v2.Envelope)
+		go func() {
+			envs <- d.Next()
+		}()
+
+		Expect(d.Reserve(1)).To(BeTrue())
+		d.SetReserved(&loggregator_v2.Envelope{SourceId: "some-id"})
+
+		Eventually(envs).Should(Receive(Equal(&loggregator_v2.Envelope{SourceId: "some-id"})))
+	})
+})
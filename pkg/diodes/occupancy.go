@@ -0,0 +1,221 @@
+package diodes
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	gendiodes "code.cloudfoundry.org/go-diodes"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/pkg/metrics"
+)
+
+// Occupancy counts the envelopes that enter and leave diodes to give their
+// fill level. Writers only add to a counter. The high water mark is updated
+// by the reader and the OccupancyReporter. An Occupancy may be shared by
+// several diodes to track their total fill level.
+type Occupancy struct {
+	enqueued  int64
+	dequeued  int64
+	dropped   int64
+	highWater int64
+}
+
+// NewOccupancy returns an empty Occupancy.
+func NewOccupancy() *Occupancy {
+	return &Occupancy{}
+}
+
+// Enqueue counts an envelope that was set on a diode.
+func (o *Occupancy) Enqueue() {
+	atomic.AddInt64(&o.enqueued, 1)
+}
+
+// Dequeue counts an envelope that was read from a diode.
+func (o *Occupancy) Dequeue() {
+	o.observe(o.Fill())
+	atomic.AddInt64(&o.dequeued, 1)
+}
+
+// Drop counts envelopes that were dropped by a diode.
+func (o *Occupancy) Drop(n int) {
+	atomic.AddInt64(&o.dropped, int64(n))
+}
+
+// Fill returns the number of envelopes in the diodes.
+func (o *Occupancy) Fill() int64 {
+	fill := atomic.LoadInt64(&o.enqueued) -
+		atomic.LoadInt64(&o.dequeued) -
+		atomic.LoadInt64(&o.dropped)
+	if fill < 0 {
+		return 0
+	}
+
+	return fill
+}
+
+// HighWater returns the highest fill level since it was last reset.
+func (o *Occupancy) HighWater() int64 {
+	o.observe(o.Fill())
+	return atomic.LoadInt64(&o.highWater)
+}
+
+// resetHighWater returns the high water mark and resets it to the current
+// fill level.
+func (o *Occupancy) resetHighWater() int64 {
+	fill := o.Fill()
+	hw := atomic.SwapInt64(&o.highWater, fill)
+	if fill > hw {
+		return fill
+	}
+
+	return hw
+}
+
+func (o *Occupancy) observe(fill int64) {
+	for {
+		hw := atomic.LoadInt64(&o.highWater)
+		if fill <= hw || atomic.CompareAndSwapInt64(&o.highWater, hw, fill) {
+			return
+		}
+	}
+}
+
+// Alerter returns an alerter that counts the dropped envelopes before
+// calling the given alerter.
+func (o *Occupancy) Alerter(a gendiodes.Alerter) gendiodes.Alerter {
+	return gendiodes.AlertFunc(func(missed int) {
+		o.Drop(missed)
+		a.Alert(missed)
+	})
+}
+
+// ClassAlerter returns a class alerter that counts the dropped envelopes
+// before calling the given alerter.
+func (o *Occupancy) ClassAlerter(a ClassAlerter) ClassAlerter {
+	return ClassAlertFunc(func(class string, missed int) {
+		o.Drop(missed)
+		a.Alert(class, missed)
+	})
+}
+
+// TrackedEnvelopeV2 counts the envelopes that are set on and read from a
+// diode. Dropped envelopes must be counted by the alerter of the diode.
+type TrackedEnvelopeV2 struct {
+	d EnvelopeV2Diode
+	o *Occupancy
+}
+
+// NewTrackedEnvelopeV2 returns a TrackedEnvelopeV2 for the given diode.
+func NewTrackedEnvelopeV2(d EnvelopeV2Diode, o *Occupancy) *TrackedEnvelopeV2 {
+	return &TrackedEnvelopeV2{
+		d: d,
+		o: o,
+	}
+}
+
+// Set inserts the given V2 envelope into the diode.
+func (t *TrackedEnvelopeV2) Set(data *loggregator_v2.Envelope) {
+	t.o.Enqueue()
+	t.d.Set(data)
+}
+
+// TryNext returns the next V2 envelope to be read from the diode.
+func (t *TrackedEnvelopeV2) TryNext() (*loggregator_v2.Envelope, bool) {
+	e, ok := t.d.TryNext()
+	if ok {
+		t.o.Dequeue()
+	}
+
+	return e, ok
+}
+
+// Next returns the next V2 envelope to be read from the diode.
+func (t *TrackedEnvelopeV2) Next() *loggregator_v2.Envelope {
+	e := t.d.Next()
+	if e != nil {
+		t.o.Dequeue()
+	}
+
+	return e
+}
+
+// OccupancyReporter periodically sets gauges to the fill levels and high
+// water marks of occupancies. The high water mark is the highest fill
+// level since the previous report.
+type OccupancyReporter struct {
+	interval time.Duration
+
+	mu      sync.Mutex
+	entries map[*Occupancy]occupancyGauges
+	stop    chan struct{}
+}
+
+type occupancyGauges struct {
+	fill      metrics.Gauge
+	highWater metrics.Gauge
+}
+
+// NewOccupancyReporter returns an OccupancyReporter that reports at the
+// given interval.
+func NewOccupancyReporter(interval time.Duration) *OccupancyReporter {
+	return &OccupancyReporter{
+		interval: interval,
+		entries:  make(map[*Occupancy]occupancyGauges),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Add reports the occupancy with the given gauges.
+func (r *OccupancyReporter) Add(o *Occupancy, fill, highWater metrics.Gauge) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries[o] = occupancyGauges{
+		fill:      fill,
+		highWater: highWater,
+	}
+}
+
+// Remove stops reporting the occupancy. Its gauges are set to zero.
+func (r *OccupancyReporter) Remove(o *Occupancy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if g, ok := r.entries[o]; ok {
+		g.fill.Set(0)
+		g.highWater.Set(0)
+		delete(r.entries, o)
+	}
+}
+
+// Report sets the gauges of all occupancies.
+func (r *OccupancyReporter) Report() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for o, g := range r.entries {
+		g.fill.Set(float64(o.Fill()))
+		g.highWater.Set(float64(o.resetHighWater()))
+	}
+}
+
+// Start reports at every interval until Stop is called.
+func (r *OccupancyReporter) Start() {
+	t := time.NewTicker(r.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			r.Report()
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// Stop stops reporting.
+func (r *OccupancyReporter) Stop() {
+	close(r.stop)
+}
@@ -0,0 +1,112 @@
+package diodes_test
+
+import (
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/internal/testhelper"
+	"code.cloudfoundry.org/loggregator-agent/pkg/diodes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Occupancy", func() {
+	var (
+		o *diodes.Occupancy
+		m *testhelper.SpyMetricClient
+	)
+
+	BeforeEach(func() {
+		o = diodes.NewOccupancy()
+		m = testhelper.NewMetricClient()
+	})
+
+	It("tracks the fill level of a diode", func() {
+		d := diodes.NewManyToOneEnvelopeV2(5, o.Alerter(newSpyAlerter()))
+		tracked := diodes.NewTrackedEnvelopeV2(d, o)
+
+		for i := 0; i < 3; i++ {
+			tracked.Set(&loggregator_v2.Envelope{})
+		}
+		Expect(o.Fill()).To(Equal(int64(3)))
+
+		_, ok := tracked.TryNext()
+		Expect(ok).To(BeTrue())
+		Expect(o.Fill()).To(Equal(int64(2)))
+		Expect(o.HighWater()).To(Equal(int64(3)))
+	})
+
+	It("does not count dropped envelopes", func() {
+		d := diodes.NewManyToOneEnvelopeV2(5, o.Alerter(newSpyAlerter()))
+		tracked := diodes.NewTrackedEnvelopeV2(d, o)
+
+		for i := 0; i < 12; i++ {
+			tracked.Set(&loggregator_v2.Envelope{})
+		}
+		for {
+			if _, ok := tracked.TryNext(); !ok {
+				break
+			}
+		}
+
+		Expect(o.Fill()).To(BeZero())
+	})
+
+	It("never reports a negative fill level", func() {
+		o.Drop(3)
+
+		Expect(o.Fill()).To(BeZero())
+	})
+
+	It("reports the fill level and high water mark", func() {
+		r := diodes.NewOccupancyReporter(0)
+		r.Add(o, m.NewGauge("queue_depth"), m.NewGauge("queue_high_water"))
+
+		for i := 0; i < 4; i++ {
+			o.Enqueue()
+		}
+		for i := 0; i < 3; i++ {
+			o.Dequeue()
+		}
+		r.Report()
+
+		Expect(m.GetMetric("queue_depth", nil).Value()).To(Equal(1.0))
+		Expect(m.GetMetric("queue_high_water", nil).Value()).To(Equal(4.0))
+	})
+
+	It("resets the high water mark after every report", func() {
+		r := diodes.NewOccupancyReporter(0)
+		r.Add(o, m.NewGauge("queue_depth"), m.NewGauge("queue_high_water"))
+
+		o.Enqueue()
+		o.Enqueue()
+		o.Dequeue()
+		r.Report()
+		r.Report()
+
+		Expect(m.GetMetric("queue_high_water", nil).Value()).To(Equal(1.0))
+	})
+
+	It("zeroes the gauges of removed occupancies", func() {
+		r := diodes.NewOccupancyReporter(0)
+		r.Add(o, m.NewGauge("queue_depth"), m.NewGauge("queue_high_water"))
+
+		o.Enqueue()
+		r.Report()
+		r.Remove(o)
+
+		Expect(m.GetMetric("queue_depth", nil).Value()).To(BeZero())
+		Expect(m.GetMetric("queue_high_water", nil).Value()).To(BeZero())
+	})
+})
+
+type spyAlerter struct {
+	missed int
+}
+
+func newSpyAlerter() *spyAlerter {
+	return &spyAlerter{}
+}
+
+func (s *spyAlerter) Alert(missed int) {
+	s.missed += missed
+}
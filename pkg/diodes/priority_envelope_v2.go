@@ -0,0 +1,192 @@
+package diodes
+
+import (
+	gendiodes "code.cloudfoundry.org/go-diodes"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+// Classes of the PriorityEnvelopeV2 diode. Every envelope type is a class.
+// Envelopes without a message are in the log class.
+const (
+	ClassLog     = "log"
+	ClassEvent   = "event"
+	ClassTimer   = "timer"
+	ClassCounter = "counter"
+	ClassGauge   = "gauge"
+)
+
+// Classes are all classes of the PriorityEnvelopeV2 diode.
+var Classes = []string{ClassLog, ClassEvent, ClassTimer, ClassCounter, ClassGauge}
+
+// EnvelopeV2Diode is a diode of V2 envelopes with many writers and a single
+// reader.
+type EnvelopeV2Diode interface {
+	Set(*loggregator_v2.Envelope)
+	TryNext() (*loggregator_v2.Envelope, bool)
+	Next() *loggregator_v2.Envelope
+}
+
+// ClassAlerter is called when envelopes of a class are dropped.
+type ClassAlerter interface {
+	Alert(class string, missed int)
+}
+
+// ClassAlertFunc type is an adapter to allow the use of ordinary functions
+// as a ClassAlerter.
+type ClassAlertFunc func(class string, missed int)
+
+// Alert calls f(class, missed).
+func (f ClassAlertFunc) Alert(class string, missed int) {
+	f(class, missed)
+}
+
+// PriorityOption configures a PriorityEnvelopeV2 diode.
+type PriorityOption func(*priorityConfig)
+
+// WithClassSize sets the size of the buffer of a class.
+func WithClassSize(class string, size int) PriorityOption {
+	return func(c *priorityConfig) {
+		c.sizes[class] = size
+	}
+}
+
+// WithClassWeight sets how many envelopes of a class are read before the
+// next class is read. Classes with a weight of zero are only read when all
+// other classes are empty.
+func WithClassWeight(class string, weight int) PriorityOption {
+	return func(c *priorityConfig) {
+		c.weights[class] = weight
+	}
+}
+
+type priorityConfig struct {
+	sizes   map[string]int
+	weights map[string]int
+}
+
+// PriorityEnvelopeV2 diode has a buffer per class for many writers and a
+// single reader for V2 envelopes. Classes are read in turns of their
+// weight. By default logs and events are read four times and timers and
+// counters twice as often as gauges so that the buffers of metrics are
+// full and drop envelopes before the buffers of logs.
+type PriorityEnvelopeV2 struct {
+	classes []*priorityClass
+	notify  chan struct{}
+
+	// current and credits are only used by the reader.
+	current int
+	credits int
+}
+
+type priorityClass struct {
+	name   string
+	weight int
+	d      *gendiodes.ManyToOne
+}
+
+// NewPriorityEnvelopeV2 returns a new PriorityEnvelopeV2 diode with buffers
+// of the given size to be used with many writers and a single reader.
+func NewPriorityEnvelopeV2(size int, alerter ClassAlerter, opts ...PriorityOption) *PriorityEnvelopeV2 {
+	c := priorityConfig{
+		sizes: make(map[string]int),
+		weights: map[string]int{
+			ClassLog:     4,
+			ClassEvent:   4,
+			ClassTimer:   2,
+			ClassCounter: 2,
+			ClassGauge:   1,
+		},
+	}
+	for _, n := range Classes {
+		c.sizes[n] = size
+	}
+
+	for _, o := range opts {
+		o(&c)
+	}
+
+	d := &PriorityEnvelopeV2{
+		notify: make(chan struct{}, 1),
+	}
+	for _, n := range Classes {
+		name := n
+		d.classes = append(d.classes, &priorityClass{
+			name:   name,
+			weight: c.weights[name],
+			d: gendiodes.NewManyToOne(c.sizes[name], gendiodes.AlertFunc(func(missed int) {
+				alerter.Alert(name, missed)
+			})),
+		})
+	}
+	d.credits = d.classes[0].weight
+
+	return d
+}
+
+// Set inserts the given V2 envelope into the buffer of its class.
+func (d *PriorityEnvelopeV2) Set(data *loggregator_v2.Envelope) {
+	d.classes[classIndex(data)].d.Set(gendiodes.GenericDataType(data))
+
+	select {
+	case d.notify <- struct{}{}:
+	default:
+	}
+}
+
+// TryNext returns the next V2 envelope to be read from the diode. If the
+// diode is empty it will return a nil envelope and false for the bool.
+func (d *PriorityEnvelopeV2) TryNext() (*loggregator_v2.Envelope, bool) {
+	for i := 0; i <= len(d.classes); i++ {
+		if d.credits > 0 {
+			if data, ok := d.classes[d.current].d.TryNext(); ok {
+				d.credits--
+				return (*loggregator_v2.Envelope)(data), true
+			}
+		}
+
+		d.current = (d.current + 1) % len(d.classes)
+		d.credits = d.classes[d.current].weight
+	}
+
+	// Every class with a weight is empty.
+	for _, c := range d.classes {
+		if c.weight > 0 {
+			continue
+		}
+
+		if data, ok := c.d.TryNext(); ok {
+			return (*loggregator_v2.Envelope)(data), true
+		}
+	}
+
+	return nil, false
+}
+
+// Next will return the next V2 envelope to be read from the diode. If the
+// diode is empty this method will block until an envelope is available to
+// be read.
+func (d *PriorityEnvelopeV2) Next() *loggregator_v2.Envelope {
+	for {
+		if e, ok := d.TryNext(); ok {
+			return e
+		}
+
+		<-d.notify
+	}
+}
+
+// classIndex returns the index in Classes of the class of the envelope.
+func classIndex(e *loggregator_v2.Envelope) int {
+	switch e.GetMessage().(type) {
+	case *loggregator_v2.Envelope_Event:
+		return 1
+	case *loggregator_v2.Envelope_Timer:
+		return 2
+	case *loggregator_v2.Envelope_Counter:
+		return 3
+	case *loggregator_v2.Envelope_Gauge:
+		return 4
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,121 @@
+package diodes_test
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/pkg/diodes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PriorityEnvelopeV2", func() {
+	var (
+		alerter *spyClassAlerter
+	)
+
+	logEnvelope := func(id string) *loggregator_v2.Envelope {
+		return &loggregator_v2.Envelope{
+			SourceId: id,
+			Message:  &loggregator_v2.Envelope_Log{Log: &loggregator_v2.Log{}},
+		}
+	}
+
+	gaugeEnvelope := func(id string) *loggregator_v2.Envelope {
+		return &loggregator_v2.Envelope{
+			SourceId: id,
+			Message:  &loggregator_v2.Envelope_Gauge{Gauge: &loggregator_v2.Gauge{}},
+		}
+	}
+
+	readAll := func(d *diodes.PriorityEnvelopeV2) []string {
+		var ids []string
+		for {
+			e, ok := d.TryNext()
+			if !ok {
+				return ids
+			}
+			ids = append(ids, e.SourceId)
+		}
+	}
+
+	BeforeEach(func() {
+		alerter = newSpyClassAlerter()
+	})
+
+	It("reads classes in turns of their weight", func() {
+		d := diodes.NewPriorityEnvelopeV2(10, alerter,
+			diodes.WithClassWeight(diodes.ClassLog, 2),
+			diodes.WithClassWeight(diodes.ClassGauge, 1),
+		)
+		for _, id := range []string{"l1", "l2", "l3", "l4"} {
+			d.Set(logEnvelope(id))
+		}
+		for _, id := range []string{"g1", "g2", "g3"} {
+			d.Set(gaugeEnvelope(id))
+		}
+
+		Expect(readAll(d)).To(Equal([]string{"l1", "l2", "g1", "l3", "l4", "g2", "g3"}))
+	})
+
+	It("only reads classes without weight when all others are empty", func() {
+		d := diodes.NewPriorityEnvelopeV2(10, alerter, diodes.WithClassWeight(diodes.ClassGauge, 0))
+		d.Set(gaugeEnvelope("g1"))
+		d.Set(logEnvelope("l1"))
+
+		Expect(readAll(d)).To(Equal([]string{"l1", "g1"}))
+	})
+
+	It("drops envelopes per class", func() {
+		d := diodes.NewPriorityEnvelopeV2(10, alerter, diodes.WithClassSize(diodes.ClassGauge, 2))
+		for i := 0; i < 5; i++ {
+			d.Set(gaugeEnvelope("g"))
+		}
+		for i := 0; i < 5; i++ {
+			d.Set(logEnvelope("l"))
+		}
+
+		ids := readAll(d)
+
+		Expect(ids).To(ContainElement("l"))
+		Expect(alerter.missed(diodes.ClassGauge)).To(BeNumerically(">", 0))
+		Expect(alerter.missed(diodes.ClassLog)).To(BeZero())
+	})
+
+	It("blocks on Next until an envelope is set", func() {
+		d := diodes.NewPriorityEnvelopeV2(10, alerter)
+		ids := make(chan string)
+		go func() {
+			ids <- d.Next().SourceId
+		}()
+
+		Consistently(ids).ShouldNot(Receive())
+		d.Set(&loggregator_v2.Envelope{SourceId: "some-id"})
+
+		Eventually(ids).Should(Receive(Equal("some-id")))
+	})
+})
+
+type spyClassAlerter struct {
+	mu       sync.Mutex
+	missedBy map[string]int
+}
+
+func newSpyClassAlerter() *spyClassAlerter {
+	return &spyClassAlerter{
+		missedBy: make(map[string]int),
+	}
+}
+
+func (s *spyClassAlerter) Alert(class string, missed int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.missedBy[class] += missed
+}
+
+func (s *spyClassAlerter) missed(class string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.missedBy[class]
+}
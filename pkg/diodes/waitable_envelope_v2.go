@@ -0,0 +1,64 @@
+package diodes
+
+import (
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+// WaitableEnvelopeV2 wakes up a reader that waits for envelopes as soon as
+// an envelope is set on the diode it wraps.
+type WaitableEnvelopeV2 struct {
+	d      EnvelopeV2Diode
+	notify chan struct{}
+}
+
+// NewWaitableEnvelopeV2 returns a WaitableEnvelopeV2 for the given diode.
+func NewWaitableEnvelopeV2(d EnvelopeV2Diode) *WaitableEnvelopeV2 {
+	return &WaitableEnvelopeV2{
+		d:      d,
+		notify: make(chan struct{}, 1),
+	}
+}
+
+// Set inserts the given V2 envelope into the diode.
+func (w *WaitableEnvelopeV2) Set(data *loggregator_v2.Envelope) {
+	w.d.Set(data)
+
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+// TryNext returns the next V2 envelope to be read from the diode.
+func (w *WaitableEnvelopeV2) TryNext() (*loggregator_v2.Envelope, bool) {
+	return w.d.TryNext()
+}
+
+// Next returns the next V2 envelope to be read from the diode. If the
+// diode is empty it blocks until an envelope is set.
+func (w *WaitableEnvelopeV2) Next() *loggregator_v2.Envelope {
+	for {
+		if e, ok := w.d.TryNext(); ok {
+			return e
+		}
+
+		<-w.notify
+	}
+}
+
+// NextOrDone returns the next V2 envelope to be read from the diode. If the
+// diode is empty it blocks until an envelope is set or done is closed. It
+// returns false once done is closed and the diode is empty.
+func (w *WaitableEnvelopeV2) NextOrDone(done <-chan struct{}) (*loggregator_v2.Envelope, bool) {
+	for {
+		if e, ok := w.d.TryNext(); ok {
+			return e, true
+		}
+
+		select {
+		case <-w.notify:
+		case <-done:
+			return w.d.TryNext()
+		}
+	}
+}
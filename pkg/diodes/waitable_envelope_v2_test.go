@@ -0,0 +1,59 @@
+package diodes_test
+
+import (
+	gendiodes "code.cloudfoundry.org/go-diodes"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/pkg/diodes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WaitableEnvelopeV2", func() {
+	var (
+		d    *diodes.WaitableEnvelopeV2
+		done chan struct{}
+	)
+
+	BeforeEach(func() {
+		d = diodes.NewWaitableEnvelopeV2(diodes.NewManyToOneEnvelopeV2(10, gendiodes.AlertFunc(func(int) {})))
+		done = make(chan struct{})
+	})
+
+	It("wakes up a blocked reader when an envelope is set", func() {
+		envs := make(chan *loggregator_v2.Envelope)
+		go func() {
+			e, _ := d.NextOrDone(done)
+			envs <- e
+		}()
+		Consistently(envs).ShouldNot(Receive())
+
+		d.Set(&loggregator_v2.Envelope{SourceId: "some-id"})
+
+		Eventually(envs).Should(Receive(Equal(&loggregator_v2.Envelope{SourceId: "some-id"})))
+	})
+
+	It("returns the remaining envelopes once done is closed", func() {
+		d.Set(&loggregator_v2.Envelope{SourceId: "some-id"})
+		close(done)
+
+		e, ok := d.NextOrDone(done)
+		Expect(ok).To(BeTrue())
+		Expect(e.SourceId).To(Equal("some-id"))
+
+		_, ok = d.NextOrDone(done)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("unblocks a reader when done is closed", func() {
+		oks := make(chan bool)
+		go func() {
+			_, ok := d.NextOrDone(done)
+			oks <- ok
+		}()
+
+		close(done)
+
+		Eventually(oks).Should(Receive(BeFalse()))
+	})
+})
@@ -0,0 +1,131 @@
+package downstream
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Types of downstream consumers.
+const (
+	TypeLoggregator = "loggregator"
+	TypeOTLP        = "otlp"
+)
+
+// Config describes a downstream consumer. It is read from a port file
+// written by the consumer's job.
+type Config struct {
+	// Type is the protocol of the consumer. It is either loggregator, the
+	// default, or otlp.
+	Type string `yaml:"type"`
+
+	// Host is the host of the consumer. It defaults to 127.0.0.1.
+	Host string `yaml:"host"`
+
+	// Port is the port of the consumer. Ingress is the name used by port
+	// files of co-located consumers and is used when Port is not set.
+	Port    string `yaml:"port"`
+	Ingress string `yaml:"ingress"`
+
+	TLS     TLS     `yaml:"tls"`
+	Filters Filters `yaml:"filters"`
+}
+
+// TLS holds the credentials used to connect to the consumer. Unset paths
+// default to the agent's own credentials.
+type TLS struct {
+	// ServerName is the name the consumer's certificate is verified
+	// against. It defaults to the host of remote consumers and to the
+	// agent's own name for co-located consumers.
+	ServerName string `yaml:"server_name"`
+	CAFile     string `yaml:"ca_file"`
+	CertFile   string `yaml:"cert_file"`
+	KeyFile    string `yaml:"key_file"`
+}
+
+// Addr returns the address of the consumer.
+func (c Config) Addr() string {
+	host := c.Host
+	if host == "" {
+		host = "127.0.0.1"
+	}
+
+	port := c.Port
+	if port == "" {
+		port = c.Ingress
+	}
+
+	return net.JoinHostPort(host, port)
+}
+
+func (c Config) validate() error {
+	switch c.Type {
+	case "", TypeLoggregator, TypeOTLP:
+	default:
+		return fmt.Errorf("unknown type: %s", c.Type)
+	}
+
+	if c.Port == "" && c.Ingress == "" {
+		return errors.New("missing ingress port")
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return errors.New("cert_file and key_file must be set together")
+	}
+
+	return c.Filters.validate()
+}
+
+// ReadConfigs reads every port file matching the glob. The configs are keyed
+// by file name. Files that can not be read or parsed are skipped and
+// returned as errors keyed by file name.
+func ReadConfigs(glob string) (map[string]Config, map[string]error) {
+	configs := make(map[string]Config)
+	errs := make(map[string]error)
+
+	files, err := filepath.Glob(glob)
+	if err != nil {
+		errs[glob] = fmt.Errorf("invalid glob: %s", err)
+		return configs, errs
+	}
+
+	for _, f := range files {
+		c, err := readConfig(f)
+		if err != nil {
+			errs[f] = err
+			continue
+		}
+
+		configs[f] = c
+	}
+
+	return configs, errs
+}
+
+func readConfig(file string) (Config, error) {
+	yamlFile, err := ioutil.ReadFile(file)
+	if err != nil {
+		return Config{}, fmt.Errorf("cannot read file: %s", err)
+	}
+
+	var c Config
+	err = yaml.Unmarshal(yamlFile, &c)
+	if err != nil {
+		return Config{}, fmt.Errorf("cannot parse file: %s", err)
+	}
+
+	err = c.validate()
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid config: %s", err)
+	}
+
+	if c.TLS.ServerName == "" {
+		c.TLS.ServerName = c.Host
+	}
+
+	return c, nil
+}
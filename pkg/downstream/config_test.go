@@ -0,0 +1,152 @@
+package downstream_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/loggregator-agent/pkg/downstream"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ReadConfigs", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("reads every file matching the glob", func() {
+		f1 := writePortFile(dir, "a", "ingress: 1234")
+		f2 := writePortFile(dir, "b", "ingress: 5678")
+
+		configs, errs := downstream.ReadConfigs(filepath.Join(dir, "*", "ingress_port.yml"))
+		Expect(errs).To(BeEmpty())
+		Expect(configs).To(Equal(map[string]downstream.Config{
+			f1: {Ingress: "1234"},
+			f2: {Ingress: "5678"},
+		}))
+		Expect(configs[f1].Addr()).To(Equal("127.0.0.1:1234"))
+	})
+
+	It("returns errors for invalid files", func() {
+		f1 := writePortFile(dir, "a", "ingress: 1234")
+		f2 := writePortFile(dir, "b", "ingress: [")
+		f3 := writePortFile(dir, "c", "egress: 1234")
+
+		configs, errs := downstream.ReadConfigs(filepath.Join(dir, "*", "ingress_port.yml"))
+		Expect(configs).To(HaveLen(1))
+		Expect(configs).To(HaveKey(f1))
+
+		Expect(errs).To(HaveLen(2))
+		Expect(errs[f2].Error()).To(HavePrefix("cannot parse file"))
+		Expect(errs[f3]).To(MatchError("invalid config: missing ingress port"))
+	})
+
+	It("reads the host, port and TLS config of remote consumers", func() {
+		f := writePortFile(dir, "a", `---
+host: logs.example.com
+port: 8082
+tls:
+  server_name: logs
+  ca_file: /ca.crt
+  cert_file: /client.crt
+  key_file: /client.key
+`)
+
+		configs, errs := downstream.ReadConfigs(filepath.Join(dir, "*", "ingress_port.yml"))
+		Expect(errs).To(BeEmpty())
+		Expect(configs[f].Addr()).To(Equal("logs.example.com:8082"))
+		Expect(configs[f].TLS).To(Equal(downstream.TLS{
+			ServerName: "logs",
+			CAFile:     "/ca.crt",
+			CertFile:   "/client.crt",
+			KeyFile:    "/client.key",
+		}))
+	})
+
+	It("defaults the server name of remote consumers to the host", func() {
+		f1 := writePortFile(dir, "a", "{host: logs.example.com, port: 8082}")
+		f2 := writePortFile(dir, "b", "{ingress: 8082}")
+
+		configs, errs := downstream.ReadConfigs(filepath.Join(dir, "*", "ingress_port.yml"))
+		Expect(errs).To(BeEmpty())
+		Expect(configs[f1].TLS.ServerName).To(Equal("logs.example.com"))
+		Expect(configs[f2].TLS.ServerName).To(BeEmpty())
+	})
+
+	It("returns an error for unknown types", func() {
+		f1 := writePortFile(dir, "a", "{port: 4317, type: otlp}")
+		f2 := writePortFile(dir, "b", "{port: 4317, type: jaeger}")
+
+		configs, errs := downstream.ReadConfigs(filepath.Join(dir, "*", "ingress_port.yml"))
+		Expect(configs[f1].Type).To(Equal(downstream.TypeOTLP))
+		Expect(errs[f2]).To(MatchError("invalid config: unknown type: jaeger"))
+	})
+
+	It("returns an error when only one of cert_file and key_file is set", func() {
+		f := writePortFile(dir, "a", "{port: 8082, tls: {cert_file: /client.crt}}")
+
+		_, errs := downstream.ReadConfigs(filepath.Join(dir, "*", "ingress_port.yml"))
+		Expect(errs[f]).To(MatchError("invalid config: cert_file and key_file must be set together"))
+	})
+
+	It("reads filters", func() {
+		f := writePortFile(dir, "a", `---
+ingress: 1234
+filters:
+  envelope_types: [log]
+  source_ids:
+    include: ["app-*"]
+    exclude: ["app-noisy"]
+  tags:
+    deployment: cf
+`)
+
+		configs, errs := downstream.ReadConfigs(filepath.Join(dir, "*", "ingress_port.yml"))
+		Expect(errs).To(BeEmpty())
+		Expect(configs[f].Filters).To(Equal(downstream.Filters{
+			EnvelopeTypes: []string{"log"},
+			SourceIDs: downstream.SourceIDFilter{
+				Include: []string{"app-*"},
+				Exclude: []string{"app-noisy"},
+			},
+			Tags: map[string]string{"deployment": "cf"},
+		}))
+	})
+
+	It("returns errors for invalid filters", func() {
+		f1 := writePortFile(dir, "a", "{ingress: 1234, filters: {envelope_types: [metric]}}")
+		f2 := writePortFile(dir, "b", "{ingress: 1234, filters: {source_ids: {exclude: ['[']}}}")
+
+		configs, errs := downstream.ReadConfigs(filepath.Join(dir, "*", "ingress_port.yml"))
+		Expect(configs).To(BeEmpty())
+		Expect(errs[f1]).To(MatchError("invalid config: unknown envelope type: metric"))
+		Expect(errs[f2]).To(MatchError("invalid config: invalid pattern: ["))
+	})
+
+	It("returns an error for an invalid glob", func() {
+		configs, errs := downstream.ReadConfigs("[")
+		Expect(configs).To(BeEmpty())
+		Expect(errs).To(HaveKey("["))
+	})
+})
+
+func writePortFile(dir, name, contents string) string {
+	err := os.MkdirAll(filepath.Join(dir, name), 0755)
+	Expect(err).ToNot(HaveOccurred())
+
+	f := filepath.Join(dir, name, "ingress_port.yml")
+	err = ioutil.WriteFile(f, []byte(contents), 0644)
+	Expect(err).ToNot(HaveOccurred())
+
+	return f
+}
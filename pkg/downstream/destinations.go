@@ -0,0 +1,254 @@
+package downstream
+
+import (
+	"context"
+	"log"
+	"reflect"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/pkg/metrics"
+)
+
+// Metrics is the client used to expose gauge and counter metrics.
+type Metrics interface {
+	NewGauge(name string, opts ...metrics.MetricOption) metrics.Gauge
+	NewCounter(name string, opts ...metrics.MetricOption) metrics.Counter
+	RemoveGauge(metrics.Gauge)
+	RemoveCounter(metrics.Counter)
+}
+
+// Destination writes envelopes to a downstream consumer.
+type Destination interface {
+	Write(*loggregator_v2.Envelope) error
+
+	// Close writes any buffered envelopes and closes the connection to the
+	// consumer.
+	Close() error
+}
+
+// DestinationFactory creates a Destination for a config.
+type DestinationFactory func(Config) (Destination, error)
+
+type destination struct {
+	cfg      Config
+	d        Destination
+	filtered metrics.Counter
+}
+
+// Destinations writes envelopes to every downstream consumer. It keeps the
+// consumers in sync with the port files matching the glob.
+type Destinations struct {
+	glob    string
+	factory DestinationFactory
+	log     *log.Logger
+	metrics Metrics
+
+	destinationCount     metrics.Gauge
+	invalidConfigsMetric metrics.Gauge
+
+	mu           sync.RWMutex
+	destinations map[string]destination
+	errs         map[string]string
+	closed       bool
+}
+
+// NewDestinations returns Destinations for the port files matching the glob.
+// The port files are not read until Reload is called.
+func NewDestinations(
+	glob string,
+	f DestinationFactory,
+	m Metrics,
+	l *log.Logger,
+) *Destinations {
+	return &Destinations{
+		glob:                 glob,
+		factory:              f,
+		log:                  l,
+		metrics:              m,
+		destinationCount:     m.NewGauge("downstream_destinations", metrics.WithMetricTags(map[string]string{"unit": "count"})),
+		invalidConfigsMetric: m.NewGauge("invalid_downstream_configs", metrics.WithMetricTags(map[string]string{"unit": "total"})),
+		destinations:         make(map[string]destination),
+		errs:                 make(map[string]string),
+	}
+}
+
+// Write writes the envelope to every destination whose filters match the
+// envelope.
+func (d *Destinations) Write(e *loggregator_v2.Envelope) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	for _, dest := range d.destinations {
+		if !dest.cfg.Filters.Matches(e) {
+			dest.filtered.Add(1)
+			continue
+		}
+
+		dest.d.Write(e)
+	}
+
+	return nil
+}
+
+// Watch reloads the port files on the given interval. It does not return.
+func (d *Destinations) Watch(interval time.Duration) {
+	t := time.NewTicker(interval)
+	for range t.C {
+		d.Reload()
+	}
+}
+
+// Reload reads the port files and creates destinations for new and changed
+// files. Destinations of removed files are closed once their buffered
+// envelopes are written. Files that are invalid are reported and the
+// destination that was created from a previous version of the file is kept.
+func (d *Destinations) Reload() {
+	configs, errs := ReadConfigs(d.glob)
+	d.reportErrors(errs)
+
+	d.mu.RLock()
+	if d.closed {
+		d.mu.RUnlock()
+		return
+	}
+
+	var (
+		added   = make(map[string]Config)
+		removed []string
+	)
+	for file, cfg := range configs {
+		dest, ok := d.destinations[file]
+		if !ok || !reflect.DeepEqual(dest.cfg, cfg) {
+			added[file] = cfg
+		}
+	}
+	for file := range d.destinations {
+		if _, ok := configs[file]; ok {
+			continue
+		}
+
+		if _, invalid := errs[file]; invalid {
+			continue
+		}
+
+		removed = append(removed, file)
+	}
+	d.mu.RUnlock()
+
+	if len(added) == 0 && len(removed) == 0 {
+		return
+	}
+
+	created := make(map[string]destination)
+	for file, cfg := range added {
+		dest, err := d.factory(cfg)
+		if err != nil {
+			d.log.Printf("failed to create downstream destination for %s: %s", file, err)
+			continue
+		}
+
+		created[file] = destination{
+			cfg: cfg,
+			d:   dest,
+			filtered: d.metrics.NewCounter(
+				"downstream_filtered",
+				metrics.WithMetricTags(map[string]string{"destination": cfg.Addr()}),
+			),
+		}
+	}
+
+	var closing []destination
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		for _, dest := range created {
+			d.close(dest)
+		}
+		return
+	}
+	for file, dest := range created {
+		if old, ok := d.destinations[file]; ok {
+			closing = append(closing, old)
+		}
+
+		d.destinations[file] = dest
+		d.log.Printf("added downstream destination %s from %s", dest.cfg.Addr(), file)
+	}
+	for _, file := range removed {
+		closing = append(closing, d.destinations[file])
+		delete(d.destinations, file)
+		d.log.Printf("removed downstream destination from %s", file)
+	}
+	d.destinationCount.Set(float64(len(d.destinations)))
+	d.mu.Unlock()
+
+	for _, dest := range closing {
+		go d.close(dest)
+	}
+}
+
+// Close closes every destination and waits until their buffered envelopes
+// are written or the context is done. Envelopes written after Close are
+// dropped and port files are no longer reloaded.
+func (d *Destinations) Close(ctx context.Context) error {
+	d.mu.Lock()
+	d.closed = true
+	closing := d.destinations
+	d.destinations = make(map[string]destination)
+	d.destinationCount.Set(0)
+	d.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, dest := range closing {
+		wg.Add(1)
+		go func(dest destination) {
+			defer wg.Done()
+
+			d.close(dest)
+		}(dest)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// close closes the destination and removes its metric.
+func (d *Destinations) close(dest destination) {
+	err := dest.d.Close()
+	if err != nil {
+		d.log.Printf("failed to close downstream destination %s: %s", dest.cfg.Addr(), err)
+	}
+
+	d.metrics.RemoveCounter(dest.filtered)
+}
+
+// reportErrors logs invalid port files once and updates the invalid config
+// metric.
+func (d *Destinations) reportErrors(errs map[string]error) {
+	d.invalidConfigsMetric.Set(float64(len(errs)))
+
+	reported := make(map[string]string)
+	for file, err := range errs {
+		reported[file] = err.Error()
+
+		if d.errs[file] == err.Error() {
+			continue
+		}
+
+		d.log.Printf("invalid downstream config %s: %s", file, err)
+	}
+
+	d.errs = reported
+}
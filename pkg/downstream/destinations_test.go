@@ -0,0 +1,261 @@
+package downstream_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/internal/testhelper"
+	"code.cloudfoundry.org/loggregator-agent/pkg/downstream"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Destinations", func() {
+	var (
+		dir     string
+		factory *spyFactory
+		mc      *testhelper.SpyMetricClient
+		dests   *downstream.Destinations
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "")
+		Expect(err).ToNot(HaveOccurred())
+
+		factory = newSpyFactory()
+		mc = testhelper.NewMetricClient()
+		dests = downstream.NewDestinations(
+			filepath.Join(dir, "*", "ingress_port.yml"),
+			factory.create,
+			mc,
+			log.New(GinkgoWriter, "", 0),
+		)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("writes envelopes to every destination", func() {
+		writePortFile(dir, "a", "ingress: 1234")
+		writePortFile(dir, "b", "ingress: 5678")
+		dests.Reload()
+
+		e := &loggregator_v2.Envelope{SourceId: "some-id"}
+		Expect(dests.Write(e)).To(Succeed())
+
+		Expect(factory.destination("1234").envelopes()).To(ConsistOf(e))
+		Expect(factory.destination("5678").envelopes()).To(ConsistOf(e))
+		Expect(mc.GetMetric("downstream_destinations", map[string]string{"unit": "count"}).Value()).To(Equal(2.0))
+	})
+
+	It("filters envelopes for each destination", func() {
+		writePortFile(dir, "a", "{ingress: 1234, filters: {envelope_types: [counter]}}")
+		writePortFile(dir, "b", "ingress: 5678")
+		dests.Reload()
+
+		e := &loggregator_v2.Envelope{
+			Message: &loggregator_v2.Envelope_Log{Log: &loggregator_v2.Log{}},
+		}
+		dests.Write(e)
+		dests.Write(e)
+
+		Expect(factory.destination("1234").envelopes()).To(BeEmpty())
+		Expect(factory.destination("5678").envelopes()).To(HaveLen(2))
+
+		filtered := mc.GetMetric("downstream_filtered", map[string]string{"destination": "127.0.0.1:1234"})
+		Expect(filtered.Value()).To(Equal(2.0))
+		Expect(mc.GetMetric("downstream_filtered", map[string]string{"destination": "127.0.0.1:5678"}).Value()).To(BeZero())
+	})
+
+	It("adds destinations for new files", func() {
+		dests.Reload()
+		writePortFile(dir, "a", "ingress: 1234")
+		dests.Reload()
+
+		dests.Write(&loggregator_v2.Envelope{})
+
+		Expect(factory.destination("1234").envelopes()).To(HaveLen(1))
+	})
+
+	It("closes destinations of removed files", func() {
+		writePortFile(dir, "a", "ingress: 1234")
+		dests.Reload()
+
+		os.RemoveAll(filepath.Join(dir, "a"))
+		dests.Reload()
+		dests.Write(&loggregator_v2.Envelope{})
+
+		d := factory.destination("1234")
+		Eventually(d.closed).Should(BeTrue())
+		Expect(d.envelopes()).To(BeEmpty())
+		Eventually(func() bool {
+			return mc.HasMetric("downstream_filtered", map[string]string{"destination": "127.0.0.1:1234"})
+		}).Should(BeFalse())
+	})
+
+	It("replaces destinations of changed files", func() {
+		writePortFile(dir, "a", "ingress: 1234")
+		dests.Reload()
+
+		writePortFile(dir, "a", "ingress: 5678")
+		dests.Reload()
+		dests.Write(&loggregator_v2.Envelope{})
+
+		Eventually(factory.destination("1234").closed).Should(BeTrue())
+		Expect(factory.destination("5678").envelopes()).To(HaveLen(1))
+	})
+
+	It("does not recreate destinations of unchanged files", func() {
+		writePortFile(dir, "a", "ingress: 1234")
+		dests.Reload()
+		dests.Reload()
+
+		Expect(factory.created()).To(Equal(1))
+	})
+
+	It("reports invalid files and keeps their existing destination", func() {
+		writePortFile(dir, "a", "ingress: 1234")
+		dests.Reload()
+
+		writePortFile(dir, "a", "ingress: [")
+		writePortFile(dir, "b", "egress: 5678")
+		dests.Reload()
+		dests.Write(&loggregator_v2.Envelope{})
+
+		d := factory.destination("1234")
+		Expect(d.envelopes()).To(HaveLen(1))
+		Consistently(d.closed).Should(BeFalse())
+		Expect(mc.GetMetric("invalid_downstream_configs", map[string]string{"unit": "total"}).Value()).To(Equal(2.0))
+
+		writePortFile(dir, "a", "ingress: 1234")
+		os.RemoveAll(filepath.Join(dir, "b"))
+		dests.Reload()
+
+		Expect(mc.GetMetric("invalid_downstream_configs", map[string]string{"unit": "total"}).Value()).To(Equal(0.0))
+		Expect(factory.created()).To(Equal(1))
+	})
+
+	It("closes every destination and stops reloading", func() {
+		writePortFile(dir, "a", "ingress: 1234")
+		writePortFile(dir, "b", "ingress: 5678")
+		dests.Reload()
+
+		Expect(dests.Close(context.Background())).To(Succeed())
+		Expect(factory.destination("1234").closed()).To(BeTrue())
+		Expect(factory.destination("5678").closed()).To(BeTrue())
+
+		writePortFile(dir, "c", "ingress: 9012")
+		dests.Reload()
+		dests.Write(&loggregator_v2.Envelope{})
+
+		Expect(factory.created()).To(Equal(2))
+		Expect(factory.destination("1234").envelopes()).To(BeEmpty())
+	})
+
+	It("stops waiting for destinations when the context is done", func() {
+		writePortFile(dir, "a", "ingress: 1234")
+		dests.Reload()
+		factory.destination("1234").mu.Lock()
+		defer factory.destination("1234").mu.Unlock()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		Expect(dests.Close(ctx)).To(MatchError(context.Canceled))
+	})
+
+	It("skips destinations that can not be created", func() {
+		factory.err = errors.New("some-error")
+		writePortFile(dir, "a", "ingress: 1234")
+		dests.Reload()
+
+		Expect(dests.Write(&loggregator_v2.Envelope{})).To(Succeed())
+	})
+})
+
+type spyFactory struct {
+	mu           sync.Mutex
+	destinations map[string]*spyDestination
+	count        int
+	err          error
+}
+
+func newSpyFactory() *spyFactory {
+	return &spyFactory{
+		destinations: make(map[string]*spyDestination),
+	}
+}
+
+func (f *spyFactory) create(c downstream.Config) (downstream.Destination, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.count++
+
+	d := &spyDestination{}
+	f.destinations[c.Ingress] = d
+
+	return d, nil
+}
+
+func (f *spyFactory) destination(ingress string) *spyDestination {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.destinations[ingress]
+}
+
+func (f *spyFactory) created() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.count
+}
+
+type spyDestination struct {
+	mu        sync.Mutex
+	written   []*loggregator_v2.Envelope
+	wasClosed bool
+}
+
+func (d *spyDestination) Write(e *loggregator_v2.Envelope) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.written = append(d.written, e)
+
+	return nil
+}
+
+func (d *spyDestination) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.wasClosed = true
+
+	return nil
+}
+
+func (d *spyDestination) envelopes() []*loggregator_v2.Envelope {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.written
+}
+
+func (d *spyDestination) closed() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.wasClosed
+}
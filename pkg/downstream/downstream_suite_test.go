@@ -0,0 +1,13 @@
+package downstream_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestDownstream(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Downstream Suite")
+}
@@ -0,0 +1,104 @@
+package downstream
+
+import (
+	"fmt"
+	"path"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/pkg/egress"
+)
+
+// Filters select the envelopes that are written to a consumer. An envelope
+// is written when it matches every filter that is set. Source ID and tag
+// patterns use the syntax of path.Match.
+type Filters struct {
+	// EnvelopeTypes is the list of envelope types the consumer receives:
+	// log, counter, gauge, timer or event. All types are received when it
+	// is empty.
+	EnvelopeTypes []string `yaml:"envelope_types"`
+
+	SourceIDs SourceIDFilter `yaml:"source_ids"`
+
+	// Tags maps tag names to patterns that the tag value must match.
+	Tags map[string]string `yaml:"tags"`
+}
+
+// SourceIDFilter selects envelopes by source ID. An envelope must match one
+// of the include patterns, when there are any, and none of the exclude
+// patterns.
+type SourceIDFilter struct {
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+}
+
+// Matches reports whether the envelope should be written to the consumer.
+func (f Filters) Matches(e *loggregator_v2.Envelope) bool {
+	if len(f.EnvelopeTypes) > 0 && !contains(f.EnvelopeTypes, egress.EnvelopeType(e)) {
+		return false
+	}
+
+	if len(f.SourceIDs.Include) > 0 && !matchesAny(f.SourceIDs.Include, e.GetSourceId()) {
+		return false
+	}
+
+	if matchesAny(f.SourceIDs.Exclude, e.GetSourceId()) {
+		return false
+	}
+
+	for name, pattern := range f.Tags {
+		v, ok := e.GetTags()[name]
+		if !ok || !matches(pattern, v) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (f Filters) validate() error {
+	for _, t := range f.EnvelopeTypes {
+		if !egress.ValidEnvelopeType(t) {
+			return fmt.Errorf("unknown envelope type: %s", t)
+		}
+	}
+
+	var patterns []string
+	patterns = append(patterns, f.SourceIDs.Include...)
+	patterns = append(patterns, f.SourceIDs.Exclude...)
+	for _, p := range f.Tags {
+		patterns = append(patterns, p)
+	}
+
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid pattern: %s", p)
+		}
+	}
+
+	return nil
+}
+
+func matchesAny(patterns []string, v string) bool {
+	for _, p := range patterns {
+		if matches(p, v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matches(pattern, v string) bool {
+	ok, _ := path.Match(pattern, v)
+	return ok
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+
+	return false
+}
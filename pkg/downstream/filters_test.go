@@ -0,0 +1,76 @@
+package downstream_test
+
+import (
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/pkg/downstream"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Filters", func() {
+	var (
+		log = &loggregator_v2.Envelope{
+			SourceId: "app-1",
+			Message:  &loggregator_v2.Envelope_Log{Log: &loggregator_v2.Log{}},
+			Tags:     map[string]string{"deployment": "cf-1"},
+		}
+		counter = &loggregator_v2.Envelope{
+			SourceId: "doppler",
+			Message:  &loggregator_v2.Envelope_Counter{Counter: &loggregator_v2.Counter{}},
+		}
+	)
+
+	It("matches every envelope when empty", func() {
+		f := downstream.Filters{}
+
+		Expect(f.Matches(log)).To(BeTrue())
+		Expect(f.Matches(counter)).To(BeTrue())
+	})
+
+	It("matches envelope types", func() {
+		f := downstream.Filters{EnvelopeTypes: []string{"counter", "gauge"}}
+
+		Expect(f.Matches(log)).To(BeFalse())
+		Expect(f.Matches(counter)).To(BeTrue())
+	})
+
+	It("matches included source IDs", func() {
+		f := downstream.Filters{
+			SourceIDs: downstream.SourceIDFilter{Include: []string{"app-*"}},
+		}
+
+		Expect(f.Matches(log)).To(BeTrue())
+		Expect(f.Matches(counter)).To(BeFalse())
+	})
+
+	It("does not match excluded source IDs", func() {
+		f := downstream.Filters{
+			SourceIDs: downstream.SourceIDFilter{
+				Include: []string{"*"},
+				Exclude: []string{"dopp*"},
+			},
+		}
+
+		Expect(f.Matches(log)).To(BeTrue())
+		Expect(f.Matches(counter)).To(BeFalse())
+	})
+
+	It("matches tags", func() {
+		f := downstream.Filters{Tags: map[string]string{"deployment": "cf-*"}}
+		Expect(f.Matches(log)).To(BeTrue())
+		Expect(f.Matches(counter)).To(BeFalse())
+
+		f = downstream.Filters{Tags: map[string]string{"deployment": "diego"}}
+		Expect(f.Matches(log)).To(BeFalse())
+	})
+
+	It("matches only when every filter matches", func() {
+		f := downstream.Filters{
+			EnvelopeTypes: []string{"log"},
+			SourceIDs:     downstream.SourceIDFilter{Include: []string{"app-2"}},
+		}
+
+		Expect(f.Matches(log)).To(BeFalse())
+	})
+})
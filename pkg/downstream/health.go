@@ -0,0 +1,168 @@
+package downstream
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/loggregator-agent/pkg/metrics"
+)
+
+// Health tracks the connection state of destinations and reports the ones
+// that have failed continuously for longer than a threshold.
+type Health struct {
+	threshold time.Duration
+	metrics   Metrics
+
+	mu     sync.Mutex
+	states map[*ConnectionState]struct{}
+}
+
+// NewHealth returns a Health that reports destinations that have failed for
+// longer than threshold.
+func NewHealth(threshold time.Duration, m Metrics) *Health {
+	return &Health{
+		threshold: threshold,
+		metrics:   m,
+		states:    make(map[*ConnectionState]struct{}),
+	}
+}
+
+// NewConnectionState starts tracking the connection state of the destination
+// with the given address.
+func (h *Health) NewConnectionState(addr string) *ConnectionState {
+	s := &ConnectionState{
+		addr: addr,
+		connected: h.metrics.NewGauge(
+			"downstream_connected",
+			metrics.WithMetricTags(map[string]string{"destination": addr}),
+		),
+	}
+	s.connected.Set(0)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.states[s] = struct{}{}
+
+	return s
+}
+
+// Remove stops tracking the connection state and removes its metric.
+func (h *Health) Remove(s *ConnectionState) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.states, s)
+	h.metrics.RemoveGauge(s.connected)
+}
+
+// FailingDestination describes a destination that has failed continuously.
+type FailingDestination struct {
+	Destination  string    `json:"destination"`
+	FailingSince time.Time `json:"failing_since"`
+	LastError    string    `json:"last_error"`
+}
+
+// Failing returns the destinations that have failed continuously for longer
+// than the threshold.
+func (h *Health) Failing() []FailingDestination {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	failing := []FailingDestination{}
+	for s := range h.states {
+		fd, ok := s.failing()
+		if !ok || time.Since(fd.FailingSince) < h.threshold {
+			continue
+		}
+
+		failing = append(failing, fd)
+	}
+
+	sort.Slice(failing, func(i, j int) bool {
+		return failing[i].Destination < failing[j].Destination
+	})
+
+	return failing
+}
+
+// Check returns an error naming the failing destinations.
+func (h *Health) Check() error {
+	failing := h.Failing()
+	if len(failing) == 0 {
+		return nil
+	}
+
+	addrs := make([]string, 0, len(failing))
+	for _, fd := range failing {
+		addrs = append(addrs, fd.Destination)
+	}
+
+	return fmt.Errorf("failing destinations: %s", strings.Join(addrs, ", "))
+}
+
+// ServeHTTP writes the failing destinations as JSON. The status is 503 if
+// any destination is failing.
+func (h *Health) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	failing := h.Failing()
+
+	w.Header().Set("Content-Type", "application/json")
+	if len(failing) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	json.NewEncoder(w).Encode(map[string][]FailingDestination{
+		"failing": failing,
+	})
+}
+
+// ConnectionState records whether writes to a destination succeed.
+type ConnectionState struct {
+	addr      string
+	connected metrics.Gauge
+
+	mu           sync.Mutex
+	failingSince time.Time
+	lastErr      error
+}
+
+// Succeeded records a successful write.
+func (s *ConnectionState) Succeeded() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failingSince = time.Time{}
+	s.lastErr = nil
+	s.connected.Set(1)
+}
+
+// Failed records a failed write. The destination is failing until the next
+// successful write.
+func (s *ConnectionState) Failed(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failingSince.IsZero() {
+		s.failingSince = time.Now()
+	}
+	s.lastErr = err
+	s.connected.Set(0)
+}
+
+func (s *ConnectionState) failing() (FailingDestination, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failingSince.IsZero() {
+		return FailingDestination{}, false
+	}
+
+	return FailingDestination{
+		Destination:  s.addr,
+		FailingSince: s.failingSince,
+		LastError:    s.lastErr.Error(),
+	}, true
+}
@@ -0,0 +1,111 @@
+package downstream_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"code.cloudfoundry.org/loggregator-agent/internal/testhelper"
+	"code.cloudfoundry.org/loggregator-agent/pkg/downstream"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Health", func() {
+	var (
+		mc *testhelper.SpyMetricClient
+		h  *downstream.Health
+	)
+
+	BeforeEach(func() {
+		mc = testhelper.NewMetricClient()
+		h = downstream.NewHealth(0, mc)
+	})
+
+	It("reports destinations that are failing", func() {
+		s1 := h.NewConnectionState("127.0.0.1:1234")
+		s2 := h.NewConnectionState("127.0.0.1:5678")
+
+		s1.Failed(errors.New("some-error"))
+		s1.Failed(errors.New("other-error"))
+		s2.Succeeded()
+
+		failing := h.Failing()
+		Expect(failing).To(HaveLen(1))
+		Expect(failing[0].Destination).To(Equal("127.0.0.1:1234"))
+		Expect(failing[0].LastError).To(Equal("other-error"))
+		Expect(failing[0].FailingSince).To(BeTemporally("~", time.Now(), time.Second))
+	})
+
+	It("checks that no destination is failing", func() {
+		s1 := h.NewConnectionState("127.0.0.1:1234")
+		s2 := h.NewConnectionState("127.0.0.1:5678")
+		s1.Succeeded()
+		s2.Succeeded()
+		Expect(h.Check()).To(Succeed())
+
+		s1.Failed(errors.New("some-error"))
+		s2.Failed(errors.New("some-error"))
+		Expect(h.Check()).To(MatchError("failing destinations: 127.0.0.1:1234, 127.0.0.1:5678"))
+	})
+
+	It("does not report destinations that have recovered", func() {
+		s := h.NewConnectionState("127.0.0.1:1234")
+		s.Failed(errors.New("some-error"))
+		s.Succeeded()
+
+		Expect(h.Failing()).To(BeEmpty())
+	})
+
+	It("does not report destinations that have failed for less than the threshold", func() {
+		h = downstream.NewHealth(time.Hour, mc)
+		s := h.NewConnectionState("127.0.0.1:1234")
+		s.Failed(errors.New("some-error"))
+
+		Expect(h.Failing()).To(BeEmpty())
+	})
+
+	It("does not report removed destinations", func() {
+		s := h.NewConnectionState("127.0.0.1:1234")
+		s.Failed(errors.New("some-error"))
+		h.Remove(s)
+
+		Expect(h.Failing()).To(BeEmpty())
+		Expect(mc.HasMetric("downstream_connected", map[string]string{"destination": "127.0.0.1:1234"})).To(BeFalse())
+	})
+
+	It("sets the connected metric", func() {
+		s := h.NewConnectionState("127.0.0.1:1234")
+		connected := mc.GetMetric("downstream_connected", map[string]string{"destination": "127.0.0.1:1234"})
+		Expect(connected.Value()).To(Equal(0.0))
+
+		s.Succeeded()
+		Expect(connected.Value()).To(Equal(1.0))
+
+		s.Failed(errors.New("some-error"))
+		Expect(connected.Value()).To(Equal(0.0))
+	})
+
+	It("serves the failing destinations", func() {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/downstream/health", nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(MatchJSON(`{"failing": []}`))
+
+		h.NewConnectionState("127.0.0.1:1234").Failed(errors.New("some-error"))
+
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/downstream/health", nil))
+		Expect(rec.Code).To(Equal(http.StatusServiceUnavailable))
+
+		var body struct {
+			Failing []downstream.FailingDestination `json:"failing"`
+		}
+		Expect(json.Unmarshal(rec.Body.Bytes(), &body)).To(Succeed())
+		Expect(body.Failing).To(HaveLen(1))
+		Expect(body.Failing[0].Destination).To(Equal("127.0.0.1:1234"))
+	})
+})
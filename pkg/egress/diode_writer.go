@@ -25,25 +25,46 @@ type WriteCloser interface {
 }
 
 type DiodeWriter struct {
-	wc    WriteCloser
-	diode *diodes.OneToOneEnvelopeV2
-	wg    WaitGroup
+	wc          WriteCloser
+	diode       *diodes.OneToOneEnvelopeV2
+	wg          WaitGroup
+	occupancies []*diodes.Occupancy
 
 	ctx context.Context
 }
 
+// DiodeWriterOption configures a DiodeWriter.
+type DiodeWriterOption func(*DiodeWriter)
+
+// WithOccupancy tracks the fill level of the diode in the given
+// occupancies. An envelope leaves the diode once it has been written.
+func WithOccupancy(o ...*diodes.Occupancy) DiodeWriterOption {
+	return func(d *DiodeWriter) {
+		d.occupancies = append(d.occupancies, o...)
+	}
+}
+
 func NewDiodeWriter(
 	ctx context.Context,
 	wc WriteCloser,
 	alerter gendiodes.Alerter,
 	wg WaitGroup,
+	opts ...DiodeWriterOption,
 ) *DiodeWriter {
 	dw := &DiodeWriter{
-		wc:    wc,
-		diode: diodes.NewOneToOneEnvelopeV2(10000, alerter, gendiodes.WithWaiterContext(ctx)),
-		wg:    wg,
-		ctx:   ctx,
+		wc:  wc,
+		wg:  wg,
+		ctx: ctx,
+	}
+	for _, o := range opts {
+		o(dw)
 	}
+
+	for _, o := range dw.occupancies {
+		alerter = o.Alerter(alerter)
+	}
+	dw.diode = diodes.NewOneToOneEnvelopeV2(10000, alerter, gendiodes.WithWaiterContext(ctx))
+
 	wg.Add(1)
 	go dw.start()
 
@@ -52,6 +73,9 @@ func NewDiodeWriter(
 
 // Write writes an envelope into the diode. This can not fail.
 func (d *DiodeWriter) Write(env *loggregator_v2.Envelope) error {
+	for _, o := range d.occupancies {
+		o.Enqueue()
+	}
 	d.diode.Set(env)
 
 	return nil
@@ -68,6 +92,9 @@ func (d *DiodeWriter) start() {
 		}
 
 		err := d.wc.Write(e)
+		for _, o := range d.occupancies {
+			o.Dequeue()
+		}
 		if err != nil && ContextDone(d.ctx) {
 			return
 		}
@@ -12,6 +12,7 @@ import (
 	. "github.com/onsi/gomega"
 
 	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/pkg/diodes"
 	"code.cloudfoundry.org/loggregator-agent/pkg/egress"
 )
 
@@ -112,6 +113,25 @@ var _ = Describe("DiodeWriter", func() {
 		cancel()
 		Eventually(spyWaitGroup.DoneCalled).Should(Equal(int64(1)))
 	})
+
+	It("tracks the envelopes that have not been written", func() {
+		spyWaitGroup := &SpyWaitGroup{}
+		spyWriter := &SpyWriter{
+			blockWrites: true,
+		}
+		spyAlerter := &SpyAlerter{}
+		o := diodes.NewOccupancy()
+
+		dw := egress.NewDiodeWriter(context.TODO(), spyWriter, spyAlerter, spyWaitGroup, egress.WithOccupancy(o))
+		for i := 0; i < 5; i++ {
+			dw.Write(&loggregator_v2.Envelope{})
+		}
+		Expect(o.Fill()).To(Equal(int64(5)))
+
+		spyWriter.WriteBlocked(false)
+		Eventually(o.Fill).Should(BeZero())
+		Expect(o.HighWater()).To(Equal(int64(5)))
+	})
 })
 
 type SpyWriter struct {
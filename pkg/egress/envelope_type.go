@@ -0,0 +1,37 @@
+package egress
+
+import "code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+
+// EnvelopeTypes are the names of the envelope types that egress filters
+// select envelopes by.
+var EnvelopeTypes = []string{"log", "counter", "gauge", "timer", "event"}
+
+// EnvelopeType returns the name of the type of the envelope. It is empty for
+// envelopes without a message.
+func EnvelopeType(e *loggregator_v2.Envelope) string {
+	switch e.GetMessage().(type) {
+	case *loggregator_v2.Envelope_Log:
+		return "log"
+	case *loggregator_v2.Envelope_Counter:
+		return "counter"
+	case *loggregator_v2.Envelope_Gauge:
+		return "gauge"
+	case *loggregator_v2.Envelope_Timer:
+		return "timer"
+	case *loggregator_v2.Envelope_Event:
+		return "event"
+	default:
+		return ""
+	}
+}
+
+// ValidEnvelopeType reports whether t is the name of an envelope type.
+func ValidEnvelopeType(t string) bool {
+	for _, et := range EnvelopeTypes {
+		if et == t {
+			return true
+		}
+	}
+
+	return false
+}
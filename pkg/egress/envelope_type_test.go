@@ -0,0 +1,27 @@
+package egress_test
+
+import (
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/pkg/egress"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("EnvelopeType", func() {
+	It("returns the name of every envelope type", func() {
+		Expect(egress.EnvelopeType(&loggregator_v2.Envelope{Message: &loggregator_v2.Envelope_Log{}})).To(Equal("log"))
+		Expect(egress.EnvelopeType(&loggregator_v2.Envelope{Message: &loggregator_v2.Envelope_Counter{}})).To(Equal("counter"))
+		Expect(egress.EnvelopeType(&loggregator_v2.Envelope{Message: &loggregator_v2.Envelope_Gauge{}})).To(Equal("gauge"))
+		Expect(egress.EnvelopeType(&loggregator_v2.Envelope{Message: &loggregator_v2.Envelope_Timer{}})).To(Equal("timer"))
+		Expect(egress.EnvelopeType(&loggregator_v2.Envelope{Message: &loggregator_v2.Envelope_Event{}})).To(Equal("event"))
+		Expect(egress.EnvelopeType(&loggregator_v2.Envelope{})).To(BeEmpty())
+	})
+
+	It("validates envelope type names", func() {
+		for _, t := range egress.EnvelopeTypes {
+			Expect(egress.ValidEnvelopeType(t)).To(BeTrue())
+		}
+		Expect(egress.ValidEnvelopeType("metric")).To(BeFalse())
+	})
+})
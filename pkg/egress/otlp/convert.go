@@ -0,0 +1,308 @@
+package otlp
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+const scopeName = "loggregator-agent"
+
+// DefaultResourceTags are the envelope tags that describe the source of an
+// envelope. They become resource attributes instead of record attributes.
+var DefaultResourceTags = []string{
+	"deployment",
+	"job",
+	"index",
+	"ip",
+	"origin",
+}
+
+// converter groups envelopes by resource and converts them to OTLP logs,
+// metrics and spans.
+type converter struct {
+	resourceTags map[string]bool
+
+	order     []string
+	resources map[string]*resourcepb.Resource
+	logs      map[string][]*logspb.LogRecord
+	metrics   map[string][]*metricspb.Metric
+	spans     map[string][]*tracepb.Span
+
+	// The number of envelopes converted to logs, metrics and spans.
+	logCount    int
+	metricCount int
+	spanCount   int
+}
+
+func newConverter(resourceTags []string) *converter {
+	c := &converter{
+		resourceTags: make(map[string]bool),
+		resources:    make(map[string]*resourcepb.Resource),
+		logs:         make(map[string][]*logspb.LogRecord),
+		metrics:      make(map[string][]*metricspb.Metric),
+		spans:        make(map[string][]*tracepb.Span),
+	}
+
+	for _, t := range resourceTags {
+		c.resourceTags[t] = true
+	}
+
+	return c
+}
+
+// add converts the envelope. Envelopes that have no OTLP equivalent, such
+// as events, are ignored.
+func (c *converter) add(e *loggregator_v2.Envelope) {
+	resourceAttrs, recordAttrs := c.attributes(e)
+	key := resourceKey(resourceAttrs)
+	if _, ok := c.resources[key]; !ok {
+		c.order = append(c.order, key)
+		c.resources[key] = &resourcepb.Resource{Attributes: resourceAttrs}
+	}
+
+	ts := uint64(e.GetTimestamp())
+	switch m := e.GetMessage().(type) {
+	case *loggregator_v2.Envelope_Log:
+		c.logs[key] = append(c.logs[key], logRecord(m.Log, ts, recordAttrs))
+		c.logCount++
+	case *loggregator_v2.Envelope_Counter:
+		c.metrics[key] = append(c.metrics[key], counterMetric(m.Counter, ts, recordAttrs))
+		c.metricCount++
+	case *loggregator_v2.Envelope_Gauge:
+		c.metrics[key] = append(c.metrics[key], gaugeMetrics(m.Gauge, ts, recordAttrs)...)
+		c.metricCount++
+	case *loggregator_v2.Envelope_Timer:
+		c.spans[key] = append(c.spans[key], span(m.Timer, e.GetTags(), recordAttrs))
+		c.spanCount++
+	}
+}
+
+func (c *converter) resourceLogs() []*logspb.ResourceLogs {
+	var rls []*logspb.ResourceLogs
+	for _, key := range c.order {
+		if len(c.logs[key]) == 0 {
+			continue
+		}
+
+		rls = append(rls, &logspb.ResourceLogs{
+			Resource: c.resources[key],
+			ScopeLogs: []*logspb.ScopeLogs{{
+				Scope:      &commonpb.InstrumentationScope{Name: scopeName},
+				LogRecords: c.logs[key],
+			}},
+		})
+	}
+
+	return rls
+}
+
+func (c *converter) resourceMetrics() []*metricspb.ResourceMetrics {
+	var rms []*metricspb.ResourceMetrics
+	for _, key := range c.order {
+		if len(c.metrics[key]) == 0 {
+			continue
+		}
+
+		rms = append(rms, &metricspb.ResourceMetrics{
+			Resource: c.resources[key],
+			ScopeMetrics: []*metricspb.ScopeMetrics{{
+				Scope:   &commonpb.InstrumentationScope{Name: scopeName},
+				Metrics: c.metrics[key],
+			}},
+		})
+	}
+
+	return rms
+}
+
+func (c *converter) resourceSpans() []*tracepb.ResourceSpans {
+	var rss []*tracepb.ResourceSpans
+	for _, key := range c.order {
+		if len(c.spans[key]) == 0 {
+			continue
+		}
+
+		rss = append(rss, &tracepb.ResourceSpans{
+			Resource: c.resources[key],
+			ScopeSpans: []*tracepb.ScopeSpans{{
+				Scope: &commonpb.InstrumentationScope{Name: scopeName},
+				Spans: c.spans[key],
+			}},
+		})
+	}
+
+	return rss
+}
+
+// attributes splits the envelope's source and tags into resource and record
+// attributes. Both are sorted by key.
+func (c *converter) attributes(e *loggregator_v2.Envelope) ([]*commonpb.KeyValue, []*commonpb.KeyValue) {
+	resourceAttrs := []*commonpb.KeyValue{
+		stringAttr("service.name", e.GetSourceId()),
+	}
+	if e.GetInstanceId() != "" {
+		resourceAttrs = append(resourceAttrs, stringAttr("service.instance.id", e.GetInstanceId()))
+	}
+
+	var recordAttrs []*commonpb.KeyValue
+	for k, v := range e.GetTags() {
+		if c.resourceTags[k] {
+			resourceAttrs = append(resourceAttrs, stringAttr(k, v))
+			continue
+		}
+
+		recordAttrs = append(recordAttrs, stringAttr(k, v))
+	}
+
+	sortAttrs(resourceAttrs)
+	sortAttrs(recordAttrs)
+
+	return resourceAttrs, recordAttrs
+}
+
+func logRecord(l *loggregator_v2.Log, ts uint64, attrs []*commonpb.KeyValue) *logspb.LogRecord {
+	severityNumber := logspb.SeverityNumber_SEVERITY_NUMBER_INFO
+	severityText := "INFO"
+	if l.GetType() == loggregator_v2.Log_ERR {
+		severityNumber = logspb.SeverityNumber_SEVERITY_NUMBER_ERROR
+		severityText = "ERROR"
+	}
+
+	return &logspb.LogRecord{
+		TimeUnixNano:   ts,
+		SeverityNumber: severityNumber,
+		SeverityText:   severityText,
+		Body: &commonpb.AnyValue{
+			Value: &commonpb.AnyValue_StringValue{StringValue: validUTF8(string(l.GetPayload()))},
+		},
+		Attributes: attrs,
+	}
+}
+
+func counterMetric(c *loggregator_v2.Counter, ts uint64, attrs []*commonpb.KeyValue) *metricspb.Metric {
+	return &metricspb.Metric{
+		Name: validUTF8(c.GetName()),
+		Data: &metricspb.Metric_Sum{
+			Sum: &metricspb.Sum{
+				AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+				IsMonotonic:            true,
+				DataPoints: []*metricspb.NumberDataPoint{{
+					TimeUnixNano: ts,
+					Attributes:   attrs,
+					Value:        &metricspb.NumberDataPoint_AsInt{AsInt: int64(c.GetTotal())},
+				}},
+			},
+		},
+	}
+}
+
+// gaugeMetrics returns a metric for each value of the gauge, sorted by
+// name.
+func gaugeMetrics(g *loggregator_v2.Gauge, ts uint64, attrs []*commonpb.KeyValue) []*metricspb.Metric {
+	names := make([]string, 0, len(g.GetMetrics()))
+	for name := range g.GetMetrics() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	metrics := make([]*metricspb.Metric, 0, len(names))
+	for _, name := range names {
+		v := g.GetMetrics()[name]
+		metrics = append(metrics, &metricspb.Metric{
+			Name: validUTF8(name),
+			Unit: validUTF8(v.GetUnit()),
+			Data: &metricspb.Metric_Gauge{
+				Gauge: &metricspb.Gauge{
+					DataPoints: []*metricspb.NumberDataPoint{{
+						TimeUnixNano: ts,
+						Attributes:   attrs,
+						Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: v.GetValue()},
+					}},
+				},
+			},
+		})
+	}
+
+	return metrics
+}
+
+// span converts the timer to a span. The trace ID is taken from the
+// request_id tag when it is a UUID and is random otherwise.
+func span(t *loggregator_v2.Timer, tags map[string]string, attrs []*commonpb.KeyValue) *tracepb.Span {
+	traceID, ok := uuidBytes(tags["request_id"])
+	if !ok {
+		traceID = randomBytes(16)
+	}
+
+	return &tracepb.Span{
+		TraceId:           traceID,
+		SpanId:            randomBytes(8),
+		Name:              validUTF8(t.GetName()),
+		StartTimeUnixNano: uint64(t.GetStart()),
+		EndTimeUnixNano:   uint64(t.GetStop()),
+		Attributes:        attrs,
+	}
+}
+
+func uuidBytes(s string) ([]byte, bool) {
+	b, err := hex.DecodeString(strings.Replace(s, "-", "", -1))
+	if err != nil || len(b) != 16 {
+		return nil, false
+	}
+
+	return b, true
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	rand.Read(b)
+
+	return b
+}
+
+func stringAttr(k, v string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key: validUTF8(k),
+		Value: &commonpb.AnyValue{
+			Value: &commonpb.AnyValue_StringValue{StringValue: validUTF8(v)},
+		},
+	}
+}
+
+// validUTF8 replaces invalid UTF-8 with the Unicode replacement character.
+// Proto3 strings must be valid UTF-8 or the whole request fails to marshal.
+func validUTF8(s string) string {
+	if utf8.ValidString(s) {
+		return s
+	}
+
+	return strings.ToValidUTF8(s, string(utf8.RuneError))
+}
+
+func sortAttrs(attrs []*commonpb.KeyValue) {
+	sort.Slice(attrs, func(i, j int) bool {
+		return attrs[i].Key < attrs[j].Key
+	})
+}
+
+func resourceKey(attrs []*commonpb.KeyValue) string {
+	var b strings.Builder
+	for _, a := range attrs {
+		b.WriteString(a.Key)
+		b.WriteByte(0)
+		b.WriteString(a.GetValue().GetStringValue())
+		b.WriteByte(0)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,129 @@
+// Package otlp exports envelopes to an OpenTelemetry Protocol (OTLP)
+// receiver over gRPC.
+package otlp
+
+import (
+	"context"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+)
+
+// Exporter converts envelopes to OTLP and exports them. Logs become log
+// records, counters and gauges become metrics and timers become spans.
+type Exporter struct {
+	logs    collogspb.LogsServiceClient
+	metrics colmetricspb.MetricsServiceClient
+	traces  coltracepb.TraceServiceClient
+
+	resourceTags []string
+	timeout      time.Duration
+}
+
+// ExporterOption configures an Exporter.
+type ExporterOption func(*Exporter)
+
+// WithResourceTags sets the envelope tags that become resource attributes.
+// All other tags become attributes of the log record, data point or span.
+// It defaults to DefaultResourceTags.
+func WithResourceTags(tags ...string) ExporterOption {
+	return func(e *Exporter) {
+		e.resourceTags = tags
+	}
+}
+
+// WithExportTimeout sets the timeout of each export request. It defaults
+// to 10 seconds.
+func WithExportTimeout(d time.Duration) ExporterOption {
+	return func(e *Exporter) {
+		e.timeout = d
+	}
+}
+
+// NewExporter returns an Exporter that exports to the receiver on the given
+// connection.
+func NewExporter(conn grpc.ClientConnInterface, opts ...ExporterOption) *Exporter {
+	e := &Exporter{
+		logs:         collogspb.NewLogsServiceClient(conn),
+		metrics:      colmetricspb.NewMetricsServiceClient(conn),
+		traces:       coltracepb.NewTraceServiceClient(conn),
+		resourceTags: DefaultResourceTags,
+		timeout:      10 * time.Second,
+	}
+
+	for _, o := range opts {
+		o(e)
+	}
+
+	return e
+}
+
+// ExportError is returned by Write when the receiver fails to export some
+// of the envelopes.
+type ExportError struct {
+	// Failed is the number of envelopes that were not exported.
+	Failed int
+	Err    error
+}
+
+func (e *ExportError) Error() string {
+	return e.Err.Error()
+}
+
+// Write exports the batch. Only the services for which the batch has data
+// are called. Every service is called even if an earlier one fails. It
+// returns an *ExportError with the first error returned by the receiver.
+func (e *Exporter) Write(batch []*loggregator_v2.Envelope) error {
+	c := newConverter(e.resourceTags)
+	for _, env := range batch {
+		c.add(env)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	var exportErr *ExportError
+	failed := func(n int, err error) {
+		if exportErr == nil {
+			exportErr = &ExportError{Err: err}
+		}
+		exportErr.Failed += n
+	}
+
+	if rls := c.resourceLogs(); len(rls) > 0 {
+		_, err := e.logs.Export(ctx, &collogspb.ExportLogsServiceRequest{
+			ResourceLogs: rls,
+		})
+		if err != nil {
+			failed(c.logCount, err)
+		}
+	}
+
+	if rms := c.resourceMetrics(); len(rms) > 0 {
+		_, err := e.metrics.Export(ctx, &colmetricspb.ExportMetricsServiceRequest{
+			ResourceMetrics: rms,
+		})
+		if err != nil {
+			failed(c.metricCount, err)
+		}
+	}
+
+	if rss := c.resourceSpans(); len(rss) > 0 {
+		_, err := e.traces.Export(ctx, &coltracepb.ExportTraceServiceRequest{
+			ResourceSpans: rss,
+		})
+		if err != nil {
+			failed(c.spanCount, err)
+		}
+	}
+
+	if exportErr != nil {
+		return exportErr
+	}
+
+	return nil
+}
@@ -0,0 +1,382 @@
+package otlp_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/pkg/egress/otlp"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Exporter", func() {
+	var (
+		receiver *stubReceiver
+		conn     *grpc.ClientConn
+		exporter *otlp.Exporter
+	)
+
+	BeforeEach(func() {
+		receiver = startStubReceiver()
+
+		var err error
+		conn, err = grpc.Dial(receiver.addr, grpc.WithInsecure())
+		Expect(err).ToNot(HaveOccurred())
+
+		exporter = otlp.NewExporter(conn)
+	})
+
+	AfterEach(func() {
+		conn.Close()
+		receiver.stop()
+	})
+
+	It("exports logs as log records", func() {
+		err := exporter.Write([]*loggregator_v2.Envelope{
+			{
+				Timestamp:  99,
+				SourceId:   "app-id",
+				InstanceId: "1",
+				Tags: map[string]string{
+					"deployment":  "cf",
+					"source_type": "APP/PROC/WEB",
+				},
+				Message: &loggregator_v2.Envelope_Log{
+					Log: &loggregator_v2.Log{Payload: []byte("hello"), Type: loggregator_v2.Log_ERR},
+				},
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		reqs := receiver.logRequests()
+		Expect(reqs).To(HaveLen(1))
+		Expect(reqs[0].ResourceLogs).To(HaveLen(1))
+
+		rl := reqs[0].ResourceLogs[0]
+		Expect(attrs(rl.Resource.Attributes)).To(Equal(map[string]string{
+			"service.name":        "app-id",
+			"service.instance.id": "1",
+			"deployment":          "cf",
+		}))
+
+		record := rl.ScopeLogs[0].LogRecords[0]
+		Expect(record.TimeUnixNano).To(Equal(uint64(99)))
+		Expect(record.Body.GetStringValue()).To(Equal("hello"))
+		Expect(record.SeverityNumber).To(Equal(logspb.SeverityNumber_SEVERITY_NUMBER_ERROR))
+		Expect(attrs(record.Attributes)).To(Equal(map[string]string{
+			"source_type": "APP/PROC/WEB",
+		}))
+
+		Expect(receiver.metricRequests()).To(BeEmpty())
+		Expect(receiver.traceRequests()).To(BeEmpty())
+	})
+
+	It("exports counters and gauges as metrics", func() {
+		err := exporter.Write([]*loggregator_v2.Envelope{
+			{
+				SourceId: "doppler",
+				Message: &loggregator_v2.Envelope_Counter{
+					Counter: &loggregator_v2.Counter{Name: "ingress", Total: 10},
+				},
+			},
+			{
+				SourceId: "doppler",
+				Tags:     map[string]string{"direction": "egress"},
+				Message: &loggregator_v2.Envelope_Gauge{
+					Gauge: &loggregator_v2.Gauge{
+						Metrics: map[string]*loggregator_v2.GaugeValue{
+							"cpu":    {Unit: "percentage", Value: 12.5},
+							"memory": {Unit: "bytes", Value: 1024},
+						},
+					},
+				},
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		reqs := receiver.metricRequests()
+		Expect(reqs).To(HaveLen(1))
+		Expect(reqs[0].ResourceMetrics).To(HaveLen(1))
+
+		metrics := reqs[0].ResourceMetrics[0].ScopeMetrics[0].Metrics
+		Expect(metrics).To(HaveLen(3))
+
+		Expect(metrics[0].Name).To(Equal("ingress"))
+		sum := metrics[0].GetSum()
+		Expect(sum.IsMonotonic).To(BeTrue())
+		Expect(sum.AggregationTemporality).To(Equal(metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE))
+		Expect(sum.DataPoints[0].GetAsInt()).To(Equal(int64(10)))
+
+		Expect(metrics[1].Name).To(Equal("cpu"))
+		Expect(metrics[1].Unit).To(Equal("percentage"))
+		Expect(metrics[1].GetGauge().DataPoints[0].GetAsDouble()).To(Equal(12.5))
+		Expect(attrs(metrics[1].GetGauge().DataPoints[0].Attributes)).To(Equal(map[string]string{
+			"direction": "egress",
+		}))
+
+		Expect(metrics[2].Name).To(Equal("memory"))
+		Expect(metrics[2].GetGauge().DataPoints[0].GetAsDouble()).To(Equal(1024.0))
+	})
+
+	It("exports timers as spans", func() {
+		err := exporter.Write([]*loggregator_v2.Envelope{
+			{
+				SourceId: "app-id",
+				Tags:     map[string]string{"request_id": "c2b0a1c4-d7d6-4fd6-9a6c-2bcd4e3b1b8f"},
+				Message: &loggregator_v2.Envelope_Timer{
+					Timer: &loggregator_v2.Timer{Name: "http", Start: 10, Stop: 20},
+				},
+			},
+			{
+				SourceId: "app-id",
+				Message: &loggregator_v2.Envelope_Timer{
+					Timer: &loggregator_v2.Timer{Name: "http", Start: 30, Stop: 40},
+				},
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		reqs := receiver.traceRequests()
+		Expect(reqs).To(HaveLen(1))
+
+		spans := reqs[0].ResourceSpans[0].ScopeSpans[0].Spans
+		Expect(spans).To(HaveLen(2))
+		Expect(spans[0].Name).To(Equal("http"))
+		Expect(spans[0].StartTimeUnixNano).To(Equal(uint64(10)))
+		Expect(spans[0].EndTimeUnixNano).To(Equal(uint64(20)))
+		Expect(spans[0].TraceId).To(Equal([]byte{
+			0xc2, 0xb0, 0xa1, 0xc4, 0xd7, 0xd6, 0x4f, 0xd6,
+			0x9a, 0x6c, 0x2b, 0xcd, 0x4e, 0x3b, 0x1b, 0x8f,
+		}))
+		Expect(spans[0].SpanId).To(HaveLen(8))
+		Expect(spans[1].TraceId).To(HaveLen(16))
+	})
+
+	It("groups envelopes by resource", func() {
+		err := exporter.Write([]*loggregator_v2.Envelope{
+			logEnvelope("app-1"),
+			logEnvelope("app-2"),
+			logEnvelope("app-1"),
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		reqs := receiver.logRequests()
+		Expect(reqs).To(HaveLen(1))
+		Expect(reqs[0].ResourceLogs).To(HaveLen(2))
+		Expect(reqs[0].ResourceLogs[0].ScopeLogs[0].LogRecords).To(HaveLen(2))
+		Expect(reqs[0].ResourceLogs[1].ScopeLogs[0].LogRecords).To(HaveLen(1))
+	})
+
+	It("uses the configured resource tags", func() {
+		exporter = otlp.NewExporter(conn, otlp.WithResourceTags("az"))
+
+		e := logEnvelope("app-id")
+		e.Tags = map[string]string{"az": "z1", "deployment": "cf"}
+		Expect(exporter.Write([]*loggregator_v2.Envelope{e})).To(Succeed())
+
+		rl := receiver.logRequests()[0].ResourceLogs[0]
+		Expect(attrs(rl.Resource.Attributes)).To(HaveKeyWithValue("az", "z1"))
+		Expect(attrs(rl.ScopeLogs[0].LogRecords[0].Attributes)).To(HaveKeyWithValue("deployment", "cf"))
+	})
+
+	It("returns an error when the receiver fails", func() {
+		receiver.setErr(errors.New("some-error"))
+
+		err := exporter.Write([]*loggregator_v2.Envelope{logEnvelope("app-id")})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("reports only the envelopes of the services that failed", func() {
+		receiver.setMetricsErr(errors.New("some-error"))
+
+		err := exporter.Write([]*loggregator_v2.Envelope{
+			logEnvelope("app-id"),
+			logEnvelope("app-id"),
+			{
+				SourceId: "doppler",
+				Message: &loggregator_v2.Envelope_Counter{
+					Counter: &loggregator_v2.Counter{Name: "ingress", Total: 10},
+				},
+			},
+			{
+				SourceId: "doppler",
+				Message: &loggregator_v2.Envelope_Timer{
+					Timer: &loggregator_v2.Timer{Name: "http"},
+				},
+			},
+		})
+
+		exportErr, ok := err.(*otlp.ExportError)
+		Expect(ok).To(BeTrue())
+		Expect(exportErr.Failed).To(Equal(1))
+		Expect(receiver.logRequests()).To(HaveLen(1))
+		Expect(receiver.traceRequests()).To(HaveLen(1))
+	})
+
+	It("replaces invalid UTF-8 in payloads and tags", func() {
+		err := exporter.Write([]*loggregator_v2.Envelope{
+			{
+				SourceId: "app-id",
+				Tags:     map[string]string{"key": "va\xfflue"},
+				Message: &loggregator_v2.Envelope_Log{
+					Log: &loggregator_v2.Log{Payload: []byte("hel\xfflo")},
+				},
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		reqs := receiver.logRequests()
+		Expect(reqs).To(HaveLen(1))
+
+		record := reqs[0].ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+		Expect(record.Body.GetStringValue()).To(Equal("hel\uFFFDlo"))
+		Expect(attrs(record.Attributes)).To(HaveKeyWithValue("key", "va\uFFFDlue"))
+	})
+
+	It("does not export envelopes without an OTLP equivalent", func() {
+		err := exporter.Write([]*loggregator_v2.Envelope{
+			{
+				SourceId: "app-id",
+				Message: &loggregator_v2.Envelope_Event{
+					Event: &loggregator_v2.Event{Title: "title"},
+				},
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(receiver.logRequests()).To(BeEmpty())
+		Expect(receiver.metricRequests()).To(BeEmpty())
+		Expect(receiver.traceRequests()).To(BeEmpty())
+	})
+})
+
+func logEnvelope(sourceID string) *loggregator_v2.Envelope {
+	return &loggregator_v2.Envelope{
+		SourceId: sourceID,
+		Message: &loggregator_v2.Envelope_Log{
+			Log: &loggregator_v2.Log{Payload: []byte("hello")},
+		},
+	}
+}
+
+func attrs(kvs []*commonpb.KeyValue) map[string]string {
+	m := make(map[string]string)
+	for _, kv := range kvs {
+		m[kv.Key] = kv.Value.GetStringValue()
+	}
+
+	return m
+}
+
+// stubReceiver is an OTLP receiver that records every request.
+type stubReceiver struct {
+	addr string
+	stop func()
+
+	mu         sync.Mutex
+	err        error
+	metricsErr error
+	logs       []*collogspb.ExportLogsServiceRequest
+	metrics    []*colmetricspb.ExportMetricsServiceRequest
+	traces     []*coltracepb.ExportTraceServiceRequest
+}
+
+func startStubReceiver() *stubReceiver {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).ToNot(HaveOccurred())
+
+	r := &stubReceiver{addr: lis.Addr().String()}
+	srv := grpc.NewServer()
+	collogspb.RegisterLogsServiceServer(srv, stubLogsService{r: r})
+	colmetricspb.RegisterMetricsServiceServer(srv, stubMetricsService{r: r})
+	coltracepb.RegisterTraceServiceServer(srv, stubTraceService{r: r})
+	go srv.Serve(lis)
+
+	r.stop = srv.Stop
+
+	return r
+}
+
+func (r *stubReceiver) setErr(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = err
+}
+
+func (r *stubReceiver) setMetricsErr(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metricsErr = err
+}
+
+func (r *stubReceiver) logRequests() []*collogspb.ExportLogsServiceRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.logs
+}
+
+func (r *stubReceiver) metricRequests() []*colmetricspb.ExportMetricsServiceRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.metrics
+}
+
+func (r *stubReceiver) traceRequests() []*coltracepb.ExportTraceServiceRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.traces
+}
+
+type stubLogsService struct {
+	collogspb.UnimplementedLogsServiceServer
+	r *stubReceiver
+}
+
+func (s stubLogsService) Export(_ context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.r.logs = append(s.r.logs, req)
+
+	return &collogspb.ExportLogsServiceResponse{}, s.r.err
+}
+
+type stubMetricsService struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+	r *stubReceiver
+}
+
+func (s stubMetricsService) Export(_ context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.r.metrics = append(s.r.metrics, req)
+
+	if s.r.metricsErr != nil {
+		return nil, s.r.metricsErr
+	}
+
+	return &colmetricspb.ExportMetricsServiceResponse{}, s.r.err
+}
+
+type stubTraceService struct {
+	coltracepb.UnimplementedTraceServiceServer
+	r *stubReceiver
+}
+
+func (s stubTraceService) Export(_ context.Context, req *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.r.traces = append(s.r.traces, req)
+
+	return &coltracepb.ExportTraceServiceResponse{}, s.r.err
+}
@@ -0,0 +1,154 @@
+package syslog
+
+import (
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/pkg/diodes"
+	"code.cloudfoundry.org/loggregator-agent/pkg/egress"
+)
+
+// Connection states reported in DrainState.
+const (
+	StatePending   = "pending"
+	StateConnected = "connected"
+	StateFailing   = "failing"
+)
+
+// DrainState is a snapshot of the state of a drain writer.
+type DrainState struct {
+	Connection    string    `json:"connection"`
+	LastError     string    `json:"last_error,omitempty"`
+	LastErrorTime time.Time `json:"last_error_time,omitempty"`
+	LastWriteTime time.Time `json:"last_write_time,omitempty"`
+	QueueDepth    int64     `json:"queue_depth"`
+	HighWater     int64     `json:"queue_high_water"`
+}
+
+// drainState tracks the state of a drain writer. The occupancy of the
+// drain's diode gives the queue depth and its high water mark since the
+// drain was connected.
+type drainState struct {
+	occupancy *diodes.Occupancy
+
+	mu            sync.Mutex
+	connection    string
+	lastError     string
+	lastErrorTime time.Time
+	lastWriteTime time.Time
+}
+
+func newDrainState() *drainState {
+	return &drainState{
+		occupancy:  diodes.NewOccupancy(),
+		connection: StatePending,
+	}
+}
+
+func (s *drainState) write(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.setConnection(err)
+	if err == nil {
+		s.lastWriteTime = time.Now()
+	}
+}
+
+func (s *drainState) dialed(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.setConnection(err)
+}
+
+// setConnection updates the connection state. The caller must hold the lock.
+func (s *drainState) setConnection(err error) {
+	if err != nil {
+		s.connection = StateFailing
+		s.lastError = err.Error()
+		s.lastErrorTime = time.Now()
+		return
+	}
+
+	s.connection = StateConnected
+}
+
+func (s *drainState) snapshot() DrainState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return DrainState{
+		Connection:    s.connection,
+		LastError:     s.lastError,
+		LastErrorTime: s.lastErrorTime,
+		LastWriteTime: s.lastWriteTime,
+		QueueDepth:    s.occupancy.Fill(),
+		HighWater:     s.occupancy.HighWater(),
+	}
+}
+
+// stateWriter records the result of every write to the drain.
+type stateWriter struct {
+	egress.WriteCloser
+	state *drainState
+}
+
+func (w stateWriter) Write(e *loggregator_v2.Envelope) error {
+	err := w.WriteCloser.Write(e)
+	w.state.write(err)
+
+	return err
+}
+
+// drainWriter is the writer handed out by the SyslogConnector. It drops
+// envelopes that do not match the drain type of the binding before they
+// reach the drain's diode.
+type drainWriter struct {
+	drainType DrainType
+	writer    egress.Writer
+	dialer    dialer
+	state     *drainState
+}
+
+type dialer interface {
+	Dial() error
+}
+
+func (w *drainWriter) Write(env *loggregator_v2.Envelope) error {
+	if !matchesDrainType(w.drainType, env) {
+		return nil
+	}
+
+	return w.writer.Write(env)
+}
+
+// Dial connects to the drain ahead of the first write. Writers without a
+// persistent connection are not affected.
+func (w *drainWriter) Dial() error {
+	if w.dialer == nil {
+		return nil
+	}
+
+	err := w.dialer.Dial()
+	w.state.dialed(err)
+
+	return err
+}
+
+// State returns a snapshot of the state of the drain.
+func (w *drainWriter) State() DrainState {
+	return w.state.snapshot()
+}
+
+func matchesDrainType(t DrainType, env *loggregator_v2.Envelope) bool {
+	switch env.GetMessage().(type) {
+	case *loggregator_v2.Envelope_Log:
+		return t == LOGS || t == ALL
+	case *loggregator_v2.Envelope_Counter, *loggregator_v2.Envelope_Gauge, *loggregator_v2.Envelope_Timer:
+		return t == METRICS || t == ALL
+	default:
+		return t == ALL
+	}
+}
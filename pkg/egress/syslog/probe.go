@@ -0,0 +1,66 @@
+package syslog
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+
+	"golang.org/x/net/context"
+)
+
+// Probe checks that the drain of the binding accepts connections. It dials
+// the drain and completes the TLS handshake for syslog-tls and https drains
+// without writing any data. Failures are reported to the app.
+func (w *SyslogConnector) Probe(ctx context.Context, b Binding) error {
+	urlBinding, err := buildBinding(ctx, b)
+	if err != nil {
+		return err
+	}
+
+	err = w.probe(urlBinding)
+	if err != nil && b.AppId != "" {
+		anonymousUrl := *urlBinding.URL
+		anonymousUrl.User = nil
+		anonymousUrl.RawQuery = ""
+
+		w.emitErrorLog(b.AppId, fmt.Sprintf("Syslog drain %s failed health check", anonymousUrl.String()))
+	}
+
+	return err
+}
+
+func (w *SyslogConnector) probe(b *URLBinding) error {
+	dialer := &net.Dialer{
+		Timeout: w.dialTimeout,
+	}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	switch b.Scheme() {
+	case "syslog":
+		conn, err = dialer.Dial("tcp", b.URL.Host)
+	case "syslog-tls":
+		conn, err = tls.DialWithDialer(dialer, "tcp", b.URL.Host, &tls.Config{
+			InsecureSkipVerify: w.skipCertVerify,
+		})
+	case "https":
+		addr := b.URL.Host
+		if b.URL.Port() == "" {
+			addr = net.JoinHostPort(b.URL.Hostname(), "443")
+		}
+
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{
+			InsecureSkipVerify: w.skipCertVerify,
+		})
+	default:
+		return errors.New("unsupported protocol")
+	}
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
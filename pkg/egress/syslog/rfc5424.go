@@ -120,6 +120,15 @@ func genPriority(logType loggregator_v2.Log_Type) string {
 	}
 }
 
+// appName returns the app ID of the binding. Aggregate drains are not bound
+// to an app, so the source ID of the envelope is used instead.
+func appName(appID string, env *loggregator_v2.Envelope) string {
+	if appID == "" {
+		return env.GetSourceId()
+	}
+	return appID
+}
+
 func nilify(x string) string {
 	if x == "" {
 		return "-"
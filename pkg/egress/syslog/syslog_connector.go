@@ -8,8 +8,9 @@ import (
 
 	"golang.org/x/net/context"
 
-	"code.cloudfoundry.org/go-diodes"
+	gendiodes "code.cloudfoundry.org/go-diodes"
 	"code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/loggregator-agent/pkg/diodes"
 	"code.cloudfoundry.org/loggregator-agent/pkg/egress"
 )
 
@@ -47,6 +48,9 @@ type SyslogConnector struct {
 	writerFactory  writerFactory
 	m              metricClient
 	droppedMetric  metrics.Counter
+	occupancy      *diodes.Occupancy
+
+	aggregateDroppedMetric metrics.Counter
 }
 
 // NewSyslogConnector configures and returns a new SyslogConnector.
@@ -59,6 +63,7 @@ func NewSyslogConnector(
 	opts ...ConnectorOption,
 ) *SyslogConnector {
 	metric := m.NewCounter("dropped", metrics.WithMetricTags(map[string]string{"direction": "egress"}))
+	aggregateMetric := m.NewCounter("aggregate_drains_dropped")
 
 	sc := &SyslogConnector{
 		keepalive:      netConf.Keepalive,
@@ -69,6 +74,8 @@ func NewSyslogConnector(
 		logClient:      nullLogClient{},
 		writerFactory:  f,
 		droppedMetric:  metric,
+
+		aggregateDroppedMetric: aggregateMetric,
 	}
 	for _, o := range opts {
 		o(sc)
@@ -97,6 +104,14 @@ func WithLogClient(logClient LogClient, sourceIndex string) ConnectorOption {
 	}
 }
 
+// WithOccupancy returns a ConnectorOption that tracks the total fill level
+// of the diodes of all drains in the given occupancy.
+func WithOccupancy(o *diodes.Occupancy) ConnectorOption {
+	return func(sc *SyslogConnector) {
+		sc.occupancy = o
+	}
+}
+
 // Connect returns an egress writer based on the scheme of the binding drain
 // URL.
 func (w *SyslogConnector) Connect(ctx context.Context, b Binding) (egress.Writer, error) {
@@ -124,18 +139,44 @@ func (w *SyslogConnector) Connect(ctx context.Context, b Binding) (egress.Writer
 	anonymousUrl.User = nil
 	anonymousUrl.RawQuery = ""
 
-	dw := egress.NewDiodeWriter(ctx, writer, diodes.AlertFunc(func(missed int) {
+	d, _ := writer.(dialer)
+	state := newDrainState()
+	writer = stateWriter{WriteCloser: writer, state: state}
+
+	occupancies := []*diodes.Occupancy{state.occupancy}
+	if w.occupancy != nil {
+		occupancies = append(occupancies, w.occupancy)
+	}
+
+	dw := egress.NewDiodeWriter(ctx, writer, gendiodes.AlertFunc(func(missed int) {
 		w.droppedMetric.Add(float64(missed))
 
+		// Aggregate drains are not bound to an app, so there is nobody to
+		// notify other than the operator.
+		if b.AppId == "" {
+			w.aggregateDroppedMetric.Add(float64(missed))
+
+			log.Printf(
+				"Dropped %d %s logs for aggregate drain url %s",
+				missed, urlBinding.Scheme(), anonymousUrl.String(),
+			)
+			return
+		}
+
 		w.emitErrorLog(b.AppId, fmt.Sprintf("%d messages lost in user provided syslog drain", missed))
 
 		log.Printf(
 			"Dropped %d %s logs for url %s in app %s",
 			missed, urlBinding.Scheme(), anonymousUrl.String(), b.AppId,
 		)
-	}), w.wg)
-
-	return dw, nil
+	}), w.wg, egress.WithOccupancy(occupancies...))
+
+	return &drainWriter{
+		drainType: urlBinding.DrainType,
+		writer:    dw,
+		dialer:    d,
+		state:     state,
+	}, nil
 }
 
 func (w *SyslogConnector) emitErrorLog(appID, message string) {
@@ -4,12 +4,14 @@ import (
 	"code.cloudfoundry.org/loggregator-agent/internal/testhelper"
 	"errors"
 	"io"
+	"net"
 	"sync/atomic"
 	"time"
 
 	"golang.org/x/net/context"
 
 	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/pkg/diodes"
 	"code.cloudfoundry.org/loggregator-agent/pkg/egress"
 	"code.cloudfoundry.org/loggregator-agent/pkg/egress/syslog"
 
@@ -133,6 +135,214 @@ var _ = Describe("SyslogConnector", func() {
 		Expect(logClient.sourceType()).To(HaveKey("LGR"))
 	})
 
+	Describe("drain state", func() {
+		var connector *syslog.SyslogConnector
+
+		BeforeEach(func() {
+			connector = syslog.NewSyslogConnector(
+				netConf,
+				true,
+				spyWaitGroup,
+				writerFactory,
+				sm,
+			)
+		})
+
+		It("reports a pending drain before anything is written", func() {
+			writerFactory.writer = &SleepWriterCloser{metric: func(uint64) {}}
+
+			writer, err := connector.Connect(ctx, syslog.Binding{AppId: "app-id", Drain: "syslog://"})
+			Expect(err).ToNot(HaveOccurred())
+
+			state := writer.(stater).State()
+			Expect(state.Connection).To(Equal(syslog.StatePending))
+			Expect(state.QueueDepth).To(BeZero())
+		})
+
+		It("reports the last write time of a connected drain", func() {
+			writerFactory.writer = &SleepWriterCloser{metric: func(uint64) {}}
+
+			writer, err := connector.Connect(ctx, syslog.Binding{AppId: "app-id", Drain: "syslog://"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(writer.Write(logEnvelope())).To(Succeed())
+
+			Eventually(func() string {
+				return writer.(stater).State().Connection
+			}).Should(Equal(syslog.StateConnected))
+			Expect(writer.(stater).State().LastWriteTime).ToNot(BeZero())
+		})
+
+		It("reports the last error of a failing drain", func() {
+			writerFactory.writer = &errorWriteCloser{err: errors.New("connection refused")}
+
+			writer, err := connector.Connect(ctx, syslog.Binding{AppId: "app-id", Drain: "syslog://"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(writer.Write(logEnvelope())).To(Succeed())
+
+			Eventually(func() string {
+				return writer.(stater).State().Connection
+			}).Should(Equal(syslog.StateFailing))
+			Expect(writer.(stater).State().LastError).To(Equal("connection refused"))
+		})
+
+		It("reports the queue depth", func() {
+			writerFactory.writer = &SleepWriterCloser{
+				metric:   func(uint64) {},
+				duration: time.Hour,
+			}
+
+			writer, err := connector.Connect(ctx, syslog.Binding{AppId: "app-id", Drain: "syslog://"})
+			Expect(err).ToNot(HaveOccurred())
+			for i := 0; i < 5; i++ {
+				Expect(writer.Write(logEnvelope())).To(Succeed())
+			}
+
+			Expect(writer.(stater).State().QueueDepth).To(Equal(int64(5)))
+			Expect(writer.(stater).State().HighWater).To(Equal(int64(5)))
+		})
+
+		It("tracks the total queue depth of all drains", func() {
+			writerFactory.writer = &SleepWriterCloser{
+				metric:   func(uint64) {},
+				duration: time.Hour,
+			}
+			o := diodes.NewOccupancy()
+			connector = syslog.NewSyslogConnector(
+				netConf,
+				true,
+				spyWaitGroup,
+				writerFactory,
+				sm,
+				syslog.WithOccupancy(o),
+			)
+
+			for _, drain := range []string{"syslog://a", "syslog://b"} {
+				writer, err := connector.Connect(ctx, syslog.Binding{AppId: "app-id", Drain: drain})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(writer.Write(logEnvelope())).To(Succeed())
+			}
+
+			Expect(o.Fill()).To(Equal(int64(2)))
+		})
+	})
+
+	Describe("Probe()", func() {
+		var (
+			logClient *spyLogClient
+			connector *syslog.SyslogConnector
+		)
+
+		BeforeEach(func() {
+			logClient = newSpyLogClient()
+			connector = syslog.NewSyslogConnector(
+				syslog.NetworkTimeoutConfig{DialTimeout: time.Second},
+				true,
+				spyWaitGroup,
+				writerFactory,
+				sm,
+				syslog.WithLogClient(logClient, "3"),
+			)
+		})
+
+		It("succeeds when the drain accepts connections", func() {
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).ToNot(HaveOccurred())
+			defer lis.Close()
+
+			binding := syslog.Binding{AppId: "app-id", Drain: "syslog://" + lis.Addr().String()}
+			Expect(connector.Probe(ctx, binding)).To(Succeed())
+			Expect(logClient.message()).To(BeEmpty())
+		})
+
+		It("reports drains that do not accept connections to the app", func() {
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).ToNot(HaveOccurred())
+			addr := lis.Addr().String()
+			lis.Close()
+
+			binding := syslog.Binding{AppId: "app-id", Drain: "syslog://user:pass@" + addr + "?token=secret"}
+			Expect(connector.Probe(ctx, binding)).ToNot(Succeed())
+
+			Expect(logClient.message()).To(ContainElement("Syslog drain syslog://" + addr + " failed health check"))
+			Expect(logClient.appID()).To(ContainElement("app-id"))
+		})
+
+		It("does not report failing aggregate drains to an app", func() {
+			binding := syslog.Binding{Drain: "syslog://127.0.0.1:1"}
+
+			Expect(connector.Probe(ctx, binding)).ToNot(Succeed())
+			Expect(logClient.message()).To(BeEmpty())
+		})
+
+		It("returns an error for unsupported protocols", func() {
+			binding := syslog.Binding{AppId: "app-id", Drain: "bla://some-domain.tld"}
+
+			Expect(connector.Probe(ctx, binding)).To(MatchError("unsupported protocol"))
+		})
+	})
+
+	Describe("drain types", func() {
+		var writes int64
+
+		BeforeEach(func() {
+			writes = 0
+			writerFactory.writer = &SleepWriterCloser{
+				metric: func(n uint64) { atomic.AddInt64(&writes, int64(n)) },
+			}
+		})
+
+		writeAll := func(drain string) {
+			connector := syslog.NewSyslogConnector(
+				netConf,
+				true,
+				spyWaitGroup,
+				writerFactory,
+				sm,
+			)
+
+			writer, err := connector.Connect(ctx, syslog.Binding{AppId: "app-id", Drain: drain})
+			Expect(err).ToNot(HaveOccurred())
+
+			for _, e := range []*loggregator_v2.Envelope{
+				{Message: &loggregator_v2.Envelope_Log{Log: &loggregator_v2.Log{}}},
+				{Message: &loggregator_v2.Envelope_Counter{Counter: &loggregator_v2.Counter{}}},
+				{Message: &loggregator_v2.Envelope_Gauge{Gauge: &loggregator_v2.Gauge{}}},
+				{Message: &loggregator_v2.Envelope_Timer{Timer: &loggregator_v2.Timer{}}},
+				{Message: &loggregator_v2.Envelope_Event{Event: &loggregator_v2.Event{}}},
+			} {
+				Expect(writer.Write(e)).To(Succeed())
+			}
+		}
+
+		It("only writes logs by default", func() {
+			writeAll("syslog://some-domain.tld")
+
+			Eventually(func() int64 { return atomic.LoadInt64(&writes) }).Should(Equal(int64(1)))
+			Consistently(func() int64 { return atomic.LoadInt64(&writes) }).Should(Equal(int64(1)))
+		})
+
+		It("only writes logs for the logs drain type", func() {
+			writeAll("syslog://some-domain.tld?drain-type=logs")
+
+			Eventually(func() int64 { return atomic.LoadInt64(&writes) }).Should(Equal(int64(1)))
+			Consistently(func() int64 { return atomic.LoadInt64(&writes) }).Should(Equal(int64(1)))
+		})
+
+		It("only writes metrics for the metrics drain type", func() {
+			writeAll("syslog://some-domain.tld?drain-type=metrics")
+
+			Eventually(func() int64 { return atomic.LoadInt64(&writes) }).Should(Equal(int64(3)))
+			Consistently(func() int64 { return atomic.LoadInt64(&writes) }).Should(Equal(int64(3)))
+		})
+
+		It("writes every envelope for the all drain type", func() {
+			writeAll("syslog://some-domain.tld?drain-type=all")
+
+			Eventually(func() int64 { return atomic.LoadInt64(&writes) }).Should(Equal(int64(5)))
+			Consistently(func() int64 { return atomic.LoadInt64(&writes) }).Should(Equal(int64(5)))
+		})
+	})
+
 	Describe("dropping messages", func() {
 		BeforeEach(func() {
 			writerFactory.writer = &SleepWriterCloser{
@@ -159,6 +369,9 @@ var _ = Describe("SyslogConnector", func() {
 				for {
 					w.Write(&loggregator_v2.Envelope{
 						SourceId: "test-source-id",
+						Message: &loggregator_v2.Envelope_Log{
+							Log: &loggregator_v2.Log{},
+						},
 					})
 				}
 			}(writer)
@@ -187,6 +400,9 @@ var _ = Describe("SyslogConnector", func() {
 				for {
 					w.Write(&loggregator_v2.Envelope{
 						SourceId: "test-source-id",
+						Message: &loggregator_v2.Envelope_Log{
+							Log: &loggregator_v2.Log{},
+						},
 					})
 				}
 			}(writer)
@@ -203,6 +419,37 @@ var _ = Describe("SyslogConnector", func() {
 			Eventually(logClient.sourceInstance).Should(HaveKey("3"))
 		})
 
+		It("emits a metric and does not emit app logs for aggregate drains", func() {
+			logClient := newSpyLogClient()
+			connector := syslog.NewSyslogConnector(
+				netConf,
+				true,
+				spyWaitGroup,
+				writerFactory,
+				sm,
+				syslog.WithLogClient(logClient, "3"),
+			)
+
+			binding := syslog.Binding{Drain: "dropping://"}
+			writer, err := connector.Connect(ctx, binding)
+			Expect(err).ToNot(HaveOccurred())
+
+			go func(w egress.Writer) {
+				for {
+					w.Write(&loggregator_v2.Envelope{
+						SourceId: "test-source-id",
+						Message: &loggregator_v2.Envelope_Log{
+							Log: &loggregator_v2.Log{},
+						},
+					})
+				}
+			}(writer)
+
+			metric := sm.GetMetric("aggregate_drains_dropped", nil)
+			Eventually(metric.Value).Should(BeNumerically(">=", 10000))
+			Consistently(logClient.message).Should(BeEmpty())
+		})
+
 		It("does not panic on unknown dropped metrics", func() {
 			binding := syslog.Binding{Drain: "dropping://"}
 
@@ -221,6 +468,9 @@ var _ = Describe("SyslogConnector", func() {
 				for i := 0; i < 50000; i++ {
 					writer.Write(&loggregator_v2.Envelope{
 						SourceId: "test-source-id",
+						Message: &loggregator_v2.Envelope_Log{
+							Log: &loggregator_v2.Log{},
+						},
 					})
 				}
 			}
@@ -229,6 +479,31 @@ var _ = Describe("SyslogConnector", func() {
 	})
 })
 
+type stater interface {
+	State() syslog.DrainState
+}
+
+func logEnvelope() *loggregator_v2.Envelope {
+	return &loggregator_v2.Envelope{
+		SourceId: "test-source-id",
+		Message: &loggregator_v2.Envelope_Log{
+			Log: &loggregator_v2.Log{},
+		},
+	}
+}
+
+type errorWriteCloser struct {
+	err error
+}
+
+func (c *errorWriteCloser) Write(*loggregator_v2.Envelope) error {
+	return c.err
+}
+
+func (c *errorWriteCloser) Close() error {
+	return nil
+}
+
 type stubWriterFactory struct {
 	called bool
 	writer egress.WriteCloser
@@ -9,6 +9,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
@@ -29,7 +30,9 @@ type DialFunc func(addr string) (net.Conn, error)
 // TCPWriter represents a syslog writer that connects over unencrypted TCP.
 // This writer is not meant to be used from multiple goroutines. The same
 // goroutine that calls `.Write()` should be the one that calls `.Close()`.
+// Only `.Dial()` may be called from another goroutine.
 type TCPWriter struct {
+	mu           sync.Mutex
 	url          *url.URL
 	appID        string
 	hostname     string
@@ -71,12 +74,15 @@ func NewTCPWriter(
 
 // Write writes an envelope to the syslog drain connection.
 func (w *TCPWriter) Write(env *loggregator_v2.Envelope) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
 	conn, err := w.connection()
 	if err != nil {
 		return err
 	}
 
-	msgs, err := ToRFC5424(env, w.hostname, w.appID)
+	msgs, err := ToRFC5424(env, w.hostname, appName(w.appID, env))
 	if err != nil {
 		return err
 	}
@@ -85,13 +91,13 @@ func (w *TCPWriter) Write(env *loggregator_v2.Envelope) error {
 		conn.SetWriteDeadline(time.Now().Add(w.writeTimeout))
 		_, err = conn.Write([]byte(strconv.Itoa(len(msg)) + " "))
 		if err != nil {
-			_ = w.Close()
+			_ = w.close()
 			return err
 		}
 
 		_, err = conn.Write(msg)
 		if err != nil {
-			_ = w.Close()
+			_ = w.close()
 			return err
 		}
 
@@ -101,6 +107,15 @@ func (w *TCPWriter) Write(env *loggregator_v2.Envelope) error {
 	return nil
 }
 
+// Dial connects to the syslog drain ahead of the first write.
+func (w *TCPWriter) Dial() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	_, err := w.connection()
+	return err
+}
+
 func (w *TCPWriter) connection() (net.Conn, error) {
 	if w.conn == nil {
 		return w.connect()
@@ -122,6 +137,13 @@ func (w *TCPWriter) connect() (net.Conn, error) {
 
 // Close tears down any active connections to the drain and prevents reconnect.
 func (w *TCPWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.close()
+}
+
+func (w *TCPWriter) close() error {
 	if w.conn != nil {
 		err := w.conn.Close()
 		w.conn = nil
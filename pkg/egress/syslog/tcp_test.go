@@ -196,6 +196,57 @@ var _ = Describe("TCPWriter", func() {
 		})
 	})
 
+	Describe("Dial()", func() {
+		It("connects before the first write", func() {
+			writer := syslog.NewTCPWriter(
+				binding,
+				netConf,
+				false,
+				&testhelper.SpyMetric{},
+			)
+
+			Expect(writer.(*syslog.TCPWriter).Dial()).To(Succeed())
+
+			conn, err := listener.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			defer conn.Close()
+
+			env := buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT)
+			Expect(writer.Write(env)).To(Succeed())
+
+			actual, err := bufio.NewReader(conn).ReadString('\n')
+			Expect(err).ToNot(HaveOccurred())
+			Expect(actual).To(ContainSubstring("just a test"))
+		})
+	})
+
+	Describe("without an app ID", func() {
+		It("uses the source ID as the app name", func() {
+			writer := syslog.NewTCPWriter(
+				&syslog.URLBinding{
+					URL:      binding.URL,
+					Hostname: "test-hostname",
+				},
+				netConf,
+				false,
+				&testhelper.SpyMetric{},
+			)
+
+			env := buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT)
+			Expect(writer.Write(env)).To(Succeed())
+
+			conn, err := listener.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			buf := bufio.NewReader(conn)
+
+			actual, err := buf.ReadString('\n')
+			Expect(err).ToNot(HaveOccurred())
+
+			expected := "87 <14>1 1970-01-01T00:00:00.012345+00:00 test-hostname source-id [APP/2] - - just a test\n"
+			Expect(actual).To(Equal(expected))
+		})
+	})
+
 	Describe("when write fails to connect", func() {
 		It("write returns an error", func() {
 			env := buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT)
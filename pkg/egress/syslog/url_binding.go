@@ -1,18 +1,31 @@
 package syslog
 
-// URLBinding associates a particular application with a syslog URL. The
 import (
 	"context"
 	"net/url"
 )
 
+// DrainType determines which envelope types are written to a drain.
+type DrainType int
+
+const (
+	// LOGS drains receive only log envelopes. This is the default.
+	LOGS DrainType = iota
+	// METRICS drains receive only counter, gauge and timer envelopes.
+	METRICS
+	// ALL drains receive every envelope.
+	ALL
+)
+
+// URLBinding associates a particular application with a syslog URL. The
 // application is identified by AppID and Hostname. The syslog URL is
 // identified by URL.
 type URLBinding struct {
-	Context  context.Context
-	AppID    string
-	Hostname string
-	URL      *url.URL
+	Context   context.Context
+	AppID     string
+	Hostname  string
+	URL       *url.URL
+	DrainType DrainType
 }
 
 // Scheme is a convenience wrapper around the *url.URL Scheme field
@@ -27,11 +40,25 @@ func buildBinding(c context.Context, b Binding) (*URLBinding, error) {
 	}
 
 	u := &URLBinding{
-		AppID:    b.AppId,
-		URL:      url,
-		Hostname: b.Hostname,
-		Context:  c,
+		AppID:     b.AppId,
+		URL:       url,
+		Hostname:  b.Hostname,
+		Context:   c,
+		DrainType: drainType(url),
 	}
 
 	return u, nil
 }
+
+// drainType reads the drain-type query parameter of the drain URL. Unknown
+// values fall back to LOGS.
+func drainType(u *url.URL) DrainType {
+	switch u.Query().Get("drain-type") {
+	case "metrics":
+		return METRICS
+	case "all":
+		return ALL
+	default:
+		return LOGS
+	}
+}
@@ -2,6 +2,7 @@ package v2
 
 import (
 	"code.cloudfoundry.org/loggregator-agent/pkg/metrics"
+	"context"
 	"time"
 
 	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
@@ -24,6 +25,9 @@ type Transponder struct {
 	batchInterval time.Duration
 	droppedMetric metrics.Counter
 	egressMetric  metrics.Counter
+
+	stop chan struct{}
+	done chan struct{}
 }
 
 type MetricClient interface {
@@ -46,10 +50,15 @@ func NewTransponder(
 		egressMetric:  egressMetric,
 		batchSize:     batchSize,
 		batchInterval: batchInterval,
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
 	}
 }
 
+// Start writes envelopes until Stop is called and the nexter is empty.
 func (t *Transponder) Start() {
+	defer close(t.done)
+
 	b := batching.NewV2EnvelopeBatcher(
 		t.batchSize,
 		t.batchInterval,
@@ -60,7 +69,13 @@ func (t *Transponder) Start() {
 		envelope, ok := t.nexter.TryNext()
 		if !ok {
 			b.Flush()
-			time.Sleep(100 * time.Millisecond)
+
+			select {
+			case <-t.stop:
+				b.ForcedFlush()
+				return
+			case <-time.After(100 * time.Millisecond):
+			}
 			continue
 		}
 
@@ -68,6 +83,17 @@ func (t *Transponder) Start() {
 	}
 }
 
+// Stop returns once the envelopes left in the nexter have been written or
+// the context is done. The nexter must not receive new envelopes.
+func (t *Transponder) Stop(ctx context.Context) {
+	close(t.stop)
+
+	select {
+	case <-t.done:
+	case <-ctx.Done():
+	}
+}
+
 func (t *Transponder) write(batch []*loggregator_v2.Envelope) {
 	if err := t.writer.Write(batch); err != nil {
 		// metric-documentation-v2: (loggregator.metron.dropped) Number of messages
@@ -1,6 +1,7 @@
 package v2_test
 
 import (
+	"context"
 	"errors"
 	"time"
 
@@ -30,6 +31,43 @@ var _ = Describe("Transponder", func() {
 		Eventually(writer.WriteInput.Msg).Should(Receive(Equal([]*loggregator_v2.Envelope{envelope})))
 	})
 
+	Describe("Stop()", func() {
+		It("writes the envelopes left in the buffer", func() {
+			envelope := &loggregator_v2.Envelope{SourceId: "uuid"}
+			nexter := newMockNexter()
+			writer := newMockWriter()
+			close(writer.WriteOutput.Ret0)
+
+			for i := 0; i < 3; i++ {
+				nexter.TryNextOutput.Ret0 <- envelope
+				nexter.TryNextOutput.Ret1 <- true
+			}
+			close(nexter.TryNextOutput.Ret0)
+			close(nexter.TryNextOutput.Ret1)
+
+			tx := egress.NewTransponder(nexter, writer, 100, time.Minute, testhelper.NewMetricClient())
+			go tx.Start()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			tx.Stop(ctx)
+
+			var batch []*loggregator_v2.Envelope
+			Expect(writer.WriteInput.Msg).To(Receive(&batch))
+			Expect(batch).To(HaveLen(3))
+		})
+
+		It("returns when the context is done", func() {
+			tx := egress.NewTransponder(newMockNexter(), newMockWriter(), 100, time.Minute, testhelper.NewMetricClient())
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			tx.Stop(ctx)
+
+			Expect(ctx.Err()).To(HaveOccurred())
+		})
+	})
+
 	Describe("batching", func() {
 		It("emits once the batch count has been reached", func() {
 			envelope := &loggregator_v2.Envelope{SourceId: "uuid"}
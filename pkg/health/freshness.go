@@ -0,0 +1,76 @@
+package health
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Freshness records the outcome of a recurring task such as a scrape or a
+// poll.
+type Freshness struct {
+	maxAge time.Duration
+
+	mu          sync.Mutex
+	lastSuccess time.Time
+	lastErr     error
+}
+
+// NewFreshness returns a Freshness that considers a success older than
+// maxAge stale.
+func NewFreshness(maxAge time.Duration) *Freshness {
+	return &Freshness{
+		maxAge: maxAge,
+	}
+}
+
+// Record records the outcome of an attempt. A nil error is a success.
+func (f *Freshness) Record(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.lastErr = err
+	if err == nil {
+		f.lastSuccess = time.Now()
+	}
+}
+
+// LastError returns the error of the last attempt.
+func (f *Freshness) LastError() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.lastErr != nil {
+		return fmt.Errorf("last attempt failed: %s", f.lastErr)
+	}
+
+	return nil
+}
+
+// Stale returns an error when there has not been a success within the
+// maximum age.
+func (f *Freshness) Stale() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.lastSuccess.IsZero() {
+		return errors.New("no successful attempt yet")
+	}
+
+	if age := time.Since(f.lastSuccess); age > f.maxAge {
+		return fmt.Errorf("last success was %s ago", age.Round(time.Second))
+	}
+
+	return nil
+}
+
+// Check returns an error when the last attempt failed or the last success
+// is stale.
+func (f *Freshness) Check() error {
+	if err := f.LastError(); err != nil {
+		return err
+	}
+
+	return f.Stale()
+}
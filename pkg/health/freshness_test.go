@@ -0,0 +1,44 @@
+package health_test
+
+import (
+	"errors"
+	"time"
+
+	"code.cloudfoundry.org/loggregator-agent/pkg/health"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Freshness", func() {
+	It("is not ready before the first success", func() {
+		f := health.NewFreshness(time.Minute)
+
+		Expect(f.Check()).To(MatchError("no successful attempt yet"))
+	})
+
+	It("is ready after a success", func() {
+		f := health.NewFreshness(time.Minute)
+		f.Record(nil)
+
+		Expect(f.Check()).To(Succeed())
+	})
+
+	It("reports the error of the last attempt", func() {
+		f := health.NewFreshness(time.Minute)
+		f.Record(nil)
+		f.Record(errors.New("some-error"))
+
+		Expect(f.LastError()).To(MatchError("last attempt failed: some-error"))
+		Expect(f.Stale()).To(Succeed())
+		Expect(f.Check()).To(HaveOccurred())
+	})
+
+	It("is stale when the last success is older than the maximum age", func() {
+		f := health.NewFreshness(10 * time.Millisecond)
+		f.Record(nil)
+
+		Eventually(f.Stale).Should(MatchError(ContainSubstring("last success was")))
+		Expect(f.LastError()).To(Succeed())
+	})
+})
@@ -0,0 +1,104 @@
+// Package health serves the liveness and readiness endpoints of the agent
+// processes.
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// Check reports whether a component is ready. The error describes why it is
+// not.
+type Check func() error
+
+// Component is the state of a single component.
+type Component struct {
+	Ready bool   `json:"ready"`
+	Error string `json:"error,omitempty"`
+}
+
+// Status is the body of the health and readiness responses.
+type Status struct {
+	Status     string               `json:"status"`
+	Components map[string]Component `json:"components,omitempty"`
+}
+
+// Handler serves the /health and /ready endpoints. /health reports that the
+// process is alive without checking any component. /ready reports whether
+// every component is ready and includes the state of every component.
+type Handler struct {
+	mu     sync.Mutex
+	checks map[string]Check
+}
+
+// NewHandler returns a Handler without any components. It is ready until a
+// component is added.
+func NewHandler() *Handler {
+	return &Handler{
+		checks: make(map[string]Check),
+	}
+}
+
+// Add adds a component. A component with the same name is replaced.
+func (h *Handler) Add(name string, c Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.checks[name] = c
+}
+
+// Register registers the endpoints with the mux.
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/health", h.serveHealth)
+	mux.HandleFunc("/ready", h.serveReady)
+}
+
+// Status checks every component and returns whether all of them are ready.
+func (h *Handler) Status() (Status, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := Status{
+		Status:     "ready",
+		Components: make(map[string]Component, len(h.checks)),
+	}
+	ready := true
+	for name, c := range h.checks {
+		if err := c(); err != nil {
+			s.Components[name] = Component{Error: err.Error()}
+			ready = false
+			continue
+		}
+
+		s.Components[name] = Component{Ready: true}
+	}
+
+	if !ready {
+		s.Status = "not_ready"
+	}
+
+	return s, ready
+}
+
+func (h *Handler) serveHealth(w http.ResponseWriter, r *http.Request) {
+	writeStatus(w, http.StatusOK, Status{Status: "alive"})
+}
+
+func (h *Handler) serveReady(w http.ResponseWriter, r *http.Request) {
+	s, ready := h.Status()
+
+	code := http.StatusOK
+	if !ready {
+		code = http.StatusServiceUnavailable
+	}
+
+	writeStatus(w, code, s)
+}
+
+func writeStatus(w http.ResponseWriter, code int, s Status) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	json.NewEncoder(w).Encode(s)
+}
@@ -0,0 +1,91 @@
+package health_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/loggregator-agent/pkg/health"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Handler", func() {
+	var (
+		h   *health.Handler
+		mux *http.ServeMux
+	)
+
+	get := func(path string) (int, health.Status) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+		var s health.Status
+		Expect(json.Unmarshal(rec.Body.Bytes(), &s)).To(Succeed())
+		Expect(rec.Header().Get("Content-Type")).To(Equal("application/json"))
+
+		return rec.Code, s
+	}
+
+	BeforeEach(func() {
+		h = health.NewHandler()
+		mux = http.NewServeMux()
+		h.Register(mux)
+	})
+
+	It("is ready when every component is ready", func() {
+		h.Add("a", func() error { return nil })
+		h.Add("b", func() error { return nil })
+
+		code, s := get("/ready")
+
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(s.Status).To(Equal("ready"))
+		Expect(s.Components).To(Equal(map[string]health.Component{
+			"a": {Ready: true},
+			"b": {Ready: true},
+		}))
+	})
+
+	It("is not ready when a component is not ready", func() {
+		h.Add("a", func() error { return nil })
+		h.Add("b", func() error { return errors.New("some-error") })
+
+		code, s := get("/ready")
+
+		Expect(code).To(Equal(http.StatusServiceUnavailable))
+		Expect(s.Status).To(Equal("not_ready"))
+		Expect(s.Components).To(HaveKeyWithValue("b", health.Component{Error: "some-error"}))
+	})
+
+	It("is alive while components are not ready", func() {
+		h.Add("a", func() error { return errors.New("some-error") })
+
+		code, s := get("/health")
+
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(s.Status).To(Equal("alive"))
+		Expect(s.Components).To(BeEmpty())
+	})
+
+	It("is alive while a component check is blocked", func() {
+		checking := make(chan struct{})
+		unblock := make(chan struct{})
+		defer close(unblock)
+		h.Add("a", func() error {
+			close(checking)
+			<-unblock
+			return nil
+		})
+		go mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ready", nil))
+		Eventually(checking).Should(BeClosed())
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(MatchJSON(`{"status":"alive"}`))
+	})
+})
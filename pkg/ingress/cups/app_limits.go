@@ -0,0 +1,38 @@
+package cups
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// AppLimits overrides the per app drain limit for individual apps.
+type AppLimits struct {
+	Limits map[string]int
+}
+
+// UnmarshalEnv implements envstruct.Unmarshaller.
+// Example input:
+// 9be15160-4845-4f05-b089-40e827ba61f1:10,e5d4c2a0-03f8-4a5c-8e0e-4d1b0c4c6e4e:0
+func (a *AppLimits) UnmarshalEnv(v string) error {
+	if v == "" {
+		return nil
+	}
+
+	a.Limits = make(map[string]int)
+	for _, appLimit := range strings.Split(v, ",") {
+		parts := strings.Split(strings.TrimSpace(appLimit), ":")
+		if len(parts) != 2 || parts[0] == "" {
+			return fmt.Errorf("invalid app limit: %s", appLimit)
+		}
+
+		limit, err := strconv.Atoi(parts[1])
+		if err != nil || limit < 0 {
+			return fmt.Errorf("invalid app limit: %s", appLimit)
+		}
+
+		a.Limits[parts[0]] = limit
+	}
+
+	return nil
+}
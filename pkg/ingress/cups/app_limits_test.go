@@ -0,0 +1,33 @@
+package cups_test
+
+import (
+	"code.cloudfoundry.org/loggregator-agent/pkg/ingress/cups"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AppLimits", func() {
+	It("parses a comma separated list of app limits", func() {
+		var l cups.AppLimits
+		Expect(l.UnmarshalEnv("app-1:10, app-2:0")).To(Succeed())
+
+		Expect(l.Limits).To(Equal(map[string]int{
+			"app-1": 10,
+			"app-2": 0,
+		}))
+	})
+
+	It("does not return an error for an empty list", func() {
+		var l cups.AppLimits
+		Expect(l.UnmarshalEnv("")).To(Succeed())
+		Expect(l.Limits).To(BeEmpty())
+	})
+
+	It("returns an error for invalid app limits", func() {
+		var l cups.AppLimits
+		Expect(l.UnmarshalEnv("app-1")).To(MatchError("invalid app limit: app-1"))
+		Expect(l.UnmarshalEnv(":10")).To(MatchError("invalid app limit: :10"))
+		Expect(l.UnmarshalEnv("app-1:ten")).To(MatchError("invalid app limit: app-1:ten"))
+		Expect(l.UnmarshalEnv("app-1:-1")).To(MatchError("invalid app limit: app-1:-1"))
+	})
+})
@@ -2,11 +2,14 @@ package cups
 
 import (
 	"code.cloudfoundry.org/loggregator-agent/pkg/metrics"
+	"fmt"
+	"hash/fnv"
 	"math"
 	"net/url"
 	"sort"
 	"time"
 
+	"code.cloudfoundry.org/go-loggregator"
 	"code.cloudfoundry.org/loggregator-agent/pkg/binding"
 	"code.cloudfoundry.org/loggregator-agent/pkg/egress/syslog"
 )
@@ -24,22 +27,77 @@ type Getter interface {
 
 // BindingFetcher uses a Getter to fetch and decode Bindings
 type BindingFetcher struct {
-	refreshCount metrics.Counter
-	maxLatency   metrics.Gauge
-	limit        int
-	getter       Getter
+	refreshCount       metrics.Counter
+	maxLatency         metrics.Gauge
+	appLimitedDrains   metrics.Gauge
+	agentLimitedDrains metrics.Gauge
+	limit              int
+	appLimits          map[string]int
+	maxDrains          int
+	getter             Getter
+
+	logClient   syslog.LogClient
+	sourceIndex string
+	dropped     map[string]droppedDrains
+}
+
+// droppedDrains is the number of drains of an app that were dropped by the
+// per app limit and by the agent limit.
+type droppedDrains struct {
+	app   int
+	agent int
+}
+
+// BindingFetcherOption configures a BindingFetcher.
+type BindingFetcherOption func(*BindingFetcher)
+
+// WithAppLimits overrides the per app limit for the given apps.
+func WithAppLimits(limits map[string]int) BindingFetcherOption {
+	return func(f *BindingFetcher) {
+		f.appLimits = limits
+	}
+}
+
+// WithMaxDrains limits the number of drains across all apps. Apps take turns
+// to fill the limit so that every app keeps its highest ranked drains.
+func WithMaxDrains(n int) BindingFetcherOption {
+	return func(f *BindingFetcher) {
+		f.maxDrains = n
+	}
+}
+
+// WithLogClient reports drains dropped by a limit to the affected app.
+func WithLogClient(lc syslog.LogClient, sourceIndex string) BindingFetcherOption {
+	return func(f *BindingFetcher) {
+		f.logClient = lc
+		f.sourceIndex = sourceIndex
+	}
 }
 
 // NewBindingFetcher returns a new BindingFetcher
-func NewBindingFetcher(limit int, g Getter, m Metrics) *BindingFetcher {
+func NewBindingFetcher(limit int, g Getter, m Metrics, opts ...BindingFetcherOption) *BindingFetcher {
 	refreshCount := m.NewCounter("binding_refresh_count")
 	maxLatency := m.NewGauge("latency_for_last_binding_refresh", metrics.WithMetricTags(map[string]string{"unit": "ms"}))
-	return &BindingFetcher{
-		limit:        limit,
-		getter:       g,
-		refreshCount: refreshCount,
-		maxLatency:   maxLatency,
+
+	opt := metrics.WithMetricTags(map[string]string{"unit": "total"})
+	appLimitedDrains := m.NewGauge("app_limited_drains", opt)
+	agentLimitedDrains := m.NewGauge("agent_limited_drains", opt)
+
+	f := &BindingFetcher{
+		limit:              limit,
+		getter:             g,
+		refreshCount:       refreshCount,
+		maxLatency:         maxLatency,
+		appLimitedDrains:   appLimitedDrains,
+		agentLimitedDrains: agentLimitedDrains,
+		dropped:            make(map[string]droppedDrains),
 	}
+
+	for _, o := range opts {
+		o(f)
+	}
+
+	return f
 }
 
 // FetchBindings reaches out to the syslog drain binding provider via the Getter and decodes
@@ -58,43 +116,184 @@ func (f *BindingFetcher) FetchBindings() ([]syslog.Binding, error) {
 		return nil, err
 	}
 	latency = time.Since(start).Nanoseconds()
-	syslogBindings := f.toSyslogBindings(bindings, f.limit)
+	syslogBindings := f.toSyslogBindings(bindings)
 
 	return syslogBindings, nil
 }
 
+// DrainLimit returns the highest number of drains a single app may have.
 func (f *BindingFetcher) DrainLimit() int {
-	return f.limit
+	limit := f.limit
+	for _, l := range f.appLimits {
+		if l > limit {
+			limit = l
+		}
+	}
+
+	return limit
 }
 
-func (f *BindingFetcher) toSyslogBindings(bs []binding.Binding, perAppLimit int) []syslog.Binding {
-	var bindings []syslog.Binding
+// toSyslogBindings ranks the drains of every app and applies the per app
+// and agent limits. Drains are ranked by a hash of the app ID and drain URL
+// so that every agent selects the same drains regardless of the order in
+// which the binding cache returns them. The URL is hashed as written, so
+// differently spelled URLs of the same drain rank differently.
+func (f *BindingFetcher) toSyslogBindings(bs []binding.Binding) []syslog.Binding {
+	dropped := make(map[string]droppedDrains)
+	appBindings := make([][]syslog.Binding, 0, len(bs))
 	for _, b := range bs {
-		drains := b.Drains
-		sort.Strings(drains)
-
-		if perAppLimit < len(drains) {
-			drains = drains[:perAppLimit]
-		}
-
-		for _, d := range drains {
+		var bindings []syslog.Binding
+		for _, d := range b.Drains {
 			u, err := url.Parse(d)
 			if err != nil {
 				continue
 			}
 
-			binding := syslog.Binding{
+			bindings = append(bindings, syslog.Binding{
 				AppId:    b.AppID,
 				Hostname: b.Hostname,
 				Drain:    u.String(),
-			}
-			bindings = append(bindings, binding)
+			})
+		}
+		sortByRank(bindings)
+
+		limit := f.appLimit(b.AppID)
+		if limit < len(bindings) {
+			dropped[b.AppID] = droppedDrains{app: len(bindings) - limit}
+			bindings = bindings[:limit]
 		}
+
+		appBindings = append(appBindings, bindings)
 	}
 
+	bindings := f.applyMaxDrains(appBindings, dropped)
+	f.reportDropped(dropped)
+
 	return bindings
 }
 
+func (f *BindingFetcher) appLimit(appID string) int {
+	if l, ok := f.appLimits[appID]; ok {
+		return l
+	}
+
+	return f.limit
+}
+
+// applyMaxDrains selects drains in rounds. Every round takes the next
+// highest ranked drain of every app until the agent limit is reached.
+func (f *BindingFetcher) applyMaxDrains(appBindings [][]syslog.Binding, dropped map[string]droppedDrains) []syslog.Binding {
+	var total int
+	for _, bindings := range appBindings {
+		total += len(bindings)
+	}
+
+	if f.maxDrains <= 0 || total <= f.maxDrains {
+		var all []syslog.Binding
+		for _, bindings := range appBindings {
+			all = append(all, bindings...)
+		}
+		return all
+	}
+
+	// Apps take turns in an order that does not depend on their IDs.
+	sort.SliceStable(appBindings, func(i, j int) bool {
+		return appRank(appBindings[i]) < appRank(appBindings[j])
+	})
+
+	selected := make([]int, len(appBindings))
+	remaining := f.maxDrains
+	for round := 0; remaining > 0; round++ {
+		for i, bindings := range appBindings {
+			if remaining == 0 {
+				break
+			}
+
+			if round < len(bindings) {
+				selected[i]++
+				remaining--
+			}
+		}
+	}
+
+	var result []syslog.Binding
+	for i, bindings := range appBindings {
+		result = append(result, bindings[:selected[i]]...)
+
+		if n := len(bindings) - selected[i]; n > 0 {
+			appID := bindings[0].AppId
+			d := dropped[appID]
+			d.agent = n
+			dropped[appID] = d
+		}
+	}
+
+	return result
+}
+
+// reportDropped updates the metrics for dropped drains and notifies every
+// app whose number of dropped drains changed.
+func (f *BindingFetcher) reportDropped(dropped map[string]droppedDrains) {
+	var app, agent int
+	for appID, d := range dropped {
+		app += d.app
+		agent += d.agent
+
+		if f.dropped[appID] == d {
+			continue
+		}
+
+		if d.app > 0 {
+			f.emitLog(appID, fmt.Sprintf("%d syslog drains ignored, the app is limited to %d drains", d.app, f.appLimit(appID)))
+		}
+
+		if d.agent > 0 {
+			f.emitLog(appID, fmt.Sprintf("%d syslog drains ignored, the syslog agent is limited to %d drains", d.agent, f.maxDrains))
+		}
+	}
+
+	f.dropped = dropped
+	f.appLimitedDrains.Set(float64(app))
+	f.agentLimitedDrains.Set(float64(agent))
+}
+
+func (f *BindingFetcher) emitLog(appID, message string) {
+	if f.logClient == nil {
+		return
+	}
+
+	f.logClient.EmitLog(message, loggregator.WithAppInfo(appID, "LGR", ""))
+	f.logClient.EmitLog(message, loggregator.WithAppInfo(appID, "SYS", f.sourceIndex))
+}
+
+func sortByRank(bindings []syslog.Binding) {
+	sort.Slice(bindings, func(i, j int) bool {
+		ri, rj := rank(bindings[i].AppId, bindings[i].Drain), rank(bindings[j].AppId, bindings[j].Drain)
+		if ri != rj {
+			return ri < rj
+		}
+
+		return bindings[i].Drain < bindings[j].Drain
+	})
+}
+
+func appRank(bindings []syslog.Binding) uint64 {
+	if len(bindings) == 0 {
+		return 0
+	}
+
+	return rank(bindings[0].AppId, "")
+}
+
+func rank(appID, drain string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(appID))
+	h.Write([]byte{0})
+	h.Write([]byte(drain))
+
+	return h.Sum64()
+}
+
 // toMilliseconds truncates the calculated milliseconds float to microsecond
 // precision.
 func toMilliseconds(num int64) float64 {
@@ -2,8 +2,11 @@ package cups_test
 
 import (
 	"errors"
+	"sync"
 	"time"
 
+	"code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
 	"code.cloudfoundry.org/loggregator-agent/internal/testhelper"
 	"code.cloudfoundry.org/loggregator-agent/pkg/binding"
 	"code.cloudfoundry.org/loggregator-agent/pkg/egress/syslog"
@@ -60,38 +63,112 @@ var _ = Describe("BindingFetcher", func() {
 
 		appID := "9be15160-4845-4f05-b089-40e827ba61f1"
 		otherAppID := "blah"
-		Expect(bindings).To(Equal([]syslog.Binding{
-			syslog.Binding{
-				AppId:    appID,
-				Hostname: "org.space.logspinner",
-				Drain:    "https://v3.other.url",
-			},
-			syslog.Binding{
-				AppId:    appID,
-				Hostname: "org.space.logspinner",
-				Drain:    "syslog://v3.other-included.url",
-			},
-			syslog.Binding{
-				AppId:    appID,
-				Hostname: "org.space.logspinner",
-				Drain:    "syslog://v3.other.url",
-			},
-			syslog.Binding{
-				AppId:    otherAppID,
-				Hostname: "org.space.logspinner",
-				Drain:    "https://v3.other.url",
-			},
-			syslog.Binding{
-				AppId:    otherAppID,
-				Hostname: "org.space.logspinner",
-				Drain:    "syslog://v3.other-included.url",
-			},
-			syslog.Binding{
-				AppId:    otherAppID,
-				Hostname: "org.space.logspinner",
-				Drain:    "syslog://v3.other.url",
-			},
+		Expect(drainsFor(bindings, appID)).To(HaveLen(3))
+		Expect(drainsFor(bindings, otherAppID)).To(HaveLen(3))
+
+		for _, b := range bindings {
+			Expect(b.Hostname).To(Equal("org.space.logspinner"))
+			Expect(getter.bindings[0].Drains).To(ContainElement(b.Drain))
+		}
+	})
+
+	It("selects the same drains regardless of their order", func() {
+		bindings, err := fetcher.FetchBindings()
+		Expect(err).ToNot(HaveOccurred())
+
+		drains := getter.bindings[0].Drains
+		reversed := make([]string, 0, len(drains))
+		for i := len(drains) - 1; i >= 0; i-- {
+			reversed = append(reversed, drains[i])
+		}
+		getter.bindings[0].Drains = reversed
+
+		reorderedBindings, err := fetcher.FetchBindings()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reorderedBindings).To(ConsistOf(bindings))
+	})
+
+	It("overrides the limit for individual apps", func() {
+		fetcher = cups.NewBindingFetcher(maxDrains, getter, metrics, cups.WithAppLimits(map[string]int{
+			"blah": 1,
+		}))
+
+		bindings, err := fetcher.FetchBindings()
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(drainsFor(bindings, "9be15160-4845-4f05-b089-40e827ba61f1")).To(HaveLen(3))
+		Expect(drainsFor(bindings, "blah")).To(HaveLen(1))
+		Expect(fetcher.DrainLimit()).To(Equal(3))
+	})
+
+	It("returns the highest app limit as the drain limit", func() {
+		fetcher = cups.NewBindingFetcher(maxDrains, getter, metrics, cups.WithAppLimits(map[string]int{
+			"blah": 10,
 		}))
+
+		Expect(fetcher.DrainLimit()).To(Equal(10))
+	})
+
+	It("shares the agent limit fairly between apps", func() {
+		getter.bindings = append(getter.bindings, binding.Binding{
+			AppID:    "other-app",
+			Drains:   []string{"syslog://v3.other.url", "syslog://v3.another.url"},
+			Hostname: "org.space.other",
+		})
+		fetcher = cups.NewBindingFetcher(maxDrains, getter, metrics, cups.WithMaxDrains(5))
+
+		bindings, err := fetcher.FetchBindings()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(bindings).To(HaveLen(5))
+
+		for _, appID := range []string{"9be15160-4845-4f05-b089-40e827ba61f1", "blah", "other-app"} {
+			Expect(len(drainsFor(bindings, appID))).To(BeNumerically(">=", 1))
+			Expect(len(drainsFor(bindings, appID))).To(BeNumerically("<=", 2))
+		}
+
+		again, err := fetcher.FetchBindings()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(again).To(Equal(bindings))
+	})
+
+	It("reports drains that were dropped by a limit", func() {
+		fetcher = cups.NewBindingFetcher(maxDrains, getter, metrics, cups.WithMaxDrains(4))
+
+		_, err := fetcher.FetchBindings()
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(
+			metrics.GetMetric("app_limited_drains", map[string]string{"unit": "total"}).Value(),
+		).To(BeNumerically("==", 4))
+		Expect(
+			metrics.GetMetric("agent_limited_drains", map[string]string{"unit": "total"}).Value(),
+		).To(BeNumerically("==", 2))
+	})
+
+	It("reports drains that were dropped by a limit to the app", func() {
+		logClient := newSpyLogClient()
+		getter.bindings = getter.bindings[:1]
+		fetcher = cups.NewBindingFetcher(maxDrains, getter, metrics, cups.WithMaxDrains(2), cups.WithLogClient(logClient, "3"))
+
+		_, err := fetcher.FetchBindings()
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(logClient.message()).To(ConsistOf(
+			"2 syslog drains ignored, the app is limited to 3 drains",
+			"2 syslog drains ignored, the app is limited to 3 drains",
+			"1 syslog drains ignored, the syslog agent is limited to 2 drains",
+			"1 syslog drains ignored, the syslog agent is limited to 2 drains",
+		))
+		Expect(logClient.appID()).To(ConsistOf(
+			"9be15160-4845-4f05-b089-40e827ba61f1",
+			"9be15160-4845-4f05-b089-40e827ba61f1",
+			"9be15160-4845-4f05-b089-40e827ba61f1",
+			"9be15160-4845-4f05-b089-40e827ba61f1",
+		))
+
+		_, err = fetcher.FetchBindings()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(logClient.message()).To(HaveLen(4))
 	})
 
 	It("tracks the number of binding refreshes", func() {
@@ -145,6 +222,56 @@ var _ = Describe("BindingFetcher", func() {
 	})
 })
 
+func drainsFor(bindings []syslog.Binding, appID string) []string {
+	var drains []string
+	for _, b := range bindings {
+		if b.AppId == appID {
+			drains = append(drains, b.Drain)
+		}
+	}
+
+	return drains
+}
+
+type spyLogClient struct {
+	mu       sync.Mutex
+	_message []string
+	_appID   []string
+}
+
+func newSpyLogClient() *spyLogClient {
+	return &spyLogClient{}
+}
+
+func (s *spyLogClient) EmitLog(message string, opts ...loggregator.EmitLogOption) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	env := &loggregator_v2.Envelope{
+		Tags: make(map[string]string),
+	}
+	for _, o := range opts {
+		o(env)
+	}
+
+	s._message = append(s._message, message)
+	s._appID = append(s._appID, env.SourceId)
+}
+
+func (s *spyLogClient) message() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s._message
+}
+
+func (s *spyLogClient) appID() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s._appID
+}
+
 type SpyGetter struct {
 	bindings []binding.Binding
 	err      error
@@ -0,0 +1,317 @@
+// Package fluent receives records sent with the Fluent Forward protocol
+// and converts them to v2 log envelopes.
+package fluent
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/vmihailenco/msgpack"
+	"github.com/vmihailenco/msgpack/codes"
+)
+
+// eventTimeExt is the msgpack extension type of EventTime.
+const eventTimeExt = 0
+
+// maxChunkSize is the largest decompressed PackedForward chunk that is
+// accepted. It matches the default chunk limit of Fluentd.
+const maxChunkSize = 8 << 20
+
+func init() {
+	msgpack.RegisterExt(eventTimeExt, (*EventTime)(nil))
+}
+
+// EventTime is the Fluent Forward timestamp with nanosecond precision. It
+// is encoded as a msgpack extension of seconds and nanoseconds.
+type EventTime struct {
+	time.Time
+}
+
+func (t *EventTime) MarshalMsgpack() ([]byte, error) {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint32(b, uint32(t.Unix()))
+	binary.BigEndian.PutUint32(b[4:], uint32(t.Nanosecond()))
+	return b, nil
+}
+
+func (t *EventTime) UnmarshalMsgpack(b []byte) error {
+	if len(b) != 8 {
+		return fmt.Errorf("invalid event time length: %d", len(b))
+	}
+
+	t.Time = time.Unix(
+		int64(binary.BigEndian.Uint32(b)),
+		int64(binary.BigEndian.Uint32(b[4:])),
+	)
+	return nil
+}
+
+// entry is a single record with its timestamp.
+type entry struct {
+	time   time.Time
+	record map[string]interface{}
+}
+
+// message is a decoded message in any of the modes.
+type message struct {
+	tag     string
+	entries []entry
+	// chunk is the ID the client expects to be acknowledged. It is empty
+	// when no acknowledgement was requested.
+	chunk string
+}
+
+// decodeMessage decodes a message in the Message, Forward or PackedForward
+// mode. PackedForward entries may be gzip compressed.
+func decodeMessage(d *msgpack.Decoder) (message, error) {
+	n, err := d.DecodeArrayLen()
+	if err != nil {
+		return message{}, err
+	}
+	if n < 2 || n > 4 {
+		return message{}, fmt.Errorf("invalid message length: %d", n)
+	}
+
+	var m message
+	if m.tag, err = d.DecodeString(); err != nil {
+		return message{}, err
+	}
+
+	c, err := d.PeekCode()
+	if err != nil {
+		return message{}, err
+	}
+
+	var (
+		packed     []byte
+		optionElem int
+	)
+	switch {
+	case codes.IsFixedArray(c) || c == codes.Array16 || c == codes.Array32:
+		if m.entries, err = decodeEntries(d); err != nil {
+			return message{}, err
+		}
+		optionElem = 3
+	case codes.IsBin(c) || codes.IsString(c):
+		if packed, err = d.DecodeBytes(); err != nil {
+			return message{}, err
+		}
+		optionElem = 3
+	default:
+		e, err := decodeEntry(d, false)
+		if err != nil {
+			return message{}, err
+		}
+		m.entries = []entry{e}
+		optionElem = 4
+	}
+
+	var opts options
+	if n == optionElem {
+		if opts, err = decodeOptions(d); err != nil {
+			return message{}, err
+		}
+	} else if n > optionElem {
+		return message{}, fmt.Errorf("invalid message length: %d", n)
+	}
+	m.chunk = opts.chunk
+
+	if packed != nil {
+		if m.entries, err = decodePacked(packed, opts.compressed); err != nil {
+			return message{}, err
+		}
+	}
+
+	return m, nil
+}
+
+// decodeEntries decodes the array of entries of the Forward mode.
+func decodeEntries(d *msgpack.Decoder) ([]entry, error) {
+	n, err := d.DecodeArrayLen()
+	if err != nil {
+		return nil, err
+	}
+
+	// The length is not trusted to preallocate the entries, as it is read
+	// from the wire.
+	var entries []entry
+	for i := 0; i < n; i++ {
+		e, err := decodeEntry(d, true)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// decodePacked decodes the concatenated entries of the PackedForward mode.
+func decodePacked(b []byte, compressed string) ([]entry, error) {
+	var r io.Reader = bytes.NewReader(b)
+	switch compressed {
+	case "":
+	case "gzip":
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+
+		data, err := ioutil.ReadAll(io.LimitReader(gz, maxChunkSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > maxChunkSize {
+			return nil, fmt.Errorf("decompressed chunk is larger than %d bytes", maxChunkSize)
+		}
+		r = bytes.NewReader(data)
+	default:
+		return nil, fmt.Errorf("unknown compression: %s", compressed)
+	}
+
+	d := msgpack.NewDecoder(r)
+
+	var entries []entry
+	for {
+		e, err := decodeEntry(d, true)
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+}
+
+// decodeEntry decodes a time and record. In the Message mode they are
+// elements of the message and otherwise they are wrapped in an array.
+func decodeEntry(d *msgpack.Decoder, wrapped bool) (entry, error) {
+	if wrapped {
+		n, err := d.DecodeArrayLen()
+		if err != nil {
+			return entry{}, err
+		}
+		if n != 2 {
+			return entry{}, fmt.Errorf("invalid entry length: %d", n)
+		}
+	}
+
+	t, err := decodeTime(d)
+	if err != nil {
+		return entry{}, err
+	}
+
+	record, err := decodeRecord(d)
+	if err != nil {
+		return entry{}, err
+	}
+
+	return entry{time: t, record: record}, nil
+}
+
+// decodeTime decodes an EventTime or a number of seconds.
+func decodeTime(d *msgpack.Decoder) (time.Time, error) {
+	c, err := d.PeekCode()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if codes.IsExt(c) {
+		var t EventTime
+		if err := d.Decode(&t); err != nil {
+			return time.Time{}, err
+		}
+		return t.Time, nil
+	}
+
+	if c == codes.Float || c == codes.Double {
+		s, err := d.DecodeFloat64()
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(0, int64(s*float64(time.Second))), nil
+	}
+
+	s, err := d.DecodeInt64()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(s, 0), nil
+}
+
+func decodeRecord(d *msgpack.Decoder) (map[string]interface{}, error) {
+	n, err := d.DecodeMapLen()
+	if err != nil {
+		return nil, err
+	}
+
+	record := make(map[string]interface{})
+	for i := 0; i < n; i++ {
+		k, err := d.DecodeString()
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := d.DecodeInterface()
+		if err != nil {
+			return nil, err
+		}
+		record[k] = v
+	}
+
+	return record, nil
+}
+
+type options struct {
+	chunk      string
+	compressed string
+}
+
+func decodeOptions(d *msgpack.Decoder) (options, error) {
+	c, err := d.PeekCode()
+	if err != nil {
+		return options{}, err
+	}
+	if c == codes.Nil {
+		return options{}, d.DecodeNil()
+	}
+
+	n, err := d.DecodeMapLen()
+	if err != nil {
+		return options{}, err
+	}
+
+	var opts options
+	for i := 0; i < n; i++ {
+		k, err := d.DecodeString()
+		if err != nil {
+			return options{}, err
+		}
+
+		switch k {
+		case "chunk":
+			opts.chunk, err = d.DecodeString()
+		case "compressed":
+			opts.compressed, err = d.DecodeString()
+		default:
+			err = d.Skip()
+		}
+		if err != nil {
+			return options{}, err
+		}
+	}
+
+	return opts, nil
+}
+
+// encodeAck writes the acknowledgement of a chunk.
+func encodeAck(w io.Writer, chunk string) error {
+	return msgpack.NewEncoder(w).Encode(map[string]string{"ack": chunk})
+}
@@ -0,0 +1,247 @@
+package fluent
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/pkg/metrics"
+	"github.com/vmihailenco/msgpack"
+)
+
+type DataSetter interface {
+	Set(e *loggregator_v2.Envelope)
+}
+
+// MetricClient creates new CounterMetrics to be emitted periodically.
+type MetricClient interface {
+	NewCounter(name string, opts ...metrics.MetricOption) metrics.Counter
+}
+
+// RecordMapping maps record fields to envelope fields.
+type RecordMapping struct {
+	// MessageKey is the field of the log message.
+	MessageKey string
+	// SourceIDKey is the field of the source ID. The Fluent tag is used
+	// when the record does not have it.
+	SourceIDKey string
+	// InstanceIDKey is the field of the instance ID.
+	InstanceIDKey string
+	// TagKeys are the fields that become envelope tags. All other fields
+	// become tags when it is empty.
+	TagKeys []string
+}
+
+// DefaultRecordMapping matches the records of the Fluent Bit docker and
+// tail inputs.
+var DefaultRecordMapping = RecordMapping{
+	MessageKey:    "log",
+	SourceIDKey:   "source_id",
+	InstanceIDKey: "instance_id",
+}
+
+// ListenerOption configures a Listener.
+type ListenerOption func(*Listener)
+
+// WithRecordMapping sets how record fields are mapped to envelope fields.
+// It defaults to DefaultRecordMapping.
+func WithRecordMapping(m RecordMapping) ListenerOption {
+	return func(l *Listener) {
+		l.mapping = m
+	}
+}
+
+// Listener accepts Fluent Forward connections over TCP or TLS. Every
+// record becomes a log envelope. Records with a "stream" field of "stderr"
+// are written as stderr.
+type Listener struct {
+	lis     net.Listener
+	setter  DataSetter
+	mapping RecordMapping
+
+	ingressMetric metrics.Counter
+	invalidMetric metrics.Counter
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+// NewListener binds to the given TCP address. Connections use TLS when the
+// TLS config is not nil.
+func NewListener(
+	addr string,
+	tlsConfig *tls.Config,
+	setter DataSetter,
+	m MetricClient,
+	opts ...ListenerOption,
+) (*Listener, error) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	protocol := "tcp"
+	if tlsConfig != nil {
+		lis = tls.NewListener(lis, tlsConfig)
+		protocol = "tls"
+	}
+	log.Printf("fluent forward %s bound to: %s", protocol, lis.Addr())
+
+	tags := metrics.WithMetricTags(map[string]string{"protocol": protocol})
+	l := &Listener{
+		lis:           lis,
+		setter:        setter,
+		mapping:       DefaultRecordMapping,
+		ingressMetric: m.NewCounter("fluent_ingress", tags),
+		invalidMetric: m.NewCounter("fluent_invalid_messages", tags),
+		conns:         make(map[net.Conn]struct{}),
+	}
+
+	for _, o := range opts {
+		o(l)
+	}
+
+	return l, nil
+}
+
+// Addr returns the address the listener is bound to.
+func (l *Listener) Addr() net.Addr {
+	return l.lis.Addr()
+}
+
+// Start accepts connections until the listener is stopped.
+func (l *Listener) Start() {
+	for {
+		conn, err := l.lis.Accept()
+		if err != nil {
+			log.Printf("Error while accepting: %s", err)
+			return
+		}
+
+		l.mu.Lock()
+		l.conns[conn] = struct{}{}
+		l.mu.Unlock()
+
+		go l.serve(conn)
+	}
+}
+
+// Stop closes the listener and all open connections.
+func (l *Listener) Stop() {
+	l.lis.Close()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for conn := range l.conns {
+		conn.Close()
+	}
+}
+
+// serve reads messages until the connection is closed. A message that can
+// not be decoded closes the connection because the rest of the stream can
+// not be read.
+func (l *Listener) serve(conn net.Conn) {
+	defer func() {
+		conn.Close()
+
+		l.mu.Lock()
+		delete(l.conns, conn)
+		l.mu.Unlock()
+	}()
+
+	d := msgpack.NewDecoder(bufio.NewReader(conn))
+	for {
+		m, err := decodeMessage(d)
+		if err != nil {
+			if err != io.EOF {
+				l.invalidMetric.Add(1)
+				log.Printf("Error while reading fluent forward message: %s", err)
+			}
+			return
+		}
+
+		for _, e := range m.entries {
+			l.setter.Set(l.toEnvelope(m.tag, e))
+		}
+		l.ingressMetric.Add(float64(len(m.entries)))
+
+		if m.chunk != "" {
+			if err := encodeAck(conn, m.chunk); err != nil {
+				log.Printf("Failed to acknowledge chunk: %s", err)
+				return
+			}
+		}
+	}
+}
+
+func (l *Listener) toEnvelope(tag string, e entry) *loggregator_v2.Envelope {
+	env := &loggregator_v2.Envelope{
+		Timestamp: e.time.UnixNano(),
+		SourceId:  tag,
+		Tags:      make(map[string]string),
+	}
+
+	logType := loggregator_v2.Log_OUT
+	var payload []byte
+	for k, v := range e.record {
+		switch k {
+		case l.mapping.MessageKey:
+			payload = []byte(stringValue(v))
+		case l.mapping.SourceIDKey:
+			if s := stringValue(v); s != "" {
+				env.SourceId = s
+			}
+		case l.mapping.InstanceIDKey:
+			env.InstanceId = stringValue(v)
+		default:
+			if k == "stream" && stringValue(v) == "stderr" {
+				logType = loggregator_v2.Log_ERR
+			}
+
+			if l.isTag(k) {
+				env.Tags[k] = stringValue(v)
+			}
+		}
+	}
+
+	env.Message = &loggregator_v2.Envelope_Log{
+		Log: &loggregator_v2.Log{
+			Payload: payload,
+			Type:    logType,
+		},
+	}
+
+	return env
+}
+
+func (l *Listener) isTag(k string) bool {
+	if len(l.mapping.TagKeys) == 0 {
+		return true
+	}
+
+	for _, t := range l.mapping.TagKeys {
+		if t == k {
+			return true
+		}
+	}
+
+	return false
+}
+
+func stringValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
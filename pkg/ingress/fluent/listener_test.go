@@ -0,0 +1,248 @@
+package fluent_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"net"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/internal/testhelper"
+	"code.cloudfoundry.org/loggregator-agent/pkg/ingress/fluent"
+	"code.cloudfoundry.org/loggregator-agent/pkg/plumbing"
+	"github.com/vmihailenco/msgpack"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Listener", func() {
+	var (
+		setter *spySetter
+		mc     *testhelper.SpyMetricClient
+		l      *fluent.Listener
+		conn   net.Conn
+		ts     time.Time
+	)
+
+	start := func(tlsConfig *tls.Config, opts ...fluent.ListenerOption) {
+		var err error
+		l, err = fluent.NewListener("127.0.0.1:0", tlsConfig, setter, mc, opts...)
+		Expect(err).ToNot(HaveOccurred())
+		go l.Start()
+
+		if tlsConfig != nil {
+			conn, err = tls.Dial("tcp", l.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		} else {
+			conn, err = net.Dial("tcp", l.Addr().String())
+		}
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	send := func(msg ...interface{}) {
+		Expect(msgpack.NewEncoder(conn).Encode(msg)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		setter = newSpySetter()
+		mc = testhelper.NewMetricClient()
+		ts = time.Unix(1565445600, 123)
+	})
+
+	AfterEach(func() {
+		conn.Close()
+		l.Stop()
+	})
+
+	Context("with the default mapping", func() {
+		BeforeEach(func() {
+			start(nil)
+		})
+
+		It("reads the Message mode", func() {
+			send("app.web", &fluent.EventTime{Time: ts}, map[string]interface{}{
+				"log":         "hello",
+				"source_id":   "my-app",
+				"instance_id": "2",
+				"stream":      "stderr",
+				"pod":         "web-1",
+				"code":        200,
+			})
+
+			var e *loggregator_v2.Envelope
+			Eventually(setter.envs).Should(Receive(&e))
+			Expect(e.Timestamp).To(Equal(ts.UnixNano()))
+			Expect(e.SourceId).To(Equal("my-app"))
+			Expect(e.InstanceId).To(Equal("2"))
+			Expect(e.Tags).To(Equal(map[string]string{
+				"stream": "stderr",
+				"pod":    "web-1",
+				"code":   "200",
+			}))
+			Expect(e.GetLog().GetPayload()).To(Equal([]byte("hello")))
+			Expect(e.GetLog().GetType()).To(Equal(loggregator_v2.Log_ERR))
+
+			Expect(mc.GetMetric("fluent_ingress", map[string]string{"protocol": "tcp"}).Value()).To(Equal(1.0))
+		})
+
+		It("reads the Forward mode and uses the tag as source ID", func() {
+			send("app.web", []interface{}{
+				[]interface{}{ts.Unix(), map[string]interface{}{"log": "first"}},
+				[]interface{}{&fluent.EventTime{Time: ts}, map[string]interface{}{"log": "second"}},
+			})
+
+			var e *loggregator_v2.Envelope
+			Eventually(setter.envs).Should(Receive(&e))
+			Expect(e.SourceId).To(Equal("app.web"))
+			Expect(e.Timestamp).To(Equal(time.Unix(ts.Unix(), 0).UnixNano()))
+			Expect(e.GetLog().GetPayload()).To(Equal([]byte("first")))
+			Expect(e.GetLog().GetType()).To(Equal(loggregator_v2.Log_OUT))
+
+			Eventually(setter.envs).Should(Receive(&e))
+			Expect(e.GetLog().GetPayload()).To(Equal([]byte("second")))
+		})
+
+		It("reads the PackedForward mode", func() {
+			send("app.web", packed(ts, "first", "second"))
+
+			var e *loggregator_v2.Envelope
+			Eventually(setter.envs).Should(Receive(&e))
+			Expect(e.GetLog().GetPayload()).To(Equal([]byte("first")))
+			Eventually(setter.envs).Should(Receive(&e))
+			Expect(e.GetLog().GetPayload()).To(Equal([]byte("second")))
+		})
+
+		It("reads compressed PackedForward messages and acknowledges chunks", func() {
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			gz.Write(packed(ts, "hello"))
+			gz.Close()
+
+			send("app.web", buf.Bytes(), map[string]string{"chunk": "abc123", "compressed": "gzip"})
+
+			var e *loggregator_v2.Envelope
+			Eventually(setter.envs).Should(Receive(&e))
+			Expect(e.GetLog().GetPayload()).To(Equal([]byte("hello")))
+
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			var ack map[string]string
+			Expect(msgpack.NewDecoder(conn).Decode(&ack)).To(Succeed())
+			Expect(ack).To(Equal(map[string]string{"ack": "abc123"}))
+		})
+
+		It("closes connections with invalid messages", func() {
+			send("app.web", "not a time", map[string]interface{}{})
+
+			Eventually(func() float64 {
+				return mc.GetMetric("fluent_invalid_messages", map[string]string{"protocol": "tcp"}).Value()
+			}).Should(Equal(1.0))
+
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			_, err := conn.Read(make([]byte, 1))
+			Expect(err).To(HaveOccurred())
+			Expect(setter.envs).ToNot(Receive())
+		})
+
+		It("does not trust the lengths of arrays and maps", func() {
+			for _, msg := range [][]byte{
+				// A Forward mode message with an array32 of 2^32-1 entries.
+				{0x92, 0xa1, 'a', 0xdd, 0xff, 0xff, 0xff, 0xff},
+				// A Message mode message with a map32 of 2^32-1 pairs.
+				{0x93, 0xa1, 'a', 0x01, 0xdf, 0xff, 0xff, 0xff, 0xff},
+			} {
+				c, err := net.Dial("tcp", l.Addr().String())
+				Expect(err).ToNot(HaveOccurred())
+				defer c.Close()
+
+				_, err = c.Write(msg)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(c.(*net.TCPConn).CloseWrite()).To(Succeed())
+
+				c.SetReadDeadline(time.Now().Add(5 * time.Second))
+				_, err = c.Read(make([]byte, 1))
+				Expect(err).To(HaveOccurred())
+			}
+
+			send("app.web", &fluent.EventTime{Time: ts}, map[string]interface{}{"log": "hello"})
+			Eventually(setter.envs).Should(Receive())
+		})
+
+		It("rejects compressed chunks that are too large", func() {
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			gz.Write(make([]byte, 9<<20))
+			gz.Close()
+
+			send("app.web", buf.Bytes(), map[string]string{"compressed": "gzip"})
+
+			Eventually(func() float64 {
+				return mc.GetMetric("fluent_invalid_messages", map[string]string{"protocol": "tcp"}).Value()
+			}).Should(Equal(1.0))
+			Expect(setter.envs).ToNot(Receive())
+		})
+	})
+
+	It("uses the configured record mapping", func() {
+		start(nil, fluent.WithRecordMapping(fluent.RecordMapping{
+			MessageKey:    "message",
+			SourceIDKey:   "app",
+			InstanceIDKey: "index",
+			TagKeys:       []string{"pod"},
+		}))
+
+		send("app.web", ts.Unix(), map[string]interface{}{
+			"message": "hello",
+			"app":     "my-app",
+			"index":   3,
+			"pod":     "web-1",
+			"node":    "node-1",
+		})
+
+		var e *loggregator_v2.Envelope
+		Eventually(setter.envs).Should(Receive(&e))
+		Expect(e.SourceId).To(Equal("my-app"))
+		Expect(e.InstanceId).To(Equal("3"))
+		Expect(e.Tags).To(Equal(map[string]string{"pod": "web-1"}))
+		Expect(e.GetLog().GetPayload()).To(Equal([]byte("hello")))
+	})
+
+	It("reads messages over TLS", func() {
+		tlsConfig, err := plumbing.NewServerTLSConfig(
+			testhelper.Cert("metron.crt"),
+			testhelper.Cert("metron.key"),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		start(tlsConfig)
+
+		send("app.web", ts.Unix(), map[string]interface{}{"log": "hello"})
+
+		var e *loggregator_v2.Envelope
+		Eventually(setter.envs).Should(Receive(&e))
+		Expect(e.GetLog().GetPayload()).To(Equal([]byte("hello")))
+		Expect(mc.GetMetric("fluent_ingress", map[string]string{"protocol": "tls"}).Value()).To(Equal(1.0))
+	})
+})
+
+func packed(ts time.Time, logs ...string) []byte {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	for _, l := range logs {
+		err := enc.Encode([]interface{}{&fluent.EventTime{Time: ts}, map[string]interface{}{"log": l}})
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	return buf.Bytes()
+}
+
+type spySetter struct {
+	envs chan *loggregator_v2.Envelope
+}
+
+func newSpySetter() *spySetter {
+	return &spySetter{envs: make(chan *loggregator_v2.Envelope, 100)}
+}
+
+func (s *spySetter) Set(e *loggregator_v2.Envelope) {
+	s.envs <- e
+}
@@ -0,0 +1,229 @@
+package otlp
+
+import (
+	"encoding/base64"
+	"math"
+	"strconv"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+// Resource attributes that are mapped to the source of an envelope. The
+// source ID is the Cloud Foundry app ID when it is set and the service name
+// otherwise.
+const (
+	appIDAttr      = "cloudfoundry.app.id"
+	serviceAttr    = "service.name"
+	instanceIDAttr = "service.instance.id"
+)
+
+// source holds the envelope fields and tags derived from a resource.
+type source struct {
+	sourceID   string
+	instanceID string
+	tags       map[string]string
+}
+
+func newSource(r *resourcepb.Resource) source {
+	s := source{tags: make(map[string]string)}
+	for _, kv := range r.GetAttributes() {
+		v, ok := stringValue(kv.GetValue())
+		if !ok {
+			continue
+		}
+
+		switch kv.GetKey() {
+		case appIDAttr:
+			s.sourceID = v
+		case serviceAttr:
+			if s.sourceID == "" {
+				s.sourceID = v
+			}
+			s.tags[kv.GetKey()] = v
+		case instanceIDAttr:
+			s.instanceID = v
+		default:
+			s.tags[kv.GetKey()] = v
+		}
+	}
+
+	return s
+}
+
+// envelope returns an envelope for the source with the tags of the resource
+// and the given attributes.
+func (s source) envelope(ts uint64, attrs []*commonpb.KeyValue) *loggregator_v2.Envelope {
+	tags := make(map[string]string, len(s.tags)+len(attrs))
+	for k, v := range s.tags {
+		tags[k] = v
+	}
+
+	for _, kv := range attrs {
+		if v, ok := stringValue(kv.GetValue()); ok {
+			tags[kv.GetKey()] = v
+		}
+	}
+
+	if ts == 0 {
+		ts = uint64(time.Now().UnixNano())
+	}
+
+	return &loggregator_v2.Envelope{
+		Timestamp:  int64(ts),
+		SourceId:   s.sourceID,
+		InstanceId: s.instanceID,
+		Tags:       tags,
+	}
+}
+
+// logsToEnvelopes converts every log record to a log envelope. Records with
+// a severity of error or above are written as stderr.
+func logsToEnvelopes(req *collogspb.ExportLogsServiceRequest) []*loggregator_v2.Envelope {
+	var envs []*loggregator_v2.Envelope
+	for _, rl := range req.GetResourceLogs() {
+		s := newSource(rl.GetResource())
+		for _, sl := range rl.GetScopeLogs() {
+			for _, lr := range sl.GetLogRecords() {
+				ts := lr.GetTimeUnixNano()
+				if ts == 0 {
+					ts = lr.GetObservedTimeUnixNano()
+				}
+
+				logType := loggregator_v2.Log_OUT
+				if lr.GetSeverityNumber() >= logspb.SeverityNumber_SEVERITY_NUMBER_ERROR {
+					logType = loggregator_v2.Log_ERR
+				}
+
+				body, _ := stringValue(lr.GetBody())
+
+				e := s.envelope(ts, lr.GetAttributes())
+				e.Message = &loggregator_v2.Envelope_Log{
+					Log: &loggregator_v2.Log{
+						Payload: []byte(body),
+						Type:    logType,
+					},
+				}
+				envs = append(envs, e)
+			}
+		}
+	}
+
+	return envs
+}
+
+// metricsToEnvelopes converts every data point of sums and gauges to an
+// envelope. Monotonic sums become counters and all other sums and gauges
+// become gauges. It also returns the number of data points that were not
+// converted because their type, such as histograms, is not supported.
+func metricsToEnvelopes(req *colmetricspb.ExportMetricsServiceRequest) ([]*loggregator_v2.Envelope, int) {
+	var (
+		envs        []*loggregator_v2.Envelope
+		unsupported int
+	)
+	for _, rm := range req.GetResourceMetrics() {
+		s := newSource(rm.GetResource())
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, m := range sm.GetMetrics() {
+				switch data := m.GetData().(type) {
+				case *metricspb.Metric_Sum:
+					for _, dp := range data.Sum.GetDataPoints() {
+						if data.Sum.GetIsMonotonic() {
+							envs = append(envs, counterEnvelope(s, m, data.Sum, dp))
+							continue
+						}
+
+						envs = append(envs, gaugeEnvelope(s, m, dp))
+					}
+				case *metricspb.Metric_Gauge:
+					for _, dp := range data.Gauge.GetDataPoints() {
+						envs = append(envs, gaugeEnvelope(s, m, dp))
+					}
+				case *metricspb.Metric_Histogram:
+					unsupported += len(data.Histogram.GetDataPoints())
+				case *metricspb.Metric_ExponentialHistogram:
+					unsupported += len(data.ExponentialHistogram.GetDataPoints())
+				case *metricspb.Metric_Summary:
+					unsupported += len(data.Summary.GetDataPoints())
+				}
+			}
+		}
+	}
+
+	return envs, unsupported
+}
+
+// counterEnvelope converts a data point of a monotonic sum. Cumulative sums
+// set the counter total and delta sums set the delta.
+func counterEnvelope(
+	s source,
+	m *metricspb.Metric,
+	sum *metricspb.Sum,
+	dp *metricspb.NumberDataPoint,
+) *loggregator_v2.Envelope {
+	c := &loggregator_v2.Counter{Name: m.GetName()}
+
+	v := uint64(math.Max(0, numberValue(dp)))
+	if sum.GetAggregationTemporality() == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA {
+		c.Delta = v
+	} else {
+		c.Total = v
+	}
+
+	e := s.envelope(dp.GetTimeUnixNano(), dp.GetAttributes())
+	e.Message = &loggregator_v2.Envelope_Counter{Counter: c}
+
+	return e
+}
+
+func gaugeEnvelope(s source, m *metricspb.Metric, dp *metricspb.NumberDataPoint) *loggregator_v2.Envelope {
+	e := s.envelope(dp.GetTimeUnixNano(), dp.GetAttributes())
+	e.Message = &loggregator_v2.Envelope_Gauge{
+		Gauge: &loggregator_v2.Gauge{
+			Metrics: map[string]*loggregator_v2.GaugeValue{
+				m.GetName(): {
+					Unit:  m.GetUnit(),
+					Value: numberValue(dp),
+				},
+			},
+		},
+	}
+
+	return e
+}
+
+func numberValue(dp *metricspb.NumberDataPoint) float64 {
+	switch v := dp.GetValue().(type) {
+	case *metricspb.NumberDataPoint_AsInt:
+		return float64(v.AsInt)
+	case *metricspb.NumberDataPoint_AsDouble:
+		return v.AsDouble
+	default:
+		return 0
+	}
+}
+
+// stringValue returns the value as a string. Arrays and key value lists
+// can not be represented as tags and are ignored.
+func stringValue(v *commonpb.AnyValue) (string, bool) {
+	switch v := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue, true
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(v.BoolValue), true
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(v.IntValue, 10), true
+	case *commonpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(v.DoubleValue, 'g', -1, 64), true
+	case *commonpb.AnyValue_BytesValue:
+		return base64.StdEncoding.EncodeToString(v.BytesValue), true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,109 @@
+package otlp
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	protobufContentType = "application/x-protobuf"
+	jsonContentType     = "application/json"
+
+	maxRequestBytes = 8 << 20
+)
+
+// NewHTTPHandler returns a handler for the OTLP/HTTP logs and metrics
+// paths. Requests may be binary protobuf or JSON encoded and may be gzip
+// compressed. The response has the encoding of the request.
+func NewHTTPHandler(r *Receiver) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/logs", func(w http.ResponseWriter, req *http.Request) {
+		var msg collogspb.ExportLogsServiceRequest
+		if !decode(w, req, &msg) {
+			return
+		}
+
+		r.ExportLogs(&msg)
+		encode(w, req, &collogspb.ExportLogsServiceResponse{})
+	})
+	mux.HandleFunc("/v1/metrics", func(w http.ResponseWriter, req *http.Request) {
+		var msg colmetricspb.ExportMetricsServiceRequest
+		if !decode(w, req, &msg) {
+			return
+		}
+
+		r.ExportMetrics(&msg)
+		encode(w, req, &colmetricspb.ExportMetricsServiceResponse{})
+	})
+
+	return mux
+}
+
+// decode reads the request body into msg. It writes an error response and
+// returns false if the request is invalid.
+func decode(w http.ResponseWriter, req *http.Request, msg proto.Message) bool {
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return false
+	}
+
+	var body io.Reader = http.MaxBytesReader(w, req.Body, maxRequestBytes)
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			http.Error(w, "invalid gzip body", http.StatusBadRequest)
+			return false
+		}
+		defer gz.Close()
+
+		body = gz
+	}
+
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return false
+	}
+
+	switch req.Header.Get("Content-Type") {
+	case protobufContentType:
+		err = proto.Unmarshal(data, msg)
+	case jsonContentType:
+		err = protojson.Unmarshal(data, msg)
+	default:
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return false
+	}
+	if err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
+
+func encode(w http.ResponseWriter, req *http.Request, msg proto.Message) {
+	var (
+		data []byte
+		err  error
+	)
+	if req.Header.Get("Content-Type") == jsonContentType {
+		data, err = protojson.Marshal(msg)
+	} else {
+		data, err = proto.Marshal(msg)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", req.Header.Get("Content-Type"))
+	w.Write(data)
+}
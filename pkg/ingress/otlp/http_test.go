@@ -0,0 +1,105 @@
+package otlp_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/loggregator-agent/internal/testhelper"
+	"code.cloudfoundry.org/loggregator-agent/pkg/ingress/otlp"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"google.golang.org/protobuf/proto"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HTTP handler", func() {
+	var (
+		setter  *spySetter
+		handler http.Handler
+	)
+
+	BeforeEach(func() {
+		setter = &spySetter{}
+		handler = otlp.NewHTTPHandler(otlp.NewReceiver(setter, testhelper.NewMetricClient()))
+	})
+
+	post := func(path, contentType string, body []byte, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		for i := 0; i < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	It("accepts protobuf logs", func() {
+		body, err := proto.Marshal(logsRequest(
+			resource("service.name", "my-service"),
+			&logspb.LogRecord{Body: stringValue("hello")},
+		))
+		Expect(err).ToNot(HaveOccurred())
+
+		rec := post("/v1/logs", "application/x-protobuf", body)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get("Content-Type")).To(Equal("application/x-protobuf"))
+
+		envs := setter.envelopes()
+		Expect(envs).To(HaveLen(1))
+		Expect(envs[0].SourceId).To(Equal("my-service"))
+	})
+
+	It("accepts JSON metrics", func() {
+		body := []byte(`{
+			"resourceMetrics": [{
+				"resource": {"attributes": [{"key": "service.name", "value": {"stringValue": "my-service"}}]},
+				"scopeMetrics": [{"metrics": [{
+					"name": "memory",
+					"gauge": {"dataPoints": [{"asDouble": 12.5}]}
+				}]}]
+			}]
+		}`)
+
+		rec := post("/v1/metrics", "application/json", body)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(MatchJSON(`{}`))
+
+		envs := setter.envelopes()
+		Expect(envs).To(HaveLen(1))
+		Expect(envs[0].GetGauge().GetMetrics()["memory"].GetValue()).To(Equal(12.5))
+	})
+
+	It("accepts gzip compressed requests", func() {
+		body, err := proto.Marshal(logsRequest(
+			resource("service.name", "my-service"),
+			&logspb.LogRecord{Body: stringValue("hello")},
+		))
+		Expect(err).ToNot(HaveOccurred())
+
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write(body)
+		gz.Close()
+
+		rec := post("/v1/logs", "application/x-protobuf", buf.Bytes(), "Content-Encoding", "gzip")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(setter.envelopes()).To(HaveLen(1))
+	})
+
+	It("rejects invalid requests", func() {
+		Expect(post("/v1/logs", "application/json", []byte("{")).Code).To(Equal(http.StatusBadRequest))
+		Expect(post("/v1/logs", "text/plain", []byte("hello")).Code).To(Equal(http.StatusUnsupportedMediaType))
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/logs", nil))
+		Expect(rec.Code).To(Equal(http.StatusMethodNotAllowed))
+
+		Expect(setter.envelopes()).To(BeEmpty())
+	})
+})
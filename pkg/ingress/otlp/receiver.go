@@ -0,0 +1,92 @@
+// Package otlp receives logs and metrics over the OpenTelemetry Protocol
+// (OTLP) and converts them to v2 envelopes.
+package otlp
+
+import (
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/pkg/metrics"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+type DataSetter interface {
+	Set(e *loggregator_v2.Envelope)
+}
+
+// MetricClient creates new CounterMetrics to be emitted periodically.
+type MetricClient interface {
+	NewCounter(name string, opts ...metrics.MetricOption) metrics.Counter
+}
+
+// Receiver converts OTLP export requests to envelopes and writes them to
+// the data setter.
+type Receiver struct {
+	dataSetter        DataSetter
+	ingressMetric     metrics.Counter
+	unsupportedMetric metrics.Counter
+}
+
+// NewReceiver returns a Receiver that writes to the given data setter.
+func NewReceiver(setter DataSetter, m MetricClient) *Receiver {
+	return &Receiver{
+		dataSetter:        setter,
+		ingressMetric:     m.NewCounter("otlp_ingress"),
+		unsupportedMetric: m.NewCounter("otlp_unsupported"),
+	}
+}
+
+// Register registers the OTLP logs and metrics services on the gRPC
+// server.
+func (r *Receiver) Register(s *grpc.Server) {
+	collogspb.RegisterLogsServiceServer(s, logsService{r: r})
+	colmetricspb.RegisterMetricsServiceServer(s, metricsService{r: r})
+}
+
+// ExportLogs writes a log envelope for every log record.
+func (r *Receiver) ExportLogs(req *collogspb.ExportLogsServiceRequest) {
+	r.set(logsToEnvelopes(req))
+}
+
+// ExportMetrics writes an envelope for every data point of supported
+// metric types.
+func (r *Receiver) ExportMetrics(req *colmetricspb.ExportMetricsServiceRequest) {
+	envs, unsupported := metricsToEnvelopes(req)
+	r.unsupportedMetric.Add(float64(unsupported))
+	r.set(envs)
+}
+
+func (r *Receiver) set(envs []*loggregator_v2.Envelope) {
+	for _, e := range envs {
+		r.dataSetter.Set(e)
+	}
+
+	r.ingressMetric.Add(float64(len(envs)))
+}
+
+type logsService struct {
+	collogspb.UnimplementedLogsServiceServer
+	r *Receiver
+}
+
+func (s logsService) Export(
+	_ context.Context,
+	req *collogspb.ExportLogsServiceRequest,
+) (*collogspb.ExportLogsServiceResponse, error) {
+	s.r.ExportLogs(req)
+	return &collogspb.ExportLogsServiceResponse{}, nil
+}
+
+type metricsService struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+	r *Receiver
+}
+
+func (s metricsService) Export(
+	_ context.Context,
+	req *colmetricspb.ExportMetricsServiceRequest,
+) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	s.r.ExportMetrics(req)
+	return &colmetricspb.ExportMetricsServiceResponse{}, nil
+}
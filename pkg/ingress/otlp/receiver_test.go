@@ -0,0 +1,248 @@
+package otlp_test
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/internal/testhelper"
+	"code.cloudfoundry.org/loggregator-agent/pkg/ingress/otlp"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Receiver", func() {
+	var (
+		setter *spySetter
+		mc     *testhelper.SpyMetricClient
+		rx     *otlp.Receiver
+	)
+
+	BeforeEach(func() {
+		setter = &spySetter{}
+		mc = testhelper.NewMetricClient()
+		rx = otlp.NewReceiver(setter, mc)
+	})
+
+	Describe("ExportLogs", func() {
+		It("converts log records to log envelopes", func() {
+			rx.ExportLogs(logsRequest(
+				resource("service.name", "my-service", "service.instance.id", "3", "deployment", "cf"),
+				&logspb.LogRecord{
+					TimeUnixNano:   99,
+					SeverityNumber: logspb.SeverityNumber_SEVERITY_NUMBER_INFO,
+					Body:           stringValue("hello"),
+					Attributes:     []*commonpb.KeyValue{attr("thread", "main")},
+				},
+				&logspb.LogRecord{
+					ObservedTimeUnixNano: 100,
+					SeverityNumber:       logspb.SeverityNumber_SEVERITY_NUMBER_FATAL,
+					Body:                 stringValue("oops"),
+				},
+			))
+
+			envs := setter.envelopes()
+			Expect(envs).To(HaveLen(2))
+
+			Expect(envs[0].SourceId).To(Equal("my-service"))
+			Expect(envs[0].InstanceId).To(Equal("3"))
+			Expect(envs[0].Timestamp).To(Equal(int64(99)))
+			Expect(envs[0].GetLog().GetPayload()).To(Equal([]byte("hello")))
+			Expect(envs[0].GetLog().GetType()).To(Equal(loggregator_v2.Log_OUT))
+			Expect(envs[0].Tags).To(Equal(map[string]string{
+				"service.name": "my-service",
+				"deployment":   "cf",
+				"thread":       "main",
+			}))
+
+			Expect(envs[1].Timestamp).To(Equal(int64(100)))
+			Expect(envs[1].GetLog().GetType()).To(Equal(loggregator_v2.Log_ERR))
+
+			Expect(mc.GetMetric("otlp_ingress", nil).Value()).To(Equal(2.0))
+		})
+
+		It("uses the Cloud Foundry app ID as the source ID", func() {
+			rx.ExportLogs(logsRequest(
+				resource("service.name", "my-service", "cloudfoundry.app.id", "app-guid"),
+				&logspb.LogRecord{Body: stringValue("hello")},
+			))
+
+			envs := setter.envelopes()
+			Expect(envs[0].SourceId).To(Equal("app-guid"))
+			Expect(envs[0].Timestamp).ToNot(BeZero())
+		})
+	})
+
+	Describe("ExportMetrics", func() {
+		It("converts sums and gauges to counters and gauges", func() {
+			rx.ExportMetrics(metricsRequest(
+				resource("service.name", "my-service"),
+				&metricspb.Metric{
+					Name: "requests",
+					Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+						IsMonotonic:            true,
+						AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+						DataPoints:             []*metricspb.NumberDataPoint{intPoint(10, attr("status", "200"))},
+					}},
+				},
+				&metricspb.Metric{
+					Name: "errors",
+					Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+						IsMonotonic:            true,
+						AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+						DataPoints:             []*metricspb.NumberDataPoint{intPoint(2)},
+					}},
+				},
+				&metricspb.Metric{
+					Name: "queue",
+					Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+						DataPoints: []*metricspb.NumberDataPoint{intPoint(5)},
+					}},
+				},
+				&metricspb.Metric{
+					Name: "memory",
+					Unit: "bytes",
+					Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+						DataPoints: []*metricspb.NumberDataPoint{doublePoint(1024.5)},
+					}},
+				},
+			))
+
+			envs := setter.envelopes()
+			Expect(envs).To(HaveLen(4))
+
+			Expect(envs[0].SourceId).To(Equal("my-service"))
+			Expect(envs[0].GetCounter()).To(Equal(&loggregator_v2.Counter{Name: "requests", Total: 10}))
+			Expect(envs[0].Tags).To(HaveKeyWithValue("status", "200"))
+
+			Expect(envs[1].GetCounter()).To(Equal(&loggregator_v2.Counter{Name: "errors", Delta: 2}))
+
+			Expect(envs[2].GetGauge().GetMetrics()).To(HaveKeyWithValue("queue", &loggregator_v2.GaugeValue{Value: 5}))
+			Expect(envs[3].GetGauge().GetMetrics()).To(HaveKeyWithValue("memory", &loggregator_v2.GaugeValue{Unit: "bytes", Value: 1024.5}))
+		})
+
+		It("counts unsupported data points", func() {
+			rx.ExportMetrics(metricsRequest(
+				resource("service.name", "my-service"),
+				&metricspb.Metric{
+					Name: "latency",
+					Data: &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+						DataPoints: []*metricspb.HistogramDataPoint{{}, {}},
+					}},
+				},
+			))
+
+			Expect(setter.envelopes()).To(BeEmpty())
+			Expect(mc.GetMetric("otlp_unsupported", nil).Value()).To(Equal(2.0))
+		})
+	})
+
+	It("serves the OTLP gRPC services", func() {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+
+		srv := grpc.NewServer()
+		rx.Register(srv)
+		go srv.Serve(lis)
+		defer srv.Stop()
+
+		conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+
+		_, err = collogspb.NewLogsServiceClient(conn).Export(context.Background(), logsRequest(
+			resource("service.name", "my-service"),
+			&logspb.LogRecord{Body: stringValue("hello")},
+		))
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = colmetricspb.NewMetricsServiceClient(conn).Export(context.Background(), metricsRequest(
+			resource("service.name", "my-service"),
+			&metricspb.Metric{
+				Name: "memory",
+				Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+					DataPoints: []*metricspb.NumberDataPoint{doublePoint(1)},
+				}},
+			},
+		))
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(setter.envelopes()).To(HaveLen(2))
+	})
+})
+
+type spySetter struct {
+	mu   sync.Mutex
+	envs []*loggregator_v2.Envelope
+}
+
+func (s *spySetter) Set(e *loggregator_v2.Envelope) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.envs = append(s.envs, e)
+}
+
+func (s *spySetter) envelopes() []*loggregator_v2.Envelope {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.envs
+}
+
+func logsRequest(r *resourcepb.Resource, records ...*logspb.LogRecord) *collogspb.ExportLogsServiceRequest {
+	return &collogspb.ExportLogsServiceRequest{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			Resource:  r,
+			ScopeLogs: []*logspb.ScopeLogs{{LogRecords: records}},
+		}},
+	}
+}
+
+func metricsRequest(r *resourcepb.Resource, metrics ...*metricspb.Metric) *colmetricspb.ExportMetricsServiceRequest {
+	return &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			Resource:     r,
+			ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: metrics}},
+		}},
+	}
+}
+
+func resource(kvs ...string) *resourcepb.Resource {
+	r := &resourcepb.Resource{}
+	for i := 0; i < len(kvs); i += 2 {
+		r.Attributes = append(r.Attributes, attr(kvs[i], kvs[i+1]))
+	}
+
+	return r
+}
+
+func attr(k, v string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: k, Value: stringValue(v)}
+}
+
+func stringValue(v string) *commonpb.AnyValue {
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}}
+}
+
+func intPoint(v int64, attrs ...*commonpb.KeyValue) *metricspb.NumberDataPoint {
+	return &metricspb.NumberDataPoint{
+		TimeUnixNano: 1,
+		Attributes:   attrs,
+		Value:        &metricspb.NumberDataPoint_AsInt{AsInt: v},
+	}
+}
+
+func doublePoint(v float64) *metricspb.NumberDataPoint {
+	return &metricspb.NumberDataPoint{
+		TimeUnixNano: 1,
+		Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: v},
+	}
+}
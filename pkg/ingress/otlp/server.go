@@ -0,0 +1,79 @@
+package otlp
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"net"
+	"net/http"
+
+	"google.golang.org/grpc"
+)
+
+// Server serves the OTLP/gRPC logs and metrics services.
+type Server struct {
+	addr       string
+	grpcServer *grpc.Server
+}
+
+func NewServer(addr string, rx *Receiver, opts ...grpc.ServerOption) *Server {
+	grpcServer := grpc.NewServer(opts...)
+	rx.Register(grpcServer)
+
+	return &Server{
+		addr:       addr,
+		grpcServer: grpcServer,
+	}
+}
+
+func (s *Server) Start() {
+	lis, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+	log.Printf("otlp grpc bound to: %s", lis.Addr())
+
+	if err := s.grpcServer.Serve(lis); err != nil && err != grpc.ErrServerStopped {
+		log.Fatalf("failed to serve: %v", err)
+	}
+}
+
+// Stop closes the listener and all open connections.
+func (s *Server) Stop() {
+	s.grpcServer.Stop()
+}
+
+// HTTPServer serves OTLP/HTTP over TLS.
+type HTTPServer struct {
+	addr      string
+	tlsConfig *tls.Config
+	srv       *http.Server
+}
+
+func NewHTTPServer(addr string, rx *Receiver, tlsConfig *tls.Config) *HTTPServer {
+	return &HTTPServer{
+		addr:      addr,
+		tlsConfig: tlsConfig,
+		srv: &http.Server{
+			Handler:   NewHTTPHandler(rx),
+			TLSConfig: tlsConfig,
+		},
+	}
+}
+
+func (s *HTTPServer) Start() {
+	lis, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+	log.Printf("otlp http bound to: %s", lis.Addr())
+
+	if err := s.srv.Serve(tls.NewListener(lis, s.tlsConfig)); err != nil && err != http.ErrServerClosed {
+		log.Fatalf("failed to serve: %v", err)
+	}
+}
+
+// Stop closes the listener and waits for active requests to finish.
+func (s *HTTPServer) Stop() {
+	s.srv.Shutdown(context.Background())
+}
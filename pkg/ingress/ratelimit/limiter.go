@@ -0,0 +1,323 @@
+// Package ratelimit limits the rate of envelopes per source ID and reports
+// the sources that send the most envelopes.
+package ratelimit
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/pkg/metrics"
+)
+
+type DataSetter interface {
+	Set(e *loggregator_v2.Envelope)
+}
+
+// MetricClient creates new CounterMetrics and GaugeMetrics to be emitted
+// periodically.
+type MetricClient interface {
+	NewCounter(name string, opts ...metrics.MetricOption) metrics.Counter
+	NewGauge(name string, opts ...metrics.MetricOption) metrics.Gauge
+	RemoveGauge(metrics.Gauge)
+}
+
+// shardCount is the number of shards of the sources. Envelopes of sources
+// in different shards do not contend for a lock.
+const shardCount = 32
+
+// SourceStats are the envelopes of a source ID in a report window.
+type SourceStats struct {
+	SourceID    string  `json:"source_id"`
+	Received    uint64  `json:"received"`
+	RateLimited uint64  `json:"rate_limited"`
+	Rate        float64 `json:"rate"`
+}
+
+// Report is the list of the sources that sent the most envelopes in the
+// last window.
+type Report struct {
+	Window  string        `json:"window"`
+	End     time.Time     `json:"end"`
+	Sources []SourceStats `json:"sources"`
+}
+
+// LimiterOption configures a Limiter.
+type LimiterOption func(*Limiter)
+
+// WithRate limits every source ID to the given number of envelopes per
+// second with bursts of the given size. There is no limit when the rate is
+// zero.
+func WithRate(rate float64, burst int) LimiterOption {
+	return func(l *Limiter) {
+		l.rate = rate
+		l.burst = float64(burst)
+	}
+}
+
+// WithReport sets the number of sources in the report and the window they
+// are counted in. It defaults to 10 sources per minute.
+func WithReport(size int, window time.Duration) LimiterOption {
+	return func(l *Limiter) {
+		l.reportSize = size
+		l.window = window
+	}
+}
+
+// WithClock sets the function that returns the current time. It defaults
+// to time.Now.
+func WithClock(now func() time.Time) LimiterOption {
+	return func(l *Limiter) {
+		l.now = now
+	}
+}
+
+// Limiter is a DataSetter that drops envelopes of source IDs that exceed
+// their rate. It serves the last report as JSON and publishes the rates of
+// the reported sources as gauges. Only the sources of the last report have
+// gauges.
+type Limiter struct {
+	setter     DataSetter
+	rate       float64
+	burst      float64
+	reportSize int
+	window     time.Duration
+	now        func() time.Time
+
+	m               MetricClient
+	rateLimited     metrics.Counter
+	rateGauges      map[string]metrics.Gauge
+	rateLimitGauges map[string]metrics.Gauge
+
+	shards [shardCount]shard
+
+	mu     sync.Mutex
+	report Report
+	stop   chan struct{}
+}
+
+type shard struct {
+	mu      sync.Mutex
+	sources map[string]*source
+}
+
+type source struct {
+	tokens      float64
+	last        time.Time
+	received    uint64
+	rateLimited uint64
+}
+
+// NewLimiter returns a Limiter that writes allowed envelopes to the given
+// setter.
+func NewLimiter(setter DataSetter, m MetricClient, opts ...LimiterOption) *Limiter {
+	l := &Limiter{
+		setter:          setter,
+		reportSize:      10,
+		window:          time.Minute,
+		now:             time.Now,
+		m:               m,
+		rateLimited:     m.NewCounter("rate_limited"),
+		rateGauges:      make(map[string]metrics.Gauge),
+		rateLimitGauges: make(map[string]metrics.Gauge),
+		stop:            make(chan struct{}),
+	}
+	for i := range l.shards {
+		l.shards[i].sources = make(map[string]*source)
+	}
+
+	for _, o := range opts {
+		o(l)
+	}
+
+	if l.burst < 1 {
+		l.burst = 1
+	}
+	if l.window <= 0 {
+		l.window = time.Minute
+	}
+	l.report = Report{
+		Window:  l.window.String(),
+		Sources: []SourceStats{},
+	}
+
+	return l
+}
+
+// Set writes the envelope unless its source ID exceeded its rate.
+func (l *Limiter) Set(e *loggregator_v2.Envelope) {
+	now := l.now()
+
+	sh := l.shard(e.SourceId)
+	sh.mu.Lock()
+	s, ok := sh.sources[e.SourceId]
+	if !ok {
+		s = &source{tokens: l.burst, last: now}
+		sh.sources[e.SourceId] = s
+	}
+	s.received++
+	allowed := l.take(s, now)
+	if !allowed {
+		s.rateLimited++
+	}
+	sh.mu.Unlock()
+
+	if !allowed {
+		l.rateLimited.Add(1)
+		return
+	}
+
+	l.setter.Set(e)
+}
+
+// shard returns the shard of the source ID. It uses FNV-1a inline to
+// avoid an allocation per envelope.
+func (l *Limiter) shard(sourceID string) *shard {
+	h := uint32(2166136261)
+	for i := 0; i < len(sourceID); i++ {
+		h ^= uint32(sourceID[i])
+		h *= 16777619
+	}
+
+	return &l.shards[h%shardCount]
+}
+
+// take refills the token bucket of the source and takes a token from it.
+func (l *Limiter) take(s *source, now time.Time) bool {
+	if l.rate <= 0 {
+		return true
+	}
+
+	s.tokens += now.Sub(s.last).Seconds() * l.rate
+	if s.tokens > l.burst {
+		s.tokens = l.burst
+	}
+	s.last = now
+
+	if s.tokens < 1 {
+		return false
+	}
+	s.tokens--
+
+	return true
+}
+
+// Start creates a report at the end of every window until Stop is called.
+func (l *Limiter) Start() {
+	t := time.NewTicker(l.window)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			l.Rotate()
+		case <-l.stop:
+			return
+		}
+	}
+}
+
+// Stop stops creating reports.
+func (l *Limiter) Stop() {
+	close(l.stop)
+}
+
+// Rotate ends the current window. It creates the report of the window and
+// resets the counts of all sources. Sources that did not send envelopes in
+// the window are forgotten.
+func (l *Limiter) Rotate() {
+	var stats []SourceStats
+	for i := range l.shards {
+		sh := &l.shards[i]
+
+		sh.mu.Lock()
+		for id, s := range sh.sources {
+			if s.received == 0 {
+				delete(sh.sources, id)
+				continue
+			}
+
+			stats = append(stats, SourceStats{
+				SourceID:    id,
+				Received:    s.received,
+				RateLimited: s.rateLimited,
+				Rate:        float64(s.received) / l.window.Seconds(),
+			})
+			s.received = 0
+			s.rateLimited = 0
+		}
+		sh.mu.Unlock()
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Received != stats[j].Received {
+			return stats[i].Received > stats[j].Received
+		}
+		return stats[i].SourceID < stats[j].SourceID
+	})
+	if len(stats) > l.reportSize {
+		stats = stats[:l.reportSize]
+	}
+	if stats == nil {
+		stats = []SourceStats{}
+	}
+
+	l.publish(stats)
+
+	l.mu.Lock()
+	l.report = Report{
+		Window:  l.window.String(),
+		End:     l.now(),
+		Sources: stats,
+	}
+	l.mu.Unlock()
+}
+
+// publish sets the gauges of the reported sources. The gauges of sources
+// that are no longer reported are removed.
+func (l *Limiter) publish(stats []SourceStats) {
+	reported := make(map[string]bool, len(stats))
+	for _, s := range stats {
+		reported[s.SourceID] = true
+
+		if _, ok := l.rateGauges[s.SourceID]; !ok {
+			tags := metrics.WithMetricTags(map[string]string{"ingress_source_id": s.SourceID})
+			l.rateGauges[s.SourceID] = l.m.NewGauge("source_ingress_rate", tags)
+			l.rateLimitGauges[s.SourceID] = l.m.NewGauge("source_rate_limited", tags)
+		}
+
+		l.rateGauges[s.SourceID].Set(s.Rate)
+		l.rateLimitGauges[s.SourceID].Set(float64(s.RateLimited))
+	}
+
+	for id, g := range l.rateGauges {
+		if reported[id] {
+			continue
+		}
+
+		l.m.RemoveGauge(g)
+		l.m.RemoveGauge(l.rateLimitGauges[id])
+		delete(l.rateGauges, id)
+		delete(l.rateLimitGauges, id)
+	}
+}
+
+// Report returns the report of the last window.
+func (l *Limiter) Report() Report {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.report
+}
+
+// ServeHTTP writes the report of the last window as JSON.
+func (l *Limiter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(l.Report()); err != nil {
+		log.Printf("Failed to write source report: %s", err)
+	}
+}
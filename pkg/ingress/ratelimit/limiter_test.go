@@ -0,0 +1,201 @@
+package ratelimit_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/internal/testhelper"
+	"code.cloudfoundry.org/loggregator-agent/pkg/ingress/ratelimit"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Limiter", func() {
+	var (
+		setter       *spySetter
+		metricClient *testhelper.SpyMetricClient
+		clock        *fakeClock
+	)
+
+	send := func(l *ratelimit.Limiter, sourceID string, n int) {
+		for i := 0; i < n; i++ {
+			l.Set(&loggregator_v2.Envelope{SourceId: sourceID})
+		}
+	}
+
+	BeforeEach(func() {
+		setter = &spySetter{}
+		metricClient = testhelper.NewMetricClient()
+		clock = &fakeClock{t: time.Unix(1000, 0)}
+	})
+
+	It("writes all envelopes without a rate", func() {
+		l := ratelimit.NewLimiter(setter, metricClient)
+
+		send(l, "app-1", 100)
+
+		Expect(setter.count("app-1")).To(Equal(100))
+	})
+
+	It("drops envelopes of a source that exceed its rate", func() {
+		l := ratelimit.NewLimiter(
+			setter,
+			metricClient,
+			ratelimit.WithRate(10, 5),
+			ratelimit.WithClock(clock.now),
+		)
+
+		send(l, "noisy", 20)
+		send(l, "quiet", 3)
+
+		Expect(setter.count("noisy")).To(Equal(5))
+		Expect(setter.count("quiet")).To(Equal(3))
+		Expect(metricClient.GetMetric("rate_limited", nil).Value()).To(Equal(15.0))
+
+		clock.add(500 * time.Millisecond)
+		send(l, "noisy", 20)
+
+		Expect(setter.count("noisy")).To(Equal(10))
+	})
+
+	It("reports the sources that send the most envelopes", func() {
+		l := ratelimit.NewLimiter(
+			setter,
+			metricClient,
+			ratelimit.WithRate(10, 50),
+			ratelimit.WithReport(2, 10*time.Second),
+			ratelimit.WithClock(clock.now),
+		)
+
+		send(l, "app-1", 20)
+		send(l, "app-2", 100)
+		send(l, "app-3", 5)
+		l.Rotate()
+
+		r := l.Report()
+		Expect(r.Window).To(Equal("10s"))
+		Expect(r.Sources).To(Equal([]ratelimit.SourceStats{
+			{SourceID: "app-2", Received: 100, RateLimited: 50, Rate: 10},
+			{SourceID: "app-1", Received: 20, Rate: 2},
+		}))
+
+		tags := map[string]string{"ingress_source_id": "app-2"}
+		Expect(metricClient.GetMetric("source_ingress_rate", tags).Value()).To(Equal(10.0))
+		Expect(metricClient.GetMetric("source_rate_limited", tags).Value()).To(Equal(50.0))
+	})
+
+	It("resets the counts of every window", func() {
+		l := ratelimit.NewLimiter(
+			setter,
+			metricClient,
+			ratelimit.WithReport(1, 10*time.Second),
+			ratelimit.WithClock(clock.now),
+		)
+
+		send(l, "app-1", 20)
+		l.Rotate()
+		send(l, "app-2", 10)
+		l.Rotate()
+
+		Expect(l.Report().Sources).To(Equal([]ratelimit.SourceStats{
+			{SourceID: "app-2", Received: 10, Rate: 1},
+		}))
+
+		Expect(metricClient.HasMetric("source_ingress_rate", map[string]string{"ingress_source_id": "app-1"})).To(BeFalse())
+		Expect(metricClient.HasMetric("source_rate_limited", map[string]string{"ingress_source_id": "app-1"})).To(BeFalse())
+		Expect(metricClient.HasMetric("source_ingress_rate", map[string]string{"ingress_source_id": "app-2"})).To(BeTrue())
+	})
+
+	It("counts envelopes of sources written concurrently", func() {
+		l := ratelimit.NewLimiter(setter, metricClient, ratelimit.WithReport(100, 10*time.Second))
+
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func(id string) {
+				defer wg.Done()
+				send(l, id, 100)
+			}(fmt.Sprintf("app-%d", i))
+		}
+		wg.Wait()
+		l.Rotate()
+
+		sources := l.Report().Sources
+		Expect(sources).To(HaveLen(50))
+		for _, s := range sources {
+			Expect(s.Received).To(Equal(uint64(100)))
+		}
+	})
+
+	It("serves the report as JSON", func() {
+		l := ratelimit.NewLimiter(setter, metricClient, ratelimit.WithClock(clock.now))
+		send(l, "app-1", 60)
+		l.Rotate()
+
+		rec := httptest.NewRecorder()
+		l.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ingress/sources", nil))
+
+		var r ratelimit.Report
+		Expect(json.Unmarshal(rec.Body.Bytes(), &r)).To(Succeed())
+		Expect(r.Window).To(Equal("1m0s"))
+		Expect(r.Sources).To(Equal([]ratelimit.SourceStats{
+			{SourceID: "app-1", Received: 60, Rate: 1},
+		}))
+	})
+
+	It("creates reports periodically", func() {
+		l := ratelimit.NewLimiter(setter, metricClient, ratelimit.WithReport(10, 10*time.Millisecond))
+		go l.Start()
+		defer l.Stop()
+
+		// Envelopes are sent continuously as every report only covers a
+		// window of 10ms.
+		Eventually(func() []ratelimit.SourceStats {
+			send(l, "app-1", 1)
+			return l.Report().Sources
+		}).Should(HaveLen(1))
+	})
+})
+
+type spySetter struct {
+	mu        sync.Mutex
+	envelopes []*loggregator_v2.Envelope
+}
+
+func (s *spySetter) Set(e *loggregator_v2.Envelope) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.envelopes = append(s.envelopes, e)
+}
+
+func (s *spySetter) count(sourceID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int
+	for _, e := range s.envelopes {
+		if e.SourceId == sourceID {
+			n++
+		}
+	}
+
+	return n
+}
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func (c *fakeClock) add(d time.Duration) {
+	c.t = c.t.Add(d)
+}
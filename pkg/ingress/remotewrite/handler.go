@@ -0,0 +1,197 @@
+// Package remotewrite receives samples pushed with the Prometheus remote
+// write protocol and converts them to v2 envelopes.
+package remotewrite
+
+import (
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/pkg/metrics"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+)
+
+const (
+	nameLabel     = "__name__"
+	sourceIDLabel = "source_id"
+
+	// maxRequestBytes limits both the compressed and the decompressed size
+	// of a request.
+	maxRequestBytes = 32 << 20
+)
+
+type DataSetter interface {
+	Set(e *loggregator_v2.Envelope)
+}
+
+// MetricClient creates new CounterMetrics to be emitted periodically.
+type MetricClient interface {
+	NewCounter(name string, opts ...metrics.MetricOption) metrics.Counter
+}
+
+// Handler accepts remote write requests. Samples of counters become
+// counter envelopes and all other samples become gauge envelopes. A series
+// is a counter when its metadata says so or its name ends in "_total".
+type Handler struct {
+	setter          DataSetter
+	defaultSourceID string
+
+	ingressMetric metrics.Counter
+	invalidMetric metrics.Counter
+}
+
+// HandlerOption configures a Handler.
+type HandlerOption func(*Handler)
+
+// WithDefaultSourceID sets the source ID of series without a source_id
+// label. It defaults to "remote_write".
+func WithDefaultSourceID(id string) HandlerOption {
+	return func(h *Handler) {
+		h.defaultSourceID = id
+	}
+}
+
+// NewHandler returns a Handler that writes to the given data setter.
+func NewHandler(setter DataSetter, m MetricClient, opts ...HandlerOption) *Handler {
+	h := &Handler{
+		setter:          setter,
+		defaultSourceID: "remote_write",
+		ingressMetric:   m.NewCounter("remote_write_ingress"),
+		invalidMetric:   m.NewCounter("remote_write_invalid_requests"),
+	}
+
+	for _, o := range opts {
+		o(h)
+	}
+
+	return h
+}
+
+// ServeHTTP decodes the snappy compressed write request and writes an
+// envelope for every sample.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	compressed, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+	if err != nil {
+		h.invalidMetric.Add(1)
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	n, err := snappy.DecodedLen(compressed)
+	if err != nil {
+		h.invalidMetric.Add(1)
+		http.Error(w, "invalid snappy body", http.StatusBadRequest)
+		return
+	}
+
+	if n > maxRequestBytes {
+		h.invalidMetric.Add(1)
+		http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		h.invalidMetric.Add(1)
+		http.Error(w, "invalid snappy body", http.StatusBadRequest)
+		return
+	}
+
+	var req WriteRequest
+	if err := proto.Unmarshal(data, &req); err != nil {
+		h.invalidMetric.Add(1)
+		http.Error(w, "invalid write request", http.StatusBadRequest)
+		return
+	}
+
+	envs := h.toEnvelopes(&req)
+	for _, e := range envs {
+		h.setter.Set(e)
+	}
+	h.ingressMetric.Add(float64(len(envs)))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) toEnvelopes(req *WriteRequest) []*loggregator_v2.Envelope {
+	counters := make(map[string]bool)
+	units := make(map[string]string)
+	for _, md := range req.Metadata {
+		counters[md.MetricFamilyName] = md.Type == MetricTypeCounter
+		units[md.MetricFamilyName] = md.Unit
+	}
+
+	var envs []*loggregator_v2.Envelope
+	for _, ts := range req.Timeseries {
+		var name string
+		sourceID := h.defaultSourceID
+		tags := make(map[string]string, len(ts.Labels))
+		for _, l := range ts.Labels {
+			switch l.Name {
+			case nameLabel:
+				name = l.Value
+			case sourceIDLabel:
+				sourceID = l.Value
+			default:
+				tags[l.Name] = l.Value
+			}
+		}
+
+		if name == "" {
+			continue
+		}
+		isCounter := counters[name] || strings.HasSuffix(name, "_total")
+
+		for _, s := range ts.Samples {
+			// Stale markers and other NaN samples have no value to write.
+			if math.IsNaN(s.Value) {
+				continue
+			}
+
+			e := &loggregator_v2.Envelope{
+				Timestamp: (time.Duration(s.Timestamp) * time.Millisecond).Nanoseconds(),
+				SourceId:  sourceID,
+				Tags:      copyTags(tags),
+			}
+
+			if isCounter {
+				e.Message = &loggregator_v2.Envelope_Counter{
+					Counter: &loggregator_v2.Counter{
+						Name:  name,
+						Total: uint64(math.Max(0, s.Value)),
+					},
+				}
+			} else {
+				e.Message = &loggregator_v2.Envelope_Gauge{
+					Gauge: &loggregator_v2.Gauge{
+						Metrics: map[string]*loggregator_v2.GaugeValue{
+							name: {Unit: units[name], Value: s.Value},
+						},
+					},
+				}
+			}
+
+			envs = append(envs, e)
+		}
+	}
+
+	return envs
+}
+
+func copyTags(tags map[string]string) map[string]string {
+	c := make(map[string]string, len(tags))
+	for k, v := range tags {
+		c[k] = v
+	}
+
+	return c
+}
@@ -0,0 +1,147 @@
+package remotewrite_test
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/internal/testhelper"
+	"code.cloudfoundry.org/loggregator-agent/pkg/ingress/remotewrite"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Handler", func() {
+	var (
+		setter *spySetter
+		mc     *testhelper.SpyMetricClient
+		h      *remotewrite.Handler
+	)
+
+	BeforeEach(func() {
+		setter = &spySetter{}
+		mc = testhelper.NewMetricClient()
+		h = remotewrite.NewHandler(setter, mc, remotewrite.WithDefaultSourceID("some-source"))
+	})
+
+	write := func(req *remotewrite.WriteRequest) *httptest.ResponseRecorder {
+		data, err := proto.Marshal(req)
+		Expect(err).ToNot(HaveOccurred())
+
+		return post(h, snappy.Encode(nil, data))
+	}
+
+	It("writes gauge envelopes for samples", func() {
+		rec := write(&remotewrite.WriteRequest{
+			Timeseries: []*remotewrite.TimeSeries{
+				series(
+					labels("__name__", "memory", "source_id", "my-app", "instance", "a:8080"),
+					&remotewrite.Sample{Value: 1.5, Timestamp: 1000},
+					&remotewrite.Sample{Value: 2.5, Timestamp: 2000},
+				),
+			},
+			Metadata: []*remotewrite.MetricMetadata{
+				{MetricFamilyName: "memory", Unit: "bytes"},
+			},
+		})
+		Expect(rec.Code).To(Equal(http.StatusNoContent))
+
+		Expect(setter.envs).To(HaveLen(2))
+		e := setter.envs[0]
+		Expect(e.SourceId).To(Equal("my-app"))
+		Expect(e.Timestamp).To(Equal(int64(1e9)))
+		Expect(e.Tags).To(Equal(map[string]string{"instance": "a:8080"}))
+		Expect(e.GetGauge().GetMetrics()).To(Equal(map[string]*loggregator_v2.GaugeValue{
+			"memory": {Unit: "bytes", Value: 1.5},
+		}))
+		Expect(setter.envs[1].GetGauge().GetMetrics()["memory"].GetValue()).To(Equal(2.5))
+
+		Expect(mc.GetMetric("remote_write_ingress", nil).Value()).To(Equal(2.0))
+	})
+
+	It("writes counter envelopes for counters", func() {
+		write(&remotewrite.WriteRequest{
+			Timeseries: []*remotewrite.TimeSeries{
+				series(labels("__name__", "requests"), &remotewrite.Sample{Value: 10}),
+				series(labels("__name__", "errors_total"), &remotewrite.Sample{Value: 3}),
+			},
+			Metadata: []*remotewrite.MetricMetadata{
+				{MetricFamilyName: "requests", Type: remotewrite.MetricTypeCounter},
+			},
+		})
+
+		Expect(setter.envs).To(HaveLen(2))
+		Expect(setter.envs[0].SourceId).To(Equal("some-source"))
+		Expect(setter.envs[0].GetCounter()).To(Equal(&loggregator_v2.Counter{Name: "requests", Total: 10}))
+		Expect(setter.envs[1].GetCounter()).To(Equal(&loggregator_v2.Counter{Name: "errors_total", Total: 3}))
+	})
+
+	It("skips series without a name and stale samples", func() {
+		write(&remotewrite.WriteRequest{
+			Timeseries: []*remotewrite.TimeSeries{
+				series(labels("job", "no-name"), &remotewrite.Sample{Value: 1}),
+				series(labels("__name__", "memory"), &remotewrite.Sample{Value: math.NaN()}),
+			},
+		})
+
+		Expect(setter.envs).To(BeEmpty())
+	})
+
+	It("rejects invalid requests", func() {
+		Expect(post(h, []byte("not snappy")).Code).To(Equal(http.StatusBadRequest))
+		Expect(post(h, snappy.Encode(nil, []byte{0xff})).Code).To(Equal(http.StatusBadRequest))
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, remotewrite.Path, nil))
+		Expect(rec.Code).To(Equal(http.StatusMethodNotAllowed))
+
+		Expect(mc.GetMetric("remote_write_invalid_requests", nil).Value()).To(Equal(2.0))
+		Expect(setter.envs).To(BeEmpty())
+	})
+
+	It("rejects requests that decode to more than the maximum size", func() {
+		// The header claims a decoded length of 4 GiB.
+		body := []byte{0xff, 0xff, 0xff, 0xff, 0x0f}
+		Expect(post(h, body).Code).To(Equal(http.StatusRequestEntityTooLarge))
+
+		Expect(mc.GetMetric("remote_write_invalid_requests", nil).Value()).To(Equal(1.0))
+		Expect(setter.envs).To(BeEmpty())
+	})
+})
+
+func post(h http.Handler, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, remotewrite.Path, bytes.NewReader(body))
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func series(ls []*remotewrite.Label, samples ...*remotewrite.Sample) *remotewrite.TimeSeries {
+	return &remotewrite.TimeSeries{Labels: ls, Samples: samples}
+}
+
+func labels(kvs ...string) []*remotewrite.Label {
+	var ls []*remotewrite.Label
+	for i := 0; i < len(kvs); i += 2 {
+		ls = append(ls, &remotewrite.Label{Name: kvs[i], Value: kvs[i+1]})
+	}
+
+	return ls
+}
+
+type spySetter struct {
+	envs []*loggregator_v2.Envelope
+}
+
+func (s *spySetter) Set(e *loggregator_v2.Envelope) {
+	s.envs = append(s.envs, e)
+}
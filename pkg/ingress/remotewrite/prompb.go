@@ -0,0 +1,58 @@
+package remotewrite
+
+import "github.com/golang/protobuf/proto"
+
+// The messages below are the subset of the Prometheus remote write
+// protocol (prometheus/prompb) that is read by the handler. They are
+// defined here to avoid depending on the Prometheus server module.
+
+// MetricTypeCounter is the metadata type of counters.
+const MetricTypeCounter = 1
+
+type WriteRequest struct {
+	Timeseries []*TimeSeries     `protobuf:"bytes,1,rep,name=timeseries,proto3"`
+	Metadata   []*MetricMetadata `protobuf:"bytes,3,rep,name=metadata,proto3"`
+}
+
+func (m *WriteRequest) Reset()         { *m = WriteRequest{} }
+func (m *WriteRequest) String() string { return proto.CompactTextString(m) }
+func (*WriteRequest) ProtoMessage()    {}
+
+type TimeSeries struct {
+	Labels  []*Label  `protobuf:"bytes,1,rep,name=labels,proto3"`
+	Samples []*Sample `protobuf:"bytes,2,rep,name=samples,proto3"`
+}
+
+func (m *TimeSeries) Reset()         { *m = TimeSeries{} }
+func (m *TimeSeries) String() string { return proto.CompactTextString(m) }
+func (*TimeSeries) ProtoMessage()    {}
+
+type Label struct {
+	Name  string `protobuf:"bytes,1,opt,name=name,proto3"`
+	Value string `protobuf:"bytes,2,opt,name=value,proto3"`
+}
+
+func (m *Label) Reset()         { *m = Label{} }
+func (m *Label) String() string { return proto.CompactTextString(m) }
+func (*Label) ProtoMessage()    {}
+
+// Sample is a value at a timestamp in milliseconds.
+type Sample struct {
+	Value     float64 `protobuf:"fixed64,1,opt,name=value,proto3"`
+	Timestamp int64   `protobuf:"varint,2,opt,name=timestamp,proto3"`
+}
+
+func (m *Sample) Reset()         { *m = Sample{} }
+func (m *Sample) String() string { return proto.CompactTextString(m) }
+func (*Sample) ProtoMessage()    {}
+
+type MetricMetadata struct {
+	Type             int32  `protobuf:"varint,1,opt,name=type,proto3"`
+	MetricFamilyName string `protobuf:"bytes,2,opt,name=metric_family_name,json=metricFamilyName,proto3"`
+	Help             string `protobuf:"bytes,4,opt,name=help,proto3"`
+	Unit             string `protobuf:"bytes,5,opt,name=unit,proto3"`
+}
+
+func (m *MetricMetadata) Reset()         { *m = MetricMetadata{} }
+func (m *MetricMetadata) String() string { return proto.CompactTextString(m) }
+func (*MetricMetadata) ProtoMessage()    {}
@@ -0,0 +1,13 @@
+package remotewrite_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestRemoteWrite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Remote Write Ingress Suite")
+}
@@ -0,0 +1,50 @@
+package remotewrite
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"net"
+	"net/http"
+)
+
+// Path is the path that write requests are accepted on.
+const Path = "/api/v1/write"
+
+// Server serves the remote write endpoint over TLS.
+type Server struct {
+	addr      string
+	tlsConfig *tls.Config
+	srv       *http.Server
+}
+
+func NewServer(addr string, h *Handler, tlsConfig *tls.Config) *Server {
+	mux := http.NewServeMux()
+	mux.Handle(Path, h)
+
+	return &Server{
+		addr:      addr,
+		tlsConfig: tlsConfig,
+		srv: &http.Server{
+			Handler:   mux,
+			TLSConfig: tlsConfig,
+		},
+	}
+}
+
+func (s *Server) Start() {
+	lis, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+	log.Printf("remote write bound to: %s", lis.Addr())
+
+	if err := s.srv.Serve(tls.NewListener(lis, s.tlsConfig)); err != nil && err != http.ErrServerClosed {
+		log.Fatalf("failed to serve: %v", err)
+	}
+}
+
+// Stop closes the listener and waits for active requests to finish.
+func (s *Server) Stop() {
+	s.srv.Shutdown(context.Background())
+}
@@ -0,0 +1,212 @@
+package statsd
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+// gaugeExpiry is the number of flushes without an update after which a
+// gauge is forgotten.
+const gaugeExpiry = 10
+
+// aggregator accumulates counters, gauges and sets between flushes.
+// Gauges keep their value across flushes so that deltas can be applied, but
+// are only emitted when they were updated since the last flush. Gauges that
+// are not updated for gaugeExpiry flushes are forgotten, so a later delta
+// starts from zero.
+type aggregator struct {
+	sourceID string
+
+	mu       sync.Mutex
+	counters map[string]*counter
+	gauges   map[string]*gauge
+	sets     map[string]*set
+}
+
+type series struct {
+	name string
+	tags map[string]string
+}
+
+type counter struct {
+	series
+	value float64
+}
+
+type gauge struct {
+	series
+	value   float64
+	updated bool
+	idle    int
+}
+
+type set struct {
+	series
+	members map[string]struct{}
+}
+
+func newAggregator(sourceID string) *aggregator {
+	return &aggregator{
+		sourceID: sourceID,
+		counters: make(map[string]*counter),
+		gauges:   make(map[string]*gauge),
+		sets:     make(map[string]*set),
+	}
+}
+
+// add records the metric. Timers are not aggregated and are returned as an
+// envelope that ends now.
+func (a *aggregator) add(m metric) *loggregator_v2.Envelope {
+	if m.typ == timerType {
+		stop := time.Now()
+		start := stop.Add(-time.Duration(m.value * float64(time.Millisecond)))
+
+		e := a.envelope(series{m.name, m.tags})
+		e.Message = &loggregator_v2.Envelope_Timer{
+			Timer: &loggregator_v2.Timer{
+				Name:  m.name,
+				Start: start.UnixNano(),
+				Stop:  stop.UnixNano(),
+			},
+		}
+
+		return e
+	}
+
+	key := seriesKey(m.name, m.tags)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch m.typ {
+	case counterType:
+		c, ok := a.counters[key]
+		if !ok {
+			c = &counter{series: series{m.name, m.tags}}
+			a.counters[key] = c
+		}
+		c.value += m.value / m.rate
+	case gaugeType:
+		g, ok := a.gauges[key]
+		if !ok {
+			g = &gauge{series: series{m.name, m.tags}}
+			a.gauges[key] = g
+		}
+		if m.delta {
+			g.value += m.value
+		} else {
+			g.value = m.value
+		}
+		g.updated = true
+	case setType:
+		s, ok := a.sets[key]
+		if !ok {
+			s = &set{
+				series:  series{m.name, m.tags},
+				members: make(map[string]struct{}),
+			}
+			a.sets[key] = s
+		}
+		s.members[m.member] = struct{}{}
+	}
+
+	return nil
+}
+
+// flush returns a counter envelope with the delta of every counter, and a
+// gauge envelope for every updated gauge and every set. Counter deltas are
+// rounded and never negative. Sets are emitted as the number of unique
+// members.
+func (a *aggregator) flush() []*loggregator_v2.Envelope {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var envs []*loggregator_v2.Envelope
+	for key, c := range a.counters {
+		e := a.envelope(c.series)
+		e.Message = &loggregator_v2.Envelope_Counter{
+			Counter: &loggregator_v2.Counter{
+				Name:  c.name,
+				Delta: counterDelta(c.value),
+			},
+		}
+		envs = append(envs, e)
+		delete(a.counters, key)
+	}
+
+	for key, g := range a.gauges {
+		if !g.updated {
+			g.idle++
+			if g.idle >= gaugeExpiry {
+				delete(a.gauges, key)
+			}
+			continue
+		}
+		g.updated = false
+		g.idle = 0
+
+		envs = append(envs, a.gaugeEnvelope(g.series, g.value))
+	}
+
+	for key, s := range a.sets {
+		envs = append(envs, a.gaugeEnvelope(s.series, float64(len(s.members))))
+		delete(a.sets, key)
+	}
+
+	return envs
+}
+
+// counterDelta rounds the value of a counter. The delta is never negative
+// and saturates at the largest delta.
+func counterDelta(v float64) uint64 {
+	v = math.Round(v)
+	switch {
+	case !(v > 0):
+		return 0
+	case v >= math.MaxUint64:
+		return math.MaxUint64
+	default:
+		return uint64(v)
+	}
+}
+
+func (a *aggregator) gaugeEnvelope(s series, v float64) *loggregator_v2.Envelope {
+	e := a.envelope(s)
+	e.Message = &loggregator_v2.Envelope_Gauge{
+		Gauge: &loggregator_v2.Gauge{
+			Metrics: map[string]*loggregator_v2.GaugeValue{
+				s.name: {Value: v},
+			},
+		},
+	}
+
+	return e
+}
+
+func (a *aggregator) envelope(s series) *loggregator_v2.Envelope {
+	tags := make(map[string]string, len(s.tags))
+	for k, v := range s.tags {
+		tags[k] = v
+	}
+
+	return &loggregator_v2.Envelope{
+		Timestamp: time.Now().UnixNano(),
+		SourceId:  a.sourceID,
+		Tags:      tags,
+	}
+}
+
+func seriesKey(name string, tags map[string]string) string {
+	pairs := make([]string, 0, len(tags))
+	for k, v := range tags {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+
+	return name + "|" + strings.Join(pairs, ",")
+}
@@ -0,0 +1,153 @@
+package statsd
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/pkg/metrics"
+)
+
+type DataSetter interface {
+	Set(e *loggregator_v2.Envelope)
+}
+
+// MetricClient creates new CounterMetrics to be emitted periodically.
+type MetricClient interface {
+	NewCounter(name string, opts ...metrics.MetricOption) metrics.Counter
+}
+
+// Listener reads StatsD lines from UDP packets. Counters, gauges and sets
+// are aggregated and written to the data setter every flush interval.
+// Timers are written as they are received.
+type Listener struct {
+	conn          net.PacketConn
+	setter        DataSetter
+	agg           *aggregator
+	flushInterval time.Duration
+	sourceID      string
+
+	ingressMetric    metrics.Counter
+	parseErrorMetric metrics.Counter
+}
+
+// ListenerOption configures a Listener.
+type ListenerOption func(*Listener)
+
+// WithFlushInterval sets how often aggregated metrics are written. It
+// defaults to 10 seconds.
+func WithFlushInterval(d time.Duration) ListenerOption {
+	return func(l *Listener) {
+		l.flushInterval = d
+	}
+}
+
+// WithSourceID sets the source ID of the envelopes. It defaults to
+// "statsd".
+func WithSourceID(id string) ListenerOption {
+	return func(l *Listener) {
+		l.sourceID = id
+	}
+}
+
+// NewListener binds to the given UDP address.
+func NewListener(
+	addr string,
+	setter DataSetter,
+	m MetricClient,
+	opts ...ListenerOption,
+) (*Listener, error) {
+	conn, err := net.ListenPacket("udp4", addr)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("statsd bound to: %s", conn.LocalAddr())
+
+	l := &Listener{
+		conn:             conn,
+		setter:           setter,
+		flushInterval:    10 * time.Second,
+		sourceID:         "statsd",
+		ingressMetric:    m.NewCounter("statsd_ingress"),
+		parseErrorMetric: m.NewCounter("statsd_parse_errors"),
+	}
+
+	for _, o := range opts {
+		o(l)
+	}
+	l.agg = newAggregator(l.sourceID)
+
+	return l, nil
+}
+
+// Addr returns the address the listener is bound to.
+func (l *Listener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+// Start reads packets and flushes aggregated metrics until the listener is
+// stopped. Metrics aggregated since the last flush are written before it
+// returns.
+func (l *Listener) Start() {
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		t := time.NewTicker(l.flushInterval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C:
+				l.flush()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	buf := make([]byte, 65535)
+	for {
+		n, _, err := l.conn.ReadFrom(buf)
+		if err != nil {
+			log.Printf("Error while reading: %s", err)
+			l.flush()
+			return
+		}
+
+		l.handle(buf[:n])
+	}
+}
+
+// Stop closes the connection.
+func (l *Listener) Stop() {
+	l.conn.Close()
+}
+
+func (l *Listener) handle(packet []byte) {
+	for _, line := range bytes.Split(packet, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		m, err := parseLine(string(line))
+		if err != nil {
+			l.parseErrorMetric.Add(1)
+			continue
+		}
+		l.ingressMetric.Add(1)
+
+		if e := l.agg.add(m); e != nil {
+			l.setter.Set(e)
+		}
+	}
+}
+
+func (l *Listener) flush() {
+	for _, e := range l.agg.flush() {
+		l.setter.Set(e)
+	}
+}
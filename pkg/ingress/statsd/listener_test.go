@@ -0,0 +1,227 @@
+package statsd_test
+
+import (
+	"math"
+	"net"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/internal/testhelper"
+	"code.cloudfoundry.org/loggregator-agent/pkg/ingress/statsd"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Listener", func() {
+	var (
+		setter   *spySetter
+		mc       *testhelper.SpyMetricClient
+		listener *statsd.Listener
+		stopped  chan struct{}
+		conn     net.Conn
+	)
+
+	BeforeEach(func() {
+		setter = newSpySetter()
+		mc = testhelper.NewMetricClient()
+
+		var err error
+		listener, err = statsd.NewListener(
+			"127.0.0.1:0",
+			setter,
+			mc,
+			statsd.WithFlushInterval(time.Hour),
+			statsd.WithSourceID("some-source"),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		stopped = make(chan struct{})
+		go func() {
+			defer close(stopped)
+			listener.Start()
+		}()
+
+		conn, err = net.Dial("udp4", listener.Addr().String())
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		conn.Close()
+		listener.Stop()
+		Eventually(stopped).Should(BeClosed())
+	})
+
+	send := func(packets ...string) {
+		for _, p := range packets {
+			_, err := conn.Write([]byte(p))
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Eventually(func() float64 {
+			return mc.GetMetric("statsd_ingress", nil).Value() +
+				mc.GetMetric("statsd_parse_errors", nil).Value()
+		}).Should(BeNumerically(">=", len(packets)))
+	}
+
+	// flush stops the listener, which flushes the aggregated metrics.
+	flush := func() []*loggregator_v2.Envelope {
+		listener.Stop()
+		Eventually(stopped).Should(BeClosed())
+		return setter.envelopes()
+	}
+
+	It("aggregates counters between flushes", func() {
+		send(
+			"requests:1|c|#status:200",
+			"requests:2|c|#status:200\nrequests:1|c|@0.5|#status:200",
+			"requests:5|c|#status:500",
+		)
+
+		envs := flush()
+		Expect(envs).To(ConsistOf(
+			counter("requests", 5, map[string]string{"status": "200"}),
+			counter("requests", 5, map[string]string{"status": "500"}),
+		))
+		Expect(envs[0].SourceId).To(Equal("some-source"))
+		Expect(envs[0].Timestamp).ToNot(BeZero())
+	})
+
+	It("writes the last value of gauges and applies deltas", func() {
+		send("memory:100|g", "memory:+20|g", "memory:-5|g", "cpu:1.5|g|#flag")
+
+		Expect(flush()).To(ConsistOf(
+			gauge("memory", 115, map[string]string{}),
+			gauge("cpu", 1.5, map[string]string{"flag": ""}),
+		))
+	})
+
+	It("writes the number of unique members of sets", func() {
+		send("users:alice|s", "users:bob|s", "users:alice|s")
+
+		Expect(flush()).To(ConsistOf(
+			gauge("users", 2, map[string]string{}),
+		))
+	})
+
+	It("writes timers as they are received", func() {
+		send("latency:250|ms|#route:/v1", "size:3|h")
+
+		Eventually(setter.envelopes).Should(HaveLen(2))
+		envs := setter.envelopes()
+
+		Expect(envs[0].SourceId).To(Equal("some-source"))
+		Expect(envs[0].Tags).To(Equal(map[string]string{"route": "/v1"}))
+		Expect(envs[0].GetTimer().GetName()).To(Equal("latency"))
+		t := envs[0].GetTimer()
+		Expect(time.Duration(t.GetStop() - t.GetStart())).To(Equal(250 * time.Millisecond))
+
+		Expect(envs[1].GetTimer().GetName()).To(Equal("size"))
+	})
+
+	It("counts lines that can not be parsed", func() {
+		send(
+			"no-value",
+			"requests:abc|c",
+			"requests:1|x",
+			"requests:1|c|@2",
+			"requests:1|c|bogus",
+			"requests:1|c",
+		)
+
+		Expect(mc.GetMetric("statsd_parse_errors", nil).Value()).To(Equal(5.0))
+		Expect(mc.GetMetric("statsd_ingress", nil).Value()).To(Equal(1.0))
+		Expect(flush()).To(HaveLen(1))
+	})
+
+	It("rejects values that are not finite", func() {
+		send(
+			"requests:1e308|c\nrequests:1e308|c",
+			"requests:NaN|c",
+			"requests:+Inf|c",
+			"memory:-Inf|g",
+			"latency:1e300|ms",
+		)
+
+		Expect(mc.GetMetric("statsd_parse_errors", nil).Value()).To(Equal(4.0))
+		Expect(flush()).To(ConsistOf(
+			counter("requests", math.MaxUint64, map[string]string{}),
+		))
+	})
+
+	It("forgets gauges that are no longer updated", func() {
+		l, err := statsd.NewListener("127.0.0.1:0", setter, mc, statsd.WithFlushInterval(10*time.Millisecond))
+		Expect(err).ToNot(HaveOccurred())
+		go l.Start()
+		defer l.Stop()
+
+		c, err := net.Dial("udp4", l.Addr().String())
+		Expect(err).ToNot(HaveOccurred())
+		defer c.Close()
+
+		_, err = c.Write([]byte("memory:100|g"))
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(setter.envelopes).Should(ContainElement(gauge("memory", 100, map[string]string{})))
+
+		time.Sleep(200 * time.Millisecond)
+		_, err = c.Write([]byte("memory:+5|g"))
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(setter.envelopes).Should(ContainElement(gauge("memory", 5, map[string]string{})))
+	})
+
+	It("flushes every flush interval", func() {
+		l, err := statsd.NewListener("127.0.0.1:0", setter, mc, statsd.WithFlushInterval(10*time.Millisecond))
+		Expect(err).ToNot(HaveOccurred())
+		go l.Start()
+		defer l.Stop()
+
+		c, err := net.Dial("udp4", l.Addr().String())
+		Expect(err).ToNot(HaveOccurred())
+		defer c.Close()
+
+		_, err = c.Write([]byte("requests:1|c"))
+		Expect(err).ToNot(HaveOccurred())
+
+		Eventually(setter.envelopes).Should(ConsistOf(
+			And(
+				WithTransform(func(e *loggregator_v2.Envelope) string { return e.SourceId }, Equal("statsd")),
+				WithTransform(func(e *loggregator_v2.Envelope) uint64 { return e.GetCounter().GetDelta() }, Equal(uint64(1))),
+			),
+		))
+	})
+})
+
+func counter(name string, delta uint64, tags map[string]string) OmegaMatcher {
+	return WithTransform(func(e *loggregator_v2.Envelope) interface{} {
+		return []interface{}{e.GetCounter().GetName(), e.GetCounter().GetDelta(), e.Tags}
+	}, Equal([]interface{}{name, delta, tags}))
+}
+
+func gauge(name string, value float64, tags map[string]string) OmegaMatcher {
+	return WithTransform(func(e *loggregator_v2.Envelope) interface{} {
+		return []interface{}{e.GetGauge().GetMetrics()[name].GetValue(), e.Tags}
+	}, Equal([]interface{}{value, tags}))
+}
+
+type spySetter struct {
+	envs chan *loggregator_v2.Envelope
+	seen []*loggregator_v2.Envelope
+}
+
+func newSpySetter() *spySetter {
+	return &spySetter{envs: make(chan *loggregator_v2.Envelope, 100)}
+}
+
+func (s *spySetter) Set(e *loggregator_v2.Envelope) {
+	s.envs <- e
+}
+
+func (s *spySetter) envelopes() []*loggregator_v2.Envelope {
+	for {
+		select {
+		case e := <-s.envs:
+			s.seen = append(s.seen, e)
+		default:
+			return s.seen
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Package statsd receives StatsD metrics over UDP and converts them to v2
+// envelopes.
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxTimerMillis is the longest timer that fits in a time.Duration.
+const maxTimerMillis = float64(math.MaxInt64 / int64(time.Millisecond))
+
+type metricType int
+
+const (
+	counterType metricType = iota
+	gaugeType
+	timerType
+	setType
+)
+
+// metric is a single parsed StatsD line.
+type metric struct {
+	name  string
+	typ   metricType
+	value float64
+	// delta is set for gauges whose value is prefixed with a sign. The value
+	// is added to the current value of the gauge.
+	delta bool
+	// member is the raw value of a set.
+	member string
+	rate   float64
+	tags   map[string]string
+}
+
+// parseLine parses a line of the form
+//
+//	<name>:<value>|<type>[|@<sample rate>][|#<tag>:<value>,<tag>]
+//
+// Types c, g, ms, h, d and s are supported. Histograms and distributions
+// are treated as timers. Tags use the DogStatsD format and tags without a
+// value have an empty value.
+func parseLine(line string) (metric, error) {
+	m := metric{rate: 1}
+
+	colon := strings.IndexByte(line, ':')
+	if colon < 1 {
+		return metric{}, errors.New("missing name")
+	}
+	m.name = line[:colon]
+
+	fields := strings.Split(line[colon+1:], "|")
+	if len(fields) < 2 {
+		return metric{}, errors.New("missing type")
+	}
+
+	value := fields[0]
+	switch fields[1] {
+	case "c":
+		m.typ = counterType
+	case "g":
+		m.typ = gaugeType
+		m.delta = strings.HasPrefix(value, "+") || strings.HasPrefix(value, "-")
+	case "ms", "h", "d":
+		m.typ = timerType
+	case "s":
+		m.typ = setType
+	default:
+		return metric{}, fmt.Errorf("unknown type: %s", fields[1])
+	}
+
+	if m.typ == setType {
+		if value == "" {
+			return metric{}, errors.New("missing value")
+		}
+		m.member = value
+	} else {
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return metric{}, fmt.Errorf("invalid value: %s", value)
+		}
+		if m.typ == timerType && math.Abs(v) > maxTimerMillis {
+			return metric{}, fmt.Errorf("timer out of range: %s", value)
+		}
+		m.value = v
+	}
+
+	for _, f := range fields[2:] {
+		switch {
+		case strings.HasPrefix(f, "@"):
+			rate, err := strconv.ParseFloat(f[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return metric{}, fmt.Errorf("invalid sample rate: %s", f[1:])
+			}
+			m.rate = rate
+		case strings.HasPrefix(f, "#"):
+			m.tags = parseTags(f[1:])
+		default:
+			return metric{}, fmt.Errorf("unknown field: %s", f)
+		}
+	}
+
+	return m, nil
+}
+
+func parseTags(s string) map[string]string {
+	tags := make(map[string]string)
+	for _, t := range strings.Split(s, ",") {
+		if t == "" {
+			continue
+		}
+
+		kv := strings.SplitN(t, ":", 2)
+		if len(kv) == 1 {
+			tags[kv[0]] = ""
+			continue
+		}
+		tags[kv[0]] = kv[1]
+	}
+
+	return tags
+}
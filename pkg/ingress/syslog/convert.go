@@ -0,0 +1,117 @@
+package syslog
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+// Header fields that can be used as the source ID of an envelope.
+const (
+	AppNameField   = "app_name"
+	HostnameField  = "hostname"
+	ProcIDField    = "proc_id"
+	MessageIDField = "msg_id"
+)
+
+// DefaultSourceIDFields are the header fields used for the source ID when
+// none are configured.
+var DefaultSourceIDFields = []string{AppNameField, HostnameField}
+
+// converter converts syslog messages to log envelopes.
+type converter struct {
+	sourceIDFields  []string
+	defaultSourceID string
+}
+
+// ValidateSourceIDFields returns an error if a field is not a header field.
+func ValidateSourceIDFields(fields []string) error {
+	for _, f := range fields {
+		switch f {
+		case AppNameField, HostnameField, ProcIDField, MessageIDField:
+		default:
+			return fmt.Errorf("unknown source ID field: %s", f)
+		}
+	}
+
+	return nil
+}
+
+// toEnvelope converts the message to a log envelope. The source ID is the
+// first source ID field that is set in the message. The process ID is
+// parsed in the "[SOURCE-TYPE/INSTANCE]" format written by the syslog
+// egress and structured data parameters become tags. Messages with a
+// severity of error or above are written as stderr.
+func (c converter) toEnvelope(m message) *loggregator_v2.Envelope {
+	tags := make(map[string]string)
+	for _, sd := range m.sd {
+		for _, p := range sd.Parameters {
+			tags[p.Name] = p.Value
+		}
+	}
+
+	instanceID := nilValue(m.procID)
+	if strings.HasPrefix(instanceID, "[") && strings.HasSuffix(instanceID, "]") {
+		sourceType := instanceID[1 : len(instanceID)-1]
+		instanceID = ""
+		if i := strings.LastIndex(sourceType, "/"); i >= 0 {
+			sourceType, instanceID = sourceType[:i], sourceType[i+1:]
+		}
+		tags["source_type"] = sourceType
+	}
+
+	ts := m.timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	logType := loggregator_v2.Log_OUT
+	if m.severity <= 3 {
+		logType = loggregator_v2.Log_ERR
+	}
+
+	return &loggregator_v2.Envelope{
+		Timestamp:  ts.UnixNano(),
+		SourceId:   c.sourceID(m),
+		InstanceId: instanceID,
+		Tags:       tags,
+		Message: &loggregator_v2.Envelope_Log{
+			Log: &loggregator_v2.Log{
+				Payload: m.msg,
+				Type:    logType,
+			},
+		},
+	}
+}
+
+func (c converter) sourceID(m message) string {
+	for _, f := range c.sourceIDFields {
+		var v string
+		switch f {
+		case AppNameField:
+			v = m.appName
+		case HostnameField:
+			v = m.hostname
+		case ProcIDField:
+			v = m.procID
+		case MessageIDField:
+			v = m.msgID
+		}
+
+		if v = nilValue(v); v != "" {
+			return v
+		}
+	}
+
+	return c.defaultSourceID
+}
+
+// nilValue returns an empty string for the RFC 5424 nil value.
+func nilValue(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
+}
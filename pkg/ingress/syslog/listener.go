@@ -0,0 +1,290 @@
+package syslog
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/pkg/metrics"
+)
+
+// maxMessageSize is the largest message that is accepted.
+const maxMessageSize = 64 * 1024
+
+// maxLengthSize is the longest octet count prefix, including the space.
+const maxLengthSize = 16
+
+type DataSetter interface {
+	Set(e *loggregator_v2.Envelope)
+}
+
+// MetricClient creates new CounterMetrics to be emitted periodically.
+type MetricClient interface {
+	NewCounter(name string, opts ...metrics.MetricOption) metrics.Counter
+}
+
+// ListenerOption configures a UDPListener or TCPListener.
+type ListenerOption func(*converter)
+
+// WithSourceIDFields sets the header fields that are used for the source
+// ID, in order of preference. It defaults to DefaultSourceIDFields.
+func WithSourceIDFields(fields ...string) ListenerOption {
+	return func(c *converter) {
+		c.sourceIDFields = fields
+	}
+}
+
+// WithDefaultSourceID sets the source ID of messages that have none of the
+// source ID fields. It defaults to "syslog".
+func WithDefaultSourceID(id string) ListenerOption {
+	return func(c *converter) {
+		c.defaultSourceID = id
+	}
+}
+
+// handler converts messages and writes them to the data setter.
+type handler struct {
+	conv             converter
+	setter           DataSetter
+	ingressMetric    metrics.Counter
+	parseErrorMetric metrics.Counter
+}
+
+func newHandler(protocol string, setter DataSetter, m MetricClient, opts []ListenerOption) handler {
+	conv := converter{
+		sourceIDFields:  DefaultSourceIDFields,
+		defaultSourceID: "syslog",
+	}
+	for _, o := range opts {
+		o(&conv)
+	}
+
+	tags := metrics.WithMetricTags(map[string]string{"protocol": protocol})
+
+	return handler{
+		conv:             conv,
+		setter:           setter,
+		ingressMetric:    m.NewCounter("syslog_ingress", tags),
+		parseErrorMetric: m.NewCounter("syslog_parse_errors", tags),
+	}
+}
+
+func (h handler) handle(b []byte) {
+	msg, err := parse(b, time.Now())
+	if err != nil {
+		h.parseErrorMetric.Add(1)
+		return
+	}
+
+	h.setter.Set(h.conv.toEnvelope(msg))
+	h.ingressMetric.Add(1)
+}
+
+// UDPListener reads a syslog message from every UDP packet.
+type UDPListener struct {
+	conn net.PacketConn
+	h    handler
+}
+
+// NewUDPListener binds to the given UDP address.
+func NewUDPListener(
+	addr string,
+	setter DataSetter,
+	m MetricClient,
+	opts ...ListenerOption,
+) (*UDPListener, error) {
+	conn, err := net.ListenPacket("udp4", addr)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("syslog udp bound to: %s", conn.LocalAddr())
+
+	return &UDPListener{
+		conn: conn,
+		h:    newHandler("udp", setter, m, opts),
+	}, nil
+}
+
+// Addr returns the address the listener is bound to.
+func (l *UDPListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+// Start reads packets until the listener is stopped.
+func (l *UDPListener) Start() {
+	buf := make([]byte, 65535)
+	for {
+		n, _, err := l.conn.ReadFrom(buf)
+		if err != nil {
+			log.Printf("Error while reading: %s", err)
+			return
+		}
+
+		msg := make([]byte, n)
+		copy(msg, buf[:n])
+		l.h.handle(msg)
+	}
+}
+
+// Stop closes the connection.
+func (l *UDPListener) Stop() {
+	l.conn.Close()
+}
+
+// TCPListener reads syslog messages from TCP or TLS connections. Each
+// message is either octet counted or terminated by a newline.
+type TCPListener struct {
+	lis net.Listener
+	h   handler
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+// NewTCPListener binds to the given TCP address. Connections use TLS when
+// the TLS config is not nil.
+func NewTCPListener(
+	addr string,
+	tlsConfig *tls.Config,
+	setter DataSetter,
+	m MetricClient,
+	opts ...ListenerOption,
+) (*TCPListener, error) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	protocol := "tcp"
+	if tlsConfig != nil {
+		lis = tls.NewListener(lis, tlsConfig)
+		protocol = "tls"
+	}
+	log.Printf("syslog %s bound to: %s", protocol, lis.Addr())
+
+	return &TCPListener{
+		lis:   lis,
+		h:     newHandler(protocol, setter, m, opts),
+		conns: make(map[net.Conn]struct{}),
+	}, nil
+}
+
+// Addr returns the address the listener is bound to.
+func (l *TCPListener) Addr() net.Addr {
+	return l.lis.Addr()
+}
+
+// Start accepts connections until the listener is stopped.
+func (l *TCPListener) Start() {
+	for {
+		conn, err := l.lis.Accept()
+		if err != nil {
+			log.Printf("Error while accepting: %s", err)
+			return
+		}
+
+		l.mu.Lock()
+		l.conns[conn] = struct{}{}
+		l.mu.Unlock()
+
+		go l.serve(conn)
+	}
+}
+
+// Stop closes the listener and all open connections.
+func (l *TCPListener) Stop() {
+	l.lis.Close()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for conn := range l.conns {
+		conn.Close()
+	}
+}
+
+func (l *TCPListener) serve(conn net.Conn) {
+	defer func() {
+		conn.Close()
+
+		l.mu.Lock()
+		delete(l.conns, conn)
+		l.mu.Unlock()
+	}()
+
+	r := bufio.NewReader(conn)
+	for {
+		msg, err := readFrame(r)
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("Error while reading syslog message: %s", err)
+			}
+			return
+		}
+
+		if len(bytes.TrimSpace(msg)) == 0 {
+			continue
+		}
+		l.h.handle(msg)
+	}
+}
+
+// readFrame reads an octet counted message when it starts with a digit and
+// a newline terminated message otherwise. Messages longer than
+// maxMessageSize are an error.
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if first[0] < '0' || first[0] > '9' {
+		msg, err := readUntil(r, '\n', maxMessageSize+1)
+		if err == io.EOF && len(msg) > 0 {
+			return msg, nil
+		}
+
+		return msg, err
+	}
+
+	length, err := readUntil(r, ' ', maxLengthSize)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := strconv.Atoi(string(length[:len(length)-1]))
+	if err != nil || n > maxMessageSize {
+		return nil, errors.New("invalid message length")
+	}
+
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// readUntil reads until and including the delimiter. It returns an error
+// when the delimiter is not within max bytes.
+func readUntil(r *bufio.Reader, delim byte, max int) ([]byte, error) {
+	var buf []byte
+	for {
+		chunk, err := r.ReadSlice(delim)
+		if len(buf)+len(chunk) > max {
+			return nil, errors.New("message too long")
+		}
+		buf = append(buf, chunk...)
+
+		if err != bufio.ErrBufferFull {
+			return buf, err
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package syslog_test
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/internal/testhelper"
+	"code.cloudfoundry.org/loggregator-agent/pkg/ingress/syslog"
+	"code.cloudfoundry.org/loggregator-agent/pkg/plumbing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Listeners", func() {
+	var (
+		setter *spySetter
+		mc     *testhelper.SpyMetricClient
+	)
+
+	BeforeEach(func() {
+		setter = newSpySetter()
+		mc = testhelper.NewMetricClient()
+	})
+
+	Describe("UDPListener", func() {
+		var (
+			l    *syslog.UDPListener
+			conn net.Conn
+		)
+
+		BeforeEach(func() {
+			var err error
+			l, err = syslog.NewUDPListener("127.0.0.1:0", setter, mc)
+			Expect(err).ToNot(HaveOccurred())
+			go l.Start()
+
+			conn, err = net.Dial("udp4", l.Addr().String())
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			conn.Close()
+			l.Stop()
+		})
+
+		It("converts RFC 5424 messages", func() {
+			_, err := conn.Write([]byte(`<11>1 2019-08-10T14:00:00.5Z some-host some-app [APP/PROC/WEB/3] - [tags@47450 deployment="cf" job="router"] something failed` + "\n"))
+			Expect(err).ToNot(HaveOccurred())
+
+			var e *loggregator_v2.Envelope
+			Eventually(setter.envs).Should(Receive(&e))
+			Expect(e.SourceId).To(Equal("some-app"))
+			Expect(e.InstanceId).To(Equal("3"))
+			Expect(e.Timestamp).To(Equal(time.Date(2019, 8, 10, 14, 0, 0, 5e8, time.UTC).UnixNano()))
+			Expect(e.Tags).To(Equal(map[string]string{
+				"deployment":  "cf",
+				"job":         "router",
+				"source_type": "APP/PROC/WEB",
+			}))
+			Expect(e.GetLog().GetPayload()).To(Equal([]byte("something failed")))
+			Expect(e.GetLog().GetType()).To(Equal(loggregator_v2.Log_ERR))
+
+			Expect(mc.GetMetric("syslog_ingress", map[string]string{"protocol": "udp"}).Value()).To(Equal(1.0))
+		})
+
+		It("converts RFC 3164 messages", func() {
+			_, err := conn.Write([]byte("<14>Aug 10 14:00:00 some-host sshd[123]: accepted key"))
+			Expect(err).ToNot(HaveOccurred())
+
+			var e *loggregator_v2.Envelope
+			Eventually(setter.envs).Should(Receive(&e))
+			Expect(e.SourceId).To(Equal("sshd"))
+			Expect(e.InstanceId).To(Equal("123"))
+			ts := time.Unix(0, e.Timestamp)
+			Expect(ts.Month()).To(Equal(time.August))
+			Expect(ts.Year()).To(Equal(time.Now().Year()))
+			Expect(e.GetLog().GetPayload()).To(Equal([]byte("accepted key")))
+			Expect(e.GetLog().GetType()).To(Equal(loggregator_v2.Log_OUT))
+		})
+
+		It("keeps RFC 3164 messages without a header", func() {
+			_, err := conn.Write([]byte("<13>just a message"))
+			Expect(err).ToNot(HaveOccurred())
+
+			var e *loggregator_v2.Envelope
+			Eventually(setter.envs).Should(Receive(&e))
+			Expect(e.SourceId).To(Equal("syslog"))
+			Expect(e.Timestamp).ToNot(BeZero())
+			Expect(e.GetLog().GetPayload()).To(Equal([]byte("just a message")))
+		})
+
+		It("counts messages that can not be parsed", func() {
+			_, err := conn.Write([]byte("no priority"))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = conn.Write([]byte("<14>1 not-a-timestamp - - - - -"))
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(func() float64 {
+				return mc.GetMetric("syslog_parse_errors", map[string]string{"protocol": "udp"}).Value()
+			}).Should(Equal(2.0))
+			Expect(setter.envs).ToNot(Receive())
+		})
+	})
+
+	Describe("TCPListener", func() {
+		It("reads octet counted and newline framed messages", func() {
+			l, err := syslog.NewTCPListener("127.0.0.1:0", nil, setter, mc)
+			Expect(err).ToNot(HaveOccurred())
+			go l.Start()
+			defer l.Stop()
+
+			conn, err := net.Dial("tcp", l.Addr().String())
+			Expect(err).ToNot(HaveOccurred())
+			defer conn.Close()
+
+			first := "<14>1 2019-08-10T14:00:00Z host app-1 - - - first\nline"
+			fmt.Fprintf(conn, "%d %s", len(first), first)
+			fmt.Fprint(conn, "<14>1 2019-08-10T14:00:00Z host app-2 - - - second\n\n")
+			fmt.Fprint(conn, "<14>Aug 10 14:00:00 host app-3: third\n")
+
+			var e *loggregator_v2.Envelope
+			Eventually(setter.envs).Should(Receive(&e))
+			Expect(e.SourceId).To(Equal("app-1"))
+			Expect(e.GetLog().GetPayload()).To(Equal([]byte("first\nline")))
+
+			Eventually(setter.envs).Should(Receive(&e))
+			Expect(e.SourceId).To(Equal("app-2"))
+			Expect(e.GetLog().GetPayload()).To(Equal([]byte("second")))
+
+			Eventually(setter.envs).Should(Receive(&e))
+			Expect(e.SourceId).To(Equal("app-3"))
+			Expect(e.GetLog().GetPayload()).To(Equal([]byte("third")))
+
+			Expect(mc.GetMetric("syslog_ingress", map[string]string{"protocol": "tcp"}).Value()).To(Equal(3.0))
+		})
+
+		It("closes connections that send messages that are too long", func() {
+			l, err := syslog.NewTCPListener("127.0.0.1:0", nil, setter, mc)
+			Expect(err).ToNot(HaveOccurred())
+			go l.Start()
+			defer l.Stop()
+
+			for _, msg := range []string{
+				"<14>" + strings.Repeat("a", 65*1024) + "\n",
+				strings.Repeat("1", 32) + " <14>message",
+			} {
+				conn, err := net.Dial("tcp", l.Addr().String())
+				Expect(err).ToNot(HaveOccurred())
+				defer conn.Close()
+
+				fmt.Fprint(conn, msg)
+
+				// The connection is either closed or reset, depending on
+				// whether the listener read everything that was sent.
+				conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+				_, err = conn.Read(make([]byte, 1))
+				Expect(err).To(HaveOccurred())
+				if ne, ok := err.(net.Error); ok {
+					Expect(ne.Timeout()).To(BeFalse())
+				}
+			}
+
+			Consistently(setter.envs).ShouldNot(Receive())
+		})
+
+		It("reads messages over TLS", func() {
+			tlsConfig, err := plumbing.NewServerTLSConfig(
+				testhelper.Cert("metron.crt"),
+				testhelper.Cert("metron.key"),
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			l, err := syslog.NewTCPListener("127.0.0.1:0", tlsConfig, setter, mc)
+			Expect(err).ToNot(HaveOccurred())
+			go l.Start()
+			defer l.Stop()
+
+			conn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+			Expect(err).ToNot(HaveOccurred())
+			defer conn.Close()
+
+			fmt.Fprint(conn, "<14>1 2019-08-10T14:00:00Z host app - - - hello\n")
+
+			var e *loggregator_v2.Envelope
+			Eventually(setter.envs).Should(Receive(&e))
+			Expect(e.GetLog().GetPayload()).To(Equal([]byte("hello")))
+			Expect(mc.GetMetric("syslog_ingress", map[string]string{"protocol": "tls"}).Value()).To(Equal(1.0))
+		})
+	})
+
+	It("uses the configured source ID fields", func() {
+		l, err := syslog.NewUDPListener(
+			"127.0.0.1:0",
+			setter,
+			mc,
+			syslog.WithSourceIDFields(syslog.MessageIDField, syslog.HostnameField),
+			syslog.WithDefaultSourceID("fallback"),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		go l.Start()
+		defer l.Stop()
+
+		conn, err := net.Dial("udp4", l.Addr().String())
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+
+		var e *loggregator_v2.Envelope
+		conn.Write([]byte("<14>1 - host app - msg-id - hello"))
+		Eventually(setter.envs).Should(Receive(&e))
+		Expect(e.SourceId).To(Equal("msg-id"))
+
+		conn.Write([]byte("<14>1 - host app - - - hello"))
+		Eventually(setter.envs).Should(Receive(&e))
+		Expect(e.SourceId).To(Equal("host"))
+
+		conn.Write([]byte("<14>1 - - app - - - hello"))
+		Eventually(setter.envs).Should(Receive(&e))
+		Expect(e.SourceId).To(Equal("fallback"))
+	})
+
+	It("validates source ID fields", func() {
+		Expect(syslog.ValidateSourceIDFields([]string{"app_name", "msg_id"})).To(Succeed())
+		Expect(syslog.ValidateSourceIDFields([]string{"app_name", "unknown"})).To(MatchError("unknown source ID field: unknown"))
+	})
+})
+
+type spySetter struct {
+	envs chan *loggregator_v2.Envelope
+}
+
+func newSpySetter() *spySetter {
+	return &spySetter{envs: make(chan *loggregator_v2.Envelope, 100)}
+}
+
+func (s *spySetter) Set(e *loggregator_v2.Envelope) {
+	s.envs <- e
+}
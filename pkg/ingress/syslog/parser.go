@@ -0,0 +1,134 @@
+// Package syslog receives RFC 5424 and RFC 3164 syslog messages and
+// converts them to v2 log envelopes.
+package syslog
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"time"
+
+	"code.cloudfoundry.org/rfc5424"
+)
+
+// message holds the fields of a syslog message in either format.
+type message struct {
+	severity  int
+	timestamp time.Time
+	hostname  string
+	appName   string
+	procID    string
+	msgID     string
+	sd        []rfc5424.StructuredData
+	msg       []byte
+}
+
+var errInvalidPriority = errors.New("invalid priority")
+
+// parse parses a single syslog message. Messages with a version after the
+// priority are parsed as RFC 5424 and all others as RFC 3164.
+func parse(b []byte, now time.Time) (message, error) {
+	b = bytes.TrimRight(b, "\r\n\x00")
+
+	end := bytes.IndexByte(b, '>')
+	if len(b) < 3 || b[0] != '<' || end < 2 || end > 4 {
+		return message{}, errInvalidPriority
+	}
+
+	pri, err := strconv.Atoi(string(b[1:end]))
+	if err != nil || pri < 0 || pri > 191 {
+		return message{}, errInvalidPriority
+	}
+
+	rest := b[end+1:]
+	if len(rest) > 1 && rest[0] >= '1' && rest[0] <= '9' && rest[1] == ' ' {
+		return parseRFC5424(b, end+3)
+	}
+
+	return parseRFC3164(pri, rest, now), nil
+}
+
+// nilTimestamp replaces a nil timestamp before parsing because the rfc5424
+// package requires a timestamp.
+var nilTimestamp = []byte("1970-01-01T00:00:00Z")
+
+// parseRFC5424 parses the message. The timestamp starts at the given
+// offset.
+func parseRFC5424(b []byte, tsOffset int) (message, error) {
+	nilTS := bytes.HasPrefix(b[tsOffset:], []byte("- "))
+	if nilTS {
+		tmp := make([]byte, 0, len(b)+len(nilTimestamp))
+		tmp = append(tmp, b[:tsOffset]...)
+		tmp = append(tmp, nilTimestamp...)
+		b = append(tmp, b[tsOffset+1:]...)
+	}
+
+	var m rfc5424.Message
+	if err := m.UnmarshalBinary(b); err != nil {
+		return message{}, err
+	}
+	if nilTS {
+		m.Timestamp = time.Time{}
+	}
+
+	return message{
+		severity:  int(m.Priority & 0x07),
+		timestamp: m.Timestamp,
+		hostname:  m.Hostname,
+		appName:   m.AppName,
+		procID:    m.ProcessID,
+		msgID:     m.MessageID,
+		sd:        m.StructuredData,
+		msg:       m.Message,
+	}, nil
+}
+
+// rfc3164TimeFormat is the timestamp of an RFC 3164 header. It has no year
+// and the message is assumed to be from the current year.
+const rfc3164TimeFormat = time.Stamp
+
+// parseRFC3164 parses the header after the priority. RFC 3164 messages are
+// loosely formatted, so a header that can not be parsed is treated as part
+// of the message.
+func parseRFC3164(pri int, b []byte, now time.Time) message {
+	m := message{severity: pri & 0x07}
+
+	if len(b) < len(rfc3164TimeFormat)+1 || b[len(rfc3164TimeFormat)] != ' ' {
+		m.msg = b
+		return m
+	}
+
+	ts, err := time.ParseInLocation(rfc3164TimeFormat, string(b[:len(rfc3164TimeFormat)]), now.Location())
+	if err != nil {
+		m.msg = b
+		return m
+	}
+	m.timestamp = ts.AddDate(now.Year(), 0, 0)
+	b = b[len(rfc3164TimeFormat)+1:]
+
+	if i := bytes.IndexByte(b, ' '); i > 0 {
+		m.hostname = string(b[:i])
+		b = b[i+1:]
+	}
+
+	// TAG is alphanumeric and ends at the first non-alphanumeric character,
+	// usually "[" for the PID or ":".
+	tagEnd := bytes.IndexAny(b, "[: ")
+	if tagEnd > 0 && tagEnd <= 32 {
+		m.appName = string(b[:tagEnd])
+		b = b[tagEnd:]
+
+		if b[0] == '[' {
+			if i := bytes.IndexByte(b, ']'); i > 0 {
+				m.procID = string(b[1:i])
+				b = b[i+1:]
+			}
+		}
+
+		b = bytes.TrimPrefix(b, []byte(":"))
+		b = bytes.TrimPrefix(b, []byte(" "))
+	}
+
+	m.msg = b
+	return m
+}
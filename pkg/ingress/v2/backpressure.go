@@ -0,0 +1,174 @@
+package v2
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/pkg/metrics"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// BackpressureMode is what a Receiver does with envelopes of lossless
+// sources while the ingress buffer is full.
+type BackpressureMode string
+
+const (
+	// BackpressureBlock stops reading from the client until the buffer has
+	// room or the maximum wait has passed.
+	BackpressureBlock BackpressureMode = "block"
+	// BackpressureReject fails the request with RESOURCE_EXHAUSTED.
+	BackpressureReject BackpressureMode = "reject"
+)
+
+// UnmarshalEnv implements envstruct.Unmarshaller. An empty mode disables
+// backpressure.
+func (m *BackpressureMode) UnmarshalEnv(v string) error {
+	switch BackpressureMode(v) {
+	case "":
+	case BackpressureBlock, BackpressureReject:
+		*m = BackpressureMode(v)
+	default:
+		return fmt.Errorf("invalid backpressure mode: %s", v)
+	}
+
+	return nil
+}
+
+// ReservedSetter is a bounded buffer that envelopes are only set on after
+// room was reserved for them.
+type ReservedSetter interface {
+	Reserve(n int) bool
+	SetReserved(e *loggregator_v2.Envelope)
+}
+
+// Backpressure writes envelopes of lossless sources to a bounded buffer of
+// their own. While it is full, the client is pushed back instead, so
+// envelopes of lossless sources are never dropped by the agent.
+type Backpressure struct {
+	buffer   ReservedSetter
+	mode     BackpressureMode
+	maxWait  time.Duration
+	interval time.Duration
+	sources  []string
+
+	blockedMetric  metrics.Counter
+	rejectedMetric metrics.Counter
+}
+
+// BackpressureOption configures a Backpressure.
+type BackpressureOption func(*Backpressure)
+
+// WithMaxWait limits how long a request is blocked before it is rejected.
+// It defaults to five seconds.
+func WithMaxWait(d time.Duration) BackpressureOption {
+	return func(b *Backpressure) {
+		b.maxWait = d
+	}
+}
+
+// WithLosslessSources limits backpressure to the source IDs that match the
+// given path.Match patterns. All sources are lossless by default.
+func WithLosslessSources(patterns ...string) BackpressureOption {
+	return func(b *Backpressure) {
+		b.sources = patterns
+	}
+}
+
+// WithPollInterval sets how often a blocked request checks the buffer. It
+// defaults to ten milliseconds.
+func WithPollInterval(d time.Duration) BackpressureOption {
+	return func(b *Backpressure) {
+		b.interval = d
+	}
+}
+
+// NewBackpressure returns a Backpressure that writes envelopes of lossless
+// sources to the given buffer.
+func NewBackpressure(
+	buffer ReservedSetter,
+	mode BackpressureMode,
+	m MetricClient,
+	opts ...BackpressureOption,
+) *Backpressure {
+	b := &Backpressure{
+		buffer:         buffer,
+		mode:           mode,
+		maxWait:        5 * time.Second,
+		interval:       10 * time.Millisecond,
+		blockedMetric:  m.NewCounter("backpressure_blocked_seconds"),
+		rejectedMetric: m.NewCounter("backpressure_rejected"),
+	}
+
+	for _, o := range opts {
+		o(b)
+	}
+
+	return b
+}
+
+// Wait returns once room for n envelopes of lossless sources is reserved
+// in the buffer. It returns a RESOURCE_EXHAUSTED error if it does not get
+// room in time. Every reserved envelope must be written with Set.
+func (b *Backpressure) Wait(ctx context.Context, n int) error {
+	if n == 0 || b.buffer.Reserve(n) {
+		return nil
+	}
+
+	if b.mode == BackpressureBlock {
+		start := time.Now()
+		err := b.block(ctx, n)
+		b.blockedMetric.Add(time.Since(start).Seconds())
+		if err == nil {
+			return nil
+		}
+	}
+
+	b.rejectedMetric.Add(float64(n))
+	return status.Error(codes.ResourceExhausted, "ingress buffer is full")
+}
+
+// Set writes an envelope of a lossless source to the buffer. Room for it
+// must have been reserved with Wait.
+func (b *Backpressure) Set(e *loggregator_v2.Envelope) {
+	b.buffer.SetReserved(e)
+}
+
+func (b *Backpressure) block(ctx context.Context, n int) error {
+	t := time.NewTicker(b.interval)
+	defer t.Stop()
+
+	timeout := time.NewTimer(b.maxWait)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			if b.buffer.Reserve(n) {
+				return nil
+			}
+		case <-timeout.C:
+			return context.DeadlineExceeded
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Lossless reports whether the envelope is of a lossless source.
+func (b *Backpressure) Lossless(e *loggregator_v2.Envelope) bool {
+	if len(b.sources) == 0 {
+		return true
+	}
+
+	for _, pattern := range b.sources {
+		if ok, _ := path.Match(pattern, e.SourceId); ok {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,184 @@
+package v2_test
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/internal/testhelper"
+	ingress "code.cloudfoundry.org/loggregator-agent/pkg/ingress/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Backpressure", func() {
+	var (
+		buffer       *spyReservedSetter
+		metricClient *testhelper.SpyMetricClient
+		spySetter    *SpySetter
+	)
+
+	batch := func(ids ...string) *loggregator_v2.EnvelopeBatch {
+		b := &loggregator_v2.EnvelopeBatch{}
+		for _, id := range ids {
+			b.Batch = append(b.Batch, &loggregator_v2.Envelope{SourceId: id})
+		}
+		return b
+	}
+
+	newReceiver := func(mode ingress.BackpressureMode, opts ...ingress.BackpressureOption) *ingress.Receiver {
+		opts = append(opts, ingress.WithPollInterval(time.Millisecond))
+		bp := ingress.NewBackpressure(buffer, mode, metricClient, opts...)
+
+		return ingress.NewReceiver(
+			spySetter,
+			&testhelper.SpyMetric{},
+			&testhelper.SpyMetric{},
+			ingress.WithBackpressure(bp),
+		)
+	}
+
+	BeforeEach(func() {
+		buffer = newSpyReservedSetter(10)
+		metricClient = testhelper.NewMetricClient()
+		spySetter = NewSpySetter()
+	})
+
+	It("writes envelopes while the buffer has room", func() {
+		rx := newReceiver(ingress.BackpressureReject)
+		buffer.fill(9)
+
+		_, err := rx.Send(context.Background(), batch("some-id"))
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(buffer.envelopes).To(Receive())
+		Expect(spySetter.envelopes).ToNot(Receive())
+	})
+
+	It("rejects the whole batch while the buffer does not have room for it", func() {
+		rx := newReceiver(ingress.BackpressureReject)
+		buffer.fill(9)
+
+		_, err := rx.Send(context.Background(), batch("some-id", "other-id"))
+
+		Expect(status.Code(err)).To(Equal(codes.ResourceExhausted))
+		Expect(buffer.envelopes).ToNot(Receive())
+		Expect(metricClient.GetMetric("backpressure_rejected", nil).Value()).To(Equal(2.0))
+	})
+
+	It("blocks until the buffer has room", func() {
+		rx := newReceiver(ingress.BackpressureBlock, ingress.WithMaxWait(time.Minute))
+		buffer.fill(10)
+
+		errs := make(chan error, 1)
+		go func() {
+			_, err := rx.Send(context.Background(), batch("some-id"))
+			errs <- err
+		}()
+		Consistently(errs, 100*time.Millisecond).ShouldNot(Receive())
+
+		buffer.fill(5)
+
+		Eventually(errs).Should(Receive(BeNil()))
+		Expect(buffer.envelopes).To(Receive())
+		Expect(metricClient.GetMetric("backpressure_blocked_seconds", nil).Value()).To(BeNumerically(">=", 0.05))
+	})
+
+	It("rejects blocked envelopes after the maximum wait", func() {
+		rx := newReceiver(ingress.BackpressureBlock, ingress.WithMaxWait(10*time.Millisecond))
+		buffer.fill(10)
+
+		_, err := rx.Send(context.Background(), batch("some-id"))
+
+		Expect(status.Code(err)).To(Equal(codes.ResourceExhausted))
+		Expect(buffer.envelopes).ToNot(Receive())
+	})
+
+	It("writes envelopes of lossy sources to the data setter", func() {
+		rx := newReceiver(ingress.BackpressureReject, ingress.WithLosslessSources("audit-*"))
+
+		_, err := rx.Send(context.Background(), batch("some-id", "audit-log"))
+		Expect(err).ToNot(HaveOccurred())
+
+		var e *loggregator_v2.Envelope
+		Expect(spySetter.envelopes).To(Receive(&e))
+		Expect(e.SourceId).To(Equal("some-id"))
+		Expect(buffer.envelopes).To(Receive(&e))
+		Expect(e.SourceId).To(Equal("audit-log"))
+	})
+
+	It("does not push back on lossy sources", func() {
+		rx := newReceiver(ingress.BackpressureReject, ingress.WithLosslessSources("audit-*"))
+		buffer.fill(10)
+
+		_, err := rx.Send(context.Background(), batch("some-id"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(spySetter.envelopes).To(Receive())
+
+		_, err = rx.Send(context.Background(), batch("some-id", "audit-log"))
+		Expect(status.Code(err)).To(Equal(codes.ResourceExhausted))
+		Expect(spySetter.envelopes).ToNot(Receive())
+	})
+
+	It("ends the stream when a batch is rejected", func() {
+		rx := newReceiver(ingress.BackpressureReject)
+		buffer.fill(10)
+
+		spyBatchSender := NewSpyBatchSender()
+		spyBatchSender.recvResponses <- BatchSenderRecvResponse{
+			envelopes: batch("some-id").Batch,
+		}
+
+		err := rx.BatchSender(spyBatchSender)
+
+		Expect(status.Code(err)).To(Equal(codes.ResourceExhausted))
+	})
+
+	It("returns an error for an invalid mode", func() {
+		var m ingress.BackpressureMode
+
+		Expect(m.UnmarshalEnv("drop")).ToNot(Succeed())
+		Expect(m.UnmarshalEnv("block")).To(Succeed())
+		Expect(m).To(Equal(ingress.BackpressureBlock))
+	})
+})
+
+type spyReservedSetter struct {
+	mu        sync.Mutex
+	size      int
+	reserved  int
+	envelopes chan *loggregator_v2.Envelope
+}
+
+func newSpyReservedSetter(size int) *spyReservedSetter {
+	return &spyReservedSetter{
+		size:      size,
+		envelopes: make(chan *loggregator_v2.Envelope, size),
+	}
+}
+
+func (s *spyReservedSetter) fill(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reserved = n
+}
+
+func (s *spyReservedSetter) Reserve(n int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.reserved+n > s.size {
+		return false
+	}
+	s.reserved += n
+
+	return true
+}
+
+func (s *spyReservedSetter) SetReserved(e *loggregator_v2.Envelope) {
+	s.envelopes <- e
+}
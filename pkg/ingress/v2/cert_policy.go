@@ -0,0 +1,152 @@
+package v2
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"path"
+	"strings"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/pkg/metrics"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// CertSourceIDs maps client certificate identities to the source IDs they
+// may send. An identity is the common name or a DNS or URI subject
+// alternative name of the certificate. The source IDs are path.Match
+// patterns.
+type CertSourceIDs struct {
+	Rules map[string][]string
+}
+
+// UnmarshalEnv implements envstruct.Unmarshaller. An identity may be listed
+// more than once. The pattern follows the last colon so URI identities can
+// be used.
+// Example input:
+// doppler:doppler,spiffe://cf/router:gorouter,spiffe://cf/router:router-*
+func (c *CertSourceIDs) UnmarshalEnv(v string) error {
+	if v == "" {
+		return nil
+	}
+
+	c.Rules = make(map[string][]string)
+	for _, rule := range strings.Split(v, ",") {
+		rule = strings.TrimSpace(rule)
+		i := strings.LastIndex(rule, ":")
+		if i <= 0 || i == len(rule)-1 {
+			return fmt.Errorf("invalid cert source ID rule: %s", rule)
+		}
+
+		identity, pattern := rule[:i], rule[i+1:]
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid cert source ID rule: %s", rule)
+		}
+
+		c.Rules[identity] = append(c.Rules[identity], pattern)
+	}
+
+	return nil
+}
+
+// CertPolicyMode is what a CertAuthorizer does with envelopes whose source
+// ID is not allowed for the client certificate.
+type CertPolicyMode string
+
+const (
+	// CertPolicyReject drops the envelopes.
+	CertPolicyReject CertPolicyMode = "reject"
+	// CertPolicyRewrite replaces the source ID with the common name of the
+	// certificate. Envelopes are dropped when it has no common name.
+	CertPolicyRewrite CertPolicyMode = "rewrite"
+)
+
+// UnmarshalEnv implements envstruct.Unmarshaller.
+func (m *CertPolicyMode) UnmarshalEnv(v string) error {
+	switch CertPolicyMode(v) {
+	case "":
+	case CertPolicyReject, CertPolicyRewrite:
+		*m = CertPolicyMode(v)
+	default:
+		return fmt.Errorf("invalid cert policy mode: %s", v)
+	}
+
+	return nil
+}
+
+// CertAuthorizer authorizes envelopes by the client certificate of the
+// peer. A certificate may send the source IDs of all of its identities.
+// Peers without a TLS client certificate are always allowed.
+type CertAuthorizer struct {
+	rules           map[string][]string
+	mode            CertPolicyMode
+	rewrittenMetric metrics.Counter
+}
+
+// NewCertAuthorizer returns a CertAuthorizer for the given rules. The
+// rewritten metric counts envelopes with a replaced source ID in the
+// rewrite mode. Rejected envelopes are counted by the Receiver.
+func NewCertAuthorizer(
+	rules map[string][]string,
+	mode CertPolicyMode,
+	rewritten metrics.Counter,
+) *CertAuthorizer {
+	return &CertAuthorizer{
+		rules:           rules,
+		mode:            mode,
+		rewrittenMetric: rewritten,
+	}
+}
+
+// Authorize implements Authorizer.
+func (a *CertAuthorizer) Authorize(ctx context.Context, e *loggregator_v2.Envelope) bool {
+	cert, ok := peerCertificate(ctx)
+	if !ok {
+		return true
+	}
+
+	for _, id := range certIdentities(cert) {
+		for _, pattern := range a.rules[id] {
+			if ok, _ := path.Match(pattern, e.SourceId); ok {
+				return true
+			}
+		}
+	}
+
+	if a.mode != CertPolicyRewrite || cert.Subject.CommonName == "" {
+		return false
+	}
+
+	e.SourceId = cert.Subject.CommonName
+	a.rewrittenMetric.Add(1)
+
+	return true
+}
+
+func peerCertificate(ctx context.Context) (*x509.Certificate, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.PeerCertificates) == 0 {
+		return nil, false
+	}
+
+	return info.State.PeerCertificates[0], true
+}
+
+func certIdentities(cert *x509.Certificate) []string {
+	var ids []string
+	if cert.Subject.CommonName != "" {
+		ids = append(ids, cert.Subject.CommonName)
+	}
+	ids = append(ids, cert.DNSNames...)
+	for _, u := range cert.URIs {
+		ids = append(ids, u.String())
+	}
+
+	return ids
+}
@@ -0,0 +1,173 @@
+package v2_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/internal/testhelper"
+	ingress "code.cloudfoundry.org/loggregator-agent/pkg/ingress/v2"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CertAuthorizer", func() {
+	var (
+		rules           map[string][]string
+		rewrittenMetric *testhelper.SpyMetric
+		routerCert      *x509.Certificate
+	)
+
+	certContext := func(cert *x509.Certificate) context.Context {
+		return peer.NewContext(context.Background(), &peer.Peer{
+			AuthInfo: credentials.TLSInfo{
+				State: tls.ConnectionState{
+					PeerCertificates: []*x509.Certificate{cert},
+				},
+			},
+		})
+	}
+
+	BeforeEach(func() {
+		rules = map[string][]string{
+			"router":                  {"gorouter"},
+			"router.service.internal": {"router-*"},
+			"spiffe://cf/router":      {"route-emitter"},
+		}
+		rewrittenMetric = &testhelper.SpyMetric{}
+
+		u, err := url.Parse("spiffe://cf/router")
+		Expect(err).ToNot(HaveOccurred())
+		routerCert = &x509.Certificate{
+			Subject:  pkix.Name{CommonName: "router"},
+			DNSNames: []string{"router.service.internal"},
+			URIs:     []*url.URL{u},
+		}
+	})
+
+	It("allows the source IDs of every identity of the certificate", func() {
+		a := ingress.NewCertAuthorizer(rules, ingress.CertPolicyReject, rewrittenMetric)
+		ctx := certContext(routerCert)
+
+		Expect(a.Authorize(ctx, &loggregator_v2.Envelope{SourceId: "gorouter"})).To(BeTrue())
+		Expect(a.Authorize(ctx, &loggregator_v2.Envelope{SourceId: "router-1"})).To(BeTrue())
+		Expect(a.Authorize(ctx, &loggregator_v2.Envelope{SourceId: "route-emitter"})).To(BeTrue())
+	})
+
+	It("rejects other source IDs", func() {
+		a := ingress.NewCertAuthorizer(rules, ingress.CertPolicyReject, rewrittenMetric)
+
+		e := &loggregator_v2.Envelope{SourceId: "doppler"}
+		Expect(a.Authorize(certContext(routerCert), e)).To(BeFalse())
+		Expect(e.SourceId).To(Equal("doppler"))
+	})
+
+	It("rejects certificates without a rule", func() {
+		a := ingress.NewCertAuthorizer(rules, ingress.CertPolicyReject, rewrittenMetric)
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: "doppler"}}
+
+		Expect(a.Authorize(certContext(cert), &loggregator_v2.Envelope{SourceId: "gorouter"})).To(BeFalse())
+	})
+
+	It("rewrites other source IDs to the common name", func() {
+		a := ingress.NewCertAuthorizer(rules, ingress.CertPolicyRewrite, rewrittenMetric)
+
+		e := &loggregator_v2.Envelope{SourceId: "doppler"}
+		Expect(a.Authorize(certContext(routerCert), e)).To(BeTrue())
+		Expect(e.SourceId).To(Equal("router"))
+		Expect(rewrittenMetric.Value()).To(Equal(1.0))
+	})
+
+	It("rejects source IDs it can not rewrite", func() {
+		a := ingress.NewCertAuthorizer(rules, ingress.CertPolicyRewrite, rewrittenMetric)
+		cert := &x509.Certificate{DNSNames: []string{"router.service.internal"}}
+
+		Expect(a.Authorize(certContext(cert), &loggregator_v2.Envelope{SourceId: "doppler"})).To(BeFalse())
+		Expect(rewrittenMetric.Value()).To(BeZero())
+	})
+
+	It("allows peers without a client certificate", func() {
+		a := ingress.NewCertAuthorizer(rules, ingress.CertPolicyReject, rewrittenMetric)
+
+		Expect(a.Authorize(context.Background(), &loggregator_v2.Envelope{SourceId: "doppler"})).To(BeTrue())
+	})
+
+	It("is enforced for HTTP requests", func() {
+		spySetter := NewSpySetter()
+		unauthorizedMetric := &testhelper.SpyMetric{}
+		rx := ingress.NewReceiver(
+			spySetter,
+			&testhelper.SpyMetric{},
+			&testhelper.SpyMetric{},
+			ingress.WithAuthorizer(
+				ingress.NewCertAuthorizer(rules, ingress.CertPolicyReject, rewrittenMetric),
+				unauthorizedMetric,
+			),
+		)
+
+		req := httptest.NewRequest(http.MethodPost, "/v2/envelopes", strings.NewReader(
+			`{"source_id": "doppler", "log": {"payload": "aGVsbG8="}}`,
+		))
+		req.Header.Set("Content-Type", "application/x-ndjson")
+		req.TLS = &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{routerCert},
+		}
+
+		rec := httptest.NewRecorder()
+		ingress.NewHTTPHandler(rx).ServeHTTP(rec, req)
+
+		Expect(rec.Code).To(Equal(http.StatusNoContent))
+		Expect(spySetter.envelopes).ToNot(Receive())
+		Expect(unauthorizedMetric.Value()).To(Equal(1.0))
+	})
+})
+
+var _ = Describe("CertSourceIDs", func() {
+	It("parses a comma separated list of rules", func() {
+		var c ingress.CertSourceIDs
+		Expect(c.UnmarshalEnv("router:gorouter, router:router-*,spiffe://cf/router:gorouter")).To(Succeed())
+
+		Expect(c.Rules).To(Equal(map[string][]string{
+			"router":             {"gorouter", "router-*"},
+			"spiffe://cf/router": {"gorouter"},
+		}))
+	})
+
+	It("does not return an error for an empty list", func() {
+		var c ingress.CertSourceIDs
+		Expect(c.UnmarshalEnv("")).To(Succeed())
+		Expect(c.Rules).To(BeEmpty())
+	})
+
+	It("returns an error for invalid rules", func() {
+		var c ingress.CertSourceIDs
+		Expect(c.UnmarshalEnv("router")).To(MatchError("invalid cert source ID rule: router"))
+		Expect(c.UnmarshalEnv(":gorouter")).To(MatchError("invalid cert source ID rule: :gorouter"))
+		Expect(c.UnmarshalEnv("router:")).To(MatchError("invalid cert source ID rule: router:"))
+		Expect(c.UnmarshalEnv("router:[")).To(MatchError("invalid cert source ID rule: router:["))
+	})
+})
+
+var _ = Describe("CertPolicyMode", func() {
+	It("parses the modes", func() {
+		var m ingress.CertPolicyMode
+		Expect(m.UnmarshalEnv("rewrite")).To(Succeed())
+		Expect(m).To(Equal(ingress.CertPolicyRewrite))
+		Expect(m.UnmarshalEnv("reject")).To(Succeed())
+		Expect(m).To(Equal(ingress.CertPolicyReject))
+	})
+
+	It("returns an error for an unknown mode", func() {
+		var m ingress.CertPolicyMode
+		Expect(m.UnmarshalEnv("drop")).To(MatchError("invalid cert policy mode: drop"))
+	})
+})
@@ -0,0 +1,189 @@
+package v2
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"github.com/golang/protobuf/jsonpb"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+const (
+	jsonContentType   = "application/json"
+	ndjsonContentType = "application/x-ndjson"
+
+	maxRequestBytes = 8 << 20
+)
+
+// NewHTTPHandler returns a handler that accepts envelopes posted to
+// /v2/envelopes. A JSON request body is an envelope batch and an NDJSON
+// request body has one envelope per line. Envelopes use the JSON encoding
+// of the v2 envelope schema. A request with an invalid envelope is rejected
+// without writing any of its envelopes.
+func NewHTTPHandler(rx *Receiver) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v2/envelopes", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		data, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, maxRequestBytes))
+		if err != nil {
+			http.Error(w, "failed to read body", http.StatusBadRequest)
+			return
+		}
+
+		var batch *loggregator_v2.EnvelopeBatch
+		mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		switch mediaType {
+		case jsonContentType:
+			batch, err = decodeJSON(data)
+		case ndjsonContentType:
+			batch, err = decodeNDJSON(data)
+		default:
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		for i, e := range batch.GetBatch() {
+			if err := validate(e); err != nil {
+				http.Error(w, fmt.Sprintf("invalid envelope %d: %s", i, err), http.StatusBadRequest)
+				return
+			}
+		}
+
+		if _, err := rx.Send(peerContext(req), batch); err != nil {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	return mux
+}
+
+// peerContext returns the request context with the TLS state of the client
+// as gRPC peer information so authorizers see the same client certificate
+// as for gRPC requests.
+func peerContext(req *http.Request) context.Context {
+	ctx := req.Context()
+	if req.TLS == nil {
+		return ctx
+	}
+
+	return peer.NewContext(ctx, &peer.Peer{
+		AuthInfo: credentials.TLSInfo{State: *req.TLS},
+	})
+}
+
+func decodeJSON(data []byte) (*loggregator_v2.EnvelopeBatch, error) {
+	var batch loggregator_v2.EnvelopeBatch
+	if err := jsonpb.Unmarshal(bytes.NewReader(data), &batch); err != nil {
+		return nil, fmt.Errorf("invalid envelope batch: %s", err)
+	}
+
+	return &batch, nil
+}
+
+func decodeNDJSON(data []byte) (*loggregator_v2.EnvelopeBatch, error) {
+	batch := &loggregator_v2.EnvelopeBatch{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, maxRequestBytes)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var e loggregator_v2.Envelope
+		if err := jsonpb.Unmarshal(bytes.NewReader(scanner.Bytes()), &e); err != nil {
+			return nil, fmt.Errorf("invalid envelope on line %d: %s", line, err)
+		}
+		batch.Batch = append(batch.Batch, &e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return batch, nil
+}
+
+// validate checks that the envelope has a message with the fields required
+// by its type.
+func validate(e *loggregator_v2.Envelope) error {
+	switch m := e.GetMessage().(type) {
+	case *loggregator_v2.Envelope_Log:
+	case *loggregator_v2.Envelope_Counter:
+		if m.Counter.GetName() == "" {
+			return errors.New("counter name is required")
+		}
+	case *loggregator_v2.Envelope_Gauge:
+		if len(m.Gauge.GetMetrics()) == 0 {
+			return errors.New("gauge metrics are required")
+		}
+	case *loggregator_v2.Envelope_Timer:
+		if m.Timer.GetName() == "" {
+			return errors.New("timer name is required")
+		}
+	case *loggregator_v2.Envelope_Event:
+		if m.Event.GetTitle() == "" {
+			return errors.New("event title is required")
+		}
+	default:
+		return errors.New("message is required")
+	}
+
+	return nil
+}
+
+// HTTPServer serves the HTTP envelope ingress over mutual TLS.
+type HTTPServer struct {
+	addr      string
+	tlsConfig *tls.Config
+	srv       *http.Server
+}
+
+func NewHTTPServer(addr string, rx *Receiver, tlsConfig *tls.Config) *HTTPServer {
+	return &HTTPServer{
+		addr:      addr,
+		tlsConfig: tlsConfig,
+		srv: &http.Server{
+			Handler:   NewHTTPHandler(rx),
+			TLSConfig: tlsConfig,
+		},
+	}
+}
+
+func (s *HTTPServer) Start() {
+	lis, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+	log.Printf("http bound to: %s", lis.Addr())
+
+	if err := s.srv.Serve(tls.NewListener(lis, s.tlsConfig)); err != nil && err != http.ErrServerClosed {
+		log.Fatalf("failed to serve: %v", err)
+	}
+}
+
+// Stop closes the listener and waits for active requests to finish.
+func (s *HTTPServer) Stop() {
+	s.srv.Shutdown(context.Background())
+}
@@ -0,0 +1,125 @@
+package v2_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/internal/testhelper"
+	ingress "code.cloudfoundry.org/loggregator-agent/pkg/ingress/v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HTTP handler", func() {
+	var (
+		spySetter     *SpySetter
+		ingressMetric *testhelper.SpyMetric
+		originMetric  *testhelper.SpyMetric
+		handler       http.Handler
+	)
+
+	BeforeEach(func() {
+		spySetter = NewSpySetter()
+		ingressMetric = &testhelper.SpyMetric{}
+		originMetric = &testhelper.SpyMetric{}
+		handler = ingress.NewHTTPHandler(ingress.NewReceiver(spySetter, ingressMetric, originMetric))
+	})
+
+	post := func(contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v2/envelopes", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	It("writes a JSON envelope batch", func() {
+		rec := post("application/json", `{"batch": [
+			{"source_id": "some-id", "timestamp": "99", "log": {"payload": "aGVsbG8=", "type": "ERR"}},
+			{"tags": {"origin": "some-origin"}, "counter": {"name": "requests", "delta": "2"}}
+		]}`)
+		Expect(rec.Code).To(Equal(http.StatusNoContent))
+
+		var e *loggregator_v2.Envelope
+		Expect(spySetter.envelopes).To(Receive(&e))
+		Expect(e.SourceId).To(Equal("some-id"))
+		Expect(e.Timestamp).To(Equal(int64(99)))
+		Expect(e.GetLog().GetPayload()).To(Equal([]byte("hello")))
+		Expect(e.GetLog().GetType()).To(Equal(loggregator_v2.Log_ERR))
+
+		Expect(spySetter.envelopes).To(Receive(&e))
+		Expect(e.SourceId).To(Equal("some-origin"))
+		Expect(e.GetCounter().GetDelta()).To(Equal(uint64(2)))
+
+		Expect(ingressMetric.Value()).To(Equal(2.0))
+		Expect(originMetric.Value()).To(Equal(1.0))
+	})
+
+	It("writes NDJSON envelopes", func() {
+		rec := post("application/x-ndjson; charset=utf-8",
+			`{"source_id": "some-id", "gauge": {"metrics": {"cpu": {"unit": "percentage", "value": 12.5}}}}`+"\n"+
+				"\n"+
+				`{"source_id": "some-id", "timer": {"name": "http", "start": "1", "stop": "2"}}`+"\n",
+		)
+		Expect(rec.Code).To(Equal(http.StatusNoContent))
+
+		var e *loggregator_v2.Envelope
+		Expect(spySetter.envelopes).To(Receive(&e))
+		Expect(e.GetGauge().GetMetrics()["cpu"].GetValue()).To(Equal(12.5))
+		Expect(spySetter.envelopes).To(Receive(&e))
+		Expect(e.GetTimer().GetName()).To(Equal("http"))
+
+		Expect(ingressMetric.Value()).To(Equal(2.0))
+	})
+
+	It("rejects requests with invalid envelopes", func() {
+		rec := post("application/json", `{"batch": [
+			{"source_id": "some-id", "log": {"payload": "aGVsbG8="}},
+			{"source_id": "some-id", "counter": {}}
+		]}`)
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		Expect(rec.Body.String()).To(ContainSubstring("invalid envelope 1: counter name is required"))
+
+		rec = post("application/x-ndjson", `{"source_id": "some-id"}`)
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		Expect(rec.Body.String()).To(ContainSubstring("message is required"))
+
+		rec = post("application/x-ndjson", `{"source_id": "some-id", "log": {}}`+"\n"+`{"source_id":`)
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		Expect(rec.Body.String()).To(ContainSubstring("line 2"))
+
+		Expect(post("application/json", `{"unknown": 1}`).Code).To(Equal(http.StatusBadRequest))
+
+		Consistently(spySetter.envelopes).ShouldNot(Receive())
+		Expect(ingressMetric.Value()).To(BeZero())
+	})
+
+	It("rejects unsupported content types and methods", func() {
+		Expect(post("text/plain", "hello").Code).To(Equal(http.StatusUnsupportedMediaType))
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v2/envelopes", nil))
+		Expect(rec.Code).To(Equal(http.StatusMethodNotAllowed))
+	})
+
+	It("asks the client to retry while the buffer is full", func() {
+		bp := ingress.NewBackpressure(newSpyReservedSetter(0), ingress.BackpressureReject, testhelper.NewMetricClient())
+		handler = ingress.NewHTTPHandler(ingress.NewReceiver(
+			spySetter,
+			ingressMetric,
+			originMetric,
+			ingress.WithBackpressure(bp),
+		))
+
+		rec := post("application/json", `{"batch": [{"source_id": "some-id", "log": {}}]}`)
+
+		Expect(rec.Code).To(Equal(http.StatusTooManyRequests))
+		Expect(rec.Header().Get("Retry-After")).To(Equal("1"))
+		Expect(spySetter.envelopes).ToNot(Receive())
+	})
+})
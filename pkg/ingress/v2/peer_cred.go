@@ -0,0 +1,146 @@
+package v2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// PeerCredAuthInfo holds the credentials of the process on the other end of
+// a Unix socket connection.
+type PeerCredAuthInfo struct {
+	UID uint32
+	GID uint32
+	PID int32
+
+	// Known is false when the platform does not expose peer credentials.
+	Known bool
+}
+
+// AuthType implements credentials.AuthInfo.
+func (PeerCredAuthInfo) AuthType() string {
+	return "peercred"
+}
+
+// PeerCredentials returns server transport credentials that read the peer
+// credentials of Unix socket connections. They do not encrypt the
+// connection.
+func PeerCredentials() credentials.TransportCredentials {
+	return peerCredentials{}
+}
+
+type peerCredentials struct{}
+
+func (peerCredentials) ClientHandshake(context.Context, string, net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return nil, nil, errors.New("peer credentials are only supported by servers")
+}
+
+func (peerCredentials) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	info, err := readPeerCred(conn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return conn, info, nil
+}
+
+func (peerCredentials) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{SecurityProtocol: "peercred"}
+}
+
+func (c peerCredentials) Clone() credentials.TransportCredentials {
+	return c
+}
+
+func (peerCredentials) OverrideServerName(string) error {
+	return nil
+}
+
+// PeerSourceIDs restricts the source IDs that the processes of a user may
+// send over a Unix socket. The source IDs are path.Match patterns.
+type PeerSourceIDs struct {
+	Rules map[uint32][]string
+}
+
+// UnmarshalEnv implements envstruct.Unmarshaller. A user ID may be listed
+// more than once.
+// Example input:
+// 1000:app-*,1000:router,0:*
+func (p *PeerSourceIDs) UnmarshalEnv(v string) error {
+	if v == "" {
+		return nil
+	}
+
+	p.Rules = make(map[uint32][]string)
+	for _, rule := range strings.Split(v, ",") {
+		parts := strings.SplitN(strings.TrimSpace(rule), ":", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return fmt.Errorf("invalid peer source ID rule: %s", rule)
+		}
+
+		uid, err := strconv.ParseUint(parts[0], 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid peer source ID rule: %s", rule)
+		}
+
+		if _, err := path.Match(parts[1], ""); err != nil {
+			return fmt.Errorf("invalid peer source ID rule: %s", rule)
+		}
+
+		p.Rules[uint32(uid)] = append(p.Rules[uint32(uid)], parts[1])
+	}
+
+	return nil
+}
+
+// PeerCredAuthorizer authorizes envelopes received over a Unix socket by
+// the user ID of the peer process. Envelopes from other peers are always
+// allowed. When there are no rules every user is allowed; otherwise users
+// without a rule and peers with unknown credentials are denied.
+type PeerCredAuthorizer struct {
+	rules map[uint32][]string
+}
+
+// NewPeerCredAuthorizer returns a PeerCredAuthorizer for the given rules.
+func NewPeerCredAuthorizer(rules map[uint32][]string) *PeerCredAuthorizer {
+	return &PeerCredAuthorizer{
+		rules: rules,
+	}
+}
+
+// Authorize implements Authorizer.
+func (a *PeerCredAuthorizer) Authorize(ctx context.Context, e *loggregator_v2.Envelope) bool {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return true
+	}
+
+	info, ok := p.AuthInfo.(PeerCredAuthInfo)
+	if !ok {
+		return true
+	}
+
+	if len(a.rules) == 0 {
+		return true
+	}
+
+	if !info.Known {
+		return false
+	}
+
+	for _, pattern := range a.rules[info.UID] {
+		if ok, _ := path.Match(pattern, e.SourceId); ok {
+			return true
+		}
+	}
+
+	return false
+}
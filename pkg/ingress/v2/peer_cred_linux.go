@@ -0,0 +1,42 @@
+// +build linux
+
+package v2
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+func readPeerCred(conn net.Conn) (PeerCredAuthInfo, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return PeerCredAuthInfo{}, errors.New("connection is not a unix socket")
+	}
+
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return PeerCredAuthInfo{}, err
+	}
+
+	var (
+		cred    *syscall.Ucred
+		credErr error
+	)
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil {
+		return PeerCredAuthInfo{}, err
+	}
+	if credErr != nil {
+		return PeerCredAuthInfo{}, credErr
+	}
+
+	return PeerCredAuthInfo{
+		UID:   cred.Uid,
+		GID:   cred.Gid,
+		PID:   cred.Pid,
+		Known: true,
+	}, nil
+}
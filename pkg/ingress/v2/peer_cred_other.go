@@ -0,0 +1,11 @@
+// +build !linux
+
+package v2
+
+import "net"
+
+// readPeerCred returns unknown credentials because SO_PEERCRED is only
+// available on Linux.
+func readPeerCred(net.Conn) (PeerCredAuthInfo, error) {
+	return PeerCredAuthInfo{}, nil
+}
@@ -17,18 +17,69 @@ type MetricClient interface {
 	NewCounter(name string, opts ...metrics.MetricOption) metrics.Counter
 }
 
+// Authorizer decides if the peer of a request may send an envelope. It may
+// rewrite the source ID of the envelope instead of rejecting it.
+type Authorizer interface {
+	Authorize(ctx context.Context, e *loggregator_v2.Envelope) bool
+}
+
+type authorizer struct {
+	Authorizer
+	unauthorizedMetric metrics.Counter
+}
+
 type Receiver struct {
 	dataSetter           DataSetter
 	ingressMetric        func(uint64)
 	originMappingsMetric func(uint64)
+
+	authorizers  []authorizer
+	sanitizer    *Sanitizer
+	backpressure *Backpressure
+}
+
+// ReceiverOption configures a Receiver.
+type ReceiverOption func(*Receiver)
+
+// WithAuthorizer drops envelopes the authorizer does not allow and counts
+// them with the given metric. All authorizers must allow an envelope.
+func WithAuthorizer(a Authorizer, unauthorized metrics.Counter) ReceiverOption {
+	return func(r *Receiver) {
+		r.authorizers = append(r.authorizers, authorizer{
+			Authorizer:         a,
+			unauthorizedMetric: unauthorized,
+		})
+	}
+}
+
+// WithSanitizer sanitizes envelopes after they are authorized.
+func WithSanitizer(s *Sanitizer) ReceiverOption {
+	return func(r *Receiver) {
+		r.sanitizer = s
+	}
+}
+
+// WithBackpressure writes envelopes of lossless sources to the buffer of
+// the backpressure instead of the data setter and pushes back on clients
+// while it is full.
+func WithBackpressure(b *Backpressure) ReceiverOption {
+	return func(r *Receiver) {
+		r.backpressure = b
+	}
 }
 
-func NewReceiver(setter DataSetter, ingress metrics.Counter, egress metrics.Counter) *Receiver {
-	return &Receiver{
+func NewReceiver(setter DataSetter, ingress metrics.Counter, egress metrics.Counter, opts ...ReceiverOption) *Receiver {
+	r := &Receiver{
 		dataSetter:           setter,
 		ingressMetric:        func(i uint64) { ingress.Add(float64(i)) },
 		originMappingsMetric: func(i uint64) { egress.Add(float64(i)) },
 	}
+
+	for _, o := range opts {
+		o(r)
+	}
+
+	return r
 }
 
 func (s *Receiver) Sender(sender loggregator_v2.Ingress_SenderServer) error {
@@ -38,9 +89,12 @@ func (s *Receiver) Sender(sender loggregator_v2.Ingress_SenderServer) error {
 			log.Printf("Failed to receive data: %s", err)
 			return err
 		}
-		e.SourceId = s.sourceID(e)
-		s.dataSetter.Set(e)
-		s.ingressMetric(1)
+
+		n, err := s.receive(sender.Context(), []*loggregator_v2.Envelope{e})
+		s.ingressMetric(n)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -54,27 +108,105 @@ func (s *Receiver) BatchSender(sender loggregator_v2.Ingress_BatchSenderServer)
 			return err
 		}
 
-		for _, e := range envelopes.Batch {
-			e.SourceId = s.sourceID(e)
-			s.dataSetter.Set(e)
+		n, err := s.receive(sender.Context(), envelopes.Batch)
+		s.ingressMetric(n)
+		if err != nil {
+			return err
 		}
-		s.ingressMetric(uint64(len(envelopes.Batch)))
 	}
 
 	return nil
 }
 
-func (s *Receiver) Send(_ context.Context, b *loggregator_v2.EnvelopeBatch) (*loggregator_v2.SendResponse, error) {
-	for _, e := range b.Batch {
-		e.SourceId = s.sourceID(e)
-		s.dataSetter.Set(e)
+func (s *Receiver) Send(ctx context.Context, b *loggregator_v2.EnvelopeBatch) (*loggregator_v2.SendResponse, error) {
+	n, err := s.receive(ctx, b.Batch)
+	s.ingressMetric(n)
+	if err != nil {
+		return nil, err
 	}
 
-	s.ingressMetric(uint64(len(b.Batch)))
-
 	return &loggregator_v2.SendResponse{}, nil
 }
 
+// receive writes the envelopes to the data setter. It returns the number
+// of envelopes written, which differs from the number received when
+// envelopes are not authorized or split by the sanitizer. Nothing is
+// written when the backpressure rejects the envelopes.
+func (r *Receiver) receive(ctx context.Context, envs []*loggregator_v2.Envelope) (uint64, error) {
+	if r.backpressure != nil {
+		return r.receiveLossless(ctx, envs)
+	}
+
+	var n uint64
+	for _, e := range envs {
+		e.SourceId = r.sourceID(e)
+		for _, e := range r.prepare(ctx, e) {
+			r.dataSetter.Set(e)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// receiveLossless reserves room for the envelopes of lossless sources
+// before any envelope is written.
+func (r *Receiver) receiveLossless(ctx context.Context, envs []*loggregator_v2.Envelope) (uint64, error) {
+	var (
+		ready    []*loggregator_v2.Envelope
+		lossless int
+	)
+	for _, e := range envs {
+		e.SourceId = r.sourceID(e)
+		for _, e := range r.prepare(ctx, e) {
+			if r.backpressure.Lossless(e) {
+				lossless++
+			}
+			ready = append(ready, e)
+		}
+	}
+
+	if err := r.backpressure.Wait(ctx, lossless); err != nil {
+		return 0, err
+	}
+
+	for _, e := range ready {
+		if r.backpressure.Lossless(e) {
+			r.backpressure.Set(e)
+			continue
+		}
+		r.dataSetter.Set(e)
+	}
+
+	return uint64(len(ready)), nil
+}
+
+// prepare returns the envelopes to write for the envelope. It is empty
+// when the envelope is not authorized and has several envelopes when the
+// sanitizer splits it.
+func (r *Receiver) prepare(ctx context.Context, e *loggregator_v2.Envelope) []*loggregator_v2.Envelope {
+	if !r.authorized(ctx, e) {
+		return nil
+	}
+
+	if r.sanitizer == nil {
+		return []*loggregator_v2.Envelope{e}
+	}
+
+	return r.sanitizer.Sanitize(e)
+}
+
+func (r *Receiver) authorized(ctx context.Context, e *loggregator_v2.Envelope) bool {
+	for _, a := range r.authorizers {
+		if !a.Authorize(ctx, e) {
+			a.unauthorizedMetric.Add(1)
+			return false
+		}
+	}
+
+	return true
+}
+
 func (r *Receiver) sourceID(e *loggregator_v2.Envelope) string {
 	if e.SourceId != "" {
 		return e.SourceId
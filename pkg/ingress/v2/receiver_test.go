@@ -448,8 +448,73 @@ var _ = Describe("Receiver", func() {
 			})
 		})
 	})
+
+	Describe("WithAuthorizer()", func() {
+		var (
+			ingressMetric      *testhelper.SpyMetric
+			unauthorizedMetric *testhelper.SpyMetric
+		)
+
+		BeforeEach(func() {
+			ingressMetric = &testhelper.SpyMetric{}
+			unauthorizedMetric = &testhelper.SpyMetric{}
+			rx = ingress.NewReceiver(
+				spySetter,
+				ingressMetric,
+				&testhelper.SpyMetric{},
+				ingress.WithAuthorizer(spyAuthorizer{"some-id", "some-origin"}, unauthorizedMetric),
+				ingress.WithAuthorizer(spyAuthorizer{"some-id"}, unauthorizedMetric),
+			)
+		})
+
+		It("drops envelopes that are not allowed by every authorizer", func() {
+			rx.Send(context.Background(), &loggregator_v2.EnvelopeBatch{
+				Batch: []*loggregator_v2.Envelope{
+					{SourceId: "some-id"},
+					{SourceId: "other-id"},
+					{Tags: map[string]string{"origin": "some-origin"}},
+				},
+			})
+
+			Expect(spySetter.envelopes).To(Receive(Equal(&loggregator_v2.Envelope{SourceId: "some-id"})))
+			Expect(spySetter.envelopes).ToNot(Receive())
+			Expect(ingressMetric.Value()).To(BeNumerically("==", 1))
+			Expect(unauthorizedMetric.Value()).To(BeNumerically("==", 2))
+		})
+
+		It("drops envelopes sent as a stream", func() {
+			spyBatchSender := NewSpyBatchSender()
+			spyBatchSender.recvResponses <- BatchSenderRecvResponse{
+				envelopes: []*loggregator_v2.Envelope{
+					{SourceId: "other-id"},
+					{SourceId: "some-id"},
+				},
+			}
+			spyBatchSender.recvResponses <- BatchSenderRecvResponse{
+				err: io.EOF,
+			}
+
+			rx.BatchSender(spyBatchSender)
+
+			Expect(spySetter.envelopes).To(Receive(Equal(&loggregator_v2.Envelope{SourceId: "some-id"})))
+			Expect(spySetter.envelopes).ToNot(Receive())
+			Expect(unauthorizedMetric.Value()).To(BeNumerically("==", 1))
+		})
+	})
 })
 
+type spyAuthorizer []string
+
+func (a spyAuthorizer) Authorize(_ context.Context, e *loggregator_v2.Envelope) bool {
+	for _, id := range a {
+		if id == e.SourceId {
+			return true
+		}
+	}
+
+	return false
+}
+
 type SenderRecvResponse struct {
 	envelope *loggregator_v2.Envelope
 	err      error
@@ -477,6 +542,10 @@ func (s *SpySender) Recv() (*loggregator_v2.Envelope, error) {
 	return resp.envelope, resp.err
 }
 
+func (s *SpySender) Context() context.Context {
+	return context.Background()
+}
+
 type SpyBatchSender struct {
 	loggregator_v2.Ingress_BatchSenderServer
 	recvResponses chan BatchSenderRecvResponse
@@ -494,6 +563,10 @@ func (s *SpyBatchSender) Recv() (*loggregator_v2.EnvelopeBatch, error) {
 	return &loggregator_v2.EnvelopeBatch{Batch: resp.envelopes}, resp.err
 }
 
+func (s *SpyBatchSender) Context() context.Context {
+	return context.Background()
+}
+
 type SpySetter struct {
 	envelopes chan *loggregator_v2.Envelope
 }
@@ -0,0 +1,292 @@
+package v2
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/pkg/metrics"
+	"github.com/golang/protobuf/proto"
+)
+
+// truncationMarker ends log payloads that were truncated.
+const truncationMarker = "...[truncated]"
+
+// Reasons an envelope was changed by the Sanitizer. They are the reason tag
+// of the sanitized_envelopes metric.
+const (
+	ReasonPayloadTruncated  = "payload_truncated"
+	ReasonPayloadSplit      = "payload_split"
+	ReasonTooManyTags       = "too_many_tags"
+	ReasonTagKeyTooLong     = "tag_key_too_long"
+	ReasonTagValueTruncated = "tag_value_truncated"
+	ReasonInvalidUTF8       = "invalid_utf8"
+	ReasonTimestampClamped  = "timestamp_clamped"
+)
+
+// Sanitizer repairs and limits envelopes so they can be written by every
+// egress. Invalid UTF-8 is always replaced. All limits are disabled unless
+// set by an option.
+type Sanitizer struct {
+	maxPayloadBytes  int
+	splitPayloads    bool
+	maxTags          int
+	maxTagLength     int
+	maxTimestampSkew time.Duration
+
+	metrics map[string]metrics.Counter
+}
+
+// SanitizerOption configures a Sanitizer.
+type SanitizerOption func(*Sanitizer)
+
+// WithMaxPayloadBytes limits the size of log payloads. Longer payloads are
+// truncated with a marker or, when split is true, written as several
+// envelopes.
+func WithMaxPayloadBytes(n int, split bool) SanitizerOption {
+	return func(s *Sanitizer) {
+		s.maxPayloadBytes = n
+		s.splitPayloads = split
+	}
+}
+
+// WithMaxTags limits the number of tags and the length of tag keys and
+// values. Tags with longer keys are dropped and longer values are
+// truncated. A limit of zero disables it.
+func WithMaxTags(count, length int) SanitizerOption {
+	return func(s *Sanitizer) {
+		s.maxTags = count
+		s.maxTagLength = length
+	}
+}
+
+// WithMaxTimestampSkew replaces timestamps that are further than the given
+// duration from the current time with the current time.
+func WithMaxTimestampSkew(d time.Duration) SanitizerOption {
+	return func(s *Sanitizer) {
+		s.maxTimestampSkew = d
+	}
+}
+
+// NewSanitizer returns a Sanitizer that counts its changes per reason.
+func NewSanitizer(m MetricClient, opts ...SanitizerOption) *Sanitizer {
+	s := &Sanitizer{
+		metrics: make(map[string]metrics.Counter),
+	}
+
+	for _, r := range []string{
+		ReasonPayloadTruncated,
+		ReasonPayloadSplit,
+		ReasonTooManyTags,
+		ReasonTagKeyTooLong,
+		ReasonTagValueTruncated,
+		ReasonInvalidUTF8,
+		ReasonTimestampClamped,
+	} {
+		s.metrics[r] = m.NewCounter(
+			"sanitized_envelopes",
+			metrics.WithMetricTags(map[string]string{"reason": r}),
+		)
+	}
+
+	for _, o := range opts {
+		o(s)
+	}
+
+	return s
+}
+
+// Sanitize changes the envelope in place. It returns more than one envelope
+// when the log payload is split.
+func (s *Sanitizer) Sanitize(e *loggregator_v2.Envelope) []*loggregator_v2.Envelope {
+	if repairEnvelope(e) {
+		s.metrics[ReasonInvalidUTF8].Add(1)
+	}
+
+	s.limitTags(e)
+	s.clampTimestamp(e)
+
+	return s.limitPayload(e)
+}
+
+func (s *Sanitizer) limitTags(e *loggregator_v2.Envelope) {
+	if s.maxTagLength > 0 {
+		var keyTooLong, valueTruncated bool
+		for k, v := range e.Tags {
+			if len(k) > s.maxTagLength {
+				delete(e.Tags, k)
+				keyTooLong = true
+				continue
+			}
+
+			if len(v) > s.maxTagLength {
+				e.Tags[k] = v[:runeBoundary(v, s.maxTagLength)]
+				valueTruncated = true
+			}
+		}
+
+		if keyTooLong {
+			s.metrics[ReasonTagKeyTooLong].Add(1)
+		}
+		if valueTruncated {
+			s.metrics[ReasonTagValueTruncated].Add(1)
+		}
+	}
+
+	if s.maxTags > 0 && len(e.Tags) > s.maxTags {
+		keys := make([]string, 0, len(e.Tags))
+		for k := range e.Tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys[s.maxTags:] {
+			delete(e.Tags, k)
+		}
+		s.metrics[ReasonTooManyTags].Add(1)
+	}
+}
+
+func (s *Sanitizer) clampTimestamp(e *loggregator_v2.Envelope) {
+	if s.maxTimestampSkew <= 0 {
+		return
+	}
+
+	now := time.Now()
+	ts := time.Unix(0, e.Timestamp)
+	if ts.Before(now.Add(-s.maxTimestampSkew)) || ts.After(now.Add(s.maxTimestampSkew)) {
+		e.Timestamp = now.UnixNano()
+		s.metrics[ReasonTimestampClamped].Add(1)
+	}
+}
+
+func (s *Sanitizer) limitPayload(e *loggregator_v2.Envelope) []*loggregator_v2.Envelope {
+	l := e.GetLog()
+	if s.maxPayloadBytes <= 0 || l == nil || len(l.Payload) <= s.maxPayloadBytes {
+		return []*loggregator_v2.Envelope{e}
+	}
+
+	payload := string(l.Payload)
+	if !s.splitPayloads {
+		n := s.maxPayloadBytes - len(truncationMarker)
+		if n <= 0 {
+			l.Payload = []byte(payload[:runeBoundary(payload, s.maxPayloadBytes)])
+		} else {
+			l.Payload = []byte(payload[:runeBoundary(payload, n)] + truncationMarker)
+		}
+		s.metrics[ReasonPayloadTruncated].Add(1)
+
+		return []*loggregator_v2.Envelope{e}
+	}
+
+	l.Payload = nil
+	var envs []*loggregator_v2.Envelope
+	for len(payload) > 0 {
+		n := runeBoundary(payload, s.maxPayloadBytes)
+		c := proto.Clone(e).(*loggregator_v2.Envelope)
+		c.GetLog().Payload = []byte(payload[:n])
+		envs = append(envs, c)
+		payload = payload[n:]
+	}
+	s.metrics[ReasonPayloadSplit].Add(1)
+
+	return envs
+}
+
+// runeBoundary returns the largest length up to n that does not end within
+// a rune. It returns n when no rune starts close enough to n.
+func runeBoundary(s string, n int) int {
+	if n >= len(s) {
+		return len(s)
+	}
+
+	for i := n; i > 0 && i > n-utf8.UTFMax; i-- {
+		if utf8.RuneStart(s[i]) {
+			return i
+		}
+	}
+
+	return n
+}
+
+// repairEnvelope replaces invalid UTF-8 in the string fields and log
+// payload of the envelope. It returns true if anything was replaced.
+func repairEnvelope(e *loggregator_v2.Envelope) bool {
+	var repaired bool
+	repair := func(s *string) {
+		if utf8.ValidString(*s) {
+			return
+		}
+		*s = repairUTF8(*s)
+		repaired = true
+	}
+
+	repair(&e.SourceId)
+	repair(&e.InstanceId)
+
+	for k, v := range e.Tags {
+		if utf8.ValidString(k) && utf8.ValidString(v) {
+			continue
+		}
+
+		delete(e.Tags, k)
+		repair(&k)
+		repair(&v)
+		e.Tags[k] = v
+	}
+
+	switch m := e.Message.(type) {
+	case *loggregator_v2.Envelope_Log:
+		if m.Log != nil && !utf8.Valid(m.Log.Payload) {
+			m.Log.Payload = []byte(repairUTF8(string(m.Log.Payload)))
+			repaired = true
+		}
+	case *loggregator_v2.Envelope_Counter:
+		if m.Counter != nil {
+			repair(&m.Counter.Name)
+		}
+	case *loggregator_v2.Envelope_Gauge:
+		for k, v := range m.Gauge.GetMetrics() {
+			if v != nil {
+				repair(&v.Unit)
+			}
+
+			if !utf8.ValidString(k) {
+				delete(m.Gauge.Metrics, k)
+				repair(&k)
+				m.Gauge.Metrics[k] = v
+			}
+		}
+	case *loggregator_v2.Envelope_Timer:
+		if m.Timer != nil {
+			repair(&m.Timer.Name)
+		}
+	case *loggregator_v2.Envelope_Event:
+		if m.Event != nil {
+			repair(&m.Event.Title)
+			repair(&m.Event.Body)
+		}
+	}
+
+	return repaired
+}
+
+// repairUTF8 replaces every invalid byte with the Unicode replacement
+// character.
+func repairUTF8(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b.WriteRune(utf8.RuneError)
+		} else {
+			b.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+
+	return b.String()
+}
@@ -0,0 +1,162 @@
+package v2_test
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/internal/testhelper"
+	ingress "code.cloudfoundry.org/loggregator-agent/pkg/ingress/v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Sanitizer", func() {
+	var (
+		metricClient *testhelper.SpyMetricClient
+	)
+
+	reasonCount := func(reason string) float64 {
+		return metricClient.GetMetric("sanitized_envelopes", map[string]string{"reason": reason}).Value()
+	}
+
+	logEnvelope := func(payload string) *loggregator_v2.Envelope {
+		return &loggregator_v2.Envelope{
+			SourceId: "some-id",
+			Tags:     map[string]string{"a": "b"},
+			Message: &loggregator_v2.Envelope_Log{
+				Log: &loggregator_v2.Log{Payload: []byte(payload)},
+			},
+		}
+	}
+
+	BeforeEach(func() {
+		metricClient = testhelper.NewMetricClient()
+	})
+
+	It("does not change valid envelopes without limits", func() {
+		s := ingress.NewSanitizer(metricClient)
+		e := logEnvelope(strings.Repeat("x", 100000))
+
+		envs := s.Sanitize(e)
+
+		Expect(envs).To(HaveLen(1))
+		Expect(envs[0]).To(Equal(logEnvelope(strings.Repeat("x", 100000))))
+	})
+
+	It("truncates long payloads with a marker", func() {
+		s := ingress.NewSanitizer(metricClient, ingress.WithMaxPayloadBytes(20, false))
+
+		envs := s.Sanitize(logEnvelope("0123456789abcdefghijklmnop"))
+
+		Expect(envs).To(HaveLen(1))
+		Expect(string(envs[0].GetLog().GetPayload())).To(Equal("012345...[truncated]"))
+		Expect(reasonCount(ingress.ReasonPayloadTruncated)).To(Equal(1.0))
+	})
+
+	It("splits long payloads", func() {
+		s := ingress.NewSanitizer(metricClient, ingress.WithMaxPayloadBytes(4, true))
+
+		envs := s.Sanitize(logEnvelope("abcdéfghij"))
+
+		var payloads []string
+		for _, e := range envs {
+			Expect(e.SourceId).To(Equal("some-id"))
+			Expect(e.Tags).To(Equal(map[string]string{"a": "b"}))
+			payloads = append(payloads, string(e.GetLog().GetPayload()))
+		}
+		Expect(payloads).To(Equal([]string{"abcd", "éfg", "hij"}))
+		Expect(reasonCount(ingress.ReasonPayloadSplit)).To(Equal(1.0))
+	})
+
+	It("limits the number of tags", func() {
+		s := ingress.NewSanitizer(metricClient, ingress.WithMaxTags(2, 0))
+		e := &loggregator_v2.Envelope{
+			Tags: map[string]string{"c": "3", "a": "1", "b": "2"},
+		}
+
+		s.Sanitize(e)
+
+		Expect(e.Tags).To(Equal(map[string]string{"a": "1", "b": "2"}))
+		Expect(reasonCount(ingress.ReasonTooManyTags)).To(Equal(1.0))
+	})
+
+	It("limits the length of tags", func() {
+		s := ingress.NewSanitizer(metricClient, ingress.WithMaxTags(0, 4))
+		e := &loggregator_v2.Envelope{
+			Tags: map[string]string{"long-key": "1", "key": "long-value"},
+		}
+
+		s.Sanitize(e)
+
+		Expect(e.Tags).To(Equal(map[string]string{"key": "long"}))
+		Expect(reasonCount(ingress.ReasonTagKeyTooLong)).To(Equal(1.0))
+		Expect(reasonCount(ingress.ReasonTagValueTruncated)).To(Equal(1.0))
+	})
+
+	It("replaces invalid UTF-8", func() {
+		s := ingress.NewSanitizer(metricClient)
+		e := logEnvelope("bad \xff payload")
+		e.Tags = map[string]string{"bad\xfe": "value\xff"}
+
+		s.Sanitize(e)
+
+		Expect(string(e.GetLog().GetPayload())).To(Equal("bad � payload"))
+		Expect(e.Tags).To(Equal(map[string]string{"bad�": "value�"}))
+		Expect(reasonCount(ingress.ReasonInvalidUTF8)).To(Equal(1.0))
+	})
+
+	It("replaces invalid UTF-8 in metric names", func() {
+		s := ingress.NewSanitizer(metricClient)
+		e := &loggregator_v2.Envelope{
+			Message: &loggregator_v2.Envelope_Gauge{
+				Gauge: &loggregator_v2.Gauge{
+					Metrics: map[string]*loggregator_v2.GaugeValue{
+						"cpu\xff": {Unit: "%\xff", Value: 1},
+					},
+				},
+			},
+		}
+
+		s.Sanitize(e)
+
+		Expect(e.GetGauge().GetMetrics()).To(Equal(map[string]*loggregator_v2.GaugeValue{
+			"cpu�": {Unit: "%�", Value: 1},
+		}))
+	})
+
+	It("clamps timestamps outside of the allowed skew", func() {
+		s := ingress.NewSanitizer(metricClient, ingress.WithMaxTimestampSkew(time.Hour))
+		future := &loggregator_v2.Envelope{Timestamp: time.Now().Add(2 * time.Hour).UnixNano()}
+		recent := &loggregator_v2.Envelope{Timestamp: time.Now().Add(-time.Minute).UnixNano()}
+		ts := recent.Timestamp
+
+		s.Sanitize(future)
+		s.Sanitize(recent)
+
+		Expect(time.Unix(0, future.Timestamp)).To(BeTemporally("~", time.Now(), time.Minute))
+		Expect(recent.Timestamp).To(Equal(ts))
+		Expect(reasonCount(ingress.ReasonTimestampClamped)).To(Equal(1.0))
+	})
+
+	It("is applied by the receiver", func() {
+		spySetter := NewSpySetter()
+		ingressMetric := &testhelper.SpyMetric{}
+		rx := ingress.NewReceiver(
+			spySetter,
+			ingressMetric,
+			&testhelper.SpyMetric{},
+			ingress.WithSanitizer(ingress.NewSanitizer(metricClient, ingress.WithMaxPayloadBytes(5, true))),
+		)
+
+		rx.Send(context.Background(), &loggregator_v2.EnvelopeBatch{
+			Batch: []*loggregator_v2.Envelope{logEnvelope("0123456789")},
+		})
+
+		Expect(spySetter.envelopes).To(Receive())
+		Expect(spySetter.envelopes).To(Receive())
+		Expect(ingressMetric.Value()).To(Equal(2.0))
+	})
+})
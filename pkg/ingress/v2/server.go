@@ -10,16 +10,17 @@ import (
 )
 
 type Server struct {
-	addr string
-	rx   *Receiver
-	opts []grpc.ServerOption
+	addr       string
+	grpcServer *grpc.Server
 }
 
 func NewServer(addr string, rx *Receiver, opts ...grpc.ServerOption) *Server {
+	grpcServer := grpc.NewServer(opts...)
+	loggregator_v2.RegisterIngressServer(grpcServer, rx)
+
 	return &Server{
-		addr: addr,
-		rx:   rx,
-		opts: opts,
+		addr:       addr,
+		grpcServer: grpcServer,
 	}
 }
 
@@ -30,10 +31,12 @@ func (s *Server) Start() {
 	}
 	log.Printf("grpc bound to: %s", lis.Addr())
 
-	grpcServer := grpc.NewServer(s.opts...)
-	loggregator_v2.RegisterIngressServer(grpcServer, s.rx)
-
-	if err := grpcServer.Serve(lis); err != nil {
+	if err := s.grpcServer.Serve(lis); err != nil && err != grpc.ErrServerStopped {
 		log.Fatalf("failed to serve: %v", err)
 	}
 }
+
+// Stop closes the listener and all open connections.
+func (s *Server) Stop() {
+	s.grpcServer.Stop()
+}
@@ -0,0 +1,95 @@
+package v2
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"google.golang.org/grpc"
+)
+
+// UnixServer serves the v2 ingress on a Unix domain socket. Access is
+// controlled by the file mode of the socket instead of mTLS. The
+// credentials of the peer process are available to authorizers as a
+// PeerCredAuthInfo.
+type UnixServer struct {
+	path       string
+	mode       os.FileMode
+	grpcServer *grpc.Server
+}
+
+// NewUnixServer returns a UnixServer for the given socket path. The
+// transport credentials are always the peer credentials and must not be
+// part of the options.
+func NewUnixServer(path string, mode os.FileMode, rx *Receiver, opts ...grpc.ServerOption) *UnixServer {
+	opts = append(opts, grpc.Creds(PeerCredentials()))
+	grpcServer := grpc.NewServer(opts...)
+	loggregator_v2.RegisterIngressServer(grpcServer, rx)
+
+	return &UnixServer{
+		path:       path,
+		mode:       mode,
+		grpcServer: grpcServer,
+	}
+}
+
+// Start removes a stale socket left by a previous process, binds to the
+// path and serves until Stop is called.
+func (s *UnixServer) Start() {
+	if fi, err := os.Lstat(s.path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			log.Fatalf("failed to listen: %s exists and is not a socket", s.path)
+		}
+		if err := os.Remove(s.path); err != nil {
+			log.Fatalf("failed to remove stale socket: %v", err)
+		}
+	}
+
+	lis, err := net.Listen("unix", s.path)
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+
+	if err := os.Chmod(s.path, s.mode); err != nil {
+		log.Fatalf("failed to set socket mode: %v", err)
+	}
+	log.Printf("grpc bound to: %s", lis.Addr())
+
+	if err := s.grpcServer.Serve(lis); err != nil && err != grpc.ErrServerStopped {
+		log.Fatalf("failed to serve: %v", err)
+	}
+}
+
+// Stop closes the listener and all open connections. The socket file is
+// removed.
+func (s *UnixServer) Stop() {
+	s.grpcServer.Stop()
+
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		log.Printf("failed to remove socket: %v", err)
+	}
+}
+
+// SocketMode is the file mode of a Unix socket.
+type SocketMode os.FileMode
+
+// UnmarshalEnv implements envstruct.Unmarshaller. The mode is an octal
+// number.
+// Example input:
+// 0660
+func (m *SocketMode) UnmarshalEnv(v string) error {
+	if v == "" {
+		return nil
+	}
+
+	mode, err := strconv.ParseUint(v, 8, 32)
+	if err != nil || os.FileMode(mode)&^os.ModePerm != 0 {
+		return fmt.Errorf("invalid socket mode: %s", v)
+	}
+	*m = SocketMode(mode)
+
+	return nil
+}
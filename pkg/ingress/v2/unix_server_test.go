@@ -0,0 +1,205 @@
+package v2_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent/internal/testhelper"
+	ingress "code.cloudfoundry.org/loggregator-agent/pkg/ingress/v2"
+	"google.golang.org/grpc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("UnixServer", func() {
+	var (
+		dir               string
+		socketPath        string
+		spySetter         *SpySetter
+		ingressMetric     *testhelper.SpyMetric
+		unauthorizedCount *testhelper.SpyMetric
+		server            *ingress.UnixServer
+		conn              *grpc.ClientConn
+		client            loggregator_v2.IngressClient
+	)
+
+	start := func(rules map[uint32][]string) {
+		rx := ingress.NewReceiver(
+			spySetter,
+			ingressMetric,
+			&testhelper.SpyMetric{},
+			ingress.WithAuthorizer(ingress.NewPeerCredAuthorizer(rules), unauthorizedCount),
+		)
+		server = ingress.NewUnixServer(socketPath, 0600, rx)
+		go server.Start()
+		Eventually(func() error {
+			c, err := net.Dial("unix", socketPath)
+			if err == nil {
+				c.Close()
+			}
+			return err
+		}).Should(Succeed())
+
+		var err error
+		conn, err = grpc.Dial("unix://"+socketPath, grpc.WithInsecure())
+		Expect(err).ToNot(HaveOccurred())
+		client = loggregator_v2.NewIngressClient(conn)
+	}
+
+	send := func(sourceIDs ...string) {
+		var batch []*loggregator_v2.Envelope
+		for _, id := range sourceIDs {
+			batch = append(batch, &loggregator_v2.Envelope{SourceId: id})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err := client.Send(ctx, &loggregator_v2.EnvelopeBatch{Batch: batch})
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "unix-server")
+		Expect(err).ToNot(HaveOccurred())
+		socketPath = filepath.Join(dir, "ingress.sock")
+
+		spySetter = NewSpySetter()
+		ingressMetric = &testhelper.SpyMetric{}
+		unauthorizedCount = &testhelper.SpyMetric{}
+	})
+
+	AfterEach(func() {
+		if conn != nil {
+			conn.Close()
+		}
+		if server != nil {
+			server.Stop()
+		}
+		os.RemoveAll(dir)
+	})
+
+	It("receives envelopes over the socket", func() {
+		start(nil)
+
+		send("some-id")
+
+		var e *loggregator_v2.Envelope
+		Expect(spySetter.envelopes).To(Receive(&e))
+		Expect(e.SourceId).To(Equal("some-id"))
+		Expect(ingressMetric.Value()).To(Equal(1.0))
+	})
+
+	It("sets the mode of the socket", func() {
+		start(nil)
+
+		fi, err := os.Stat(socketPath)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fi.Mode().Perm()).To(Equal(os.FileMode(0600)))
+	})
+
+	It("replaces a stale socket", func() {
+		lis, err := net.ListenUnix("unix", &net.UnixAddr{Name: socketPath, Net: "unix"})
+		Expect(err).ToNot(HaveOccurred())
+		lis.SetUnlinkOnClose(false)
+		lis.Close()
+
+		start(nil)
+
+		send("some-id")
+		Eventually(spySetter.envelopes).Should(Receive())
+	})
+
+	It("removes the socket on stop", func() {
+		start(nil)
+
+		server.Stop()
+
+		Expect(socketPath).ToNot(BeAnExistingFile())
+	})
+
+	It("drops envelopes with source IDs the peer user may not send", func() {
+		start(map[uint32][]string{
+			uint32(os.Getuid()): {"app-*", "router"},
+		})
+
+		send("app-1", "router", "other")
+
+		var e *loggregator_v2.Envelope
+		Expect(spySetter.envelopes).To(Receive(&e))
+		Expect(e.SourceId).To(Equal("app-1"))
+		Expect(spySetter.envelopes).To(Receive(&e))
+		Expect(e.SourceId).To(Equal("router"))
+		Expect(spySetter.envelopes).ToNot(Receive())
+
+		Expect(ingressMetric.Value()).To(Equal(2.0))
+		Expect(unauthorizedCount.Value()).To(Equal(1.0))
+	})
+
+	It("drops all envelopes of users without a rule", func() {
+		start(map[uint32][]string{
+			uint32(os.Getuid()) + 1: {"*"},
+		})
+
+		send("app-1")
+
+		Expect(spySetter.envelopes).ToNot(Receive())
+		Expect(unauthorizedCount.Value()).To(Equal(1.0))
+	})
+})
+
+var _ = Describe("PeerCredAuthorizer", func() {
+	It("allows peers that are not on a Unix socket", func() {
+		a := ingress.NewPeerCredAuthorizer(map[uint32][]string{
+			1000: {"app-*"},
+		})
+
+		Expect(a.Authorize(context.Background(), &loggregator_v2.Envelope{SourceId: "other"})).To(BeTrue())
+	})
+})
+
+var _ = Describe("PeerSourceIDs", func() {
+	It("parses a comma separated list of rules", func() {
+		var p ingress.PeerSourceIDs
+		Expect(p.UnmarshalEnv("1000:app-*, 1000:router,0:*")).To(Succeed())
+
+		Expect(p.Rules).To(Equal(map[uint32][]string{
+			1000: {"app-*", "router"},
+			0:    {"*"},
+		}))
+	})
+
+	It("does not return an error for an empty list", func() {
+		var p ingress.PeerSourceIDs
+		Expect(p.UnmarshalEnv("")).To(Succeed())
+		Expect(p.Rules).To(BeEmpty())
+	})
+
+	It("returns an error for invalid rules", func() {
+		var p ingress.PeerSourceIDs
+		Expect(p.UnmarshalEnv("1000")).To(MatchError("invalid peer source ID rule: 1000"))
+		Expect(p.UnmarshalEnv("1000:")).To(MatchError("invalid peer source ID rule: 1000:"))
+		Expect(p.UnmarshalEnv("user:app")).To(MatchError("invalid peer source ID rule: user:app"))
+		Expect(p.UnmarshalEnv("1000:[")).To(MatchError("invalid peer source ID rule: 1000:["))
+	})
+})
+
+var _ = Describe("SocketMode", func() {
+	It("parses an octal mode", func() {
+		var m ingress.SocketMode
+		Expect(m.UnmarshalEnv("0660")).To(Succeed())
+		Expect(m).To(Equal(ingress.SocketMode(0660)))
+	})
+
+	It("returns an error for an invalid mode", func() {
+		var m ingress.SocketMode
+		Expect(m.UnmarshalEnv("0999")).To(MatchError("invalid socket mode: 0999"))
+		Expect(m.UnmarshalEnv("17777")).To(MatchError("invalid socket mode: 17777"))
+	})
+})
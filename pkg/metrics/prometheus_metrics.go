@@ -8,6 +8,7 @@ import (
 	"net"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -16,6 +17,11 @@ type PromRegistry struct {
 	registry    *prometheus.Registry
 	defaultTags map[string]string
 	loggr       *log.Logger
+
+	// refs counts the metrics returned for every collector. A collector
+	// is unregistered once all of them are removed.
+	mu   sync.Mutex
+	refs map[prometheus.Collector]int
 }
 
 type Counter interface {
@@ -38,6 +44,7 @@ func NewPromRegistry(defaultSourceID string, logger *log.Logger, opts ...Registr
 		registry:    registry,
 		defaultTags: map[string]string{"source_id": defaultSourceID, "origin": defaultSourceID},
 		loggr:       logger,
+		refs:        make(map[prometheus.Collector]int),
 	}
 
 	for _, o := range opts {
@@ -102,7 +109,42 @@ func (p *PromRegistry) NewGauge(name string, opts ...MetricOption) Gauge {
 	return collector.(Gauge)
 }
 
+// RemoveGauge unregisters a gauge created with NewGauge so that it is no
+// longer exposed. A gauge that was returned more than once is exposed until
+// every caller removed it.
+func (p *PromRegistry) RemoveGauge(g Gauge) {
+	p.remove(g)
+}
+
+// RemoveCounter unregisters a counter created with NewCounter so that it is
+// no longer exposed. A counter that was returned more than once is exposed
+// until every caller removed it.
+func (p *PromRegistry) RemoveCounter(c Counter) {
+	p.remove(c)
+}
+
+func (p *PromRegistry) remove(m interface{}) {
+	c, ok := m.(prometheus.Collector)
+	if !ok {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.refs[c]--
+	if p.refs[c] > 0 {
+		return
+	}
+
+	delete(p.refs, c)
+	p.registry.Unregister(c)
+}
+
 func (p *PromRegistry) registerCollector(name string, c prometheus.Collector) prometheus.Collector {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	err := p.registry.Register(c)
 	if err != nil {
 		typ, ok := err.(prometheus.AlreadyRegisteredError)
@@ -110,9 +152,10 @@ func (p *PromRegistry) registerCollector(name string, c prometheus.Collector) pr
 			p.loggr.Panicf("unable to create %s: %s", name, err)
 		}
 
-		return typ.ExistingCollector
+		c = typ.ExistingCollector
 	}
 
+	p.refs[c]++
 	return c
 }
 
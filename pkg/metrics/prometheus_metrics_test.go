@@ -95,6 +95,24 @@ var _ = Describe("PrometheusMetrics", func() {
 		}).Should(ContainSubstring(`test_gauge{origin="test-source",source_id="test-source"} 3`))
 	})
 
+	It("removes metrics once every user removed them", func() {
+		r := metrics.NewPromRegistry("test-source", l, metrics.WithServer(0))
+
+		g := r.NewGauge("test_gauge")
+		g2 := r.NewGauge("test_gauge")
+		c := r.NewCounter("test_counter")
+
+		r.RemoveGauge(g)
+		r.RemoveCounter(c)
+
+		Expect(getMetrics(r.Port())).To(ContainSubstring("test_gauge"))
+		Expect(getMetrics(r.Port())).ToNot(ContainSubstring("test_counter"))
+
+		r.RemoveGauge(g2)
+
+		Expect(getMetrics(r.Port())).ToNot(ContainSubstring("test_gauge"))
+	})
+
 	It("panics if the metric is invalid", func() {
 		r := metrics.NewPromRegistry("test-source", l)
 